@@ -336,7 +336,8 @@ CREATE TABLE audit_logs (
     created_at      TIMESTAMPTZ DEFAULT NOW()
 ) PARTITION BY RANGE (created_at);
 
--- Create partitions for 2026
+-- Create partitions for 2026; the API creates later months ahead of time
+-- and archives partitions past the retention period (RDP_AUDIT_*)
 CREATE TABLE audit_logs_2026_01 PARTITION OF audit_logs
     FOR VALUES FROM ('2026-01-01') TO ('2026-02-01');
 CREATE TABLE audit_logs_2026_02 PARTITION OF audit_logs
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"rdp-platform/rdp-api/models"
@@ -12,7 +13,14 @@ import (
 type Config struct {
 	Server   ServerConfig   `mapstructure:"server"`
 	Database DatabaseConfig `mapstructure:"database"`
+	Storage  StorageConfig  `mapstructure:"storage"`
 	Auth     models.AuthConfig `mapstructure:"auth"`
+	OIDC     models.OIDCConfig `mapstructure:"oidc"`
+	LDAP     models.LDAPConfig `mapstructure:"ldap"`
+	Permission models.PermissionConfig `mapstructure:"permission"`
+	Export   models.ExportConfig `mapstructure:"export"`
+	Audit    models.AuditConfig `mapstructure:"audit"`
+	SIEM     models.SIEMConfig `mapstructure:"siem"`
 	Log      LogConfig      `mapstructure:"log"`
 }
 
@@ -35,6 +43,11 @@ type DatabaseConfig struct {
 	SSLMode  string `mapstructure:"sslmode"`
 }
 
+// StorageConfig 项目文件存储配置
+type StorageConfig struct {
+	BasePath string `mapstructure:"base_path"`
+}
+
 // LogConfig 日志配置
 type LogConfig struct {
 	Level      string `mapstructure:"level"`
@@ -48,7 +61,14 @@ func LoadConfig() *Config {
 	return &Config{
 		Server:   loadServerConfig(),
 		Database: loadDatabaseConfig(),
+		Storage:  loadStorageConfig(),
 		Auth:     loadAuthConfig(),
+		OIDC:     loadOIDCConfig(),
+		LDAP:     loadLDAPConfig(),
+		Permission: loadPermissionConfig(),
+		Export:   loadExportConfig(),
+		Audit:    loadAuditConfig(),
+		SIEM:     loadSIEMConfig(),
 		Log:      loadLogConfig(),
 	}
 }
@@ -84,6 +104,149 @@ func loadAuthConfig() models.AuthConfig {
 		RefreshTokenTTL: getDurationEnv("RDP_REFRESH_TOKEN_TTL", 7*24*time.Hour),
 		Issuer:          getEnv("RDP_JWT_ISSUER", "rdp-api"),
 		Audience:        getEnv("RDP_JWT_AUDIENCE", "rdp-users"),
+
+		RevocationSyncInterval: getDurationEnv("RDP_TOKEN_REVOCATION_SYNC", 30*time.Second),
+		Session: models.SessionPolicy{
+			IdleTimeout:      getDurationEnv("RDP_SESSION_IDLE_TIMEOUT", 30*time.Minute),
+			AbsoluteLifetime: getDurationEnv("RDP_SESSION_MAX_LIFETIME", 8*time.Hour),
+			MaxConcurrent:    getIntEnv("RDP_SESSION_MAX_CONCURRENT", 3),
+			CleanupInterval:  getDurationEnv("RDP_SESSION_CLEANUP_INTERVAL", 10*time.Minute),
+		},
+		Password: models.PasswordPolicy{
+			MinLength:      getIntEnv("RDP_PASSWORD_MIN_LENGTH", 8),
+			RequireUpper:   getBoolEnv("RDP_PASSWORD_REQUIRE_UPPER", true),
+			RequireLower:   getBoolEnv("RDP_PASSWORD_REQUIRE_LOWER", true),
+			RequireDigit:   getBoolEnv("RDP_PASSWORD_REQUIRE_DIGIT", true),
+			RequireSpecial: getBoolEnv("RDP_PASSWORD_REQUIRE_SPECIAL", false),
+			HistorySize:    getIntEnv("RDP_PASSWORD_HISTORY", 5),
+		},
+		Lockout: models.LockoutPolicy{
+			MaxFailedAttempts: getIntEnv("RDP_LOGIN_MAX_FAILURES", 5),
+			Window:            getDurationEnv("RDP_LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			Cooldown:          getDurationEnv("RDP_LOGIN_LOCKOUT_COOLDOWN", 30*time.Minute),
+		},
+		PersonalTokens: models.PersonalTokenPolicy{
+			MaxLifetime: getDurationEnv("RDP_PAT_MAX_LIFETIME", 365*24*time.Hour),
+			MaxPerUser:  getIntEnv("RDP_PAT_MAX_PER_USER", 20),
+		},
+		MFA: models.MFAPolicy{
+			RequiredRoles:     getListEnv("RDP_MFA_REQUIRED_ROLES", []string{"admin", "dept_leader"}),
+			Issuer:            getEnv("RDP_MFA_ISSUER", "RDP"),
+			ChallengeTTL:      getDurationEnv("RDP_MFA_CHALLENGE_TTL", 5*time.Minute),
+			RecoveryCodeCount: getIntEnv("RDP_MFA_RECOVERY_CODES", 10),
+			EncryptionKey:     getEnv("RDP_MFA_ENCRYPTION_KEY", ""),
+		},
+	}
+}
+
+// loadOIDCConfig 加载OIDC单点登录配置（Casdoor）
+func loadOIDCConfig() models.OIDCConfig {
+	return models.OIDCConfig{
+		IssuerURL:    getEnv("RDP_OIDC_ISSUER", ""),
+		ClientID:     getEnv("RDP_OIDC_CLIENT_ID", ""),
+		ClientSecret: getEnv("RDP_OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  getEnv("RDP_OIDC_REDIRECT_URL", "http://localhost:3000/auth/callback"),
+		Scopes:       getListEnv("RDP_OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		ProviderName: getEnv("RDP_OIDC_PROVIDER", "casdoor"),
+		StateTTL:     getDurationEnv("RDP_OIDC_STATE_TTL", 10*time.Minute),
+
+		GroupsClaim:         getEnv("RDP_OIDC_GROUPS_CLAIM", "groups"),
+		DefaultRole:         getEnv("RDP_OIDC_DEFAULT_ROLE", models.RoleDesigner),
+		RoleMappings:        getMapEnv("RDP_OIDC_ROLE_MAP"),
+		TeamMappings:        getMapEnv("RDP_OIDC_TEAM_MAP"),
+		ProductLineMappings: getMapEnv("RDP_OIDC_PRODUCT_LINE_MAP"),
+		AllowedRedirects:    getListEnv("RDP_OIDC_ALLOWED_REDIRECTS", nil),
+	}
+}
+
+// loadLDAPConfig 加载LDAP/AD目录同步配置
+func loadLDAPConfig() models.LDAPConfig {
+	return models.LDAPConfig{
+		URL:                getEnv("RDP_LDAP_URL", ""),
+		BindDN:             getEnv("RDP_LDAP_BIND_DN", ""),
+		BindPassword:       getEnv("RDP_LDAP_BIND_PASSWORD", ""),
+		StartTLS:           getBoolEnv("RDP_LDAP_START_TLS", false),
+		InsecureSkipVerify: getBoolEnv("RDP_LDAP_INSECURE_SKIP_VERIFY", false),
+		Timeout:            getDurationEnv("RDP_LDAP_TIMEOUT", 30*time.Second),
+
+		BaseDN:     getEnv("RDP_LDAP_BASE_DN", ""),
+		OrgFilter:  getEnv("RDP_LDAP_ORG_FILTER", "(objectClass=organizationalUnit)"),
+		UserFilter: getEnv("RDP_LDAP_USER_FILTER", "(objectClass=inetOrgPerson)"),
+
+		OrgCodeAttr:     getEnv("RDP_LDAP_ORG_CODE_ATTR", "ou"),
+		OrgNameAttr:     getEnv("RDP_LDAP_ORG_NAME_ATTR", "description"),
+		OrgLeaderAttr:   getEnv("RDP_LDAP_ORG_LEADER_ATTR", "managedBy"),
+		UsernameAttr:    getEnv("RDP_LDAP_USERNAME_ATTR", "uid"),
+		DisplayNameAttr: getEnv("RDP_LDAP_DISPLAY_NAME_ATTR", "displayName"),
+		EmailAttr:       getEnv("RDP_LDAP_EMAIL_ATTR", "mail"),
+		PhoneAttr:       getEnv("RDP_LDAP_PHONE_ATTR", "telephoneNumber"),
+
+		AdoptLocalRecords: getBoolEnv("RDP_LDAP_ADOPT_LOCAL_RECORDS", false),
+		SyncInterval:      getDurationEnv("RDP_LDAP_SYNC_INTERVAL", 0),
+	}
+}
+
+// loadPermissionConfig 加载权限引擎配置
+func loadPermissionConfig() models.PermissionConfig {
+	return models.PermissionConfig{
+		ReloadInterval: getDurationEnv("RDP_PERMISSION_RELOAD_INTERVAL", time.Minute),
+	}
+}
+
+// loadExportConfig 加载涉密文件导出配置
+func loadExportConfig() models.ExportConfig {
+	return models.ExportConfig{
+		LinkTTL: getDurationEnv("RDP_EXPORT_LINK_TTL", 15*time.Minute),
+	}
+}
+
+// loadAuditConfig 加载审计日志配置
+func loadAuditConfig() models.AuditConfig {
+	return models.AuditConfig{
+		CheckpointKey:      getEnv("RDP_AUDIT_CHECKPOINT_KEY", "change-this-checkpoint-key-in-production"),
+		CheckpointInterval: getDurationEnv("RDP_AUDIT_CHECKPOINT_INTERVAL", time.Hour),
+		QueueSize:          getIntEnv("RDP_AUDIT_QUEUE_SIZE", 10000),
+		BatchSize:          getIntEnv("RDP_AUDIT_BATCH_SIZE", 200),
+		FlushInterval:      getDurationEnv("RDP_AUDIT_FLUSH_INTERVAL", time.Second),
+		EnqueueTimeout:     getDurationEnv("RDP_AUDIT_ENQUEUE_TIMEOUT", 50*time.Millisecond),
+		DelayThreshold:     getDurationEnv("RDP_AUDIT_DELAY_THRESHOLD", 5*time.Second),
+		SpillDir:           getEnv("RDP_AUDIT_SPILL_DIR", "data/audit-spill"),
+		RetentionMonths:    getIntEnv("RDP_AUDIT_RETENTION_MONTHS", 12),
+		PartitionsAhead:    getIntEnv("RDP_AUDIT_PARTITIONS_AHEAD", 3),
+		ArchiveDir:         getEnv("RDP_AUDIT_ARCHIVE_DIR", "data/audit-archive"),
+		PartitionInterval:  getDurationEnv("RDP_AUDIT_PARTITION_INTERVAL", 24*time.Hour),
+	}
+}
+
+// loadSIEMConfig 加载SIEM转发配置：RDP_SIEM_SINKS 列出目标名称，
+// 每个目标以 RDP_SIEM_<名称>_* 配置
+func loadSIEMConfig() models.SIEMConfig {
+	var config models.SIEMConfig
+	for _, name := range getListEnv("RDP_SIEM_SINKS", nil) {
+		prefix := "RDP_SIEM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config.Sinks = append(config.Sinks, models.SIEMSinkConfig{
+			Name:               name,
+			Network:            getEnv(prefix+"NETWORK", "udp"),
+			Address:            getEnv(prefix+"ADDRESS", ""),
+			Format:             getEnv(prefix+"FORMAT", "cef"),
+			Facility:           getIntEnv(prefix+"FACILITY", 13),
+			AppName:            getEnv(prefix+"APP_NAME", "rdp-api"),
+			Actions:            getListEnv(prefix+"ACTIONS", nil),
+			Classifications:    getListEnv(prefix+"CLASSIFICATIONS", nil),
+			BufferSize:         getIntEnv(prefix+"BUFFER_SIZE", 10000),
+			RetryInterval:      getDurationEnv(prefix+"RETRY_INTERVAL", 5*time.Second),
+			DialTimeout:        getDurationEnv(prefix+"DIAL_TIMEOUT", 5*time.Second),
+			CAFile:             getEnv(prefix+"CA_FILE", ""),
+			InsecureSkipVerify: getBoolEnv(prefix+"INSECURE_SKIP_VERIFY", false),
+		})
+	}
+	return config
+}
+
+// loadStorageConfig 加载项目文件存储配置
+func loadStorageConfig() StorageConfig {
+	return StorageConfig{
+		BasePath: getEnv("RDP_FILE_STORAGE_PATH", "./data/files"),
 	}
 }
 
@@ -125,6 +288,38 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getBoolEnv 获取布尔环境变量
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getListEnv 获取逗号或空格分隔的列表环境变量
+func getListEnv(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		return strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return defaultValue
+}
+
+// getMapEnv 获取映射环境变量，格式为 "key1=value1,key2=value2"
+func getMapEnv(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if ok && strings.TrimSpace(k) != "" {
+			result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return result
+}
+
 // getDurationEnv 获取持续时间环境变量
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMyTokens handles GET /api/v1/users/me/tokens
+func (h *UserHandler) ListMyTokens(c *gin.Context) {
+	h.listTokens(c, c.GetString("user_id"))
+}
+
+// CreateMyToken handles POST /api/v1/users/me/tokens. The plaintext token
+// is only included in this response.
+func (h *UserHandler) CreateMyToken(c *gin.Context) {
+	// A leaked token must not be able to mint further tokens
+	if c.GetString("token_type") == models.TokenTypePersonal {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    4035,
+			"message": "personal access tokens cannot create tokens",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req models.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    4000,
+			"message": "invalid request body: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	resp, err := h.userService.CreatePersonalAccessToken(c.Request.Context(), c.GetString("user_id"), &req)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "token created; store it now, it will not be shown again",
+		"data":    resp,
+	})
+}
+
+// RevokeMyToken handles DELETE /api/v1/users/me/tokens/:tokenId
+func (h *UserHandler) RevokeMyToken(c *gin.Context) {
+	h.revokeToken(c, c.GetString("user_id"))
+}
+
+// ListUserTokens handles GET /api/v1/users/:id/tokens (admin)
+func (h *UserHandler) ListUserTokens(c *gin.Context) {
+	h.listTokens(c, c.Param("id"))
+}
+
+// RevokeUserToken handles DELETE /api/v1/users/:id/tokens/:tokenId (admin)
+func (h *UserHandler) RevokeUserToken(c *gin.Context) {
+	h.revokeToken(c, c.Param("id"))
+}
+
+// RevokeUserTokens handles DELETE /api/v1/users/:id/tokens (admin)
+func (h *UserHandler) RevokeUserTokens(c *gin.Context) {
+	if err := h.userService.RevokeAllPersonalAccessTokens(c.Request.Context(), c.Param("id")); err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "tokens revoked",
+		"data":    nil,
+	})
+}
+
+// listTokens responds with the user's personal access tokens
+func (h *UserHandler) listTokens(c *gin.Context, userID string) {
+	tokens, err := h.userService.ListPersonalAccessTokens(c.Request.Context(), userID)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    tokens,
+	})
+}
+
+// revokeToken revokes the :tokenId token owned by the user
+func (h *UserHandler) revokeToken(c *gin.Context, userID string) {
+	if err := h.userService.RevokePersonalAccessToken(c.Request.Context(), userID, c.Param("tokenId")); err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "token revoked",
+		"data":    nil,
+	})
+}
+
+// respondTokenError maps a personal access token error to a response
+func respondTokenError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, services.ErrPersonalTokenRequest):
+		status, code = http.StatusBadRequest, 4000
+	case errors.Is(err, services.ErrPersonalTokenLimit):
+		status, code = http.StatusConflict, 4090
+	case errors.Is(err, services.ErrPersonalTokenNotFound), errors.Is(err, services.ErrUserNotFound):
+		status, code = http.StatusNotFound, 4040
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
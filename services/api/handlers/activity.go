@@ -1,12 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 )
 
 // ActivityHandler handles activity-related HTTP requests
@@ -154,6 +155,10 @@ func (h *ActivityHandler) UpdateActivityProgress(c *gin.Context) {
 	}
 
 	if err := h.activityService.UpdateActivityProgress(activityID, req.Progress); err != nil {
+		if errors.Is(err, services.ErrActivityFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error(), "data": nil})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": nil})
 		return
 	}
@@ -174,6 +179,10 @@ func (h *ActivityHandler) AssignActivity(c *gin.Context) {
 	}
 
 	if err := h.activityService.AssignActivity(activityID, req.AssigneeID); err != nil {
+		if errors.Is(err, services.ErrActivityFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error(), "data": nil})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error(), "data": nil})
 		return
 	}
@@ -185,6 +194,8 @@ func (h *ActivityHandler) AssignActivity(c *gin.Context) {
 type AddDependencyRequest struct {
 	DependsOnID    string `json:"depends_on_id" binding:"required"`
 	DependencyType string `json:"dependency_type"`
+	// Lag in days; negative is a lead
+	Lag int `json:"lag"`
 }
 
 // AddDependency adds a dependency to an activity
@@ -197,15 +208,87 @@ func (h *ActivityHandler) AddDependency(c *gin.Context) {
 		return
 	}
 
-	depType := req.DependencyType
-	if depType == "" {
-		depType = "finish_to_start"
+	dependency, err := h.activityService.AddDependency(activityID, req.DependsOnID, req.DependencyType, req.Lag)
+	if err != nil {
+		var cycle *services.DependencyCycleError
+		switch {
+		case errors.As(err, &cycle):
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error(), "data": gin.H{"cycle": cycle.Path}})
+		case errors.Is(err, services.ErrActivityNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": err.Error(), "data": nil})
+		case errors.Is(err, services.ErrInvalidDependencyType), errors.Is(err, services.ErrSelfDependency),
+			errors.Is(err, services.ErrCrossWorkflowDependency), errors.Is(err, services.ErrDependencyExists):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": nil})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error(), "data": nil})
+		}
+		return
 	}
 
-	if err := h.activityService.AddDependency(activityID, req.DependsOnID, depType); err != nil {
+	c.JSON(http.StatusCreated, gin.H{"code": 201, "message": "Dependency added successfully", "data": dependency})
+}
+
+// ListTransitions lists the statuses the current user can move an activity
+// to, along with its transition history
+func (h *ActivityHandler) ListTransitions(c *gin.Context) {
+	activityID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	available, err := h.activityService.AvailableTransitions(activityID, userID.(string))
+	if err != nil {
+		respondTransitionError(c, err)
+		return
+	}
+	history, err := h.activityService.ListTransitions(activityID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error(), "data": nil})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"code": 201, "message": "Dependency added successfully", "data": nil})
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{
+		"available": available,
+		"history":   history,
+	}})
+}
+
+// TransitionActivityRequest represents the request body for changing an
+// activity's status
+type TransitionActivityRequest struct {
+	To      models.ActivityStatus `json:"to" binding:"required"`
+	Comment string                `json:"comment"`
+}
+
+// TransitionActivity moves an activity to another status
+func (h *ActivityHandler) TransitionActivity(c *gin.Context) {
+	activityID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var req TransitionActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": nil})
+		return
+	}
+
+	activity, err := h.activityService.TransitionActivity(activityID, req.To, userID.(string), req.Comment)
+	if err != nil {
+		respondTransitionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Activity status updated successfully", "data": activity})
+}
+
+// respondTransitionError maps an activity transition error to a response
+func respondTransitionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrActivityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": err.Error(), "data": nil})
+	case errors.Is(err, services.ErrTransitionNotPermitted):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": err.Error(), "data": nil})
+	case errors.Is(err, services.ErrInvalidActivityTransition), errors.Is(err, services.ErrTransitionGuardFailed),
+		errors.Is(err, services.ErrActivityFrozen):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error(), "data": nil})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error(), "data": nil})
+	}
 }
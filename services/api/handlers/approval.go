@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApprovalHandler handles activity approval HTTP requests
+type ApprovalHandler struct {
+	approvalService *services.ApprovalService
+}
+
+// NewApprovalHandler creates a new ApprovalHandler
+func NewApprovalHandler(approvalService *services.ApprovalService) *ApprovalHandler {
+	return &ApprovalHandler{
+		approvalService: approvalService,
+	}
+}
+
+// SubmitForApproval handles POST /api/v1/activities/:id/submit-for-approval
+func (h *ApprovalHandler) SubmitForApproval(c *gin.Context) {
+	var req models.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	approval, err := h.approvalService.SubmitForApproval(c.Param("id"), c.GetString("user_id"), req.Comment)
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "activity submitted for approval",
+		"data":    approval,
+	})
+}
+
+// ListPending handles GET /api/v1/approvals/pending
+func (h *ApprovalHandler) ListPending(c *gin.Context) {
+	approvals, err := h.approvalService.ListPending(c.GetString("user_id"))
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    approvals,
+	})
+}
+
+// Approve handles POST /api/v1/approvals/:id/approve
+func (h *ApprovalHandler) Approve(c *gin.Context) {
+	var req models.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	approval, err := h.approvalService.Approve(c.Param("id"), c.GetString("user_id"), req.Comment)
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "approval recorded",
+		"data":    approval,
+	})
+}
+
+// Reject handles POST /api/v1/approvals/:id/reject
+func (h *ApprovalHandler) Reject(c *gin.Context) {
+	var req models.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	approval, err := h.approvalService.Reject(c.Param("id"), c.GetString("user_id"), req.Comment)
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "rejection recorded",
+		"data":    approval,
+	})
+}
+
+// respondApprovalError maps an approval error to a response
+func respondApprovalError(c *gin.Context, err error) {
+	// Show which quality gate checks held up the submission
+	var gateErr *services.QualityGateError
+	if errors.As(err, &gateErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    4090,
+			"message": err.Error(),
+			"data":    gateErr.Results,
+		})
+		return
+	}
+
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, services.ErrApprovalNotRequired), errors.Is(err, services.ErrApproverNotResolved),
+		errors.Is(err, services.ErrApprovalCommentRequired):
+		status, code = http.StatusBadRequest, 4000
+	case errors.Is(err, services.ErrNotApprover), errors.Is(err, services.ErrTransitionNotPermitted):
+		status, code = http.StatusForbidden, 4031
+	case errors.Is(err, services.ErrApprovalNotFound), errors.Is(err, services.ErrActivityNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, services.ErrApprovalAlreadyPending), errors.Is(err, services.ErrApprovalNotPending),
+		errors.Is(err, services.ErrActivityFrozen), errors.Is(err, services.ErrInvalidActivityTransition),
+		errors.Is(err, services.ErrTransitionGuardFailed):
+		status, code = http.StatusConflict, 4090
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
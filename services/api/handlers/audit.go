@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler handles verification of the tamper-evident audit log and
+// reports on the audit pipeline
+type AuditHandler struct {
+	auditService *services.AuditService
+	auditQueue   *services.AuditQueue
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(auditService *services.AuditService, auditQueue *services.AuditQueue) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		auditQueue:   auditQueue,
+	}
+}
+
+// VerifyChain handles GET /api/v1/audit-logs/verify?from=&to=
+// Both bounds are dates (2006-01-02, to inclusive) or RFC 3339 times; by
+// default the whole chain up to now is verified.
+func (h *AuditHandler) VerifyChain(c *gin.Context) {
+	from, to := time.Unix(0, 0).UTC(), time.Now().UTC()
+	if value := c.Query("from"); value != "" {
+		t, err := parseAuditTime(value, false)
+		if err != nil {
+			respondBadRequest(c, "invalid from: "+err.Error())
+			return
+		}
+		from = t
+	}
+	if value := c.Query("to"); value != "" {
+		t, err := parseAuditTime(value, true)
+		if err != nil {
+			respondBadRequest(c, "invalid to: "+err.Error())
+			return
+		}
+		to = t
+	}
+
+	report, err := h.auditService.Verify(c.Request.Context(), from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuditPeriod) {
+			respondBadRequest(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    5000,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
+
+// QueueMetrics handles GET /api/v1/audit-logs/metrics
+func (h *AuditHandler) QueueMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    h.auditQueue.Metrics(),
+	})
+}
+
+// ExportLogs handles GET /api/v1/audit-logs/export?format=csv|jsonl
+// It takes the filters of the audit log list, start_date and end_date
+// being dates or RFC 3339 times, and streams the matching entries as a
+// download.
+func (h *AuditHandler) ExportLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", services.AuditExportCSV)
+	contentType := map[string]string{
+		services.AuditExportCSV:   "text/csv; charset=utf-8",
+		services.AuditExportJSONL: "application/x-ndjson",
+	}[format]
+	if contentType == "" {
+		respondBadRequest(c, services.ErrInvalidExportFormat.Error())
+		return
+	}
+
+	filters := make(map[string]interface{})
+	for _, key := range []string{"user_id", "action", "resource", "classification", "severity"} {
+		if value := c.Query(key); value != "" {
+			filters[key] = value
+		}
+	}
+	if value := c.Query("start_date"); value != "" {
+		t, err := parseAuditTime(value, false)
+		if err != nil {
+			respondBadRequest(c, "invalid start_date: "+err.Error())
+			return
+		}
+		filters["start_date"] = t
+	}
+	if value := c.Query("end_date"); value != "" {
+		t, err := parseAuditTime(value, true)
+		if err != nil {
+			respondBadRequest(c, "invalid end_date: "+err.Error())
+			return
+		}
+		filters["end_date"] = t
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+services.AuditExportFilename(format, time.Now())+`"`)
+	c.Status(http.StatusOK)
+	written, err := h.auditService.ExportLogs(c.Request.Context(), filters, format, c.Writer)
+	if err != nil {
+		// Once rows are streamed the status is sent; the export is truncated
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    5000,
+				"message": err.Error(),
+				"data":    nil,
+			})
+			return
+		}
+		log.Printf("audit log export failed after %d rows: %v", written, err)
+	}
+}
+
+// parseAuditTime parses a date or RFC 3339 time; a date used as an upper
+// bound includes the whole day
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClassificationHandler handles user clearance, named access grants and
+// classification changes
+type ClassificationHandler struct {
+	classificationService *services.ClassificationService
+	changeService         *services.ClassificationChangeService
+}
+
+// NewClassificationHandler creates a new ClassificationHandler
+func NewClassificationHandler(classificationService *services.ClassificationService, changeService *services.ClassificationChangeService) *ClassificationHandler {
+	return &ClassificationHandler{
+		classificationService: classificationService,
+		changeService:         changeService,
+	}
+}
+
+// SetClearance handles PUT /api/v1/users/:id/clearance
+func (h *ClassificationHandler) SetClearance(c *gin.Context) {
+	var req models.ClearanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	user, err := h.classificationService.SetClearance(c.Request.Context(), c.Param("id"), req.Level)
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "clearance updated",
+		"data":    user,
+	})
+}
+
+// ListGrants handles GET /api/v1/classification/grants
+func (h *ClassificationHandler) ListGrants(c *gin.Context) {
+	grants, err := h.classificationService.ListGrants(c.Request.Context(), c.Query("resource_type"), c.Query("resource_id"))
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    grants,
+	})
+}
+
+// AddGrant handles POST /api/v1/classification/grants
+func (h *ClassificationHandler) AddGrant(c *gin.Context) {
+	var req models.ClassificationGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	grant, err := h.classificationService.AddGrant(c.Request.Context(), req)
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "grant added",
+		"data":    grant,
+	})
+}
+
+// RemoveGrant handles DELETE /api/v1/classification/grants/:grantId
+func (h *ClassificationHandler) RemoveGrant(c *gin.Context) {
+	if err := h.classificationService.RemoveGrant(c.Request.Context(), c.Param("grantId")); err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "grant removed",
+		"data":    nil,
+	})
+}
+
+// GetHistory handles GET /api/v1/classification/:resource_type/:resource_id
+func (h *ClassificationHandler) GetHistory(c *gin.Context) {
+	history, err := h.changeService.GetHistory(c.Request.Context(), c.Param("resource_type"), c.Param("resource_id"))
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    history,
+	})
+}
+
+// ListPendingChanges handles GET /api/v1/classification/changes
+func (h *ClassificationHandler) ListPendingChanges(c *gin.Context) {
+	changes, err := h.changeService.ListPendingChanges(c.Request.Context())
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    changes,
+	})
+}
+
+// RequestChange handles POST /api/v1/classification/changes
+func (h *ClassificationHandler) RequestChange(c *gin.Context) {
+	var req models.ClassificationChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	change, err := h.changeService.RequestChange(c.Request.Context(), req)
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "classification change requested",
+		"data":    change,
+	})
+}
+
+// ApproveChange handles POST /api/v1/classification/changes/:changeId/approve
+func (h *ClassificationHandler) ApproveChange(c *gin.Context) {
+	var req models.ClassificationDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	change, err := h.changeService.ApproveChange(c.Request.Context(), c.Param("changeId"), req.Comment)
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "classification change approved",
+		"data":    change,
+	})
+}
+
+// RejectChange handles POST /api/v1/classification/changes/:changeId/reject
+func (h *ClassificationHandler) RejectChange(c *gin.Context) {
+	var req models.ClassificationDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	change, err := h.changeService.RejectChange(c.Request.Context(), c.Param("changeId"), req.Comment)
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "classification change rejected",
+		"data":    change,
+	})
+}
+
+// CancelChange handles POST /api/v1/classification/changes/:changeId/cancel
+func (h *ClassificationHandler) CancelChange(c *gin.Context) {
+	change, err := h.changeService.CancelChange(c.Request.Context(), c.Param("changeId"))
+	if err != nil {
+		respondClassificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "classification change cancelled",
+		"data":    change,
+	})
+}
+
+// respondClassificationError maps a classification error to a response
+func respondClassificationError(c *gin.Context, err error) {
+	status, code := http.StatusBadRequest, 4000
+	switch {
+	case errors.Is(err, services.ErrClassificationDenied):
+		status, code = http.StatusForbidden, 4037
+	case errors.Is(err, services.ErrNotResourceOwner), errors.Is(err, services.ErrNotStageApprover),
+		errors.Is(err, services.ErrSelfApproval), errors.Is(err, services.ErrApproverAlreadySigned):
+		status, code = http.StatusForbidden, 4031
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrGrantNotFound),
+		errors.Is(err, services.ErrChangeNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, services.ErrGrantExists), errors.Is(err, services.ErrChangeAlreadyPending),
+		errors.Is(err, services.ErrChangeNotPending):
+		status, code = http.StatusConflict, 4090
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DirectoryHandler handles LDAP directory sync HTTP requests
+type DirectoryHandler struct {
+	syncService *services.DirectorySyncService
+}
+
+// NewDirectoryHandler creates a new DirectoryHandler
+func NewDirectoryHandler(syncService *services.DirectorySyncService) *DirectoryHandler {
+	return &DirectoryHandler{
+		syncService: syncService,
+	}
+}
+
+// Sync handles POST /api/v1/organizations/sync. With ?dry_run=true the
+// planned changes are returned without being applied.
+func (h *DirectoryHandler) Sync(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+	report, err := h.syncService.Sync(c.Request.Context(), dryRun)
+	if err != nil {
+		status, code := http.StatusInternalServerError, 5000
+		switch {
+		case errors.Is(err, services.ErrDirectoryDisabled):
+			status, code = http.StatusNotFound, 4040
+		case errors.Is(err, services.ErrDirectorySyncRunning):
+			status, code = http.StatusConflict, 4090
+		case errors.Is(err, services.ErrDirectoryUnavailable):
+			status, code = http.StatusBadGateway, 5020
+		}
+		c.JSON(status, gin.H{
+			"code":    code,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportHandler handles export requests for classified files and their
+// one-time download links
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+// NewExportHandler creates a new ExportHandler
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+// ListExports handles GET /api/v1/exports
+func (h *ExportHandler) ListExports(c *gin.Context) {
+	exports, err := h.exportService.ListExports(c.Request.Context())
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    exports,
+	})
+}
+
+// RequestExport handles POST /api/v1/exports
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	var req models.CreateExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	export, err := h.exportService.RequestExport(c.Request.Context(), req)
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "export requested",
+		"data":    export,
+	})
+}
+
+// ApproveExport handles POST /api/v1/exports/:exportId/approve
+func (h *ExportHandler) ApproveExport(c *gin.Context) {
+	var req models.ClassificationDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	export, err := h.exportService.ApproveExport(c.Request.Context(), c.Param("exportId"), req.Comment)
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "export approved",
+		"data":    export,
+	})
+}
+
+// RejectExport handles POST /api/v1/exports/:exportId/reject
+func (h *ExportHandler) RejectExport(c *gin.Context) {
+	var req models.ClassificationDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	export, err := h.exportService.RejectExport(c.Request.Context(), c.Param("exportId"), req.Comment)
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "export rejected",
+		"data":    export,
+	})
+}
+
+// CancelExport handles POST /api/v1/exports/:exportId/cancel
+func (h *ExportHandler) CancelExport(c *gin.Context) {
+	export, err := h.exportService.CancelExport(c.Request.Context(), c.Param("exportId"))
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "export cancelled",
+		"data":    export,
+	})
+}
+
+// IssueLink handles POST /api/v1/exports/:exportId/link
+func (h *ExportHandler) IssueLink(c *gin.Context) {
+	link, err := h.exportService.IssueLink(c.Request.Context(), c.Param("exportId"))
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "download link issued",
+		"data":    link,
+	})
+}
+
+// Download handles GET /api/v1/exports/download/:token
+func (h *ExportHandler) Download(c *gin.Context) {
+	download, err := h.exportService.Download(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		respondExportError(c, err)
+		return
+	}
+	defer download.Content.Close()
+
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": download.Filename}))
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, download.Content); err != nil {
+		// Headers are already sent
+		log.Printf("export download interrupted: %v", err)
+	}
+}
+
+// respondExportError maps an export error to a response
+func respondExportError(c *gin.Context, err error) {
+	status, code := http.StatusBadRequest, 4000
+	switch {
+	case errors.Is(err, services.ErrClassificationDenied):
+		status, code = http.StatusForbidden, 4037
+	case errors.Is(err, services.ErrExportApprovalRequired), errors.Is(err, services.ErrExportLinkInvalid):
+		status, code = http.StatusForbidden, 4038
+	case errors.Is(err, services.ErrNotExportRequester), errors.Is(err, services.ErrNotStageApprover),
+		errors.Is(err, services.ErrSelfApproval), errors.Is(err, services.ErrApproverAlreadySigned):
+		status, code = http.StatusForbidden, 4031
+	case errors.Is(err, services.ErrExportNotFound), errors.Is(err, services.ErrUserNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, services.ErrExportAlreadyOpen), errors.Is(err, services.ErrExportNotPending),
+		errors.Is(err, services.ErrExportNotApproved):
+		status, code = http.StatusConflict, 4090
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
@@ -1,12 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"path/filepath"
 
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,11 +31,7 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 
 	files, err := h.fileService.ListProjectFiles(c.Request.Context(), projectID, path)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    5000,
-			"message": err.Error(),
-			"data":    nil,
-		})
+		respondFileError(c, http.StatusInternalServerError, 5000, err)
 		return
 	}
 
@@ -66,11 +63,7 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 
 	projectFile, err := h.fileService.UploadFile(c.Request.Context(), projectID, path, header.Filename, file)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    4001,
-			"message": err.Error(),
-			"data":    nil,
-		})
+		respondFileError(c, http.StatusBadRequest, 4001, err)
 		return
 	}
 
@@ -100,11 +93,7 @@ func (h *FileHandler) CreateDirectory(c *gin.Context) {
 
 	dir, err := h.fileService.CreateDirectory(c.Request.Context(), projectID, req.Path, req.Name)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    4001,
-			"message": err.Error(),
-			"data":    nil,
-		})
+		respondFileError(c, http.StatusBadRequest, 4001, err)
 		return
 	}
 
@@ -115,20 +104,14 @@ func (h *FileHandler) CreateDirectory(c *gin.Context) {
 	})
 }
 
-// DeleteFile handles DELETE /api/v1/projects/:projectId/files/:fileId
+// DeleteFile handles DELETE /api/v1/projects/:id/files/:fileId
 func (h *FileHandler) DeleteFile(c *gin.Context) {
-	projectID := c.Param("projectId")
+	projectID := c.Param("id")
 	fileID := c.Param("fileId")
 
-	_ = projectID // Used for authorization check
-
-	err := h.fileService.DeleteFile(c.Request.Context(), fileID)
+	err := h.fileService.DeleteFile(c.Request.Context(), projectID, fileID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    4001,
-			"message": err.Error(),
-			"data":    nil,
-		})
+		respondFileError(c, http.StatusBadRequest, 4001, err)
 		return
 	}
 
@@ -139,20 +122,14 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 	})
 }
 
-// DownloadFile handles GET /api/v1/projects/:projectId/files/:fileId/download
+// DownloadFile handles GET /api/v1/projects/:id/files/:fileId/download
 func (h *FileHandler) DownloadFile(c *gin.Context) {
-	projectID := c.Param("projectId")
+	projectID := c.Param("id")
 	fileID := c.Param("fileId")
 
-	_ = projectID // Used for authorization check
-
-	reader, err := h.fileService.DownloadFile(c.Request.Context(), fileID)
+	reader, err := h.fileService.DownloadFile(c.Request.Context(), projectID, fileID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"code":    4040,
-			"message": err.Error(),
-			"data":    nil,
-		})
+		respondFileError(c, http.StatusNotFound, 4040, err)
 		return
 	}
 	defer reader.Close()
@@ -170,6 +147,23 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 	}
 }
 
+// respondFileError answers 403 when the data is classified above the
+// caller's access or needs an export request, otherwise with the given
+// status and code
+func respondFileError(c *gin.Context, status, code int, err error) {
+	switch {
+	case errors.Is(err, services.ErrClassificationDenied):
+		status, code = http.StatusForbidden, 4037
+	case errors.Is(err, services.ErrExportApprovalRequired):
+		status, code = http.StatusForbidden, 4038
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
+
 // FileUploadRequest represents a file upload request
 type FileUploadRequest struct {
 	File   io.Reader `json:"-"`
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyMFA handles POST /api/v1/auth/mfa/verify, the second login step.
+// On success a session is opened as for a normal login.
+func (h *UserHandler) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		respondBadRequest(c, "exactly one of code or recovery_code is required")
+		return
+	}
+
+	user, err := h.userService.VerifyMFAChallenge(c.Request.Context(), req.ChallengeToken, req.Code, req.RecoveryCode)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// BeginLoginMFAEnrollment handles POST /api/v1/auth/mfa/enroll for users
+// whose role requires MFA but who have not enrolled yet
+func (h *UserHandler) BeginLoginMFAEnrollment(c *gin.Context) {
+	var req models.MFAEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	enrollment, err := h.userService.BeginMFAEnrollmentWithChallenge(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "scan the provisioning URI and confirm a code",
+		"data":    enrollment,
+	})
+}
+
+// ConfirmLoginMFAEnrollment handles POST /api/v1/auth/mfa/enroll/confirm.
+// It activates MFA, opens a session and returns the recovery codes once.
+func (h *UserHandler) ConfirmLoginMFAEnrollment(c *gin.Context) {
+	var req models.MFAEnrollConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	user, codes, err := h.userService.CompleteMFAEnrollment(c.Request.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	tokens, err := h.userService.StartSession(c.Request.Context(), user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    5000,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	_ = h.userService.UpdateLastLogin(c.Request.Context(), user.ID.String())
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "login successful",
+		"data":    models.MFAEnrollmentLoginResponse{LoginResponse: tokens, RecoveryCodes: codes},
+	})
+}
+
+// GetMyMFA handles GET /api/v1/users/me/mfa
+func (h *UserHandler) GetMyMFA(c *gin.Context) {
+	status, err := h.userService.GetMFAStatus(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    status,
+	})
+}
+
+// BeginMyMFAEnrollment handles POST /api/v1/users/me/mfa
+func (h *UserHandler) BeginMyMFAEnrollment(c *gin.Context) {
+	if rejectPersonalToken(c) {
+		return
+	}
+
+	enrollment, err := h.userService.BeginMFAEnrollment(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "scan the provisioning URI and confirm a code",
+		"data":    enrollment,
+	})
+}
+
+// ConfirmMyMFAEnrollment handles POST /api/v1/users/me/mfa/confirm
+func (h *UserHandler) ConfirmMyMFAEnrollment(c *gin.Context) {
+	if rejectPersonalToken(c) {
+		return
+	}
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	codes, err := h.userService.ConfirmMFAEnrollment(c.Request.Context(), c.GetString("user_id"), req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "two-factor authentication enabled; store the recovery codes now, they will not be shown again",
+		"data":    codes,
+	})
+}
+
+// DisableMyMFA handles DELETE /api/v1/users/me/mfa
+func (h *UserHandler) DisableMyMFA(c *gin.Context) {
+	if rejectPersonalToken(c) {
+		return
+	}
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.userService.DisableMFA(c.Request.Context(), c.GetString("user_id"), req.Code); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "two-factor authentication disabled",
+		"data":    nil,
+	})
+}
+
+// RegenerateMyRecoveryCodes handles POST /api/v1/users/me/mfa/recovery-codes
+func (h *UserHandler) RegenerateMyRecoveryCodes(c *gin.Context) {
+	if rejectPersonalToken(c) {
+		return
+	}
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	codes, err := h.userService.RegenerateRecoveryCodes(c.Request.Context(), c.GetString("user_id"), req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "recovery codes regenerated; store them now, they will not be shown again",
+		"data":    codes,
+	})
+}
+
+// ResetUserMFA handles DELETE /api/v1/users/:id/mfa (admin)
+func (h *UserHandler) ResetUserMFA(c *gin.Context) {
+	if err := h.userService.ResetMFA(c.Request.Context(), c.Param("id")); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "two-factor authentication reset",
+		"data":    nil,
+	})
+}
+
+// rejectPersonalToken stops personal access tokens from changing the
+// second factor of their owner
+func rejectPersonalToken(c *gin.Context) bool {
+	if c.GetString("token_type") != models.TokenTypePersonal {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"code":    4035,
+		"message": "personal access tokens cannot manage two-factor authentication",
+		"data":    nil,
+	})
+	return true
+}
+
+// respondBadRequest responds with 400/4000
+func respondBadRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":    4000,
+		"message": message,
+		"data":    nil,
+	})
+}
+
+// respondMFAError maps a two-factor authentication error to a response
+func respondMFAError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, services.ErrMFAInvalidCode):
+		status, code = http.StatusUnauthorized, 4017
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrTokenExpired),
+		errors.Is(err, services.ErrTokenBlacklisted):
+		status, code = http.StatusUnauthorized, 4012
+	case errors.Is(err, services.ErrUserDisabled):
+		status, code = http.StatusForbidden, 4033
+	case errors.Is(err, services.ErrAccountLocked):
+		status, code = http.StatusLocked, 4230
+	case errors.Is(err, services.ErrMFARequired):
+		status, code = http.StatusForbidden, 4036
+	case errors.Is(err, services.ErrMFANotEnabled), errors.Is(err, services.ErrMFANotEnrolling),
+		errors.Is(err, services.ErrMFAAlreadyEnabled):
+		status, code = http.StatusConflict, 4090
+	case errors.Is(err, services.ErrUserNotFound):
+		status, code = http.StatusNotFound, 4040
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHandler handles single sign-on HTTP requests
+type OIDCHandler struct {
+	oidcService *services.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDCHandler
+func NewOIDCHandler(oidcService *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// Authorize handles GET /api/v1/auth/oidc/authorize. The frontend sends the
+// browser to the returned URL; the provider redirects back to the frontend,
+// which posts the code and state to the callback endpoint.
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	resp, err := h.oidcService.AuthorizationURL(c.Request.Context(), c.Query("redirect_to"))
+	if err != nil {
+		status, code := http.StatusBadGateway, 5020
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			status, code = http.StatusNotFound, 4040
+		case errors.Is(err, services.ErrOIDCInvalidRedirect):
+			status, code = http.StatusBadRequest, 4001
+		}
+		c.JSON(status, gin.H{
+			"code":    code,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    resp,
+	})
+}
+
+// Callback handles POST /api/v1/auth/oidc/callback
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    4000,
+			"message": "invalid request body: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	resp, err := h.oidcService.Login(c.Request.Context(), req.Code, req.State)
+	if err != nil {
+		status, code := http.StatusInternalServerError, 5000
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			status, code = http.StatusNotFound, 4040
+		case errors.Is(err, services.ErrOIDCInvalidState),
+			errors.Is(err, services.ErrOIDCInvalidIDToken),
+			errors.Is(err, services.ErrOIDCExchangeFailed):
+			status, code = http.StatusUnauthorized, 4016
+		case errors.Is(err, services.ErrUserDisabled):
+			status, code = http.StatusForbidden, 4033
+		case errors.Is(err, services.ErrAccountLocked):
+			status, code = http.StatusLocked, 4230
+		case errors.Is(err, services.ErrOIDCAccountConflict):
+			status, code = http.StatusConflict, 4090
+		}
+		c.JSON(status, gin.H{
+			"code":    code,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	if resp.MFA != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "second factor required",
+			"data":    resp,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "login successful",
+		"data":    resp,
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionHandler handles permission policy administration
+type PermissionHandler struct {
+	permissionService *services.PermissionService
+}
+
+// NewPermissionHandler creates a new PermissionHandler
+func NewPermissionHandler(permissionService *services.PermissionService) *PermissionHandler {
+	return &PermissionHandler{
+		permissionService: permissionService,
+	}
+}
+
+// ListPolicies handles GET /api/v1/permissions/policies
+func (h *PermissionHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.permissionService.ListPolicies()
+	if err != nil {
+		respondPolicyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    policies,
+	})
+}
+
+// AddPolicy handles POST /api/v1/permissions/policies
+func (h *PermissionHandler) AddPolicy(c *gin.Context) {
+	var rule models.PolicyRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.permissionService.AddPolicy(c.Request.Context(), rule); err != nil {
+		respondPolicyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "policy added",
+		"data":    rule,
+	})
+}
+
+// RemovePolicy handles DELETE /api/v1/permissions/policies
+func (h *PermissionHandler) RemovePolicy(c *gin.Context) {
+	var rule models.PolicyRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.permissionService.RemovePolicy(c.Request.Context(), rule); err != nil {
+		respondPolicyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "policy removed",
+		"data":    nil,
+	})
+}
+
+// ListRoleBindings handles GET /api/v1/permissions/roles
+func (h *PermissionHandler) ListRoleBindings(c *gin.Context) {
+	bindings, err := h.permissionService.ListRoleBindings()
+	if err != nil {
+		respondPolicyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    bindings,
+	})
+}
+
+// AddRoleBinding handles POST /api/v1/permissions/roles
+func (h *PermissionHandler) AddRoleBinding(c *gin.Context) {
+	var binding models.RoleBinding
+	if err := c.ShouldBindJSON(&binding); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.permissionService.AddRoleBinding(c.Request.Context(), binding); err != nil {
+		respondPolicyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "role binding added",
+		"data":    binding,
+	})
+}
+
+// RemoveRoleBinding handles DELETE /api/v1/permissions/roles
+func (h *PermissionHandler) RemoveRoleBinding(c *gin.Context) {
+	var binding models.RoleBinding
+	if err := c.ShouldBindJSON(&binding); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.permissionService.RemoveRoleBinding(c.Request.Context(), binding); err != nil {
+		respondPolicyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "role binding removed",
+		"data":    nil,
+	})
+}
+
+// respondPolicyError maps a policy administration error to a response
+func respondPolicyError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, services.ErrPolicyInvalid):
+		status, code = http.StatusBadRequest, 4000
+	case errors.Is(err, services.ErrPolicyProtected):
+		status, code = http.StatusForbidden, 4031
+	case errors.Is(err, services.ErrPolicyNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, services.ErrPolicyExists):
+		status, code = http.StatusConflict, 4090
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
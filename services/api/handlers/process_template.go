@@ -4,8 +4,8 @@ import (
 	"net/http"
 	"strconv"
 
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -77,8 +77,8 @@ func (h *ProcessTemplateHandler) CreateTemplate(c *gin.Context) {
 	}
 
 	// Set defaults
-	if template.Activities == "" {
-		template.Activities = "[]"
+	if template.Activities == nil {
+		template.Activities = models.TemplateActivities{}
 	}
 
 	err := h.templateService.CreateTemplate(c.Request.Context(), &template)
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -167,7 +169,7 @@ func (h *ProjectHandler) GetProject(c *gin.Context) {
 
 	project, err := h.projectService.GetProjectByID(c.Request.Context(), id)
 	if err != nil {
-		NotFoundResponse(c, err.Error())
+		respondProjectLookupError(c, err)
 		return
 	}
 
@@ -189,6 +191,7 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 	delete(updates, "created_at")
 	delete(updates, "code")
 	delete(updates, "created_by")
+	delete(updates, "classification_level")
 
 	// Get current user ID for permission check
 	userID, _ := c.Get("user_id")
@@ -405,16 +408,18 @@ func (h *ProjectHandler) GetProjectActivities(c *gin.Context) {
 	SuccessResponse(c, activities)
 }
 
-// CreateActivityRequest represents the request body for creating an activity
-type CreateActivityRequest struct {
-	Name             string  `json:"name" binding:"required,max=200"`
-	Description      *string `json:"description"`
-	StartDate        *string `json:"start_date"`
-	EndDate          *string `json:"end_date"`
-	DependsOn        *string `json:"depends_on"`
-	AssigneeID       *string `json:"assignee_id"`
-	SortOrder        int     `json:"sort_order"`
-	TemplateActivityID *string `json:"template_activity_id"`
+// CreateProjectActivityRequest represents the request body for creating an
+// activity of a project; dependencies are added through the activity's
+// dependency endpoint
+type CreateProjectActivityRequest struct {
+	WorkflowID         string  `json:"workflow_id" binding:"required"`
+	Name               string  `json:"name" binding:"required,max=200"`
+	Description        string  `json:"description"`
+	PlannedStart       *string `json:"planned_start"`
+	PlannedEnd         *string `json:"planned_end"`
+	AssigneeID         *string `json:"assignee_id"`
+	Sequence           int     `json:"sequence"`
+	TemplateActivityID string  `json:"template_activity_id"`
 }
 
 // CreateActivity handles POST /api/v1/projects/:id/activities
@@ -428,29 +433,43 @@ func (h *ProjectHandler) CreateActivity(c *gin.Context) {
 		return
 	}
 
-	var req CreateActivityRequest
+	var req CreateProjectActivityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		BadRequestResponse(c, "invalid request body: "+err.Error())
 		return
 	}
 
 	activity := models.Activity{
-		ProjectID:          projectUID,
+		WorkflowID:         req.WorkflowID,
+		ProjectID:          projectUID.String(),
 		Name:               req.Name,
 		Description:        req.Description,
-		Status:             "pending",
-		SortOrder:          req.SortOrder,
+		Status:             models.ActivityStatusPending,
+		Sequence:           req.Sequence,
+		TemplateActivityID: req.TemplateActivityID,
+		CreatedBy:          c.GetString("user_id"),
 	}
 
-	if req.DependsOn != nil {
-		activity.DependsOn = req.DependsOn
+	if req.PlannedStart != nil {
+		start, err := time.Parse("2006-01-02", *req.PlannedStart)
+		if err != nil {
+			BadRequestResponse(c, "invalid planned_start")
+			return
+		}
+		activity.PlannedStart = &start
 	}
-	if req.TemplateActivityID != nil {
-		activity.TemplateActivityID = req.TemplateActivityID
+	if req.PlannedEnd != nil {
+		end, err := time.Parse("2006-01-02", *req.PlannedEnd)
+		if err != nil {
+			BadRequestResponse(c, "invalid planned_end")
+			return
+		}
+		activity.PlannedEnd = &end
 	}
 	if req.AssigneeID != nil {
 		if aid, err := uuid.Parse(*req.AssigneeID); err == nil {
-			activity.AssigneeID = &aid
+			assigneeID := aid.String()
+			activity.AssigneeID = &assigneeID
 		}
 	}
 
@@ -509,7 +528,7 @@ func (h *ProjectHandler) GetProjectGantt(c *gin.Context) {
 	// Get project details
 	project, err := h.projectService.GetProjectByID(c.Request.Context(), projectID)
 	if err != nil {
-		NotFoundResponse(c, err.Error())
+		respondProjectLookupError(c, err)
 		return
 	}
 
@@ -520,45 +539,55 @@ func (h *ProjectHandler) GetProjectGantt(c *gin.Context) {
 		return
 	}
 
+	// Early and late dates, float and the critical path
+	schedule, err := h.projectService.GetProjectSchedule(c.Request.Context(), projectID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+	scheduled := make(map[string]*models.ActivitySchedule, len(schedule.Activities))
+	for i := range schedule.Activities {
+		scheduled[schedule.Activities[i].ActivityID] = &schedule.Activities[i]
+	}
+
 	// Format for Gantt chart
 	type GanttTask struct {
-		ID          string  `json:"id"`
-		Name        string  `json:"name"`
-		StartDate   *string `json:"start_date,omitempty"`
-		EndDate     *string `json:"end_date,omitempty"`
-		Progress    int     `json:"progress"`
-		Status      string  `json:"status"`
-		AssigneeID  *string `json:"assignee_id,omitempty"`
-		DependsOn   *string `json:"depends_on,omitempty"`
-		SortOrder   int     `json:"sort_order"`
+		ID         string                   `json:"id"`
+		Name       string                   `json:"name"`
+		StartDate  *string                  `json:"start_date,omitempty"`
+		EndDate    *string                  `json:"end_date,omitempty"`
+		Progress   int                      `json:"progress"`
+		Status     models.ActivityStatus    `json:"status"`
+		AssigneeID *string                  `json:"assignee_id,omitempty"`
+		DependsOn  []string                 `json:"depends_on,omitempty"`
+		Sequence   int                      `json:"sequence"`
+		Schedule   *models.ActivitySchedule `json:"schedule,omitempty"`
 	}
 
 	tasks := make([]GanttTask, 0, len(activities))
 	for _, activity := range activities {
 		task := GanttTask{
-			ID:         activity.ID.String(),
+			ID:         activity.ID,
 			Name:       activity.Name,
 			Progress:   activity.Progress,
 			Status:     activity.Status,
-			SortOrder:  activity.SortOrder,
+			AssigneeID: activity.AssigneeID,
+			Sequence:   activity.Sequence,
+			Schedule:   scheduled[activity.ID],
 		}
-		
-		if activity.StartDate != nil {
-			startStr := activity.StartDate.Format("2006-01-02")
+
+		if activity.PlannedStart != nil {
+			startStr := activity.PlannedStart.Format("2006-01-02")
 			task.StartDate = &startStr
 		}
-		if activity.EndDate != nil {
-			endStr := activity.EndDate.Format("2006-01-02")
+		if activity.PlannedEnd != nil {
+			endStr := activity.PlannedEnd.Format("2006-01-02")
 			task.EndDate = &endStr
 		}
-		if activity.AssigneeID != nil {
-			aid := activity.AssigneeID.String()
-			task.AssigneeID = &aid
-		}
-		if activity.DependsOn != nil && *activity.DependsOn != "" {
-			task.DependsOn = activity.DependsOn
+		for _, dep := range activity.Dependencies {
+			task.DependsOn = append(task.DependsOn, dep.DependsOnID)
 		}
-		
+
 		tasks = append(tasks, task)
 	}
 
@@ -574,6 +603,133 @@ func (h *ProjectHandler) GetProjectGantt(c *gin.Context) {
 				"progress": project.Progress,
 			},
 			"tasks": tasks,
+			"schedule": gin.H{
+				"start":          schedule.Start,
+				"finish":         schedule.Finish,
+				"duration":       schedule.Duration,
+				"planned_finish": schedule.PlannedFinish,
+				"delay":          schedule.Delay,
+				"critical_path":  schedule.CriticalPath,
+			},
 		},
 	})
 }
+
+// GetCriticalPath handles GET /api/v1/projects/:id/schedule/critical-path
+// Returns the project's schedule with the activities whose slip moves the
+// project finish
+func (h *ProjectHandler) GetCriticalPath(c *gin.Context) {
+	projectID := c.Param("id")
+
+	if _, err := h.projectService.GetProjectByID(c.Request.Context(), projectID); err != nil {
+		respondProjectLookupError(c, err)
+		return
+	}
+
+	schedule, err := h.projectService.GetProjectSchedule(c.Request.Context(), projectID)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	SuccessResponse(c, schedule)
+}
+
+// GetCalendar handles GET /api/v1/projects/:id/calendar
+// Returns the working days activities are rescheduled on
+func (h *ProjectHandler) GetCalendar(c *gin.Context) {
+	projectID := c.Param("id")
+
+	if _, err := h.projectService.GetProjectByID(c.Request.Context(), projectID); err != nil {
+		respondProjectLookupError(c, err)
+		return
+	}
+
+	calendar, err := h.projectService.GetWorkCalendar(c.Request.Context(), projectID)
+	if err != nil {
+		InternalServerErrorResponse(c, err.Error())
+		return
+	}
+
+	SuccessResponse(c, calendar)
+}
+
+// UpdateCalendar handles PUT /api/v1/projects/:id/calendar
+func (h *ProjectHandler) UpdateCalendar(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var req models.UpdateWorkCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequestResponse(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if _, err := h.projectService.GetProjectByID(c.Request.Context(), projectID); err != nil {
+		respondProjectLookupError(c, err)
+		return
+	}
+
+	calendar, err := h.projectService.UpdateWorkCalendar(c.Request.Context(), projectID, &req, c.GetString("user_id"))
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	SuccessResponse(c, calendar)
+}
+
+// RescheduleActivity handles PUT /api/v1/projects/:id/activities/:activityId/schedule
+// Moves an activity's planned dates along with its successors. With
+// ?preview=true the proposed changes are returned without saving them.
+func (h *ProjectHandler) RescheduleActivity(c *gin.Context) {
+	projectID := c.Param("id")
+	preview, _ := strconv.ParseBool(c.DefaultQuery("preview", "false"))
+
+	var req models.RescheduleActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequestResponse(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	if _, err := h.projectService.GetProjectByID(c.Request.Context(), projectID); err != nil {
+		respondProjectLookupError(c, err)
+		return
+	}
+
+	ripple, err := h.projectService.RescheduleActivity(c.Request.Context(), projectID, c.Param("activityId"),
+		req.PlannedStart, req.PlannedEnd, c.GetString("user_id"), preview)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	SuccessResponse(c, ripple)
+}
+
+// respondProjectLookupError answers 403 when the project is classified
+// above the caller's access and 404 otherwise
+func respondProjectLookupError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrClassificationDenied) {
+		ForbiddenResponse(c, err.Error())
+		return
+	}
+	NotFoundResponse(c, err.Error())
+}
+
+// respondScheduleError maps a schedule or rescheduling error to a response
+func respondScheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDependencyCycle):
+		ErrorResponse(c, http.StatusConflict, 6502, err.Error())
+	case errors.Is(err, services.ErrActivityNotFound):
+		NotFoundResponse(c, err.Error())
+	case errors.Is(err, services.ErrInvalidSchedule):
+		ErrorResponse(c, http.StatusBadRequest, 6503, err.Error())
+	case errors.Is(err, services.ErrScheduleLocked), errors.Is(err, services.ErrActivityFrozen):
+		ErrorResponse(c, http.StatusConflict, 6504, err.Error())
+	case errors.Is(err, services.ErrInvalidCalendar):
+		ErrorResponse(c, http.StatusBadRequest, 6505, err.Error())
+	default:
+		InternalServerErrorResponse(c, err.Error())
+	}
+}
@@ -3,122 +3,85 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
-// MockProjectService is a mock implementation of ProjectService
-type MockProjectService struct {
-	mock.Mock
-}
-
-func (m *MockProjectService) ListProjects(ctx interface{}, page, pageSize int, filters map[string]interface{}) ([]models.Project, int64, error) {
-	args := m.Called(ctx, page, pageSize, filters)
-	return args.Get(0).([]models.Project), args.Get(1).(int64), args.Error(2)
-}
+// setupProjectTestRouter returns a router and a ProjectHandler backed by an
+// empty in-memory database
+func setupProjectTestRouter(t *testing.T) (*gin.Engine, *gorm.DB, *ProjectHandler) {
+	gin.SetMode(gin.TestMode)
 
-func (m *MockProjectService) GetProjectByID(ctx interface{}, id string) (*models.Project, error) {
-	args := m.Called(ctx, id)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
+	db, err := gorm.Open(sqlite.Open("file:project_handler?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.Workflow{}, &models.Activity{},
+		&models.Dependency{}, &models.ActivityTransition{}, &models.Notification{}, &models.AuditLog{}, &models.AuditChainHead{},
+	))
+	for _, table := range []string{"users", "projects", "project_members", "workflows", "activities",
+		"activity_dependencies", "activity_transitions", "notifications", "audit_logs", "audit_chain_heads"} {
+		db.Exec("DELETE FROM " + table)
 	}
-	return args.Get(0).(*models.Project), args.Error(1)
-}
 
-func (m *MockProjectService) CreateProject(ctx interface{}, project *models.Project, userID string) error {
-	args := m.Called(ctx, project, userID)
-	return args.Error(0)
-}
-
-func (m *MockProjectService) UpdateProject(ctx interface{}, id string, updates map[string]interface{}, userID string) (*models.Project, error) {
-	args := m.Called(ctx, id, updates, userID)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.Project), args.Error(1)
+	router := gin.New()
+	handler := NewProjectHandler(services.NewProjectService(db))
+	return router, db, handler
 }
 
-func (m *MockProjectService) DeleteProject(ctx interface{}, id, userID string) error {
-	args := m.Called(ctx, id, userID)
-	return args.Error(0)
+// createTestUser stores a user with the given system role
+func createTestUser(t *testing.T, db *gorm.DB, username, role string) *models.User {
+	user := &models.User{ID: uuid.New(), Username: username, DisplayName: username, Role: role}
+	require.NoError(t, db.Create(user).Error)
+	return user
 }
 
-func (m *MockProjectService) AddProjectMember(ctx interface{}, projectID, userID, role, addedBy string) (*models.ProjectMember, error) {
-	args := m.Called(ctx, projectID, userID, role, addedBy)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
+// createTestProject stores a project, adding the users as members with
+// the given project role
+func createTestProject(t *testing.T, db *gorm.DB, project models.Project, role string, members ...*models.User) *models.Project {
+	project.ID = uuid.New()
+	if project.Code == "" {
+		project.Code = "RDP-PD-" + project.ID.String()[:8]
 	}
-	return args.Get(0).(*models.ProjectMember), args.Error(1)
-}
-
-func (m *MockProjectService) GetProjectMembers(ctx interface{}, projectID string) ([]models.ProjectMember, error) {
-	args := m.Called(ctx, projectID)
-	return args.Get(0).([]models.ProjectMember), args.Error(1)
-}
-
-func (m *MockProjectService) RemoveMember(ctx interface{}, projectID, userID, removedBy string) error {
-	args := m.Called(ctx, projectID, userID, removedBy)
-	return args.Error(0)
-}
-
-func (m *MockProjectService) UpdateMemberRole(ctx interface{}, projectID, userID, newRole, updatedBy string) error {
-	args := m.Called(ctx, projectID, userID, newRole, updatedBy)
-	return args.Error(0)
-}
-
-func (m *MockProjectService) UpdateProjectProgress(ctx interface{}, projectID string, progress int, userID string) (*models.Project, error) {
-	args := m.Called(ctx, projectID, progress, userID)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
+	if project.Category == "" {
+		project.Category = "pd_project"
 	}
-	return args.Get(0).(*models.Project), args.Error(1)
-}
-
-func (m *MockProjectService) GetUserProjects(ctx interface{}, userID string) ([]models.Project, error) {
-	args := m.Called(ctx, userID)
-	return args.Get(0).([]models.Project), args.Error(1)
-}
-
-func (m *MockProjectService) GetProjectActivities(ctx interface{}, projectID string) ([]models.Activity, error) {
-	args := m.Called(ctx, projectID)
-	return args.Get(0).([]models.Activity), args.Error(1)
-}
-
-func (m *MockProjectService) CreateActivity(ctx interface{}, activity *models.Activity) error {
-	args := m.Called(ctx, activity)
-	return args.Error(0)
+	require.NoError(t, db.Create(&project).Error)
+	for _, member := range members {
+		require.NoError(t, db.Create(&models.ProjectMember{ID: uuid.New(), ProjectID: project.ID, UserID: member.ID, Role: role}).Error)
+	}
+	return &project
 }
 
-func (m *MockProjectService) GetProjectStats(ctx interface{}, userID string) (map[string]interface{}, error) {
-	args := m.Called(ctx, userID)
-	return args.Get(0).(map[string]interface{}), args.Error(1)
+// asUser sets the authenticated user as the auth middleware does
+func asUser(userID string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		handler(c)
+	}
 }
 
-func setupTestRouter() (*gin.Engine, *MockProjectService, *ProjectHandler) {
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	mockService := new(MockProjectService)
-	handler := NewProjectHandler(mockService)
-	return router, mockService, handler
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
 }
 
 func TestProjectHandler_CreateProject(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
-
-	router.POST("/api/v1/projects", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
-		handler.CreateProject(c)
-	})
+	router, db, handler := setupProjectTestRouter(t)
+	user := createTestUser(t, db, "creator", models.RoleDesigner)
+	router.POST("/api/v1/projects", asUser(user.ID.String(), handler.CreateProject))
 
 	t.Run("create project successfully", func(t *testing.T) {
 		reqBody := map[string]interface{}{
@@ -127,9 +90,6 @@ func TestProjectHandler_CreateProject(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(reqBody)
 
-		mockService.On("CreateProject", mock.Anything, mock.AnythingOfType("*models.Project"), "user-123").
-			Return(nil).Once()
-
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
@@ -137,11 +97,14 @@ func TestProjectHandler_CreateProject(t *testing.T) {
 
 		assert.Equal(t, http.StatusCreated, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
+		response := decodeResponse(t, w)
 		assert.Equal(t, float64(0), response["code"])
 		assert.Equal(t, "project created successfully", response["message"])
+
+		// The creator manages the new project
+		var member models.ProjectMember
+		require.NoError(t, db.First(&member, "user_id = ?", user.ID).Error)
+		assert.Equal(t, "manager", member.Role)
 	})
 
 	t.Run("invalid request body", func(t *testing.T) {
@@ -169,27 +132,20 @@ func TestProjectHandler_CreateProject(t *testing.T) {
 }
 
 func TestProjectHandler_GetProjects(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
+	router, db, handler := setupProjectTestRouter(t)
 	router.GET("/api/v1/projects", handler.GetProjects)
 
-	t.Run("get projects list", func(t *testing.T) {
-		projects := []models.Project{
-			{ID: uuid.New(), Name: "Project 1", Code: "RDP-PD-20240221-001"},
-			{ID: uuid.New(), Name: "Project 2", Code: "RDP-TR-20240221-002"},
-		}
-
-		mockService.On("ListProjects", mock.Anything, 1, 20, mock.Anything).
-			Return(projects, int64(2), nil).Once()
+	createTestProject(t, db, models.Project{Name: "Project 1", Status: "in_progress"}, "")
+	createTestProject(t, db, models.Project{Name: "Project 2", Category: "tech_research", Status: "in_progress"}, "")
 
+	t.Run("get projects list", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/api/v1/projects?page=1&page_size=20", nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
+		response := decodeResponse(t, w)
 		assert.Equal(t, float64(0), response["code"])
 
 		data := response["data"].(map[string]interface{})
@@ -197,62 +153,40 @@ func TestProjectHandler_GetProjects(t *testing.T) {
 	})
 
 	t.Run("get projects with filters", func(t *testing.T) {
-		projects := []models.Project{
-			{ID: uuid.New(), Name: "Project 1", Code: "RDP-PD-20240221-001", Status: "in_progress"},
-		}
-
-		mockService.On("ListProjects", mock.Anything, 1, 20, mock.MatchedBy(func(f map[string]interface{}) bool {
-			return f["status"] == "in_progress" && f["category"] == "pd_project"
-		})).Return(projects, int64(1), nil).Once()
-
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/api/v1/projects?status=in_progress&category=pd_project", nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+
+		data := decodeResponse(t, w)["data"].(map[string]interface{})
+		assert.Equal(t, float64(1), data["total"])
 	})
 }
 
 func TestProjectHandler_GetProject(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
+	router, db, handler := setupProjectTestRouter(t)
 	router.GET("/api/v1/projects/:id", handler.GetProject)
 
 	t.Run("get project by id", func(t *testing.T) {
-		projectID := uuid.New()
-		project := &models.Project{
-			ID:       projectID,
-			Name:     "Test Project",
-			Code:     "RDP-PD-20240221-001",
-			Status:   "in_progress",
-			Progress: 50,
-		}
-
-		mockService.On("GetProjectByID", mock.Anything, projectID.String()).
-			Return(project, nil).Once()
+		project := createTestProject(t, db, models.Project{Name: "Test Project", Status: "in_progress", Progress: 50}, "")
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID.String(), nil)
+		req, _ := http.NewRequest("GET", "/api/v1/projects/"+project.ID.String(), nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, float64(0), response["code"])
+		response := decodeResponse(t, w)
+		assert.Equal(t, float64(200), response["code"])
 
 		data := response["data"].(map[string]interface{})
 		assert.Equal(t, "Test Project", data["name"])
 	})
 
 	t.Run("project not found", func(t *testing.T) {
-		projectID := uuid.New()
-
-		mockService.On("GetProjectByID", mock.Anything, projectID.String()).
-			Return(nil, errors.New("project not found")).Once()
-
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID.String(), nil)
+		req, _ := http.NewRequest("GET", "/api/v1/projects/"+uuid.New().String(), nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
@@ -260,94 +194,64 @@ func TestProjectHandler_GetProject(t *testing.T) {
 }
 
 func TestProjectHandler_UpdateProject(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
+	router, db, handler := setupProjectTestRouter(t)
+	manager := createTestUser(t, db, "manager", models.RoleDesigner)
+	outsider := createTestUser(t, db, "outsider", models.RoleDesigner)
 	router.PUT("/api/v1/projects/:id", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
+		c.Set("user_id", c.GetHeader("X-User-ID"))
 		handler.UpdateProject(c)
 	})
+	project := createTestProject(t, db, models.Project{Name: "Test Project"}, "manager", manager)
 
-	t.Run("update project successfully", func(t *testing.T) {
-		projectID := uuid.New()
-		updatedProject := &models.Project{
-			ID:   projectID,
-			Name: "Updated Project Name",
-			Code: "RDP-PD-20240221-001",
-		}
-
-		mockService.On("UpdateProject", mock.Anything, projectID.String(), mock.Anything, "user-123").
-			Return(updatedProject, nil).Once()
-
-		reqBody := map[string]interface{}{
-			"name": "Updated Project Name",
-		}
-		jsonBody, _ := json.Marshal(reqBody)
-
+	update := func(userID string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(map[string]interface{}{"name": "Updated Project Name"})
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+projectID.String(), bytes.NewBuffer(jsonBody))
+		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+project.ID.String(), bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", userID)
 		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("update project successfully", func(t *testing.T) {
+		w := update(manager.ID.String())
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
+		response := decodeResponse(t, w)
 		assert.Equal(t, float64(0), response["code"])
+		assert.Equal(t, "Updated Project Name", response["data"].(map[string]interface{})["name"])
 	})
 
 	t.Run("insufficient permissions", func(t *testing.T) {
-		projectID := uuid.New()
-
-		mockService.On("UpdateProject", mock.Anything, projectID.String(), mock.Anything, "user-123").
-			Return(nil, errors.New("insufficient permissions to update project")).Once()
-
-		reqBody := map[string]interface{}{
-			"name": "Updated Name",
-		}
-		jsonBody, _ := json.Marshal(reqBody)
-
-		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+projectID.String(), bytes.NewBuffer(jsonBody))
-		req.Header.Set("Content-Type", "application/json")
-		router.ServeHTTP(w, req)
+		w := update(outsider.ID.String())
 
 		assert.Equal(t, http.StatusForbidden, w.Code)
 	})
 }
 
 func TestProjectHandler_DeleteProject(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
-	router.DELETE("/api/v1/projects/:id", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
-		handler.DeleteProject(c)
-	})
+	router, db, handler := setupProjectTestRouter(t)
+	admin := createTestUser(t, db, "admin", models.RoleAdmin)
+	router.DELETE("/api/v1/projects/:id", asUser(admin.ID.String(), handler.DeleteProject))
 
 	t.Run("delete project successfully", func(t *testing.T) {
-		projectID := uuid.New()
-
-		mockService.On("DeleteProject", mock.Anything, projectID.String(), "user-123").
-			Return(nil).Once()
+		project := createTestProject(t, db, models.Project{Name: "Test Project"}, "")
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("DELETE", "/api/v1/projects/"+projectID.String(), nil)
+		req, _ := http.NewRequest("DELETE", "/api/v1/projects/"+project.ID.String(), nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, float64(0), response["code"])
+		var deleted models.Project
+		require.NoError(t, db.First(&deleted, "id = ?", project.ID).Error)
+		assert.Equal(t, "deleted", deleted.Status)
 	})
 
 	t.Run("project not found", func(t *testing.T) {
-		projectID := uuid.New()
-
-		mockService.On("DeleteProject", mock.Anything, projectID.String(), "user-123").
-			Return(errors.New("project not found")).Once()
-
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("DELETE", "/api/v1/projects/"+projectID.String(), nil)
+		req, _ := http.NewRequest("DELETE", "/api/v1/projects/"+uuid.New().String(), nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -355,50 +259,34 @@ func TestProjectHandler_DeleteProject(t *testing.T) {
 }
 
 func TestProjectHandler_AddMember(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
-	router.POST("/api/v1/projects/:id/members", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
-		handler.AddMember(c)
-	})
+	router, db, handler := setupProjectTestRouter(t)
+	manager := createTestUser(t, db, "manager", models.RoleDesigner)
+	developer := createTestUser(t, db, "developer", models.RoleDesigner)
+	router.POST("/api/v1/projects/:id/members", asUser(manager.ID.String(), handler.AddMember))
+	project := createTestProject(t, db, models.Project{Name: "Test Project"}, "manager", manager)
 
 	t.Run("add member successfully", func(t *testing.T) {
-		projectID := uuid.New()
-		userID := uuid.New()
-
-		member := &models.ProjectMember{
-			ID:        uuid.New(),
-			ProjectID: projectID,
-			UserID:    userID,
-			Role:      "developer",
-		}
-
-		mockService.On("AddProjectMember", mock.Anything, projectID.String(), userID.String(), "developer", "user-123").
-			Return(member, nil).Once()
-
 		reqBody := map[string]interface{}{
-			"user_id": userID.String(),
+			"user_id": developer.ID.String(),
 			"role":    "developer",
 		}
 		jsonBody, _ := json.Marshal(reqBody)
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("POST", "/api/v1/projects/"+projectID.String()+"/members", bytes.NewBuffer(jsonBody))
+		req, _ := http.NewRequest("POST", "/api/v1/projects/"+project.ID.String()+"/members", bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusCreated, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
+		response := decodeResponse(t, w)
 		assert.Equal(t, float64(0), response["code"])
+		assert.Equal(t, "developer", response["data"].(map[string]interface{})["role"])
 	})
 
 	t.Run("invalid request body", func(t *testing.T) {
-		projectID := uuid.New()
-
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("POST", "/api/v1/projects/"+projectID.String()+"/members", bytes.NewBuffer([]byte("{}")))
+		req, _ := http.NewRequest("POST", "/api/v1/projects/"+project.ID.String()+"/members", bytes.NewBuffer([]byte("{}")))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
@@ -407,85 +295,58 @@ func TestProjectHandler_AddMember(t *testing.T) {
 }
 
 func TestProjectHandler_GetMembers(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
+	router, db, handler := setupProjectTestRouter(t)
 	router.GET("/api/v1/projects/:id/members", handler.GetMembers)
 
 	t.Run("get members successfully", func(t *testing.T) {
-		projectID := uuid.New()
-		userID1 := uuid.New()
-		userID2 := uuid.New()
-
-		members := []models.ProjectMember{
-			{ID: uuid.New(), ProjectID: projectID, UserID: userID1, Role: "manager"},
-			{ID: uuid.New(), ProjectID: projectID, UserID: userID2, Role: "developer"},
-		}
-
-		mockService.On("GetProjectMembers", mock.Anything, projectID.String()).
-			Return(members, nil).Once()
+		project := createTestProject(t, db, models.Project{Name: "Test Project"}, "developer",
+			createTestUser(t, db, "member1", models.RoleDesigner), createTestUser(t, db, "member2", models.RoleDesigner))
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID.String()+"/members", nil)
+		req, _ := http.NewRequest("GET", "/api/v1/projects/"+project.ID.String()+"/members", nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, float64(0), response["code"])
-
-		data := response["data"].([]interface{})
+		data := decodeResponse(t, w)["data"].([]interface{})
 		assert.Len(t, data, 2)
 	})
 }
 
 func TestProjectHandler_UpdateProgress(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
-	router.PUT("/api/v1/projects/:id/progress", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
-		handler.UpdateProgress(c)
-	})
+	router, db, handler := setupProjectTestRouter(t)
+	manager := createTestUser(t, db, "manager", models.RoleDesigner)
+	router.PUT("/api/v1/projects/:id/progress", asUser(manager.ID.String(), handler.UpdateProgress))
+	project := createTestProject(t, db, models.Project{Name: "Test Project"}, "manager", manager)
 
 	t.Run("update progress successfully", func(t *testing.T) {
-		projectID := uuid.New()
-		updatedProject := &models.Project{
-			ID:       projectID,
-			Name:     "Test Project",
-			Progress: 75,
-			Status:   "in_progress",
-		}
-
-		mockService.On("UpdateProjectProgress", mock.Anything, projectID.String(), 75, "user-123").
-			Return(updatedProject, nil).Once()
-
 		reqBody := map[string]interface{}{
 			"progress": 75,
 		}
 		jsonBody, _ := json.Marshal(reqBody)
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+projectID.String()+"/progress", bytes.NewBuffer(jsonBody))
+		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+project.ID.String()+"/progress", bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
+		response := decodeResponse(t, w)
 		assert.Equal(t, float64(0), response["code"])
+		data := response["data"].(map[string]interface{})
+		assert.Equal(t, float64(75), data["progress"])
+		assert.Equal(t, "in_progress", data["status"])
 	})
 
 	t.Run("invalid progress value", func(t *testing.T) {
-		projectID := uuid.New()
-
 		reqBody := map[string]interface{}{
 			"progress": 150,
 		}
 		jsonBody, _ := json.Marshal(reqBody)
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+projectID.String()+"/progress", bytes.NewBuffer(jsonBody))
+		req, _ := http.NewRequest("PUT", "/api/v1/projects/"+project.ID.String()+"/progress", bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
@@ -493,52 +354,107 @@ func TestProjectHandler_UpdateProgress(t *testing.T) {
 	})
 }
 
+// createTestWorkflow stores a workflow for the project's activities
+func createTestWorkflow(t *testing.T, db *gorm.DB, project *models.Project) *models.Workflow {
+	workflow, err := services.NewStateMachineService(db).CreateWorkflow(project.ID.String(), "", "Development", "", "")
+	require.NoError(t, err)
+	return workflow
+}
+
+// createTestActivity stores an activity planned from start for the given
+// number of days
+func createTestActivity(t *testing.T, db *gorm.DB, workflow *models.Workflow, name string, sequence int, start time.Time, days int) *models.Activity {
+	end := start.AddDate(0, 0, days)
+	activity := &models.Activity{
+		WorkflowID: workflow.ID, ProjectID: workflow.ProjectID, Name: name, Status: models.ActivityStatusPending,
+		Sequence: sequence, PlannedStart: &start, PlannedEnd: &end,
+	}
+	require.NoError(t, db.Create(activity).Error)
+	return activity
+}
+
 func TestProjectHandler_GetProjectActivities(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
+	router, db, handler := setupProjectTestRouter(t)
 	router.GET("/api/v1/projects/:id/activities", handler.GetProjectActivities)
 
 	t.Run("get activities successfully", func(t *testing.T) {
-		projectID := uuid.New()
+		project := createTestProject(t, db, models.Project{Name: "Test Project"}, "")
+		workflow := createTestWorkflow(t, db, project)
+		start := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+		second := createTestActivity(t, db, workflow, "Activity 2", 2, start, 1)
+		first := createTestActivity(t, db, workflow, "Activity 1", 1, start, 1)
 
-		activities := []models.Activity{
-			{ID: uuid.New(), ProjectID: projectID, Name: "Activity 1", Status: "completed", SortOrder: 1},
-			{ID: uuid.New(), ProjectID: projectID, Name: "Activity 2", Status: "in_progress", SortOrder: 2},
-		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/projects/"+project.ID.String()+"/activities", nil)
+		router.ServeHTTP(w, req)
 
-		mockService.On("GetProjectActivities", mock.Anything, projectID.String()).
-			Return(activities, nil).Once()
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		data := decodeResponse(t, w)["data"].([]interface{})
+		require.Len(t, data, 2)
+		assert.Equal(t, first.ID, data[0].(map[string]interface{})["id"])
+		assert.Equal(t, second.ID, data[1].(map[string]interface{})["id"])
+	})
+}
+
+func TestProjectHandler_CreateActivity(t *testing.T) {
+	router, db, handler := setupProjectTestRouter(t)
+	user := createTestUser(t, db, "planner", models.RoleDesigner)
+	router.POST("/api/v1/projects/:id/activities", asUser(user.ID.String(), handler.CreateActivity))
+	project := createTestProject(t, db, models.Project{Name: "Test Project"}, "")
+	workflow := createTestWorkflow(t, db, project)
+
+	t.Run("create activity with planned dates", func(t *testing.T) {
+		reqBody := map[string]interface{}{
+			"workflow_id":   workflow.ID,
+			"name":          "Design",
+			"planned_start": "2025-03-03",
+			"planned_end":   "2025-03-08",
+			"sequence":      1,
+		}
+		jsonBody, _ := json.Marshal(reqBody)
 
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID.String()+"/activities", nil)
+		req, _ := http.NewRequest("POST", "/api/v1/projects/"+project.ID.String()+"/activities", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusCreated, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, float64(0), response["code"])
+		var activity models.Activity
+		require.NoError(t, db.First(&activity, "project_id = ?", project.ID.String()).Error)
+		assert.Equal(t, "Design", activity.Name)
+		assert.Equal(t, user.ID.String(), activity.CreatedBy)
+		require.NotNil(t, activity.PlannedEnd)
+		assert.Equal(t, "2025-03-08", activity.PlannedEnd.Format("2006-01-02"))
+	})
 
-		data := response["data"].([]interface{})
-		assert.Len(t, data, 2)
+	t.Run("invalid planned date", func(t *testing.T) {
+		reqBody := map[string]interface{}{
+			"workflow_id":   workflow.ID,
+			"name":          "Design",
+			"planned_start": "03/03/2025",
+		}
+		jsonBody, _ := json.Marshal(reqBody)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/projects/"+project.ID.String()+"/activities", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
 
 func TestProjectHandler_GetUserProjects(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
-	router.GET("/api/v1/users/me/projects", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
-		handler.GetUserProjects(c)
-	})
+	router, db, handler := setupProjectTestRouter(t)
+	user := createTestUser(t, db, "member", models.RoleDesigner)
+	router.GET("/api/v1/users/me/projects", asUser(user.ID.String(), handler.GetUserProjects))
 
 	t.Run("get user projects successfully", func(t *testing.T) {
-		projects := []models.Project{
-			{ID: uuid.New(), Name: "Project 1", Code: "RDP-PD-20240221-001"},
-			{ID: uuid.New(), Name: "Project 2", Code: "RDP-TR-20240221-002"},
-		}
-
-		mockService.On("GetUserProjects", mock.Anything, "user-123").
-			Return(projects, nil).Once()
+		createTestProject(t, db, models.Project{Name: "Project 1"}, "developer", user)
+		createTestProject(t, db, models.Project{Name: "Project 2"}, "developer", user)
+		createTestProject(t, db, models.Project{Name: "Other Project"}, "")
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/api/v1/users/me/projects", nil)
@@ -546,17 +462,12 @@ func TestProjectHandler_GetUserProjects(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, float64(0), response["code"])
-
-		data := response["data"].([]interface{})
+		data := decodeResponse(t, w)["data"].([]interface{})
 		assert.Len(t, data, 2)
 	})
 
 	t.Run("unauthorized", func(t *testing.T) {
-		router2, _, handler2 := setupTestRouter()
+		router2, _, handler2 := setupProjectTestRouter(t)
 		router2.GET("/api/v1/users/me/projects", handler2.GetUserProjects)
 
 		w := httptest.NewRecorder()
@@ -568,25 +479,14 @@ func TestProjectHandler_GetUserProjects(t *testing.T) {
 }
 
 func TestProjectHandler_GetProjectStats(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
-	router.GET("/api/v1/projects/stats", func(c *gin.Context) {
-		c.Set("user_id", "user-123")
-		handler.GetProjectStats(c)
-	})
+	router, db, handler := setupProjectTestRouter(t)
+	user := createTestUser(t, db, "member", models.RoleDesigner)
+	router.GET("/api/v1/projects/stats", asUser(user.ID.String(), handler.GetProjectStats))
 
 	t.Run("get stats successfully", func(t *testing.T) {
-		stats := map[string]interface{}{
-			"total":       int64(100),
-			"my_projects": int64(5),
-			"by_status": map[string]int64{
-				"draft":       10,
-				"in_progress": 60,
-				"completed":   30,
-			},
-		}
-
-		mockService.On("GetProjectStats", mock.Anything, "user-123").
-			Return(stats, nil).Once()
+		createTestProject(t, db, models.Project{Name: "Project 1", Status: "in_progress"}, "developer", user)
+		createTestProject(t, db, models.Project{Name: "Project 2", Status: "draft"}, "")
+		createTestProject(t, db, models.Project{Name: "Project 3", Status: "in_progress"}, "")
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/api/v1/projects/stats", nil)
@@ -594,76 +494,77 @@ func TestProjectHandler_GetProjectStats(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, float64(0), response["code"])
-
-		data := response["data"].(map[string]interface{})
-		assert.Equal(t, float64(100), data["total"])
+		data := decodeResponse(t, w)["data"].(map[string]interface{})
+		assert.Equal(t, float64(3), data["total"])
+		assert.Equal(t, float64(1), data["my_projects"])
+		assert.Equal(t, float64(2), data["by_status"].(map[string]interface{})["in_progress"])
 	})
 }
 
 func TestProjectHandler_GetProjectGantt(t *testing.T) {
-	router, mockService, handler := setupTestRouter()
+	router, db, handler := setupProjectTestRouter(t)
 	router.GET("/api/v1/projects/:id/gantt", handler.GetProjectGantt)
 
 	t.Run("get gantt data successfully", func(t *testing.T) {
-		projectID := uuid.New()
-		now := time.Now()
-		startDate := now
-		endDate := now.AddDate(0, 1, 0)
-
-		project := &models.Project{
-			ID:       projectID,
-			Name:     "Test Project",
-			Code:     "RDP-PD-20240221-001",
-			Status:   "in_progress",
-			Progress: 50,
+		start := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+		project := createTestProject(t, db, models.Project{Name: "Test Project", Status: "in_progress", StartDate: &start}, "")
+		workflow := createTestWorkflow(t, db, project)
+
+		// design -> build is the critical path; docs may slip three days
+		design := createTestActivity(t, db, workflow, "Design", 1, start, 5)
+		build := createTestActivity(t, db, workflow, "Build", 2, start.AddDate(0, 0, 5), 5)
+		docs := createTestActivity(t, db, workflow, "Docs", 3, start.AddDate(0, 0, 5), 2)
+		activities := services.NewActivityService(db)
+		for _, activity := range []*models.Activity{build, docs} {
+			_, err := activities.AddDependency(activity.ID, design.ID, "", 0)
+			require.NoError(t, err)
 		}
 
-		activities := []models.Activity{
-			{
-				ID:        uuid.New(),
-				ProjectID: projectID,
-				Name:      "Activity 1",
-				Status:    "completed",
-				Progress:  100,
-				StartDate: &startDate,
-				EndDate:   &endDate,
-				SortOrder: 1,
-			},
-		}
-
-		mockService.On("GetProjectByID", mock.Anything, projectID.String()).
-			Return(project, nil).Once()
-		mockService.On("GetProjectActivities", mock.Anything, projectID.String()).
-			Return(activities, nil).Once()
-
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID.String()+"/gantt", nil)
+		req, _ := http.NewRequest("GET", "/api/v1/projects/"+project.ID.String()+"/gantt", nil)
 		router.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]interface{}
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
+		response := decodeResponse(t, w)
 		assert.Equal(t, float64(0), response["code"])
 
 		data := response["data"].(map[string]interface{})
-		assert.NotNil(t, data["project"])
-		assert.NotNil(t, data["tasks"])
+		assert.Equal(t, project.Name, data["project"].(map[string]interface{})["name"])
+		assert.Equal(t, []interface{}{design.ID, build.ID}, data["schedule"].(map[string]interface{})["critical_path"])
+
+		tasks := data["tasks"].([]interface{})
+		require.Len(t, tasks, 3)
+		byID := make(map[string]map[string]interface{}, len(tasks))
+		for _, task := range tasks {
+			byID[task.(map[string]interface{})["id"].(string)] = task.(map[string]interface{})
+		}
+
+		for _, tc := range []struct {
+			activity  *models.Activity
+			startDate string
+			critical  bool
+			float     float64
+		}{
+			{design, "2025-03-03", true, 0},
+			{build, "2025-03-08", true, 0},
+			{docs, "2025-03-08", false, 3},
+		} {
+			task := byID[tc.activity.ID]
+			require.NotNil(t, task, tc.activity.Name)
+			assert.Equal(t, tc.startDate, task["start_date"], tc.activity.Name)
+
+			schedule := task["schedule"].(map[string]interface{})
+			assert.Equal(t, tc.critical, schedule["critical"], tc.activity.Name)
+			assert.Equal(t, tc.float, schedule["total_float"], tc.activity.Name)
+		}
+		assert.Equal(t, []interface{}{design.ID}, byID[docs.ID]["depends_on"])
+		assert.Nil(t, byID[design.ID]["depends_on"])
 	})
 
 	t.Run("project not found", func(t *testing.T) {
-		projectID := uuid.New()
-
-		mockService.On("GetProjectByID", mock.Anything, projectID.String()).
-			Return(nil, errors.New("project not found")).Once()
-
 		w := httptest.NewRecorder()
-		req, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID.String()+"/gantt", nil)
+		req, _ := http.NewRequest("GET", "/api/v1/projects/"+uuid.New().String()+"/gantt", nil)
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QualityGateHandler handles quality gate HTTP requests
+type QualityGateHandler struct {
+	qualityGateService *services.QualityGateService
+}
+
+// NewQualityGateHandler creates a new QualityGateHandler
+func NewQualityGateHandler(qualityGateService *services.QualityGateService) *QualityGateHandler {
+	return &QualityGateHandler{
+		qualityGateService: qualityGateService,
+	}
+}
+
+// ListGates handles GET /api/v1/activities/:id/quality-gates
+func (h *QualityGateHandler) ListGates(c *gin.Context) {
+	gates, err := h.qualityGateService.ListGates(c.Param("id"))
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    gates,
+	})
+}
+
+// CreateGate handles POST /api/v1/activities/:id/quality-gates
+func (h *QualityGateHandler) CreateGate(c *gin.Context) {
+	var req models.CreateQualityGateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	gate, err := h.qualityGateService.CreateGate(c.Param("id"), c.GetString("user_id"), &req)
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "quality gate created",
+		"data":    gate,
+	})
+}
+
+// Evaluate handles POST /api/v1/activities/:id/quality-gates/evaluate
+func (h *QualityGateHandler) Evaluate(c *gin.Context) {
+	results, err := h.qualityGateService.EvaluateActivity(c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "quality gates evaluated",
+		"data":    results,
+	})
+}
+
+// RequestWaiver handles POST /api/v1/activities/:id/quality-gates/:gate_id/waivers
+func (h *QualityGateHandler) RequestWaiver(c *gin.Context) {
+	var req models.QualityGateWaiverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	waiver, err := h.qualityGateService.RequestWaiver(c.Param("gate_id"), c.GetString("user_id"), req.Reason)
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "waiver requested",
+		"data":    waiver,
+	})
+}
+
+// ListPendingWaivers handles GET /api/v1/quality-gate-waivers/pending
+func (h *QualityGateHandler) ListPendingWaivers(c *gin.Context) {
+	waivers, err := h.qualityGateService.ListPendingWaivers(c.GetString("user_id"))
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    waivers,
+	})
+}
+
+// ApproveWaiver handles POST /api/v1/quality-gate-waivers/:id/approve
+func (h *QualityGateHandler) ApproveWaiver(c *gin.Context) {
+	var req models.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	waiver, err := h.qualityGateService.ApproveWaiver(c.Param("id"), c.GetString("user_id"), req.Comment)
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "waiver approved",
+		"data":    waiver,
+	})
+}
+
+// RejectWaiver handles POST /api/v1/quality-gate-waivers/:id/reject
+func (h *QualityGateHandler) RejectWaiver(c *gin.Context) {
+	var req models.ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBadRequest(c, "invalid request body: "+err.Error())
+		return
+	}
+
+	waiver, err := h.qualityGateService.RejectWaiver(c.Param("id"), c.GetString("user_id"), req.Comment)
+	if err != nil {
+		respondQualityGateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "waiver rejected",
+		"data":    waiver,
+	})
+}
+
+// respondQualityGateError maps a quality gate error to a response
+func respondQualityGateError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, services.ErrQualityGateNotDCP), errors.Is(err, services.ErrInvalidQualityCheck),
+		errors.Is(err, services.ErrApproverNotResolved), errors.Is(err, services.ErrApprovalCommentRequired):
+		status, code = http.StatusBadRequest, 4000
+	case errors.Is(err, services.ErrNotApprover), errors.Is(err, services.ErrWaiverNotPermitted):
+		status, code = http.StatusForbidden, 4031
+	case errors.Is(err, services.ErrQualityGateNotFound), errors.Is(err, services.ErrWaiverNotFound),
+		errors.Is(err, services.ErrActivityNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, services.ErrWaiverNotRequired), errors.Is(err, services.ErrWaiverAlreadyPending),
+		errors.Is(err, services.ErrWaiverNotPending):
+		status, code = http.StatusConflict, 4090
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
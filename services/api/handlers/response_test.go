@@ -98,3 +98,52 @@ func TestNotFoundResponse(t *testing.T) {
 		assert.Equal(t, 404, response.Code)
 	})
 }
+
+// TestErrorResponse_Code 测试错误响应携带业务错误码
+func TestErrorResponse_Code(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	ErrorResponse(c, http.StatusBadRequest, 40001, "Bad request")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 40001, response.Code)
+	assert.Equal(t, "Bad request", response.Message)
+}
+
+// TestUnauthorizedResponse 测试401响应
+func TestUnauthorizedResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	UnauthorizedResponse(c, "Unauthorized")
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// TestForbiddenResponse 测试403响应
+func TestForbiddenResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	ForbiddenResponse(c, "Forbidden")
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestInternalServerErrorResponse 测试500响应
+func TestInternalServerErrorResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	InternalServerErrorResponse(c, "Server error")
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -5,8 +5,7 @@ import (
 	"strconv"
 	"time"
 
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -51,6 +50,9 @@ func (h *SecurityHandler) ListAuditLogs(c *gin.Context) {
 	if classification := c.Query("classification"); classification != "" {
 		filters["classification"] = classification
 	}
+	if severity := c.Query("severity"); severity != "" {
+		filters["severity"] = severity
+	}
 	if startDate := c.Query("start_date"); startDate != "" {
 		if t, err := time.Parse("2006-01-02", startDate); err == nil {
 			filters["start_date"] = t
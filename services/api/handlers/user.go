@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -100,8 +102,8 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 
 // CreateUser handles POST /api/v1/users
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    4000,
 			"message": "invalid request body: " + err.Error(),
@@ -110,15 +112,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	// Set defaults
-	if user.DisplayName == "" {
-		user.DisplayName = user.Username
-	}
-	if !user.IsActive {
-		user.IsActive = true
-	}
-
-	err := h.userService.CreateUser(c.Request.Context(), &user)
+	user, err := h.userService.CreateUser(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    4001,
@@ -155,6 +149,8 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	delete(updates, "username")
 	delete(updates, "password_hash")
 	delete(updates, "casdoor_id")
+	// Clearance changes go through PUT /users/:id/clearance
+	delete(updates, "clearance_level")
 
 	user, err := h.userService.UpdateUser(c.Request.Context(), id, updates)
 	if err != nil {
@@ -379,6 +375,8 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 	delete(updates, "casdoor_id")
 	delete(updates, "role")
 	delete(updates, "organization_id")
+	delete(updates, "clearance_level")
+	delete(updates, "password")
 
 	user, err := h.userService.UpdateUser(c.Request.Context(), userID.(string), updates)
 	if err != nil {
@@ -396,3 +394,333 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 		"data":    user,
 	})
 }
+
+// Login handles POST /api/v1/auth/login
+func (h *UserHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    4000,
+			"message": "invalid request body: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	user, err := h.userService.ValidateCredentials(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		respondCredentialError(c, err)
+		return
+	}
+	if user.MustChangePassword {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    4034,
+			"message": services.ErrPasswordChangeRequired.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	challenge, err := h.userService.BeginMFAChallenge(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    5000,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "second factor required",
+			"data":    challenge,
+		})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// completeLogin opens a session for an authenticated user and responds
+// with its tokens
+func (h *UserHandler) completeLogin(c *gin.Context, user *models.User) {
+	tokens, err := h.userService.StartSession(c.Request.Context(), user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    5000,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	_ = h.userService.UpdateLastLogin(c.Request.Context(), user.ID.String())
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "login successful",
+		"data":    tokens,
+	})
+}
+
+// RefreshToken handles POST /api/v1/auth/refresh
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    4000,
+			"message": "invalid request body: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	tokens, err := h.userService.RefreshAccessToken(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		status, code := http.StatusUnauthorized, 4012
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			code = 4014
+		} else if errors.Is(err, services.ErrUserDisabled) {
+			status, code = http.StatusForbidden, 4033
+		}
+		c.JSON(status, gin.H{
+			"code":    code,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "token refreshed successfully",
+		"data":    tokens,
+	})
+}
+
+// Logout handles POST /api/v1/auth/logout
+func (h *UserHandler) Logout(c *gin.Context) {
+	accessToken := ""
+	if parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2); len(parts) == 2 {
+		accessToken = parts[1]
+	}
+	if err := h.userService.Logout(c.Request.Context(), accessToken); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    4012,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	// Revoke the refresh token too when the client hands it over
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err == nil && req.RefreshToken != "" {
+		_ = h.userService.RevokeRefreshToken(c.Request.Context(), req.RefreshToken)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "logged out successfully",
+		"data":    nil,
+	})
+}
+
+// Heartbeat handles POST /api/v1/auth/heartbeat. The auth middleware has
+// already recorded the activity; this returns the refreshed remaining time.
+func (h *UserHandler) Heartbeat(c *gin.Context) {
+	h.respondSessionInfo(c)
+}
+
+// SessionInfo handles GET /api/v1/auth/session-info
+func (h *UserHandler) SessionInfo(c *gin.Context) {
+	h.respondSessionInfo(c)
+}
+
+// respondSessionInfo writes the remaining lifetime of the caller's session
+func (h *UserHandler) respondSessionInfo(c *gin.Context) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    4010,
+			"message": "unauthorized",
+			"data":    nil,
+		})
+		return
+	}
+
+	info, err := h.userService.GetSessionInfo(c.Request.Context(), sessionID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    4015,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    info,
+	})
+}
+
+// ChangePassword handles PUT /api/v1/users/me/password
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    4010,
+			"message": "unauthorized",
+			"data":    nil,
+		})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    4000,
+			"message": "invalid request body: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	err := h.userService.UpdatePassword(c.Request.Context(), userID.(string), req.OldPassword, req.NewPassword)
+	if err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "password changed successfully",
+		"data":    nil,
+	})
+}
+
+// ChangeRequiredPassword handles POST /api/v1/auth/change-password. It lets
+// a user whose password must be changed set a new one before logging in.
+func (h *UserHandler) ChangeRequiredPassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" {
+		message := "username is required"
+		if err != nil {
+			message = "invalid request body: " + err.Error()
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    4000,
+			"message": message,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, err := h.userService.ValidateCredentials(c.Request.Context(), req.Username, req.OldPassword)
+	if err != nil {
+		respondCredentialError(c, err)
+		return
+	}
+
+	err = h.userService.UpdatePassword(c.Request.Context(), user.ID.String(), req.OldPassword, req.NewPassword)
+	if err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "password changed successfully",
+		"data":    nil,
+	})
+}
+
+// ForcePasswordReset handles POST /api/v1/users/:id/force-password-reset
+func (h *UserHandler) ForcePasswordReset(c *gin.Context) {
+	var req models.ForcePasswordResetRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    4000,
+				"message": "invalid request body: " + err.Error(),
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	if err := h.userService.ForcePasswordReset(c.Request.Context(), c.Param("id"), req.TemporaryPassword); err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "password reset required at next login",
+		"data":    nil,
+	})
+}
+
+// UnlockUser handles POST /api/v1/users/:id/unlock
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	if err := h.userService.UnlockAccount(c.Request.Context(), c.Param("id")); err != nil {
+		status, code := http.StatusInternalServerError, 5000
+		if errors.Is(err, services.ErrUserNotFound) {
+			status, code = http.StatusNotFound, 4040
+		}
+		c.JSON(status, gin.H{
+			"code":    code,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "account unlocked",
+		"data":    nil,
+	})
+}
+
+// respondCredentialError maps a ValidateCredentials error to a response
+func respondCredentialError(c *gin.Context, err error) {
+	status, code := http.StatusUnauthorized, 4013
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+	case errors.Is(err, services.ErrUserDisabled):
+		status, code = http.StatusForbidden, 4033
+	case errors.Is(err, services.ErrAccountLocked):
+		status, code = http.StatusLocked, 4230
+	default:
+		status, code = http.StatusInternalServerError, 5000
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
+
+// respondPasswordError maps a password change error to a response
+func respondPasswordError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, services.ErrPasswordPolicy), errors.Is(err, services.ErrPasswordReused):
+		status, code = http.StatusBadRequest, 4002
+	case errors.Is(err, services.ErrInvalidCredentials):
+		status, code = http.StatusUnauthorized, 4013
+	case errors.Is(err, services.ErrUserNotFound):
+		status, code = http.StatusNotFound, 4040
+	}
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": err.Error(),
+		"data":    nil,
+	})
+}
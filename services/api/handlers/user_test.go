@@ -2,613 +2,326 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 
 	"rdp-platform/rdp-api/middleware"
 	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 )
 
-// MockUserService 模拟用户服务
-type MockUserService struct {
-	mock.Mock
-}
-
-func (m *MockUserService) CreateUser(ctx interface{}, req models.CreateUserRequest) (*models.User, error) {
-	args := m.Called(ctx, req)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.User), args.Error(1)
-}
-
-func (m *MockUserService) GetUserByID(ctx interface{}, id string) (*models.User, error) {
-	args := m.Called(ctx, id)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.User), args.Error(1)
-}
-
-func (m *MockUserService) GetUserByUsername(ctx interface{}, username string) (*models.User, error) {
-	args := m.Called(ctx, username)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.User), args.Error(1)
-}
-
-func (m *MockUserService) GetUserList(ctx interface{}, query models.UserListQuery) (*models.PaginatedResponse, error) {
-	args := m.Called(ctx, query)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.PaginatedResponse), args.Error(1)
-}
-
-func (m *MockUserService) UpdateUser(ctx interface{}, id string, req models.UpdateUserRequest, isAdmin bool) (*models.User, error) {
-	args := m.Called(ctx, id, req, isAdmin)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.User), args.Error(1)
-}
-
-func (m *MockUserService) DeleteUser(ctx interface{}, id string) error {
-	args := m.Called(ctx, id)
-	return args.Error(0)
-}
-
-func (m *MockUserService) ValidateCredentials(ctx interface{}, username, password string) (*models.User, error) {
-	args := m.Called(ctx, username, password)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.User), args.Error(1)
-}
-
-func (m *MockUserService) GenerateTokenPair(user *models.User) (*models.LoginResponse, error) {
-	args := m.Called(user)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.LoginResponse), args.Error(1)
-}
-
-func (m *MockUserService) RefreshAccessToken(ctx interface{}, refreshToken string) (*models.RefreshTokenResponse, error) {
-	args := m.Called(ctx, refreshToken)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.RefreshTokenResponse), args.Error(1)
-}
-
-func (m *MockUserService) Logout(ctx interface{}, token string) error {
-	args := m.Called(ctx, token)
-	return args.Error(0)
-}
-
-func (m *MockUserService) ValidateToken(ctx interface{}, tokenString string) (*models.JWTClaims, error) {
-	args := m.Called(ctx, tokenString)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.JWTClaims), args.Error(1)
-}
-
-func (m *MockUserService) UpdatePassword(ctx interface{}, userID, oldPassword, newPassword string) error {
-	args := m.Called(ctx, userID, oldPassword, newPassword)
-	return args.Error(0)
-}
-
-func (m *MockUserService) ResetPassword(ctx interface{}, userID, newPassword string) error {
-	args := m.Called(ctx, userID, newPassword)
-	return args.Error(0)
-}
-
-func (m *MockUserService) GetUserStats(ctx interface{}, userID string) (*models.UserStats, error) {
-	args := m.Called(ctx, userID)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.UserStats), args.Error(1)
-}
-
-func (m *MockUserService) GetUserContributions(ctx interface{}, userID string, year int) ([]models.UserContribution, error) {
-	args := m.Called(ctx, userID, year)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).([]models.UserContribution), args.Error(1)
-}
-
 type UserHandlerTestSuite struct {
 	suite.Suite
-	mockService *MockUserService
+	db          *gorm.DB
+	userService *services.UserService
 	handler     *UserHandler
 	router      *gin.Engine
 }
 
 func (s *UserHandlerTestSuite) SetupSuite() {
 	gin.SetMode(gin.TestMode)
-	s.mockService = new(MockUserService)
-	s.handler = NewUserHandler(s.mockService)
-	s.router = gin.New()
+
+	var err error
+	// 使用内存SQLite数据库进行测试
+	s.db, err = gorm.Open(sqlite.Open("file:user_handler?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.User{}, &models.TokenBlacklist{}, &models.RefreshToken{}, &models.LoginLog{},
+		&models.Session{}, &models.PasswordHistory{}, &models.UserMFA{}, &models.MFARecoveryCode{}, &models.AuditLog{}, &models.AuditChainHead{}))
+
+	s.userService = services.NewUserService(s.db, models.AuthConfig{
+		JWTSecret:       "test-secret",
+		AccessTokenTTL:  2 * time.Hour,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		Issuer:          "rdp-api-test",
+		Audience:        "rdp-users-test",
+	})
+	s.handler = NewUserHandler(s.userService, services.NewOrganizationService(s.db))
 }
 
-func (s *UserHandlerTestSuite) TearDownTest() {
-	s.mockService.AssertExpectations(s.T())
+func (s *UserHandlerTestSuite) SetupTest() {
+	// 清空表，每个测试使用新的路由
+	for _, table := range []string{"token_blacklists", "refresh_tokens", "login_logs", "sessions", "password_histories",
+		"user_mfa", "mfa_recovery_codes", "audit_logs", "audit_chain_heads", "users"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+	s.router = gin.New()
 }
 
 func TestUserHandlerSuite(t *testing.T) {
 	suite.Run(t, new(UserHandlerTestSuite))
 }
 
-// TestLogin_Success 测试成功登录
-func (s *UserHandlerTestSuite) TestLogin_Success() {
-	reqBody := map[string]string{
-		"username": "testuser",
-		"password": "TestPass123",
-	}
-	body, _ := json.Marshal(reqBody)
-
-	mockUser := &models.User{
-		ID:          "test-id",
-		Username:    "testuser",
+// createUser 创建测试用户
+func (s *UserHandlerTestSuite) createUser(username, role string) *models.User {
+	user, err := s.userService.CreateUser(context.Background(), models.CreateUserRequest{
+		Username:    username,
+		Password:    "TestPass123",
 		DisplayName: "Test User",
-		Email:       "test@example.com",
-		Role:        models.RoleDesigner,
-	}
+		Email:       username + "@example.com",
+		Role:        role,
+	})
+	require.NoError(s.T(), err)
+	return user
+}
 
-	mockResponse := &models.LoginResponse{
-		AccessToken:  "access-token",
-		RefreshToken: "refresh-token",
-		ExpiresIn:    7200,
-		TokenType:    "Bearer",
-		User:         mockUser.ToResponse(),
+// as 以指定用户身份调用处理函数，与认证中间件设置的上下文一致
+func as(userID string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		handler(c)
 	}
+}
 
-	s.mockService.On("ValidateCredentials", mock.Anything, "testuser", "TestPass123").Return(mockUser, nil)
-	s.mockService.On("GenerateTokenPair", mockUser).Return(mockResponse, nil)
-
-	s.router.POST("/login", s.handler.Login)
+// serve 发送请求并返回响应
+func (s *UserHandlerTestSuite) serve(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var reader *bytes.Buffer
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(encoded)
+	} else {
+		reader = bytes.NewBuffer(nil)
+	}
 
 	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	httpReq, _ := http.NewRequest(method, path, reader)
 	httpReq.Header.Set("Content-Type", "application/json")
-
 	s.router.ServeHTTP(w, httpReq)
 
-	assert.Equal(s.T(), http.StatusOK, w.Code)
-
-	var response APIResponse
+	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(s.T(), 200, response.Code)
+	return w, response
 }
 
-// TestLogin_InvalidCredentials 测试无效凭据
-func (s *UserHandlerTestSuite) TestLogin_InvalidCredentials() {
-	reqBody := map[string]string{
+// TestLogin_Success 测试成功登录
+func (s *UserHandlerTestSuite) TestLogin_Success() {
+	s.createUser("testuser", models.RoleDesigner)
+	s.router.POST("/login", s.handler.Login)
+
+	w, response := s.serve("POST", "/login", map[string]string{
 		"username": "testuser",
-		"password": "WrongPass",
-	}
-	body, _ := json.Marshal(reqBody)
+		"password": "TestPass123",
+	})
 
-	s.mockService.On("ValidateCredentials", mock.Anything, "testuser", "WrongPass").
-		Return(nil, errors.New("invalid credentials"))
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), float64(0), response["code"])
+	data := response["data"].(map[string]interface{})
+	assert.NotEmpty(s.T(), data["access_token"])
+	assert.NotEmpty(s.T(), data["refresh_token"])
+}
 
+// TestLogin_InvalidCredentials 测试无效凭据
+func (s *UserHandlerTestSuite) TestLogin_InvalidCredentials() {
+	s.createUser("testuser", models.RoleDesigner)
 	s.router.POST("/login", s.handler.Login)
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	s.router.ServeHTTP(w, httpReq)
+	w, _ := s.serve("POST", "/login", map[string]string{
+		"username": "testuser",
+		"password": "WrongPass",
+	})
 
 	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
 }
 
 // TestLogin_MissingFields 测试缺少字段
 func (s *UserHandlerTestSuite) TestLogin_MissingFields() {
-	reqBody := map[string]string{
-		"username": "testuser",
-		// missing password
-	}
-	body, _ := json.Marshal(reqBody)
-
 	s.router.POST("/login", s.handler.Login)
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	s.router.ServeHTTP(w, httpReq)
+	w, _ := s.serve("POST", "/login", map[string]string{
+		"username": "testuser",
+		// missing password
+	})
 
 	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
 }
 
 // TestGetUser_Success 测试获取用户详情
 func (s *UserHandlerTestSuite) TestGetUser_Success() {
-	mockUser := &models.User{
-		ID:          "test-id",
-		Username:    "testuser",
-		DisplayName: "Test User",
-		Email:       "test@example.com",
-		Role:        models.RoleDesigner,
-	}
-
-	s.mockService.On("GetUserByID", mock.Anything, "test-id").Return(mockUser, nil)
-
+	user := s.createUser("testuser", models.RoleDesigner)
 	s.router.GET("/users/:id", s.handler.GetUser)
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("GET", "/users/test-id", nil)
-
-	s.router.ServeHTTP(w, httpReq)
+	w, response := s.serve("GET", "/users/"+user.ID.String(), nil)
 
 	assert.Equal(s.T(), http.StatusOK, w.Code)
-
-	var response APIResponse
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(s.T(), 200, response.Code)
+	assert.Equal(s.T(), float64(0), response["code"])
+	assert.Equal(s.T(), "testuser", response["data"].(map[string]interface{})["username"])
 }
 
 // TestGetUser_NotFound 测试用户不存在
 func (s *UserHandlerTestSuite) TestGetUser_NotFound() {
-	s.mockService.On("GetUserByID", mock.Anything, "non-existent").
-		Return(nil, errors.New("user not found"))
-
 	s.router.GET("/users/:id", s.handler.GetUser)
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("GET", "/users/non-existent", nil)
-
-	s.router.ServeHTTP(w, httpReq)
+	w, _ := s.serve("GET", "/users/"+uuid.New().String(), nil)
 
 	assert.Equal(s.T(), http.StatusNotFound, w.Code)
 }
 
 // TestCreateUser_Success 测试创建用户
 func (s *UserHandlerTestSuite) TestCreateUser_Success() {
-	reqBody := models.CreateUserRequest{
-		Username:    "newuser",
-		Password:    "TestPass123",
-		DisplayName: "New User",
-		Email:       "new@example.com",
-		Role:        models.RoleDesigner,
-	}
-	body, _ := json.Marshal(reqBody)
+	s.router.POST("/users", s.handler.CreateUser)
 
-	mockUser := &models.User{
-		ID:          "new-id",
+	w, response := s.serve("POST", "/users", models.CreateUserRequest{
 		Username:    "newuser",
+		Password:    "TestPass123",
 		DisplayName: "New User",
 		Email:       "new@example.com",
 		Role:        models.RoleDesigner,
-	}
-
-	s.mockService.On("CreateUser", mock.Anything, reqBody).Return(mockUser, nil)
-
-	s.router.POST("/users", s.handler.CreateUser)
-
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	s.router.ServeHTTP(w, httpReq)
+	})
 
 	assert.Equal(s.T(), http.StatusCreated, w.Code)
+	assert.Equal(s.T(), float64(0), response["code"])
 
-	var response APIResponse
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(s.T(), 201, response.Code)
+	created, err := s.userService.GetUserByUsername(context.Background(), "newuser")
+	require.NoError(s.T(), err)
+	assert.True(s.T(), created.CheckPassword("TestPass123"))
 }
 
 // TestGetUserList_Success 测试获取用户列表
 func (s *UserHandlerTestSuite) TestGetUserList_Success() {
-	mockResponse := &models.PaginatedResponse{
-		List: []map[string]interface{}{
-			{"id": "1", "username": "user1"},
-			{"id": "2", "username": "user2"},
-		},
-		Total:    2,
-		Page:     1,
-		PageSize: 20,
-		Pages:    1,
-	}
-
-	s.mockService.On("GetUserList", mock.Anything, mock.AnythingOfType("models.UserListQuery")).
-		Return(mockResponse, nil)
-
-	s.router.GET("/users", func(c *gin.Context) {
-		c.Set("currentUser", &models.JWTClaims{
-			UserID: "test-id",
-			Role:   models.RoleAdmin,
-		})
-		s.handler.GetUserList(c)
-	})
-
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("GET", "/users?page=1&page_size=10", nil)
+	s.createUser("user1", models.RoleDesigner)
+	s.createUser("user2", models.RoleDesigner)
+	s.router.GET("/users", s.handler.ListUsers)
 
-	s.router.ServeHTTP(w, httpReq)
+	w, response := s.serve("GET", "/users?page=1&page_size=10", nil)
 
 	assert.Equal(s.T(), http.StatusOK, w.Code)
-
-	var response APIResponse
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(s.T(), 200, response.Code)
+	assert.Equal(s.T(), float64(0), response["code"])
+	assert.Equal(s.T(), float64(2), response["data"].(map[string]interface{})["total"])
 }
 
 // TestUpdateUser_Success 测试更新用户
 func (s *UserHandlerTestSuite) TestUpdateUser_Success() {
-	reqBody := models.UpdateUserRequest{
-		DisplayName: "Updated Name",
-	}
-	body, _ := json.Marshal(reqBody)
-
-	mockUser := &models.User{
-		ID:          "test-id",
-		Username:    "testuser",
-		DisplayName: "Updated Name",
-		Email:       "test@example.com",
-		Role:        models.RoleDesigner,
-	}
-
-	s.mockService.On("UpdateUser", mock.Anything, "test-id", reqBody, true).Return(mockUser, nil)
+	user := s.createUser("testuser", models.RoleDesigner)
+	s.router.PUT("/users/:id", s.handler.UpdateUser)
 
-	s.router.PUT("/users/:id", func(c *gin.Context) {
-		c.Set("currentUser", &models.JWTClaims{
-			UserID: "test-id",
-			Role:   models.RoleAdmin,
-		})
-		s.handler.UpdateUser(c)
+	w, response := s.serve("PUT", "/users/"+user.ID.String(), map[string]interface{}{
+		"display_name": "Updated Name",
 	})
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("PUT", "/users/test-id", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), "Updated Name", response["data"].(map[string]interface{})["display_name"])
+}
 
-	s.router.ServeHTTP(w, httpReq)
+// TestUpdateUser_RejectsPassword 测试不能通过通用更新接口修改密码
+func (s *UserHandlerTestSuite) TestUpdateUser_RejectsPassword() {
+	user := s.createUser("testuser", models.RoleDesigner)
+	s.router.PUT("/users/:id", s.handler.UpdateUser)
 
-	assert.Equal(s.T(), http.StatusOK, w.Code)
+	w, _ := s.serve("PUT", "/users/"+user.ID.String(), map[string]interface{}{
+		"password": "NewPass456",
+	})
+
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	unchanged, err := s.userService.GetUserByID(context.Background(), user.ID.String())
+	require.NoError(s.T(), err)
+	assert.True(s.T(), unchanged.CheckPassword("TestPass123"))
 }
 
 // TestDeleteUser_Success 测试删除用户
 func (s *UserHandlerTestSuite) TestDeleteUser_Success() {
-	s.mockService.On("DeleteUser", mock.Anything, "test-id").Return(nil)
-
+	user := s.createUser("testuser", models.RoleDesigner)
 	s.router.DELETE("/users/:id", s.handler.DeleteUser)
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("DELETE", "/users/test-id", nil)
-
-	s.router.ServeHTTP(w, httpReq)
+	w, _ := s.serve("DELETE", "/users/"+user.ID.String(), nil)
 
 	assert.Equal(s.T(), http.StatusOK, w.Code)
+	deleted, err := s.userService.GetUserByID(context.Background(), user.ID.String())
+	require.NoError(s.T(), err)
+	assert.False(s.T(), deleted.IsActive)
 }
 
 // TestRefreshToken_Success 测试刷新令牌
 func (s *UserHandlerTestSuite) TestRefreshToken_Success() {
-	reqBody := map[string]string{
-		"refresh_token": "valid-refresh-token",
-	}
-	body, _ := json.Marshal(reqBody)
-
-	mockResponse := &models.RefreshTokenResponse{
-		AccessToken: "new-access-token",
-		ExpiresIn:   7200,
-		TokenType:   "Bearer",
-	}
-
-	s.mockService.On("RefreshAccessToken", mock.Anything, "valid-refresh-token").
-		Return(mockResponse, nil)
-
+	user := s.createUser("testuser", models.RoleDesigner)
+	tokens, err := s.userService.StartSession(context.Background(), user, "127.0.0.1", "test")
+	require.NoError(s.T(), err)
 	s.router.POST("/refresh", s.handler.RefreshToken)
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("POST", "/refresh", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	s.router.ServeHTTP(w, httpReq)
+	w, response := s.serve("POST", "/refresh", map[string]string{
+		"refresh_token": tokens.RefreshToken,
+	})
 
 	assert.Equal(s.T(), http.StatusOK, w.Code)
-
-	var response APIResponse
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(s.T(), 200, response.Code)
+	assert.Equal(s.T(), float64(0), response["code"])
+	assert.NotEmpty(s.T(), response["data"].(map[string]interface{})["access_token"])
 }
 
 // TestChangePassword_Success 测试修改密码
 func (s *UserHandlerTestSuite) TestChangePassword_Success() {
-	reqBody := map[string]string{
-		"old_password": "OldPass123",
-		"new_password": "NewPass456",
-	}
-	body, _ := json.Marshal(reqBody)
-
-	s.mockService.On("UpdatePassword", mock.Anything, "test-id", "OldPass123", "NewPass456").
-		Return(nil)
+	user := s.createUser("testuser", models.RoleDesigner)
+	s.router.PUT("/users/me/password", as(user.ID.String(), s.handler.ChangePassword))
 
-	s.router.PUT("/users/:id/password", func(c *gin.Context) {
-		c.Set("currentUser", &models.JWTClaims{
-			UserID: "test-id",
-			Role:   models.RoleDesigner,
-		})
-		s.handler.ChangePassword(c)
+	w, _ := s.serve("PUT", "/users/me/password", map[string]string{
+		"old_password": "TestPass123",
+		"new_password": "NewPass456",
 	})
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("PUT", "/users/test-id/password", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	s.router.ServeHTTP(w, httpReq)
-
 	assert.Equal(s.T(), http.StatusOK, w.Code)
+	changed, err := s.userService.GetUserByID(context.Background(), user.ID.String())
+	require.NoError(s.T(), err)
+	assert.True(s.T(), changed.CheckPassword("NewPass456"))
 }
 
-// TestGetCurrentUser_Success 测试获取当前用户
-func (s *UserHandlerTestSuite) TestGetCurrentUser_Success() {
-	mockUser := &models.User{
-		ID:          "test-id",
-		Username:    "testuser",
-		DisplayName: "Test User",
-		Email:       "test@example.com",
-		Role:        models.RoleDesigner,
-	}
-
-	s.mockService.On("GetUserByID", mock.Anything, "test-id").Return(mockUser, nil)
+// TestChangePassword_WrongOldPassword 测试旧密码错误时拒绝修改
+func (s *UserHandlerTestSuite) TestChangePassword_WrongOldPassword() {
+	user := s.createUser("testuser", models.RoleDesigner)
+	s.router.PUT("/users/me/password", as(user.ID.String(), s.handler.ChangePassword))
 
-	s.router.GET("/users/me", func(c *gin.Context) {
-		c.Set("currentUser", &models.JWTClaims{
-			UserID: "test-id",
-			Role:   models.RoleDesigner,
-		})
-		s.handler.GetCurrentUser(c)
+	w, _ := s.serve("PUT", "/users/me/password", map[string]string{
+		"old_password": "WrongPass",
+		"new_password": "NewPass456",
 	})
 
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("GET", "/users/me", nil)
-
-	s.router.ServeHTTP(w, httpReq)
-
-	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
 }
 
-// TestGetUserProfile_Success 测试获取用户Profile
-func (s *UserHandlerTestSuite) TestGetUserProfile_Success() {
-	mockUser := &models.User{
-		ID:          "test-id",
-		Username:    "testuser",
-		DisplayName: "Test User",
-		Email:       "test@example.com",
-		Role:        models.RoleDesigner,
-	}
-
-	mockStats := &models.UserStats{
-		TotalProjects:      10,
-		CompletedProjects:  8,
-		TotalContributions: 100,
-	}
-
-	s.mockService.On("GetUserByID", mock.Anything, "test-id").Return(mockUser, nil)
-	s.mockService.On("GetUserStats", mock.Anything, "test-id").Return(mockStats, nil)
-	s.mockService.On("GetUserContributions", mock.Anything, "test-id", 0).
-		Return([]models.UserContribution{}, nil)
-
-	s.router.GET("/users/:id/profile", s.handler.GetUserProfile)
-
-	w := httptest.NewRecorder()
-	httpReq, _ := http.NewRequest("GET", "/users/test-id/profile", nil)
+// TestGetCurrentUser_Success 测试获取当前用户
+func (s *UserHandlerTestSuite) TestGetCurrentUser_Success() {
+	user := s.createUser("testuser", models.RoleDesigner)
+	s.router.GET("/users/me", as(user.ID.String(), s.handler.CurrentUser))
 
-	s.router.ServeHTTP(w, httpReq)
+	w, response := s.serve("GET", "/users/me", nil)
 
 	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), user.ID.String(), response["data"].(map[string]interface{})["id"])
 }
 
-// TestSuccessResponse 测试成功响应
-func TestSuccessResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	SuccessResponse(c, map[string]string{"key": "value"})
-
-	assert.Equal(t, http.StatusOK, w.Code)
-
-	var response APIResponse
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, 200, response.Code)
-	assert.Equal(t, "success", response.Message)
-}
-
-// TestErrorResponse 测试错误响应
-func TestErrorResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	ErrorResponse(c, http.StatusBadRequest, 40001, "Bad request")
-
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response APIResponse
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(t, 40001, response.Code)
-	assert.Equal(t, "Bad request", response.Message)
-}
-
-// TestBadRequestResponse 测试400响应
-func TestBadRequestResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	BadRequestResponse(c, "Invalid input")
-
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-}
-
-// TestUnauthorizedResponse 测试401响应
-func TestUnauthorizedResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	UnauthorizedResponse(c, "Unauthorized")
-
-	assert.Equal(t, http.StatusUnauthorized, w.Code)
-}
-
-// TestForbiddenResponse 测试403响应
-func TestForbiddenResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
+// TestUpdateCurrentUser_IgnoresRole 测试修改个人资料时不能修改角色
+func (s *UserHandlerTestSuite) TestUpdateCurrentUser_IgnoresRole() {
+	user := s.createUser("testuser", models.RoleDesigner)
+	s.router.PUT("/users/me", as(user.ID.String(), s.handler.UpdateCurrentUser))
 
-	ForbiddenResponse(c, "Forbidden")
-
-	assert.Equal(t, http.StatusForbidden, w.Code)
-}
-
-// TestNotFoundResponse 测试404响应
-func TestNotFoundResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	NotFoundResponse(c, "Not found")
-
-	assert.Equal(t, http.StatusNotFound, w.Code)
-}
-
-// TestInternalServerErrorResponse 测试500响应
-func TestInternalServerErrorResponse(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	InternalServerErrorResponse(c, "Server error")
+	w, response := s.serve("PUT", "/users/me", map[string]interface{}{
+		"display_name": "Updated Name",
+		"role":         models.RoleAdmin,
+	})
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(s.T(), "Updated Name", data["display_name"])
+	assert.Equal(s.T(), models.RoleDesigner, data["role"])
 }
 
 // TestUserToResponse 测试用户响应转换
 func TestUserToResponse(t *testing.T) {
+	id := uuid.New()
+	email := "test@example.com"
 	user := &models.User{
-		ID:          "test-id",
+		ID:          id,
 		Username:    "testuser",
 		DisplayName: "Test User",
-		Email:       "test@example.com",
+		Email:       &email,
 		Role:        models.RoleDesigner,
 		Skills:      []string{"Go", "Python"},
 		IsActive:    true,
@@ -616,7 +329,7 @@ func TestUserToResponse(t *testing.T) {
 	}
 
 	response := user.ToResponse()
-	assert.Equal(t, "test-id", response["id"])
+	assert.Equal(t, id.String(), response["id"])
 	assert.Equal(t, "testuser", response["username"])
 	assert.Equal(t, models.RoleDesigner, response["role"])
 }
@@ -651,49 +364,12 @@ func TestMiddlewareGetCurrentUser(t *testing.T) {
 	assert.False(t, ok)
 
 	// 测试有用户的情况
-	claims := &models.JWTClaims{
-		UserID:   "test-id",
-		Username: "testuser",
-		Role:     models.RoleAdmin,
-	}
-	c.Set("currentUser", claims)
+	c.Set("user_id", "test-id")
+	c.Set("username", "testuser")
+	c.Set("role", models.RoleAdmin)
 
 	user, ok := middleware.GetCurrentUser(c)
 	assert.True(t, ok)
 	assert.Equal(t, "test-id", user.UserID)
-}
-
-// TestMiddlewareIsAdmin 测试中间件管理员检查
-func TestMiddlewareIsAdmin(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	// 没有用户
-	assert.False(t, middleware.IsAdmin(c))
-
-	// 管理员用户
-	c.Set("currentUser", &models.JWTClaims{Role: models.RoleAdmin})
-	assert.True(t, middleware.IsAdmin(c))
-
-	// 普通用户
-	c.Set("currentUser", &models.JWTClaims{Role: models.RoleDesigner})
-	assert.False(t, middleware.IsAdmin(c))
-}
-
-// TestMiddlewareGetUserID 测试中间件获取用户ID
-func TestMiddlewareGetUserID(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-
-	// 没有用户ID
-	_, ok := middleware.GetUserID(c)
-	assert.False(t, ok)
-
-	// 有用户ID
-	c.Set("userID", "test-id")
-	id, ok := middleware.GetUserID(c)
-	assert.True(t, ok)
-	assert.Equal(t, "test-id", id)
+	assert.Equal(t, models.RoleAdmin, user.Role)
 }
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"rdp-platform/rdp-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkflowHandler handles workflow HTTP requests
+type WorkflowHandler struct {
+	stateMachine *services.StateMachineService
+}
+
+// NewWorkflowHandler creates a new WorkflowHandler
+func NewWorkflowHandler(stateMachine *services.StateMachineService) *WorkflowHandler {
+	return &WorkflowHandler{
+		stateMachine: stateMachine,
+	}
+}
+
+// GetGraph handles GET /api/v1/workflows/:id/graph
+func (h *WorkflowHandler) GetGraph(c *gin.Context) {
+	graph, err := h.stateMachine.GetWorkflowGraph(c.Param("id"))
+	if err != nil {
+		respondWorkflowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    graph,
+	})
+}
+
+// respondWorkflowError maps a workflow error to a response
+func respondWorkflowError(c *gin.Context, err error) {
+	var cycle *services.DependencyCycleError
+	switch {
+	case errors.As(err, &cycle):
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    4090,
+			"message": err.Error(),
+			"data":    gin.H{"cycle": cycle.Path},
+		})
+	case errors.Is(err, services.ErrWorkflowNotFound), errors.Is(err, services.ErrActivityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    4040,
+			"message": err.Error(),
+			"data":    nil,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    5000,
+			"message": err.Error(),
+			"data":    nil,
+		})
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"rdp-platform/rdp-api/config"
+	"rdp-platform/rdp-api/middleware"
 	"rdp-platform/rdp-api/models"
 	"rdp-platform/rdp-api/routes"
 	"rdp-platform/rdp-api/services"
@@ -43,6 +44,58 @@ func main() {
 
 	// 初始化服务
 	userService := services.NewUserService(db, cfg.Auth)
+	projectService := services.NewProjectService(db)
+	fileService := services.NewFileService(db, cfg.Storage.BasePath)
+	oidcService := services.NewOIDCService(db, cfg.OIDC, userService)
+	directoryService := services.NewDirectorySyncService(db, cfg.LDAP)
+	permissionService, err := services.NewPermissionService(db, cfg.Permission)
+	if err != nil {
+		log.Fatalf("Failed to load permission policies: %v", err)
+	}
+	classificationService := services.NewClassificationService(db)
+	changeService := services.NewClassificationChangeService(db, permissionService)
+	exportService := services.NewExportService(db, cfg.Export, permissionService)
+	auditService := services.NewAuditService(db, cfg.Audit)
+	securityService := services.NewSecurityService(db)
+	stateMachine := services.NewStateMachineService(db)
+	activityService := services.NewActivityService(db)
+	approvalService := services.NewApprovalService(db)
+	qualityGateService := services.NewQualityGateService(db)
+	auditQueue := services.NewAuditQueue(db, cfg.Audit)
+	authMiddleware := middleware.NewAuthMiddleware(userService)
+
+	// 定期清理过期会话
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go userService.Sessions().RunCleanup(cleanupCtx)
+
+	// 定期推进等待滞后时间结束的活动
+	go activityService.RunLagCheck(cleanupCtx)
+
+	// 定期从LDAP同步组织与用户
+	go directoryService.RunSchedule(cleanupCtx)
+
+	// 定期重新加载权限策略（其他实例的修改）
+	go permissionService.RunPolicySync(cleanupCtx)
+
+	// 每日为审计日志哈希链写入签名检查点
+	go auditService.RunCheckpoints(cleanupCtx)
+
+	// 预建审计日志月分区，归档并移除超出保留期的分区
+	go auditService.RunPartitionMaintenance(cleanupCtx)
+
+	// 将审计与登录事件以syslog转发到SIEM
+	for _, sinkConfig := range cfg.SIEM.Sinks {
+		sink, err := services.NewSyslogSink(sinkConfig)
+		if err != nil {
+			log.Fatalf("Failed to configure SIEM sink %s: %v", sinkConfig.Name, err)
+		}
+		services.RegisterAuditSink(sink)
+		go sink.Run(cleanupCtx)
+	}
+
+	// 异步批量写入请求审计日志（关闭时排空）
+	go auditQueue.Run()
 
 	// 创建默认管理员（如果不存在）
 	if err := createDefaultAdmin(userService); err != nil {
@@ -53,15 +106,9 @@ func main() {
 	router := gin.New()
 
 	// 配置路由
-	routerManager := routes.NewRouter(router, userService)
+	routerManager := routes.NewRouter(router, userService, projectService, fileService, oidcService, directoryService, permissionService, classificationService, changeService, exportService, auditService, securityService, auditQueue, stateMachine, activityService, approvalService, qualityGateService, authMiddleware)
 	routerManager.SetupRoutes()
 
-	// 开发环境启用测试路由
-	if cfg.IsDevelopment() {
-		routerManager.SetupTestRoutes()
-		log.Println("Test routes enabled at /test/*")
-	}
-
 	// 创建HTTP服务器
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -84,6 +131,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopCleanup()
 
 	// 优雅关闭
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -93,6 +141,13 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// 写完队列中的审计日志，超时未写完的落盘待下次启动重放
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelDrain()
+	if err := auditQueue.Close(drainCtx); err != nil {
+		log.Printf("Audit queue not drained, remaining events spilled: %v", err)
+	}
+
 	// 关闭数据库连接
 	sqlDB, err := db.DB()
 	if err == nil {
@@ -134,8 +189,39 @@ func initDatabase(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 func autoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&models.User{},
+		&models.Organization{},
 		&models.Project{},
+		&models.ProjectFile{},
 		&models.TokenBlacklist{},
+		&models.RefreshToken{},
+		&models.LoginLog{},
+		&models.Session{},
+		&models.PasswordHistory{},
+		&models.PersonalAccessToken{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.OIDCLoginState{},
+		&models.CasbinRule{},
+		&models.ClassificationGrant{},
+		&models.ClassificationChange{},
+		&models.ClassificationApproval{},
+		&models.ExportRequest{},
+		&models.ExportApproval{},
+		&models.AuditLog{},
+		&models.AuditChainHead{},
+		&models.AuditCheckpoint{},
+		&models.AuditArchive{},
+		&models.Workflow{},
+		&models.Activity{},
+		&models.Deliverable{},
+		&models.Dependency{},
+		&models.ActivityTransition{},
+		&models.Approval{},
+		&models.ApprovalStep{},
+		&models.QualityGate{},
+		&models.QualityGateResult{},
+		&models.QualityGateWaiver{},
+		&models.WorkCalendar{},
 	)
 }
 
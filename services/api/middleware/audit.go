@@ -1,94 +1,84 @@
 package middleware
 
 import (
-	"bytes"
-	"io"
-	"net/http"
+	"strings"
 	"time"
 
-	"rdp/services/api/models"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // AuditMiddleware logs all API requests
 type AuditMiddleware struct {
-	securityService *services.SecurityService
+	queue *services.AuditQueue
 }
 
 // NewAuditMiddleware creates a new AuditMiddleware
-func NewAuditMiddleware(securityService *services.SecurityService) *AuditMiddleware {
+func NewAuditMiddleware(queue *services.AuditQueue) *AuditMiddleware {
 	return &AuditMiddleware{
-		securityService: securityService,
+		queue: queue,
 	}
 }
 
-// Audit logs HTTP requests
+// Audit logs HTTP requests. The event is built from the finished request
+// and handed to the audit queue, so nothing refers to the request once
+// the handler has returned. Request bodies are not recorded: they carry
+// passwords and tokens.
 func (m *AuditMiddleware) Audit() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip health check and metrics endpoints
-		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/metrics" {
+		path := c.Request.URL.Path
+		if path == "/health" || path == "/api/v1/health" || path == "/metrics" {
 			c.Next()
 			return
 		}
 
-		// Start time
-		startTime := time.Now()
-
-		// Read request body
-		var requestBody []byte
-		if c.Request.Body != nil {
-			requestBody, _ = io.ReadAll(c.Request.Body)
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-		}
+		occurredAt := time.Now().UTC()
 
 		// Process request
 		c.Next()
 
-		// Calculate duration
-		duration := time.Since(startTime)
-
 		// Get user info if authenticated
-		var userID *string
+		var userID *uuid.UUID
 		var username *string
-		if uid, exists := c.Get("user_id"); exists {
-			uidStr := uid.(string)
-			userID = &uidStr
+		if id, err := uuid.Parse(c.GetString("user_id")); err == nil {
+			userID = &id
 		}
-		if uname, exists := c.Get("username"); exists {
-			unameStr := uname.(string)
-			username = &unameStr
+		if name := c.GetString("username"); name != "" {
+			username = &name
 		}
 
-		// Determine classification based on resource
-		classification := m.determineClassification(c.Request.URL.Path)
-
-		// Create audit log
-		log := &models.AuditLog{
-			UserID:        nil, // Would need to parse UUID
-			Username:      username,
-			IPAddress:     m.getClientIP(c),
-			UserAgent:     &c.Request.UserAgent,
-			Action:        c.Request.Method,
-			Resource:      m.getResource(c.Request.URL.Path),
-			ResourceID:    m.getResourceID(c),
-			Method:        &c.Request.Method,
-			Path:          &c.Request.URL.Path,
-			ResponseCode:  &c.Writer.Status(),
-			Classification: classification,
+		var userAgent *string
+		if ua := c.Request.UserAgent(); ua != "" {
+			userAgent = &ua
 		}
+		method := c.Request.Method
+		status := c.Writer.Status()
 
-		if userID != "" && *userID != "" {
-			// userID would be parsed to UUID here
+		var errorMessage *string
+		if len(c.Errors) > 0 {
+			message := c.Errors.String()
+			errorMessage = &message
 		}
 
-		// Log asynchronously to not block request
-		go func() {
-			_ = m.securityService.CreateAuditLog(c.Request.Context(), log)
-		}()
-
-		_ = duration // Would be used for performance logging
+		m.queue.Enqueue(&models.AuditLog{
+			UserID:         userID,
+			Username:       username,
+			IPAddress:      m.getClientIP(c),
+			UserAgent:      userAgent,
+			Action:         method,
+			Resource:       m.getResource(path),
+			ResourceID:     m.getResourceID(c),
+			Method:         &method,
+			Path:           &path,
+			ResponseCode:   &status,
+			ErrorMessage:   errorMessage,
+			Classification: m.determineClassification(path),
+			OccurredAt:     &occurredAt,
+		})
 	}
 }
 
@@ -114,14 +104,9 @@ func (m *AuditMiddleware) determineClassification(path string) string {
 // getResource extracts the resource from the path
 func (m *AuditMiddleware) getResource(path string) string {
 	// Remove /api/v1/ prefix and get first segment
-	if len(path) > 9 && path[:9] == "/api/v1/" {
-		path = path[9:]
-	}
-	// Get first segment
-	for i, c := range path {
-		if c == '/' {
-			return path[:i]
-		}
+	path = strings.TrimPrefix(path, "/api/v1/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i]
 	}
 	return path
 }
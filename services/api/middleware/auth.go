@@ -1,30 +1,42 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware handles JWT authentication
+// AuthMiddleware handles JWT and personal access token authentication
 type AuthMiddleware struct {
 	userService *services.UserService
-	jwtSecret  string
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware
-func NewAuthMiddleware(userService *services.UserService, jwtSecret string) *AuthMiddleware {
+func NewAuthMiddleware(userService *services.UserService) *AuthMiddleware {
 	return &AuthMiddleware{
 		userService: userService,
-		jwtSecret:  jwtSecret,
 	}
 }
 
 // Authenticate validates JWT token and sets user context
 func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
+	return m.authenticate(m.userService.ValidateToken)
+}
+
+// AuthenticatePassive is Authenticate for endpoints that must not count as
+// session activity, such as polling the remaining session time
+func (m *AuthMiddleware) AuthenticatePassive() gin.HandlerFunc {
+	return m.authenticate(m.userService.ValidateTokenPassive)
+}
+
+// authenticate builds the authentication handler around a token validator
+func (m *AuthMiddleware) authenticate(validate func(context.Context, string) (*models.JWTClaims, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -52,41 +64,90 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 
 		token := parts[1]
 
-		// Validate token (simplified - in production use proper JWT library)
-		claims, err := m.validateToken(token)
+		claims, err := m.validateBearer(c.Request.Context(), token, validate)
 		if err != nil {
+			code, message := 4012, "invalid or expired token"
+			switch {
+			case errors.Is(err, services.ErrTokenBlacklisted):
+				message = "token has been revoked"
+			case errors.Is(err, services.ErrPersonalTokenInvalid),
+				errors.Is(err, services.ErrUserDisabled):
+				message = err.Error()
+			case errors.Is(err, services.ErrSessionIdleTimeout),
+				errors.Is(err, services.ErrSessionExpired),
+				errors.Is(err, services.ErrSessionRevoked),
+				errors.Is(err, services.ErrSessionNotFound):
+				code, message = 4015, err.Error()
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    4012,
-				"message": "invalid or expired token",
+				"code":    code,
+				"message": message,
+				"data":    nil,
+			})
+			c.Abort()
+			return
+		}
+
+		if !personalTokenAllows(claims, c.Request.Method) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    4035,
+				"message": "token scope does not permit this request",
 				"data":    nil,
 			})
 			c.Abort()
 			return
 		}
 
-		// Set user context
-		c.Set("user_id", claims["user_id"])
-		c.Set("username", claims["username"])
-		c.Set("role", claims["role"])
+		setUserContext(c, claims)
 
 		c.Next()
 	}
 }
 
-// validateToken validates JWT token and returns claims
-func (m *AuthMiddleware) validateToken(token string) (map[string]interface{}, error) {
-	// TODO: Implement proper JWT validation with jwt-go library
-	// This is a placeholder that needs to be replaced with actual JWT validation
-	
-	// For now, return a placeholder claims map
-	// In production: use jwt-go to parse and validate the token
-	claims := map[string]interface{}{
-		"user_id":  "placeholder",
-		"username": "placeholder",
-		"role":     "designer",
+// validateBearer validates a personal access token, or a JWT with validate
+func (m *AuthMiddleware) validateBearer(ctx context.Context, token string, validate func(context.Context, string) (*models.JWTClaims, error)) (*models.JWTClaims, error) {
+	if strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+		return m.userService.ValidatePersonalAccessToken(ctx, token)
+	}
+	return validate(ctx, token)
+}
+
+// personalTokenAllows checks a personal access token's scopes against the
+// request method; read-only tokens may only make safe requests
+func personalTokenAllows(claims *models.JWTClaims, method string) bool {
+	if claims.TokenType != models.TokenTypePersonal {
+		return true
 	}
 
-	return claims, nil
+	required := models.ScopeWrite
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		required = models.ScopeRead
+	}
+	for _, scope := range claims.Scopes {
+		if scope == required || scope == models.ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// setUserContext exposes the token claims to downstream handlers
+func setUserContext(c *gin.Context, claims *models.JWTClaims) {
+	c.Set("currentUser", claims)
+	c.Set("user_id", claims.UserID)
+	c.Set("userID", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("team", claims.Team)
+	c.Set("product_line", claims.ProductLine)
+	c.Set("session_id", claims.SessionID)
+	c.Set("token_type", claims.TokenType)
+
+	// Services read the actor from the request context for audit entries
+	ctx := context.WithValue(c.Request.Context(), "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "username", claims.Username)
+	c.Request = c.Request.WithContext(ctx)
 }
 
 // OptionalAuth authenticates if token is provided, otherwise continues without auth
@@ -105,15 +166,13 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		claims, err := m.validateToken(token)
-		if err != nil {
+		claims, err := m.validateBearer(c.Request.Context(), token, m.userService.ValidateToken)
+		if err != nil || !personalTokenAllows(claims, c.Request.Method) {
 			c.Next()
 			return
 		}
 
-		c.Set("user_id", claims["user_id"])
-		c.Set("username", claims["username"])
-		c.Set("role", claims["role"])
+		setUserContext(c, claims)
 
 		c.Next()
 	}
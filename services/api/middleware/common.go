@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -52,6 +53,17 @@ func SecurityHeaders() gin.HandlerFunc {
 	}
 }
 
+// ClientContext stores the client IP address and user agent on the request
+// context so services can attach them to audit and login records
+func ClientContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), "ip_address", c.ClientIP())
+		ctx = context.WithValue(ctx, "user_agent", c.Request.UserAgent())
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
 // RequestLogger returns a middleware that logs HTTP requests
 func RequestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -3,23 +3,68 @@ package middleware
 import (
 	"net/http"
 
-	"github.com/casbin/casbin/v2"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+
 	"github.com/gin-gonic/gin"
 )
 
+// permissionDomainKey holds the casbin domain of the current request
+const permissionDomainKey = "permission_domain"
+
 // RBACMiddleware handles role-based access control
 type RBACMiddleware struct {
-	enforcer *casbin.Enforcer
+	permissions *services.PermissionService
 }
 
 // NewRBACMiddleware creates a new RBACMiddleware
-func NewRBACMiddleware(enforcer *casbin.Enforcer) *RBACMiddleware {
+func NewRBACMiddleware(permissions *services.PermissionService) *RBACMiddleware {
 	return &RBACMiddleware{
-		enforcer: enforcer,
+		permissions: permissions,
+	}
+}
+
+// ProjectScope checks permissions of the routes below it inside the
+// domain of the project named by the URL parameter
+func (m *RBACMiddleware) ProjectScope(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(permissionDomainKey, models.ProjectDomain(c.Param(param)))
+		c.Next()
+	}
+}
+
+// ProjectScopeOf checks permissions of the routes below it inside the
+// domain of the project owning the resource named by the URL parameter
+func (m *RBACMiddleware) ProjectScopeOf(param string, projectOf func(id string) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, err := projectOf(c.Param(param))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    4040,
+				"message": err.Error(),
+				"data":    nil,
+			})
+			c.Abort()
+			return
+		}
+		c.Set(permissionDomainKey, models.ProjectDomain(projectID))
+		c.Next()
 	}
 }
 
-// RequirePermission checks if user has the required permission
+// SelfScope checks permissions in the self domain when the user named by
+// the URL parameter is the caller
+func (m *RBACMiddleware) SelfScope(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param(param) == c.GetString("user_id") {
+			c.Set(permissionDomainKey, models.DomainSelf)
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission checks if user has the required permission in the
+// request's domain
 func (m *RBACMiddleware) RequirePermission(object, action string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user role from context (set by AuthMiddleware)
@@ -34,8 +79,13 @@ func (m *RBACMiddleware) RequirePermission(object, action string) gin.HandlerFun
 			return
 		}
 
+		domain := c.GetString(permissionDomainKey)
+		if domain == "" {
+			domain = models.DomainAll
+		}
+
 		// Check permission using Casbin
-		allowed, err := m.enforcer.Enforce(role, object, action)
+		allowed, err := m.permissions.Enforce(c.Request.Context(), c.GetString("user_id"), role.(string), domain, object, action)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    5000,
@@ -50,10 +100,11 @@ func (m *RBACMiddleware) RequirePermission(object, action string) gin.HandlerFun
 			c.JSON(http.StatusForbidden, gin.H{
 				"code":    4031,
 				"message": "access denied: insufficient permissions",
-				"data":    gin.H{
+				"data": gin.H{
 					"required": gin.H{
 						"object": object,
 						"action": action,
+						"domain": domain,
 					},
 				},
 			})
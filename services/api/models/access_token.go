@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token so it can be
+// told apart from a JWT
+const PersonalAccessTokenPrefix = "rdp_pat_"
+
+// Personal access token scopes
+const (
+	// ScopeRead allows GET, HEAD and OPTIONS requests only
+	ScopeRead = "read"
+	// ScopeWrite allows every request the owner may make
+	ScopeWrite = "write"
+)
+
+// IsValidTokenScope checks if the scope is a known token scope
+func IsValidTokenScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite
+}
+
+// PersonalTokenPolicy limits personal access tokens
+type PersonalTokenPolicy struct {
+	MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+	MaxPerUser  int           `mapstructure:"max_per_user"`
+}
+
+// PersonalAccessToken is a named, scoped, expiring token for non-interactive
+// clients. Only the SHA-256 hash of the token is stored; Hint keeps its last
+// characters so users can tell their tokens apart.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;index;not null"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash  string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Hint       string     `json:"hint" gorm:"type:varchar(8)"`
+	Scopes     []string   `json:"scopes" gorm:"type:jsonb;serializer:json"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip" gorm:"type:varchar(50)"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	RevokedBy  *uuid.UUID `json:"revoked_by" gorm:"type:uuid"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// BeforeCreate generates UUID before insert
+func (t *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive checks if the token is neither revoked nor expired
+func (t *PersonalAccessToken) IsActive() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// CreatePersonalAccessTokenRequest represents the request body for
+// POST /users/me/tokens
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"required,min=1"`
+}
+
+// CreatePersonalAccessTokenResponse carries the plaintext token, which is
+// shown only once
+type CreatePersonalAccessTokenResponse struct {
+	*PersonalAccessToken
+	Token string `json:"token"`
+}
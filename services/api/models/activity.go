@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/oklog/ulid/v2"
@@ -37,7 +39,7 @@ const (
 type Activity struct {
 	ID           string         `json:"id" gorm:"primaryKey;type:char(26)"`
 	WorkflowID   string         `json:"workflow_id" gorm:"index;not null;type:char(26)"`
-	ProjectID    string         `json:"project_id" gorm:"index;not null;type:char(26)"`
+	ProjectID    string         `json:"project_id" gorm:"index;not null;type:varchar(36)"`
 	ParentID     *string        `json:"parent_id" gorm:"index;type:char(26)"`
 	Name         string         `json:"name" gorm:"not null;size:200"`
 	Description  string         `json:"description" gorm:"type:text"`
@@ -45,7 +47,7 @@ type Activity struct {
 	Status       ActivityStatus `json:"status" gorm:"not null;default:'pending'"`
 	Sequence     int            `json:"sequence" gorm:"default:0"`
 	Priority     int            `json:"priority" gorm:"default:0"`
-	AssigneeID   *string        `json:"assignee_id" gorm:"type:char(26)"`
+	AssigneeID   *string        `json:"assignee_id" gorm:"type:varchar(36)"`
 	PlannedStart *time.Time     `json:"planned_start"`
 	PlannedEnd   *time.Time     `json:"planned_end"`
 	ActualStart  *time.Time     `json:"actual_start"`
@@ -56,7 +58,12 @@ type Activity struct {
 	Reviews      []Review       `json:"reviews,omitempty" gorm:"foreignKey:ActivityID"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
-	CreatedBy    string         `json:"created_by" gorm:"type:char(26)"`
+	CreatedBy    string         `json:"created_by" gorm:"type:varchar(36)"`
+
+	// Process template the activity was instantiated from
+	TemplateActivityID string          `json:"template_activity_id,omitempty" gorm:"size:50"`
+	RequireReview      bool            `json:"require_review" gorm:"default:false"`
+	ApprovalPolicy     *ApprovalPolicy `json:"approval_policy,omitempty" gorm:"type:jsonb;serializer:json"`
 
 	// Relations
 	Workflow *Workflow `json:"workflow,omitempty" gorm:"foreignKey:WorkflowID"`
@@ -106,6 +113,131 @@ func (a *Activity) Complete() {
 	a.Progress = 100
 }
 
+// CanTransitionTo checks if the activity can transition to the target
+// status; guards and actors are checked by the activity service
+func (a *Activity) CanTransitionTo(target ActivityStatus) error {
+	if a.Status == target {
+		return errors.New("activity is already in the target status")
+	}
+	if FindActivityTransition(a.Status, target) == nil {
+		return fmt.Errorf("activity cannot transition from %s to %s", a.Status, target)
+	}
+	return nil
+}
+
+// EffectiveApprovalPolicy returns the approval policy of the activity. Dcp
+// and approval activities without one get DefaultApprovalPolicy; other
+// activities need no approval.
+func (a *Activity) EffectiveApprovalPolicy() *ApprovalPolicy {
+	if a.ApprovalPolicy != nil {
+		return a.ApprovalPolicy
+	}
+	if a.Type == ActivityTypeDCP || a.Type == ActivityTypeApproval {
+		policy := DefaultApprovalPolicy
+		return &policy
+	}
+	return nil
+}
+
+// ActivityActor is who may perform an activity transition
+type ActivityActor string
+
+const (
+	// ActivityActorSystem is the workflow engine
+	ActivityActorSystem ActivityActor = "system"
+	// ActivityActorAssignee is the assignee, any project member while the
+	// activity is unassigned, or a project manager
+	ActivityActorAssignee ActivityActor = "assignee"
+	// ActivityActorManager is the project leader, tech leader or a manager
+	ActivityActorManager ActivityActor = "manager"
+)
+
+// ActivityGuard is a precondition of an activity transition
+type ActivityGuard string
+
+const (
+	ActivityGuardStartDependencies  ActivityGuard = "start_dependencies_met"
+	ActivityGuardFinishDependencies ActivityGuard = "finish_dependencies_met"
+	ActivityGuardDeliverables       ActivityGuard = "deliverables_submitted"
+	ActivityGuardApproval           ActivityGuard = "approval_passed"
+	// ActivityGuardQualityGates needs the quality gates of a DCP passed or
+	// waived
+	ActivityGuardQualityGates ActivityGuard = "quality_gates_passed"
+)
+
+// ActivityTransitionRule allows an activity to move between two statuses
+type ActivityTransitionRule struct {
+	From   ActivityStatus
+	To     ActivityStatus
+	Actor  ActivityActor
+	Guards []ActivityGuard
+}
+
+// ActivityTransitions is the activity state machine
+var ActivityTransitions = []ActivityTransitionRule{
+	// Kept up to date by the workflow engine as predecessors change
+	{ActivityStatusPending, ActivityStatusReady, ActivityActorSystem, []ActivityGuard{ActivityGuardStartDependencies}},
+	{ActivityStatusBlocked, ActivityStatusReady, ActivityActorSystem, []ActivityGuard{ActivityGuardStartDependencies}},
+	{ActivityStatusReady, ActivityStatusPending, ActivityActorSystem, nil},
+	{ActivityStatusBlocked, ActivityStatusPending, ActivityActorSystem, nil},
+	{ActivityStatusPending, ActivityStatusBlocked, ActivityActorSystem, nil},
+	{ActivityStatusReady, ActivityStatusBlocked, ActivityActorSystem, nil},
+
+	// Work
+	{ActivityStatusReady, ActivityStatusRunning, ActivityActorAssignee, []ActivityGuard{ActivityGuardStartDependencies}},
+	{ActivityStatusPending, ActivityStatusRunning, ActivityActorAssignee, []ActivityGuard{ActivityGuardStartDependencies}},
+	{ActivityStatusRunning, ActivityStatusCompleted, ActivityActorAssignee, []ActivityGuard{ActivityGuardFinishDependencies, ActivityGuardDeliverables, ActivityGuardQualityGates}},
+	{ActivityStatusRejected, ActivityStatusRunning, ActivityActorAssignee, nil},
+
+	// Review
+	{ActivityStatusRunning, ActivityStatusReviewing, ActivityActorAssignee, []ActivityGuard{ActivityGuardFinishDependencies, ActivityGuardDeliverables, ActivityGuardQualityGates}},
+	{ActivityStatusCompleted, ActivityStatusReviewing, ActivityActorAssignee, []ActivityGuard{ActivityGuardQualityGates}},
+	{ActivityStatusReviewing, ActivityStatusApproved, ActivityActorManager, []ActivityGuard{ActivityGuardApproval}},
+	{ActivityStatusReviewing, ActivityStatusRejected, ActivityActorManager, nil},
+	// Sent back for rework when an approval is rejected
+	{ActivityStatusReviewing, ActivityStatusRunning, ActivityActorManager, nil},
+
+	// Activities not needed in this project
+	{ActivityStatusPending, ActivityStatusSkipped, ActivityActorManager, nil},
+	{ActivityStatusReady, ActivityStatusSkipped, ActivityActorManager, nil},
+	{ActivityStatusBlocked, ActivityStatusSkipped, ActivityActorManager, nil},
+}
+
+// FindActivityTransition returns the rule allowing a status change, or nil
+func FindActivityTransition(from, to ActivityStatus) *ActivityTransitionRule {
+	for i := range ActivityTransitions {
+		if ActivityTransitions[i].From == from && ActivityTransitions[i].To == to {
+			return &ActivityTransitions[i]
+		}
+	}
+	return nil
+}
+
+// ActivityTransition records a change of an activity's status
+type ActivityTransition struct {
+	ID         string         `json:"id" gorm:"primaryKey;type:char(26)"`
+	ActivityID string         `json:"activity_id" gorm:"index;not null;type:char(26)"`
+	FromStatus ActivityStatus `json:"from_status" gorm:"not null;size:20"`
+	ToStatus   ActivityStatus `json:"to_status" gorm:"not null;size:20"`
+	// ActorID is empty for changes made by the workflow engine
+	ActorID   string    `json:"actor_id" gorm:"type:varchar(36)"`
+	Comment   string    `json:"comment" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the model
+func (ActivityTransition) TableName() string {
+	return "activity_transitions"
+}
+
+// BeforeCreate generates ULID before insert
+func (t *ActivityTransition) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = ulid.Make().String()
+	}
+	return nil
+}
+
 // Deliverable represents a deliverable item for an activity
 type Deliverable struct {
 	ID          string    `json:"id" gorm:"primaryKey;type:char(26)"`
@@ -134,12 +266,15 @@ func (d *Deliverable) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// Dependency represents an activity dependency
+// Dependency represents an activity dependency: DependsOnID is the
+// predecessor and ActivityID the successor
 type Dependency struct {
 	ID             string `json:"id" gorm:"primaryKey;type:char(26)"`
 	ActivityID     string `json:"activity_id" gorm:"index;not null;type:char(26)"`
 	DependsOnID    string `json:"depends_on_id" gorm:"index;not null;type:char(26)"`
 	DependencyType string `json:"dependency_type" gorm:"default:'finish_to_start';size:50"`
+	// Lag in days after the predecessor's start or finish; negative is a lead
+	Lag int `json:"lag" gorm:"default:0"`
 }
 
 // TableName returns the table name for the model
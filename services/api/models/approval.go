@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// ApprovalStatus represents the status of an approval or one of its steps
+type ApprovalStatus string
+
+const (
+	ApprovalStatusPending  ApprovalStatus = "pending"
+	ApprovalStatusApproved ApprovalStatus = "approved"
+	ApprovalStatusRejected ApprovalStatus = "rejected"
+	// ApprovalStatusSkipped marks parallel steps left open once a quorum
+	// decided the approval
+	ApprovalStatusSkipped ApprovalStatus = "skipped"
+)
+
+// DefaultApprovalPolicy applies to dcp and approval activities that were
+// not given a policy: the tech leader, then the project leader
+var DefaultApprovalPolicy = ApprovalPolicy{
+	Mode:  ApprovalModeSerial,
+	Roles: []string{ApprovalRoleTechLeader, ApprovalRoleLeader},
+}
+
+// Approval is a request to approve an activity, e.g. a DCP, by the
+// approvers its policy resolves to
+type Approval struct {
+	ID          string         `json:"id" gorm:"primaryKey;type:char(26)"`
+	ActivityID  string         `json:"activity_id" gorm:"index;not null;type:char(26)"`
+	ProjectID   string         `json:"project_id" gorm:"index;not null;type:varchar(36)"`
+	Mode        string         `json:"mode" gorm:"not null;size:20"`
+	Quorum      int            `json:"quorum"`
+	Status      ApprovalStatus `json:"status" gorm:"not null;default:'pending';size:20;index"`
+	CurrentStep int            `json:"current_step" gorm:"default:0"`
+	Comment     string         `json:"comment" gorm:"type:text"`
+	RequestedBy string         `json:"requested_by" gorm:"type:varchar(36)"`
+	DecidedAt   *time.Time     `json:"decided_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+
+	// Relations
+	Activity *Activity      `json:"activity,omitempty" gorm:"foreignKey:ActivityID"`
+	Steps    []ApprovalStep `json:"steps,omitempty" gorm:"foreignKey:ApprovalID"`
+}
+
+// TableName returns the table name for the model
+func (Approval) TableName() string {
+	return "approvals"
+}
+
+// BeforeCreate generates ULID before insert
+func (a *Approval) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = ulid.Make().String()
+	}
+	return nil
+}
+
+// IsPending checks if the approval still awaits decisions
+func (a *Approval) IsPending() bool {
+	return a.Status == ApprovalStatusPending
+}
+
+// Required returns the number of approvals that decide the approval
+func (a *Approval) Required() int {
+	if a.Mode == ApprovalModeParallel && a.Quorum > 0 && a.Quorum < len(a.Steps) {
+		return a.Quorum
+	}
+	return len(a.Steps)
+}
+
+// IsActive checks if the step can be decided now: every open step of a
+// parallel approval, but only the current one of a serial approval
+func (a *Approval) IsActive(step *ApprovalStep) bool {
+	if !a.IsPending() || step.Status != ApprovalStatusPending {
+		return false
+	}
+	return a.Mode == ApprovalModeParallel || step.Sequence == a.CurrentStep
+}
+
+// ApprovalStep is one approver's part in an approval
+type ApprovalStep struct {
+	ID         string         `json:"id" gorm:"primaryKey;type:char(26)"`
+	ApprovalID string         `json:"approval_id" gorm:"index;not null;type:char(26)"`
+	Sequence   int            `json:"sequence" gorm:"not null"`
+	Role       string         `json:"role" gorm:"not null;size:50"`
+	ApproverID string         `json:"approver_id" gorm:"index;not null;type:varchar(36)"`
+	Status     ApprovalStatus `json:"status" gorm:"not null;default:'pending';size:20"`
+	Comment    string         `json:"comment" gorm:"type:text"`
+	DecidedAt  *time.Time     `json:"decided_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// TableName returns the table name for the model
+func (ApprovalStep) TableName() string {
+	return "approval_steps"
+}
+
+// BeforeCreate generates ULID before insert
+func (s *ApprovalStep) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = ulid.Make().String()
+	}
+	return nil
+}
+
+// ApprovalDecisionRequest represents the request body for submitting,
+// approving or rejecting an approval
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment"`
+}
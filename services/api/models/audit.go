@@ -0,0 +1,195 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditConfig configures the tamper-evident audit log
+type AuditConfig struct {
+	// CheckpointKey signs the daily checkpoints of the hash chain
+	CheckpointKey string `mapstructure:"checkpoint_key"`
+	// CheckpointInterval is how often completed days are checkpointed
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+
+	// QueueSize bounds the request events waiting to be written
+	QueueSize int `mapstructure:"queue_size"`
+	// BatchSize is how many events are inserted at once
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval is the longest a partial batch waits
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// EnqueueTimeout is how long a request waits for room in a full queue
+	// before its event is spilled to disk
+	EnqueueTimeout time.Duration `mapstructure:"enqueue_timeout"`
+	// DelayThreshold is how late an event may be written before it counts
+	// as delayed
+	DelayThreshold time.Duration `mapstructure:"delay_threshold"`
+	// SpillDir keeps events that could not be written to the database
+	SpillDir string `mapstructure:"spill_dir"`
+
+	// RetentionMonths is how many monthly partitions stay in the database
+	// before they are archived
+	RetentionMonths int `mapstructure:"retention_months"`
+	// PartitionsAhead is how many future monthly partitions are created
+	PartitionsAhead int `mapstructure:"partitions_ahead"`
+	// ArchiveDir receives the compressed partitions and their manifests
+	ArchiveDir string `mapstructure:"archive_dir"`
+	// PartitionInterval is how often partitions are maintained
+	PartitionInterval time.Duration `mapstructure:"partition_interval"`
+}
+
+// Audit event severities (SRS-SECURITY-003)
+const (
+	AuditSeverityInfo = "INFO"
+	AuditSeverityWarn = "WARN"
+)
+
+// AuditChange is a field's value before and after an operation; nil
+// means the field did not exist or was cleared
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditDetails is the payload of a semantic audit event: field-level
+// changes to the resource and the context needed to read them, such as
+// the approvers or the export request
+type AuditDetails struct {
+	Changes map[string]AuditChange `json:"changes,omitempty"`
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// Change records a field's values before and after the operation
+func (d *AuditDetails) Change(field string, before, after interface{}) *AuditDetails {
+	if d.Changes == nil {
+		d.Changes = make(map[string]AuditChange)
+	}
+	d.Changes[field] = AuditChange{Before: before, After: after}
+	return d
+}
+
+// With adds a context value
+func (d *AuditDetails) With(key string, value interface{}) *AuditDetails {
+	if d.Context == nil {
+		d.Context = make(map[string]interface{})
+	}
+	d.Context[key] = value
+	return d
+}
+
+// AuditChainHead is the last link of the audit hash chain. Its row is
+// locked while entries are appended so every instance extends the same
+// chain.
+type AuditChainHead struct {
+	ID        string    `json:"id" gorm:"type:varchar(50);primaryKey"`
+	Sequence  int64     `json:"sequence" gorm:"not null;default:0"`
+	Hash      string    `json:"hash" gorm:"type:varchar(64)"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (AuditChainHead) TableName() string {
+	return "audit_chain_heads"
+}
+
+// AuditCheckpoint seals the chain at the end of a day (UTC). Each
+// checkpoint signs the last entry of its day together with the previous
+// checkpoint's signature, so truncating the log or rewriting the chain
+// from scratch is detected.
+type AuditCheckpoint struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	Day           string    `json:"day" gorm:"type:varchar(10);not null;uniqueIndex"`
+	Sequence      int64     `json:"sequence" gorm:"not null"`
+	Hash          string    `json:"hash" gorm:"type:varchar(64)"`
+	PrevSignature string    `json:"prev_signature" gorm:"type:varchar(64)"`
+	Signature     string    `json:"signature" gorm:"type:varchar(64);not null"`
+	CreatedAt     time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (AuditCheckpoint) TableName() string {
+	return "audit_checkpoints"
+}
+
+// BeforeCreate generates UUID before insert
+func (c *AuditCheckpoint) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// AuditArchive records a monthly partition moved out of the database. It
+// doubles as the manifest written next to the archive: the SHA-256 of the
+// compressed file and the chain positions it covers, signed with the
+// checkpoint key, so the archive can be checked and the chain still
+// verified across the gap.
+type AuditArchive struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	Partition     string    `json:"partition" gorm:"type:varchar(50);not null;uniqueIndex"`
+	From          time.Time `json:"from" gorm:"column:from_time;not null"`
+	To            time.Time `json:"to" gorm:"column:to_time;not null"`
+	Rows          int64     `json:"rows" gorm:"not null"`
+	FirstSequence int64     `json:"first_sequence" gorm:"index"`
+	LastSequence  int64     `json:"last_sequence" gorm:"index"`
+	LastHash      string    `json:"last_hash" gorm:"type:varchar(64)"`
+	File          string    `json:"file" gorm:"type:varchar(500);not null"`
+	SHA256        string    `json:"sha256" gorm:"column:sha256;type:varchar(64);not null"`
+	Signature     string    `json:"signature" gorm:"type:varchar(64);not null"`
+	ArchivedAt    time.Time `json:"archived_at"`
+}
+
+// TableName specifies the table name
+func (AuditArchive) TableName() string {
+	return "audit_archives"
+}
+
+// BeforeCreate generates UUID before insert
+func (a *AuditArchive) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// AuditPartitionReport is the result of a partition maintenance run
+type AuditPartitionReport struct {
+	Created  []string `json:"created"`
+	Archived []string `json:"archived"`
+}
+
+// AuditChainBreak is where verification found the chain broken
+type AuditChainBreak struct {
+	Sequence int64      `json:"sequence"`
+	LogID    *uuid.UUID `json:"log_id,omitempty"`
+	Reason   string     `json:"reason"`
+}
+
+// AuditVerification is the result of recomputing the chain over a period
+type AuditVerification struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Valid       bool             `json:"valid"`
+	Checked     int64            `json:"checked"`
+	Checkpoints int              `json:"checkpoints"`
+	FirstBroken *AuditChainBreak `json:"first_broken,omitempty"`
+}
+
+// AuditQueueMetrics reports the asynchronous audit pipeline. Counters are
+// totals since start; an event can be spilled and later replayed.
+type AuditQueueMetrics struct {
+	Enqueued      uint64     `json:"enqueued"`
+	Written       uint64     `json:"written"`
+	Spilled       uint64     `json:"spilled"`
+	Replayed      uint64     `json:"replayed"`
+	Dropped       uint64     `json:"dropped"`
+	Delayed       uint64     `json:"delayed"`
+	MaxDelayMS    int64      `json:"max_delay_ms"`
+	QueueDepth    int        `json:"queue_depth"`
+	QueueCapacity int        `json:"queue_capacity"`
+	SpillFiles    int        `json:"spill_files"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastFlushAt   *time.Time `json:"last_flush_at,omitempty"`
+}
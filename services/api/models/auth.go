@@ -0,0 +1,212 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Token types carried in JWTClaims.TokenType
+const (
+	TokenTypeAccess   = "access"
+	TokenTypeRefresh  = "refresh"
+	TokenTypePersonal = "personal"
+	// MFA challenge tokens only allow completing the second login step
+	TokenTypeMFAChallenge  = "mfa_challenge"
+	TokenTypeMFAEnrollment = "mfa_enrollment"
+)
+
+// BlacklistTypeFamily marks a TokenBlacklist entry that revokes a whole
+// refresh token family; its JTI column holds the family ID
+const BlacklistTypeFamily = "family"
+
+// AuthConfig holds JWT issuance settings
+type AuthConfig struct {
+	JWTSecret       string        `mapstructure:"jwt_secret"`
+	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl"`
+	Issuer          string        `mapstructure:"issuer"`
+	Audience        string        `mapstructure:"audience"`
+	// RevocationSyncInterval controls how often the in-process revocation
+	// cache reloads the blacklist; zero reloads on every check
+	RevocationSyncInterval time.Duration       `mapstructure:"revocation_sync_interval"`
+	Session                SessionPolicy       `mapstructure:"session"`
+	Password               PasswordPolicy      `mapstructure:"password"`
+	Lockout                LockoutPolicy       `mapstructure:"lockout"`
+	PersonalTokens         PersonalTokenPolicy `mapstructure:"personal_tokens"`
+	MFA                    MFAPolicy           `mapstructure:"mfa"`
+}
+
+// PasswordPolicy holds password complexity and reuse rules
+type PasswordPolicy struct {
+	MinLength      int  `mapstructure:"min_length"`
+	RequireUpper   bool `mapstructure:"require_upper"`
+	RequireLower   bool `mapstructure:"require_lower"`
+	RequireDigit   bool `mapstructure:"require_digit"`
+	RequireSpecial bool `mapstructure:"require_special"`
+	// HistorySize is how many recent passwords, including the current one,
+	// may not be reused
+	HistorySize int `mapstructure:"history_size"`
+}
+
+// LockoutPolicy locks an account after MaxFailedAttempts failed logins
+// inside Window, for Cooldown
+type LockoutPolicy struct {
+	MaxFailedAttempts int           `mapstructure:"max_failed_attempts"`
+	Window            time.Duration `mapstructure:"window"`
+	Cooldown          time.Duration `mapstructure:"cooldown"`
+}
+
+// SessionPolicy holds the session limits from SRS-SECURITY-002
+type SessionPolicy struct {
+	IdleTimeout      time.Duration `mapstructure:"idle_timeout"`
+	AbsoluteLifetime time.Duration `mapstructure:"absolute_lifetime"`
+	MaxConcurrent    int           `mapstructure:"max_concurrent"`
+	CleanupInterval  time.Duration `mapstructure:"cleanup_interval"`
+}
+
+// JWTClaims represents the claims embedded in access and refresh tokens
+type JWTClaims struct {
+	UserID      string `json:"user_id"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	Team        string `json:"team,omitempty"`
+	ProductLine string `json:"product_line,omitempty"`
+	TokenType   string `json:"token_type"`
+	FamilyID    string `json:"fid,omitempty"`
+	SessionID   string `json:"sid"`
+	// Scopes is only set for personal access tokens
+	Scopes []string `json:"scp,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// LoginRequest represents the request body for POST /auth/login
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse represents a freshly issued token pair
+type LoginResponse struct {
+	AccessToken  string                 `json:"access_token"`
+	RefreshToken string                 `json:"refresh_token"`
+	ExpiresIn    int                    `json:"expires_in"`
+	TokenType    string                 `json:"token_type"`
+	User         map[string]interface{} `json:"user"`
+}
+
+// SessionInfo reports the remaining lifetime of the current session
+type SessionInfo struct {
+	SessionID             string    `json:"session_id"`
+	CreatedAt             time.Time `json:"created_at"`
+	LastActiveAt          time.Time `json:"last_active_at"`
+	IdleExpiresAt         time.Time `json:"idle_expires_at"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	IdleRemainingSeconds  int       `json:"idle_remaining_seconds"`
+	TotalRemainingSeconds int       `json:"total_remaining_seconds"`
+	RemainingSeconds      int       `json:"remaining_seconds"`
+}
+
+// ChangePasswordRequest represents the request body for changing a password.
+// Username is only read by POST /auth/change-password, which lets users whose
+// password must be changed do so before they can log in.
+type ChangePasswordRequest struct {
+	Username    string `json:"username,omitempty"`
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ForcePasswordResetRequest represents the request body for an admin forced
+// password reset; without a temporary password the user keeps the current
+// one but must change it at next login
+type ForcePasswordResetRequest struct {
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+// RefreshTokenRequest represents the request body for POST /auth/refresh
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshTokenResponse represents the result of a token refresh
+type RefreshTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// TokenBlacklist records tokens revoked before their natural expiry
+type TokenBlacklist struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	JTI       string     `json:"jti" gorm:"type:varchar(64);uniqueIndex;not null"`
+	UserID    *uuid.UUID `json:"user_id" gorm:"type:uuid;index"`
+	TokenType string     `json:"token_type" gorm:"type:varchar(20);not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (TokenBlacklist) TableName() string {
+	return "token_blacklists"
+}
+
+// BeforeCreate generates UUID before insert
+func (b *TokenBlacklist) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// RefreshToken tracks an issued refresh token. Tokens issued from one login
+// share a FamilyID; each refresh marks the presented token used and issues
+// its replacement, so a second use of the same token signals theft.
+type RefreshToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	JTI        string     `json:"jti" gorm:"type:varchar(64);uniqueIndex;not null"`
+	FamilyID   string     `json:"family_id" gorm:"type:varchar(64);index;not null"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;index;not null"`
+	ParentJTI  *string    `json:"parent_jti" gorm:"type:varchar(64)"`
+	ReplacedBy *string    `json:"replaced_by" gorm:"type:varchar(64)"`
+	UsedAt     *time.Time `json:"used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null;index"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// BeforeCreate generates UUID before insert
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// PasswordHistory keeps previous password hashes to prevent reuse
+type PasswordHistory struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	UserID       uuid.UUID `json:"user_id" gorm:"type:uuid;index;not null"`
+	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (PasswordHistory) TableName() string {
+	return "password_histories"
+}
+
+// BeforeCreate generates UUID before insert
+func (h *PasswordHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
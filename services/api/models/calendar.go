@@ -0,0 +1,65 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// CalendarDateLayout is the format of holiday and working day dates
+const CalendarDateLayout = "2006-01-02"
+
+// DefaultWorkingWeekdays are the working days of a project without a
+// calendar
+var DefaultWorkingWeekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// WorkCalendar sets the working days of a project. Rescheduling counts
+// lags and durations in working days.
+type WorkCalendar struct {
+	ID        string `json:"id" gorm:"primaryKey;type:char(26)"`
+	ProjectID string `json:"project_id" gorm:"uniqueIndex;not null;type:varchar(36)"`
+	// Weekdays are the working days of the week, 0 being Sunday
+	Weekdays []time.Weekday `json:"weekdays" gorm:"type:jsonb;serializer:json;not null"`
+	// Holidays are days off on a working weekday; Workdays are working
+	// days on a weekday off, such as those made up for a holiday
+	Holidays  []string  `json:"holidays" gorm:"type:jsonb;serializer:json"`
+	Workdays  []string  `json:"workdays" gorm:"type:jsonb;serializer:json"`
+	UpdatedBy string    `json:"updated_by" gorm:"type:varchar(36)"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the model
+func (WorkCalendar) TableName() string {
+	return "work_calendars"
+}
+
+// BeforeCreate generates ULID before insert
+func (c *WorkCalendar) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = ulid.Make().String()
+	}
+	return nil
+}
+
+// IsWorkday checks if the day of t is a working day
+func (c *WorkCalendar) IsWorkday(t time.Time) bool {
+	date := t.UTC().Format(CalendarDateLayout)
+	if slices.Contains(c.Workdays, date) {
+		return true
+	}
+	if slices.Contains(c.Holidays, date) {
+		return false
+	}
+	return slices.Contains(c.Weekdays, t.UTC().Weekday())
+}
+
+// UpdateWorkCalendarRequest represents the request body for
+// PUT /projects/:id/calendar
+type UpdateWorkCalendarRequest struct {
+	Weekdays []time.Weekday `json:"weekdays" binding:"required"`
+	Holidays []string       `json:"holidays"`
+	Workdays []string       `json:"workdays"`
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Classification levels (SRS-SECURITY-001)
+const (
+	ClassificationPublic       = "public"
+	ClassificationInternal     = "internal"
+	ClassificationSecret       = "secret"
+	ClassificationConfidential = "confidential"
+)
+
+// ClassificationLevels orders classification levels from least to most
+// restricted, as in the classification_level enum of database/init.sql
+var ClassificationLevels = map[string]int{
+	ClassificationPublic:       0,
+	ClassificationInternal:     1,
+	ClassificationSecret:       2,
+	ClassificationConfidential: 3,
+}
+
+// IsValidClassification checks if the level is a known classification level
+func IsValidClassification(level string) bool {
+	_, ok := ClassificationLevels[level]
+	return ok
+}
+
+// Classified resource types
+const (
+	ClassifiedProject = "project"
+	ClassifiedFile    = "project_file"
+)
+
+// ClassificationGrant names an individual who may access a secret or
+// confidential resource without being a project member. Grants never raise
+// a user above their clearance.
+type ClassificationGrant struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	ResourceType string     `json:"resource_type" gorm:"type:varchar(50);not null;uniqueIndex:idx_classification_grant"`
+	ResourceID   uuid.UUID  `json:"resource_id" gorm:"type:uuid;not null;uniqueIndex:idx_classification_grant"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_classification_grant;index"`
+	Reason       *string    `json:"reason" gorm:"type:text"`
+	GrantedBy    *uuid.UUID `json:"granted_by" gorm:"type:uuid"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (ClassificationGrant) TableName() string {
+	return "classification_grants"
+}
+
+// BeforeCreate generates UUID before insert
+func (g *ClassificationGrant) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return nil
+}
+
+// ClassificationGrantRequest represents the request body for
+// POST /classification/grants
+type ClassificationGrantRequest struct {
+	ResourceType string  `json:"resource_type" binding:"required"`
+	ResourceID   string  `json:"resource_id" binding:"required"`
+	UserID       string  `json:"user_id" binding:"required"`
+	Reason       *string `json:"reason"`
+}
+
+// ClearanceRequest represents the request body for PUT /users/:id/clearance
+type ClearanceRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// Classification change statuses
+const (
+	ClassificationChangePending   = "pending"
+	ClassificationChangeApproved  = "approved"
+	ClassificationChangeRejected  = "rejected"
+	ClassificationChangeCancelled = "cancelled"
+)
+
+// Approval stages of a classification change or export, in the order they
+// sign off
+const (
+	ApprovalStageTeamLeader     = "team_leader"
+	ApprovalStageDeptLeader     = "dept_leader"
+	ApprovalStageSecurityOffice = "security_office"
+)
+
+// ClassificationChange is a proposal to reclassify a project or file. The
+// new level only takes effect once every stage in Stages has approved.
+type ClassificationChange struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	ResourceType string     `json:"resource_type" gorm:"type:varchar(50);not null;index:idx_classification_change_resource"`
+	ResourceID   uuid.UUID  `json:"resource_id" gorm:"type:uuid;not null;index:idx_classification_change_resource"`
+	FromLevel    string     `json:"from_level" gorm:"type:classification_level;not null"`
+	ToLevel      string     `json:"to_level" gorm:"type:classification_level;not null"`
+	Reason       *string    `json:"reason" gorm:"type:text"`
+	Status       string     `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
+	Stages       []string   `json:"stages" gorm:"type:jsonb;serializer:json"`
+	CurrentStage int        `json:"current_stage" gorm:"default:0"`
+	RequestedBy  uuid.UUID  `json:"requested_by" gorm:"type:uuid;not null;index"`
+	DecidedAt    *time.Time `json:"decided_at"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Associations
+	Approvals []ClassificationApproval `json:"approvals,omitempty" gorm:"foreignKey:ChangeID"`
+}
+
+// TableName specifies the table name
+func (ClassificationChange) TableName() string {
+	return "classification_changes"
+}
+
+// BeforeCreate generates UUID before insert
+func (c *ClassificationChange) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// PendingStage returns the stage awaiting a decision, or "" once the
+// change is no longer pending
+func (c *ClassificationChange) PendingStage() string {
+	if c.Status != ClassificationChangePending || c.CurrentStage >= len(c.Stages) {
+		return ""
+	}
+	return c.Stages[c.CurrentStage]
+}
+
+// ClassificationApproval records one approver's decision on a stage
+type ClassificationApproval struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	ChangeID   uuid.UUID `json:"change_id" gorm:"type:uuid;not null;index"`
+	Stage      string    `json:"stage" gorm:"type:varchar(50);not null"`
+	ApproverID uuid.UUID `json:"approver_id" gorm:"type:uuid;not null"`
+	Approved   bool      `json:"approved"`
+	Comment    *string   `json:"comment" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (ClassificationApproval) TableName() string {
+	return "classification_approvals"
+}
+
+// BeforeCreate generates UUID before insert
+func (a *ClassificationApproval) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// ClassificationChangeRequest represents the request body for
+// POST /classification/changes
+type ClassificationChangeRequest struct {
+	ResourceType string  `json:"resource_type" binding:"required"`
+	ResourceID   string  `json:"resource_id" binding:"required"`
+	Level        string  `json:"level" binding:"required"`
+	Reason       *string `json:"reason"`
+}
+
+// ClassificationDecisionRequest represents the request body for approving
+// or rejecting a classification change or an export request
+type ClassificationDecisionRequest struct {
+	Comment *string `json:"comment"`
+}
+
+// ClassificationHistory is the current level of a resource together with
+// every change proposed for it, newest first
+type ClassificationHistory struct {
+	ResourceType string                 `json:"resource_type"`
+	ResourceID   uuid.UUID              `json:"resource_id"`
+	Level        string                 `json:"level"`
+	Changes      []ClassificationChange `json:"changes"`
+}
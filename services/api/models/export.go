@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExportConfig configures exports of classified files
+type ExportConfig struct {
+	// LinkTTL is how long a one-time download link stays valid
+	LinkTTL time.Duration `mapstructure:"link_ttl"`
+}
+
+// Export request statuses
+const (
+	ExportPending    = "pending"
+	ExportApproved   = "approved"
+	ExportRejected   = "rejected"
+	ExportCancelled  = "cancelled"
+	ExportDownloaded = "downloaded"
+)
+
+// ExportRequest asks to download a file classified internal or higher.
+// Once every stage has approved, the requester can issue a one-time,
+// time-limited download link.
+type ExportRequest struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	FileID       uuid.UUID  `json:"file_id" gorm:"type:uuid;not null;index"`
+	ProjectID    uuid.UUID  `json:"project_id" gorm:"type:uuid;not null;index"`
+	Level        string     `json:"level" gorm:"type:classification_level;not null"`
+	Reason       *string    `json:"reason" gorm:"type:text"`
+	Status       string     `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
+	Stages       []string   `json:"stages" gorm:"type:jsonb;serializer:json"`
+	CurrentStage int        `json:"current_stage" gorm:"default:0"`
+	RequestedBy  uuid.UUID  `json:"requested_by" gorm:"type:uuid;not null;index"`
+	DecidedAt    *time.Time `json:"decided_at"`
+	// TokenHash is the SHA-256 of the current download link token
+	TokenHash     *string    `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	LinkExpiresAt *time.Time `json:"link_expires_at"`
+	DownloadedAt  *time.Time `json:"downloaded_at"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Associations
+	Approvals []ExportApproval `json:"approvals,omitempty" gorm:"foreignKey:ExportID"`
+}
+
+// TableName specifies the table name
+func (ExportRequest) TableName() string {
+	return "export_requests"
+}
+
+// BeforeCreate generates UUID before insert
+func (e *ExportRequest) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// PendingStage returns the stage awaiting a decision, or "" once the
+// request is no longer pending
+func (e *ExportRequest) PendingStage() string {
+	if e.Status != ExportPending || e.CurrentStage >= len(e.Stages) {
+		return ""
+	}
+	return e.Stages[e.CurrentStage]
+}
+
+// ExportApproval records one approver's decision on a stage
+type ExportApproval struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	ExportID   uuid.UUID `json:"export_id" gorm:"type:uuid;not null;index"`
+	Stage      string    `json:"stage" gorm:"type:varchar(50);not null"`
+	ApproverID uuid.UUID `json:"approver_id" gorm:"type:uuid;not null"`
+	Approved   bool      `json:"approved"`
+	Comment    *string   `json:"comment" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (ExportApproval) TableName() string {
+	return "export_approvals"
+}
+
+// BeforeCreate generates UUID before insert
+func (a *ExportApproval) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// CreateExportRequest represents the request body for POST /exports
+type CreateExportRequest struct {
+	FileID string  `json:"file_id" binding:"required"`
+	Reason *string `json:"reason"`
+}
+
+// ExportLinkResponse carries a one-time download link, which is shown only
+// once
+type ExportLinkResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
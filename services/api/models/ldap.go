@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// LDAPConfig holds settings for synchronizing users and organizations from
+// an LDAP/AD directory
+type LDAPConfig struct {
+	// URL enables the sync when set, e.g. ldaps://ldap.example.com:636
+	URL                string        `mapstructure:"url"`
+	BindDN             string        `mapstructure:"bind_dn"`
+	BindPassword       string        `mapstructure:"bind_password"`
+	StartTLS           bool          `mapstructure:"start_tls"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+
+	// BaseDN is the root of the synced tree; its direct child OUs become
+	// level-1 organizations
+	BaseDN     string `mapstructure:"base_dn"`
+	OrgFilter  string `mapstructure:"org_filter"`
+	UserFilter string `mapstructure:"user_filter"`
+
+	// Attribute names differ between OpenLDAP and Active Directory
+	OrgCodeAttr     string `mapstructure:"org_code_attr"`
+	OrgNameAttr     string `mapstructure:"org_name_attr"`
+	OrgLeaderAttr   string `mapstructure:"org_leader_attr"`
+	UsernameAttr    string `mapstructure:"username_attr"`
+	DisplayNameAttr string `mapstructure:"display_name_attr"`
+	EmailAttr       string `mapstructure:"email_attr"`
+	PhoneAttr       string `mapstructure:"phone_attr"`
+
+	// AdoptLocalRecords lets an entry take over a local user or organization
+	// without a directory_dn whose username or code matches. Off by default:
+	// such matches are reported as conflicts and skipped, and a record is
+	// linked explicitly by setting its directory_dn.
+	AdoptLocalRecords bool `mapstructure:"adopt_local_records"`
+
+	// SyncInterval schedules the sync; zero leaves it to manual runs
+	SyncInterval time.Duration `mapstructure:"sync_interval"`
+}
+
+// Enabled checks if a directory is configured
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != "" && c.BaseDN != ""
+}
+
+// LDAPEntry is a directory entry with its attribute values, keyed by
+// lower-cased attribute name
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of an attribute, or "" if absent
+func (e LDAPEntry) Get(attr string) string {
+	if values := e.Attributes[strings.ToLower(attr)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Directory sync change actions
+const (
+	DirectoryActionCreate     = "create"
+	DirectoryActionUpdate     = "update"
+	DirectoryActionDeactivate = "deactivate"
+	DirectoryActionConflict   = "conflict"
+)
+
+// DirectoryChange describes one planned or applied change to a user or
+// organization
+type DirectoryChange struct {
+	Resource string                 `json:"resource"` // organization or user
+	Action   string                 `json:"action"`
+	ID       string                 `json:"id"`
+	DN       string                 `json:"dn,omitempty"`
+	Name     string                 `json:"name"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+}
+
+// DirectorySyncReport summarizes a directory sync run
+type DirectorySyncReport struct {
+	DryRun     bool              `json:"dry_run"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Changes    []DirectoryChange `json:"changes"`
+	Conflicts  []DirectoryChange `json:"conflicts,omitempty"` // entries matching a local record that was not adopted
+	Warnings   []string          `json:"warnings,omitempty"`
+	Summary    map[string]int    `json:"summary"`
+}
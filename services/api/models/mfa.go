@@ -0,0 +1,123 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MFAPolicy controls TOTP two-factor authentication
+type MFAPolicy struct {
+	// RequiredRoles must complete MFA; users in other roles may opt in
+	RequiredRoles []string `mapstructure:"required_roles"`
+	// Issuer is the account label shown in authenticator apps
+	Issuer            string        `mapstructure:"issuer"`
+	ChallengeTTL      time.Duration `mapstructure:"challenge_ttl"`
+	RecoveryCodeCount int           `mapstructure:"recovery_code_count"`
+	// EncryptionKey encrypts stored TOTP secrets; defaults to the JWT secret
+	EncryptionKey string `mapstructure:"encryption_key"`
+}
+
+// UserMFA holds a user's TOTP secret. The secret is encrypted at rest and
+// only becomes active once the user has confirmed a code from it.
+type UserMFA struct {
+	UserID          uuid.UUID  `json:"user_id" gorm:"type:uuid;primaryKey"`
+	EncryptedSecret string     `json:"-" gorm:"type:varchar(255);not null"`
+	Enabled         bool       `json:"enabled" gorm:"default:false"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	// LastUsedStep is the last accepted TOTP time step, so a code cannot
+	// be replayed within its validity window
+	LastUsedStep int64     `json:"-" gorm:"default:0"`
+	CreatedAt    time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode is a one-time code for signing in without the
+// authenticator device
+type MFARecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;index;not null"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// TableName specifies the table name
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// BeforeCreate generates UUID before insert
+func (c *MFARecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// MFAChallengeResponse is returned by POST /auth/login when a second factor
+// is needed. With EnrollmentRequired set the user must first enroll using
+// the challenge token.
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ChallengeToken     string `json:"challenge_token"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+// MFAVerifyRequest represents the request body for POST /auth/mfa/verify.
+// Either Code or RecoveryCode must be set.
+type MFAVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// MFAEnrollRequest represents the request body for POST /auth/mfa/enroll
+type MFAEnrollRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// MFAEnrollConfirmRequest represents the request body for
+// POST /auth/mfa/enroll/confirm
+type MFAEnrollConfirmRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// MFACodeRequest carries a current TOTP code to confirm a sensitive change
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAEnrollmentResponse carries a new TOTP secret and its otpauth:// URI,
+// which the frontend renders as a QR code
+type MFAEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFARecoveryCodesResponse carries freshly generated recovery codes, which
+// are shown only once
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAEnrollmentLoginResponse completes a login that required enrollment
+type MFAEnrollmentLoginResponse struct {
+	*LoginResponse
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAStatus describes a user's MFA state
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
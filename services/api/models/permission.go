@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+// Permission domains. Global rules use DomainAll; rules inside a project
+// are checked in that project's domain, see ProjectDomain.
+const (
+	DomainAll = "*"
+	// DomainSelf is used when a user acts on their own account
+	DomainSelf = "self"
+)
+
+// RoleSecurityOffice is a policy role for the security office. It is not a
+// user_role value; staff get it through a role binding on their user
+// subject.
+const RoleSecurityOffice = "security_office"
+
+// Casbin policy types
+const (
+	PolicyTypePermission = "p"
+	PolicyTypeRole       = "g"
+)
+
+// ProjectDomain returns the permission domain of a project
+func ProjectDomain(projectID string) string {
+	return "project:" + projectID
+}
+
+// ProjectRoleSubject returns the subject for a project member role, so
+// project roles never collide with global roles of the same name
+func ProjectRoleSubject(role string) string {
+	return "project:" + role
+}
+
+// UserSubject returns the subject for rules bound to a single user
+func UserSubject(userID string) string {
+	return "user:" + userID
+}
+
+// PermissionConfig configures the permission engine
+type PermissionConfig struct {
+	// ReloadInterval controls how often policies edited on other
+	// instances are picked up
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+// CasbinRule is a persisted casbin policy line. The column layout matches
+// the common casbin adapters so existing tooling can read it.
+type CasbinRule struct {
+	ID    uint   `gorm:"primaryKey;autoIncrement"`
+	Ptype string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V0    string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V1    string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V2    string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V3    string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V4    string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+	V5    string `gorm:"size:100;uniqueIndex:idx_casbin_rule"`
+}
+
+// TableName specifies the table name
+func (CasbinRule) TableName() string {
+	return "casbin_rule"
+}
+
+// PolicyRule grants a subject an action on an object within a domain.
+// Object and Domain accept a trailing * wildcard; Action accepts *.
+type PolicyRule struct {
+	Subject string `json:"subject" binding:"required"`
+	Domain  string `json:"domain" binding:"required"`
+	Object  string `json:"object" binding:"required"`
+	Action  string `json:"action" binding:"required"`
+}
+
+// RoleBinding makes Subject inherit Role within Domain. Subjects are role
+// names or user:<id>; Domain * applies everywhere.
+type RoleBinding struct {
+	Subject string `json:"subject" binding:"required"`
+	Role    string `json:"role" binding:"required"`
+	Domain  string `json:"domain" binding:"required"`
+}
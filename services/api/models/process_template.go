@@ -0,0 +1,104 @@
+package models
+
+// Activity dependency (link) types
+const (
+	DependencyFinishToStart  = "finish_to_start"
+	DependencyStartToStart   = "start_to_start"
+	DependencyFinishToFinish = "finish_to_finish"
+	DependencyStartToFinish  = "start_to_finish"
+)
+
+// ValidDependencyTypes contains all valid dependency types
+var ValidDependencyTypes = []string{
+	DependencyFinishToStart,
+	DependencyStartToStart,
+	DependencyFinishToFinish,
+	DependencyStartToFinish,
+}
+
+// Approval modes
+const (
+	ApprovalModeSerial   = "serial"
+	ApprovalModeParallel = "parallel"
+)
+
+// Project roles that can be required as approvers
+const (
+	ApprovalRoleLeader        = "leader"
+	ApprovalRoleTechLeader    = "tech_leader"
+	ApprovalRoleProductLeader = "product_leader"
+	ApprovalRoleDeptLeader    = "dept_leader"
+)
+
+// ValidApprovalRoles contains all roles an approval can require
+var ValidApprovalRoles = []string{
+	ApprovalRoleLeader,
+	ApprovalRoleTechLeader,
+	ApprovalRoleProductLeader,
+	ApprovalRoleDeptLeader,
+}
+
+// TemplateActivities is the typed activity list of a process template,
+// stored as jsonb
+type TemplateActivities []TemplateActivity
+
+// TemplateActivity defines one activity of a process template
+type TemplateActivity struct {
+	// ID identifies the activity within the template, e.g. ACT001
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Type        ActivityType `json:"type,omitempty"`
+	// Duration is the default duration in days; milestones take none
+	Duration int `json:"duration"`
+	// DependsOn lists the predecessors. When omitted the activity follows
+	// the previous one; an explicit empty list makes it a start activity.
+	DependsOn     *[]TemplateDependency `json:"depends_on,omitempty"`
+	Deliverables  []TemplateDeliverable `json:"deliverables,omitempty"`
+	RequireReview bool                  `json:"require_review"`
+	Approval      *ApprovalPolicy       `json:"approval,omitempty"`
+}
+
+// TemplateDependency links a template activity to a predecessor
+type TemplateDependency struct {
+	ActivityID string `json:"activity_id"`
+	Type       string `json:"type,omitempty"`
+	// Lag in days; negative is a lead
+	Lag int `json:"lag,omitempty"`
+}
+
+// TemplateDeliverable is a deliverable created with the activity
+type TemplateDeliverable struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ApprovalPolicy describes who must approve an activity and how
+type ApprovalPolicy struct {
+	// Mode is serial (in the order of Roles) or parallel
+	Mode  string   `json:"mode"`
+	Roles []string `json:"roles"`
+	// Quorum is the number of approvals a parallel approval needs;
+	// zero means all approvers must approve
+	Quorum int `json:"quorum,omitempty"`
+}
+
+// ActivityType returns the type of the template activity, defaulting to task
+func (a *TemplateActivity) ActivityType() ActivityType {
+	if a.Type == "" {
+		return ActivityTypeTask
+	}
+	return a.Type
+}
+
+// Dependencies returns the predecessors of the activity at index i
+func (a TemplateActivities) Dependencies(i int) []TemplateDependency {
+	if a[i].DependsOn != nil {
+		return *a[i].DependsOn
+	}
+	if i == 0 {
+		return nil
+	}
+	return []TemplateDependency{{ActivityID: a[i-1].ID, Type: DependencyFinishToStart}}
+}
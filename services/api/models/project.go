@@ -4,11 +4,12 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // Project represents a research/development project
 type Project struct {
-	ID                  uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID                  uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	Code                string     `json:"code" gorm:"type:varchar(50);uniqueIndex;not null"`
 	Name                string     `json:"name" gorm:"type:varchar(200);not null"`
 	Description         *string    `json:"description" gorm:"type:text"`
@@ -16,6 +17,9 @@ type Project struct {
 	Status              string     `json:"status" gorm:"type:project_status;default:'draft'"`
 	ProductLine         *string    `json:"product_line" gorm:"type:pd_product_line"`
 	Team                *string    `json:"team" gorm:"type:team_type"`
+	// OrganizationID is the owning department; its members may read
+	// internal data of the project
+	OrganizationID      *uuid.UUID `json:"organization_id" gorm:"type:uuid;index"`
 	
 	// Process binding
 	ProcessTemplateID   *uuid.UUID `json:"process_template_id" gorm:"type:uuid"`
@@ -55,9 +59,17 @@ func (Project) TableName() string {
 	return "projects"
 }
 
+// BeforeCreate generates UUID before insert
+func (p *Project) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
 // ProjectMember represents a user participating in a project
 type ProjectMember struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	ProjectID   uuid.UUID `json:"project_id" gorm:"type:uuid;not null;index"`
 	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
 	Role        string    `json:"role" gorm:"type:varchar(50);default:'member'"`
@@ -72,14 +84,22 @@ func (ProjectMember) TableName() string {
 	return "project_members"
 }
 
+// BeforeCreate generates UUID before insert
+func (m *ProjectMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
 // ProcessTemplate represents a workflow template
 type ProcessTemplate struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	Name        string    `json:"name" gorm:"type:varchar(200);not null"`
 	Code        string    `json:"code" gorm:"type:varchar(50);uniqueIndex;not null"`
 	Category    string    `json:"category" gorm:"type:project_category;not null"`
 	Description *string   `json:"description" gorm:"type:text"`
-	Activities  string    `json:"activities" gorm:"type:jsonb;not null"`
+	Activities  TemplateActivities `json:"activities" gorm:"type:jsonb;serializer:json;not null"`
 	IsDefault   bool      `json:"is_default" gorm:"default:false"`
 	IsActive    bool      `json:"is_active" gorm:"default:true"`
 	CreatedBy   *uuid.UUID `json:"created_by" gorm:"type:uuid"`
@@ -92,44 +112,17 @@ func (ProcessTemplate) TableName() string {
 	return "process_templates"
 }
 
-// Activity represents a project activity/task
-type Activity struct {
-	ID                    uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	ProjectID             uuid.UUID  `json:"project_id" gorm:"type:uuid;not null;index"`
-	TemplateActivityID    *string    `json:"template_activity_id" gorm:"type:varchar(50)"`
-	Name                  string    `json:"name" gorm:"type:varchar(200);not null"`
-	Description           *string    `json:"description" gorm:"type:text"`
-	Status                string    `json:"status" gorm:"type:activity_status;default:'pending'"`
-	SortOrder             int       `json:"sort_order" gorm:"default:0"`
-	
-	// Dates
-	StartDate             *time.Time `json:"start_date" gorm:"type:date"`
-	EndDate               *time.Time `json:"end_date" gorm:"type:date"`
-	ActualStartDate       *time.Time `json:"actual_start_date" gorm:"type:date"`
-	ActualEndDate         *time.Time `json:"actual_end_date" gorm:"type:date"`
-	
-	// Dependencies
-	DependsOn             *string    `json:"depends_on" gorm:"type:varchar(500)"`
-	
-	// Assignee
-	AssigneeID            *uuid.UUID `json:"assignee_id" gorm:"type:uuid"`
-	
-	// Progress
-	Progress              int        `json:"progress" gorm:"default:0"`
-	
-	// Metadata
-	CreatedAt             time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
-	UpdatedAt             time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
-}
-
-// TableName specifies the table name
-func (Activity) TableName() string {
-	return "activities"
+// BeforeCreate generates UUID before insert
+func (t *ProcessTemplate) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
 }
 
 // ProjectFile represents a file in a project
 type ProjectFile struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	ProjectID   uuid.UUID `json:"project_id" gorm:"type:uuid;not null;index"`
 	Name        string    `json:"name" gorm:"type:varchar(255);not null"`
 	Path        string    `json:"path" gorm:"type:varchar(500);not null"`
@@ -137,6 +130,9 @@ type ProjectFile struct {
 	ContentType string    `json:"content_type" gorm:"type:varchar(100)"`
 	IsDirectory bool      `json:"is_directory" gorm:"default:false"`
 	StoragePath string    `json:"storage_path" gorm:"type:varchar(1000)"`
+	// ClassificationLevel may raise a file above its project's level; nil
+	// inherits the project's level
+	ClassificationLevel *string `json:"classification_level" gorm:"type:classification_level"`
 	CreatedAt   time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
 }
@@ -146,6 +142,14 @@ func (ProjectFile) TableName() string {
 	return "project_files"
 }
 
+// BeforeCreate generates UUID before insert
+func (f *ProjectFile) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
 // File is a generic file representation for API responses
 type File struct {
 	ID          uuid.UUID `json:"id"`
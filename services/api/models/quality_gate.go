@@ -0,0 +1,162 @@
+package models
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Quality check types
+const (
+	// QualityCheckRequirementApproval needs at least Threshold of the
+	// project's requirements approved
+	QualityCheckRequirementApproval = "requirement_approval_ratio"
+	// QualityCheckFeedbackClosed needs every review feedback thread of the
+	// project closed
+	QualityCheckFeedbackClosed = "review_feedback_closed"
+	// QualityCheckCriticalDefects allows at most Threshold open critical
+	// defects
+	QualityCheckCriticalDefects = "critical_defects"
+	// QualityCheckRequiredDeliverables needs the required deliverables
+	// submitted
+	QualityCheckRequiredDeliverables = "required_deliverables"
+)
+
+// Quality gate result statuses
+const (
+	QualityGatePassed = "passed"
+	QualityGateFailed = "failed"
+	// QualityGateWaived is a failed gate a department leader let through
+	QualityGateWaived = "waived"
+)
+
+// QualityCheck is one condition of a quality gate
+type QualityCheck struct {
+	Type string `json:"type"`
+	// Threshold is the minimum ratio for requirement_approval_ratio and the
+	// maximum count for critical_defects
+	Threshold float64 `json:"threshold,omitempty"`
+	// Deliverables names the deliverables required_deliverables needs;
+	// empty means every deliverable of the activities before the DCP
+	Deliverables []string `json:"deliverables,omitempty"`
+}
+
+// DefaultQualityChecks make up the gate created for each DCP of a project
+// instantiated from a process template
+var DefaultQualityChecks = []QualityCheck{
+	{Type: QualityCheckRequirementApproval, Threshold: 0.9},
+	{Type: QualityCheckFeedbackClosed},
+	{Type: QualityCheckCriticalDefects},
+	{Type: QualityCheckRequiredDeliverables},
+}
+
+// QualityCheckResult is the outcome of one check
+type QualityCheckResult struct {
+	Type    string  `json:"type"`
+	Passed  bool    `json:"passed"`
+	Actual  float64 `json:"actual"`
+	Message string  `json:"message,omitempty"`
+}
+
+// QualityGate holds the checks a DCP activity must pass before it can be
+// submitted
+type QualityGate struct {
+	ID         string         `json:"id" gorm:"primaryKey;type:char(26)"`
+	ProjectID  string         `json:"project_id" gorm:"index;not null;type:varchar(36)"`
+	ActivityID string         `json:"activity_id" gorm:"index;not null;type:char(26)"`
+	Name       string         `json:"name" gorm:"not null;size:200"`
+	Checks     []QualityCheck `json:"checks" gorm:"type:jsonb;serializer:json;not null"`
+	CreatedBy  string         `json:"created_by" gorm:"type:varchar(36)"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+
+	// Relations
+	Results []QualityGateResult `json:"results,omitempty" gorm:"foreignKey:GateID"`
+	Waivers []QualityGateWaiver `json:"waivers,omitempty" gorm:"foreignKey:GateID"`
+}
+
+// TableName returns the table name for the model
+func (QualityGate) TableName() string {
+	return "quality_gates"
+}
+
+// BeforeCreate generates ULID before insert
+func (g *QualityGate) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == "" {
+		g.ID = ulid.Make().String()
+	}
+	return nil
+}
+
+// QualityGateResult records an evaluation of a quality gate
+type QualityGateResult struct {
+	ID          string               `json:"id" gorm:"primaryKey;type:char(26)"`
+	GateID      string               `json:"gate_id" gorm:"index;not null;type:char(26)"`
+	ActivityID  string               `json:"activity_id" gorm:"index;not null;type:char(26)"`
+	ProjectID   string               `json:"project_id" gorm:"index;not null;type:varchar(36)"`
+	Status      string               `json:"status" gorm:"not null;size:20"`
+	Checks      []QualityCheckResult `json:"checks" gorm:"type:jsonb;serializer:json"`
+	EvaluatedBy string               `json:"evaluated_by" gorm:"type:varchar(36)"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+// TableName returns the table name for the model
+func (QualityGateResult) TableName() string {
+	return "quality_gate_results"
+}
+
+// BeforeCreate generates ULID before insert
+func (r *QualityGateResult) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = ulid.Make().String()
+	}
+	return nil
+}
+
+// Blocks checks if the result holds up the DCP
+func (r *QualityGateResult) Blocks() bool {
+	return r.Status == QualityGateFailed
+}
+
+// QualityGateWaiver asks the department leader to let a failed gate
+// through
+type QualityGateWaiver struct {
+	ID          string         `json:"id" gorm:"primaryKey;type:char(26)"`
+	GateID      string         `json:"gate_id" gorm:"index;not null;type:char(26)"`
+	ResultID    string         `json:"result_id" gorm:"not null;type:char(26)"`
+	ProjectID   string         `json:"project_id" gorm:"index;not null;type:varchar(36)"`
+	Reason      string         `json:"reason" gorm:"not null;type:text"`
+	Status      ApprovalStatus `json:"status" gorm:"not null;default:'pending';size:20"`
+	RequestedBy string         `json:"requested_by" gorm:"type:varchar(36)"`
+	ApproverID  string         `json:"approver_id" gorm:"index;type:varchar(36)"`
+	Comment     string         `json:"comment" gorm:"type:text"`
+	DecidedAt   *time.Time     `json:"decided_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// TableName returns the table name for the model
+func (QualityGateWaiver) TableName() string {
+	return "quality_gate_waivers"
+}
+
+// BeforeCreate generates ULID before insert
+func (w *QualityGateWaiver) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = ulid.Make().String()
+	}
+	return nil
+}
+
+// CreateQualityGateRequest represents the request body for
+// POST /activities/:id/quality-gates
+type CreateQualityGateRequest struct {
+	Name   string         `json:"name" binding:"required,max=200"`
+	Checks []QualityCheck `json:"checks"`
+}
+
+// QualityGateWaiverRequest represents the request body for requesting a
+// waiver of a failed gate
+type QualityGateWaiverRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
@@ -109,6 +109,8 @@ type Feedback struct {
 	Content   string    `json:"content" gorm:"not null;type:text"`
 	AuthorID  string    `json:"author_id" gorm:"not null;type:char(26)"`
 	Mentions  string    `json:"mentions" gorm:"type:text"`
+	// ClosedAt is set once the thread the feedback starts is resolved
+	ClosedAt  *time.Time `json:"closed_at"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
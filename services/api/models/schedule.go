@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// ProjectSchedule is the critical path analysis of a project's activities
+type ProjectSchedule struct {
+	ProjectID string    `json:"project_id"`
+	Start     time.Time `json:"start"`
+	// Finish is the earliest the project can finish given its network
+	Finish   time.Time `json:"finish"`
+	Duration int       `json:"duration"`
+	// PlannedFinish is the project's end date; Delay is how many days
+	// Finish runs past it
+	PlannedFinish *time.Time `json:"planned_finish,omitempty"`
+	Delay         int        `json:"delay"`
+	// Activities are in topological order: every activity after its
+	// predecessors
+	Activities []ActivitySchedule `json:"activities"`
+	// CriticalPath lists the critical activities in the same order
+	CriticalPath []string `json:"critical_path"`
+}
+
+// ActivitySchedule holds the early and late dates of an activity. Offsets
+// are in days from the schedule start.
+type ActivitySchedule struct {
+	ActivityID  string         `json:"activity_id"`
+	Name        string         `json:"name"`
+	Status      ActivityStatus `json:"status"`
+	Duration    int            `json:"duration"`
+	EarlyStart  int            `json:"early_start"`
+	EarlyFinish int            `json:"early_finish"`
+	LateStart   int            `json:"late_start"`
+	LateFinish  int            `json:"late_finish"`
+	// TotalFloat is how far the activity can slip without moving the
+	// project finish; FreeFloat is how far without moving any successor
+	TotalFloat int  `json:"total_float"`
+	FreeFloat  int  `json:"free_float"`
+	Critical   bool `json:"critical"`
+
+	EarlyStartDate  time.Time `json:"early_start_date"`
+	EarlyFinishDate time.Time `json:"early_finish_date"`
+	LateStartDate   time.Time `json:"late_start_date"`
+	LateFinishDate  time.Time `json:"late_finish_date"`
+}
+
+// ScheduleRipple is the outcome of moving an activity's planned dates:
+// the activity and the successors that move with it
+type ScheduleRipple struct {
+	ProjectID  string `json:"project_id"`
+	ActivityID string `json:"activity_id"`
+	// Preview is set when the changes were not saved
+	Preview bool             `json:"preview"`
+	Changes []ScheduleChange `json:"changes"`
+	// Held lists finished successors that keep their dates although
+	// their links no longer hold
+	Held []string `json:"held"`
+	// ProjectFinish is the latest planned end of the project's activities
+	// after the changes, PreviousFinish the one before
+	ProjectFinish  time.Time `json:"project_finish"`
+	PreviousFinish time.Time `json:"previous_finish"`
+	// PlannedFinish is the project's end date; Delay is how many days
+	// ProjectFinish runs past it
+	PlannedFinish        *time.Time `json:"planned_finish,omitempty"`
+	Delay                int        `json:"delay"`
+	ExceedsPlannedFinish bool       `json:"exceeds_planned_finish"`
+}
+
+// ScheduleChange is the move of one activity's planned dates
+type ScheduleChange struct {
+	ActivityID string     `json:"activity_id"`
+	Name       string     `json:"name"`
+	OldStart   *time.Time `json:"old_start"`
+	OldEnd     *time.Time `json:"old_end"`
+	NewStart   time.Time  `json:"new_start"`
+	NewEnd     time.Time  `json:"new_end"`
+}
+
+// RescheduleActivityRequest represents the request body for
+// PUT /projects/:id/activities/:activityId/schedule. A date left out
+// keeps its current value.
+type RescheduleActivityRequest struct {
+	PlannedStart *time.Time `json:"planned_start"`
+	PlannedEnd   *time.Time `json:"planned_end"`
+}
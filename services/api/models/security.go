@@ -4,11 +4,12 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // AuditLog represents an audit log entry
 type AuditLog struct {
-	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	UserID        *uuid.UUID `json:"user_id" gorm:"type:uuid;index"`
 	Username      *string    `json:"username" gorm:"type:varchar(50)"`
 	IPAddress     *string    `json:"ip_address" gorm:"type:varchar(50)"`
@@ -22,7 +23,22 @@ type AuditLog struct {
 	ResponseCode  *int      `json:"response_code" gorm:"type:integer"`
 	ErrorMessage  *string   `json:"error_message" gorm:"type:text"`
 	Classification string   `json:"classification" gorm:"type:classification_level;default:'internal'"`
+	// Severity and Details describe semantic events recorded by services;
+	// request entries from the audit middleware have neither
+	Severity string        `json:"severity,omitempty" gorm:"type:varchar(10);index"`
+	Details  *AuditDetails `json:"details,omitempty" gorm:"type:jsonb;serializer:json"`
 	CreatedAt     time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	// OccurredAt is when the event happened; CreatedAt is when it joined
+	// the chain, which is later for queued or spilled events
+	OccurredAt *time.Time `json:"occurred_at"`
+
+	// Hash chain: Sequence orders entries across all partitions and Hash
+	// covers the entry's content and PrevHash. The sequence index cannot be
+	// unique since unique indexes on a partitioned table must include the
+	// partition key.
+	Sequence int64  `json:"sequence" gorm:"index"`
+	PrevHash string `json:"prev_hash" gorm:"type:varchar(64)"`
+	Hash     string `json:"hash" gorm:"type:varchar(64)"`
 }
 
 // TableName specifies the table name
@@ -30,6 +46,14 @@ func (AuditLog) TableName() string {
 	return "audit_logs"
 }
 
+// BeforeCreate generates UUID before insert
+func (l *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
 // DataClassification represents the classification level of data
 type DataClassification struct {
 	Level       string `json:"level" gorm:"type:classification_level;primaryKey"`
@@ -46,7 +70,7 @@ func (DataClassification) TableName() string {
 
 // LoginLog tracks user login attempts
 type LoginLog struct {
-	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	UserID     *uuid.UUID `json:"user_id" gorm:"type:uuid;index"`
 	Username   string    `json:"username" gorm:"type:varchar(50);not null"`
 	IPAddress  *string   `json:"ip_address" gorm:"type:varchar(50)"`
@@ -62,9 +86,18 @@ func (LoginLog) TableName() string {
 	return "login_logs"
 }
 
-// Session represents an active user session
+// BeforeCreate generates UUID before insert
+func (l *LoginLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+// Session represents an active user session. Every access token carries the
+// session ID; Token holds the refresh token family issued with the session.
 type Session struct {
-	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
 	Token        string     `json:"token" gorm:"type:varchar(500);uniqueIndex;not null"`
 	IPAddress    *string    `json:"ip_address" gorm:"type:varchar(50)"`
@@ -79,3 +112,11 @@ type Session struct {
 func (Session) TableName() string {
 	return "sessions"
 }
+
+// BeforeCreate generates UUID before insert
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -4,11 +4,45 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// User roles (mirrors the user_role enum)
+const (
+	RoleAdmin      = "admin"
+	RoleDeptLeader = "dept_leader"
+	RoleTeamLeader = "team_leader"
+	RoleDesigner   = "designer"
+	RoleOther      = "other"
+)
+
+// Teams (mirrors the team_type enum)
+const (
+	TeamProductMgmt = "product_mgmt"
+	TeamProductDev  = "product_dev"
+	TeamTechDev     = "tech_dev"
+	TeamGeneralMgmt = "general_mgmt"
+)
+
+// RoleLevels orders roles from least to most privileged
+var RoleLevels = map[string]int{
+	RoleOther:      0,
+	RoleDesigner:   1,
+	RoleTeamLeader: 2,
+	RoleDeptLeader: 3,
+	RoleAdmin:      4,
+}
+
+// IsValidRole checks if the role is a known user role
+func IsValidRole(role string) bool {
+	_, ok := RoleLevels[role]
+	return ok
+}
+
 // User represents a user in the system
 type User struct {
-	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	Username       string     `json:"username" gorm:"type:varchar(50);uniqueIndex;not null"`
 	DisplayName   string     `json:"display_name" gorm:"type:varchar(100);not null"`
 	Email         *string    `json:"email" gorm:"type:varchar(100)"`
@@ -20,13 +54,20 @@ type User struct {
 	ProductLine   *string    `json:"product_line" gorm:"type:pd_product_line"`
 	Title         *string    `json:"title" gorm:"type:title_level"`
 	OrganizationID *uuid.UUID `json:"organization_id" gorm:"type:uuid"`
+	// ClearanceLevel is the highest classification level the user may access
+	ClearanceLevel string     `json:"clearance_level" gorm:"type:classification_level;default:'internal'"`
 	Skills        []string   `json:"skills" gorm:"type:jsonb;serializer:json"`
 	Honors        []string   `json:"honors" gorm:"type:jsonb;serializer:json"`
 	Bio           *string    `json:"bio" gorm:"type:text"`
 	PasswordHash  *string    `json:"-" gorm:"type:varchar(255)"`
 	IsActive      bool       `json:"is_active" gorm:"default:true"`
 	CasdoorID     *string    `json:"casdoor_id" gorm:"type:varchar(100)"`
+	DirectoryDN   *string    `json:"directory_dn" gorm:"type:varchar(500);index"`
 	LastLoginAt   *time.Time `json:"last_login_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UnlockedAt    *time.Time `json:"-"`
+	MustChangePassword bool  `json:"must_change_password" gorm:"default:false"`
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
 	CreatedAt     time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt     time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
 }
@@ -36,9 +77,93 @@ func (User) TableName() string {
 	return "users"
 }
 
+// BeforeCreate generates UUID before insert
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsAdmin checks if the user is an administrator
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// HasRole checks if the user's role is at least the given role
+func (u *User) HasRole(role string) bool {
+	return RoleLevels[u.Role] >= RoleLevels[role]
+}
+
+// HasClearance checks if the user's clearance covers the classification level
+func (u *User) HasClearance(level string) bool {
+	clearance, ok := ClassificationLevels[u.ClearanceLevel]
+	if !ok {
+		clearance = ClassificationLevels[ClassificationInternal]
+	}
+	required, ok := ClassificationLevels[level]
+	return ok && clearance >= required
+}
+
+// SetPassword hashes and stores the password
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	hashStr := string(hash)
+	u.PasswordHash = &hashStr
+	return nil
+}
+
+// IsLocked checks if the account is inside a lockout period
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+}
+
+// CheckPassword verifies the password against the stored hash
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == nil || *u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(*u.PasswordHash), []byte(password)) == nil
+}
+
+// ToResponse returns the public representation of the user
+func (u *User) ToResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"id":                   u.ID.String(),
+		"username":             u.Username,
+		"display_name":         u.DisplayName,
+		"email":                u.Email,
+		"avatar_url":           u.AvatarURL,
+		"role":                 u.Role,
+		"team":                 u.Team,
+		"product_line":         u.ProductLine,
+		"title":                u.Title,
+		"organization_id":      u.OrganizationID,
+		"is_active":            u.IsActive,
+		"last_login_at":        u.LastLoginAt,
+		"locked_until":         u.LockedUntil,
+		"must_change_password": u.MustChangePassword,
+	}
+}
+
+// CreateUserRequest represents the request body for creating a user
+type CreateUserRequest struct {
+	Username    string `json:"username" binding:"required,max=50"`
+	Password    string `json:"password" binding:"required"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	Role        string `json:"role"`
+	Team        string `json:"team"`
+	ProductLine string `json:"product_line"`
+}
+
 // Organization represents an organization unit
 type Organization struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	Name        string    `json:"name" gorm:"type:varchar(200);not null"`
 	Code        string    `json:"code" gorm:"type:varchar(50);uniqueIndex;not null"`
 	ParentID    *uuid.UUID `json:"parent_id" gorm:"type:uuid"`
@@ -47,6 +172,7 @@ type Organization struct {
 	LeaderID    *uuid.UUID `json:"leader_id" gorm:"type:uuid"`
 	SortOrder   int       `json:"sort_order" gorm:"default:0"`
 	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	DirectoryDN *string    `json:"directory_dn" gorm:"type:varchar(500);index"`
 	CreatedAt   time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
 }
@@ -56,9 +182,17 @@ func (Organization) TableName() string {
 	return "organizations"
 }
 
+// BeforeCreate generates UUID before insert
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
 // Notification represents a user notification
 type Notification struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
 	Type       string    `json:"type" gorm:"type:varchar(50);not null"`
 	Title      string    `json:"title" gorm:"type:varchar(200);not null"`
@@ -74,9 +208,17 @@ func (Notification) TableName() string {
 	return "notifications"
 }
 
+// BeforeCreate generates UUID before insert
+func (n *Notification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
 // Announcement represents a system announcement
 type Announcement struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	Title       string    `json:"title" gorm:"type:varchar(200);not null"`
 	Content     string    `json:"content" gorm:"type:text;not null"`
 	AuthorID    *uuid.UUID `json:"author_id" gorm:"type:uuid"`
@@ -93,9 +235,17 @@ func (Announcement) TableName() string {
 	return "announcements"
 }
 
+// BeforeCreate generates UUID before insert
+func (a *Announcement) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
 // Honor represents a team honor/award
 type Honor struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:(uuid_generate_v4())"`
 	Title       string    `json:"title" gorm:"type:varchar(200);not null"`
 	Description *string   `json:"description" gorm:"type:text"`
 	AwardYear   *int      `json:"award_year"`
@@ -111,3 +261,11 @@ type Honor struct {
 func (Honor) TableName() string {
 	return "honors"
 }
+
+// BeforeCreate generates UUID before insert
+func (h *Honor) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
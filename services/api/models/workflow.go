@@ -35,8 +35,8 @@ var ValidWorkflowStates = []WorkflowState{
 // Workflow represents a project workflow instance
 type Workflow struct {
 	ID          string        `json:"id" gorm:"primaryKey;type:char(26)"`
-	ProjectID   string        `json:"project_id" gorm:"index;not null;type:char(26)"`
-	TemplateID  string        `json:"template_id" gorm:"index;type:char(26)"`
+	ProjectID   string        `json:"project_id" gorm:"index;not null;type:varchar(36)"`
+	TemplateID  string        `json:"template_id" gorm:"index;type:varchar(36)"`
 	Name        string        `json:"name" gorm:"not null;size:200"`
 	Description string        `json:"description" gorm:"type:text"`
 	State       WorkflowState `json:"state" gorm:"not null;default:'draft'"`
@@ -44,7 +44,7 @@ type Workflow struct {
 	CompletedAt *time.Time    `json:"completed_at"`
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
-	CreatedBy   string        `json:"created_by" gorm:"type:char(26)"`
+	CreatedBy   string        `json:"created_by" gorm:"type:varchar(36)"`
 
 	// Relations
 	Project    *Project     `json:"project,omitempty" gorm:"foreignKey:ProjectID"`
@@ -130,3 +130,32 @@ func (w *Workflow) TransitionTo(target WorkflowState) error {
 
 	return nil
 }
+
+// WorkflowGraph is the dependency graph of a workflow's activities
+type WorkflowGraph struct {
+	WorkflowID string `json:"workflow_id"`
+	// Nodes are in topological order: every activity after its predecessors
+	Nodes []WorkflowGraphNode `json:"nodes"`
+	Edges []WorkflowGraphEdge `json:"edges"`
+}
+
+// WorkflowGraphNode is an activity in a workflow graph
+type WorkflowGraphNode struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Type         ActivityType   `json:"type"`
+	Status       ActivityStatus `json:"status"`
+	PlannedStart *time.Time     `json:"planned_start"`
+	PlannedEnd   *time.Time     `json:"planned_end"`
+	// Level is the length of the longest chain of predecessors
+	Level int `json:"level"`
+}
+
+// WorkflowGraphEdge links a predecessor to its successor
+type WorkflowGraphEdge struct {
+	ID   string `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+	Lag  int    `json:"lag"`
+}
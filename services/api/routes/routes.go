@@ -3,17 +3,32 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 
-	"rdp/services/api/handlers"
-	"rdp/services/api/middleware"
-	"rdp/services/api/services"
+	"rdp-platform/rdp-api/handlers"
+	"rdp-platform/rdp-api/middleware"
+	"rdp-platform/rdp-api/services"
 )
 
 // Router manages all application routes
 type Router struct {
-	engine          *gin.Engine
-	userService     *services.UserService
-	projectService  *services.ProjectService
-	authMiddleware  *middleware.AuthMiddleware
+	engine                *gin.Engine
+	userService           *services.UserService
+	projectService        *services.ProjectService
+	fileService           *services.FileService
+	oidcService           *services.OIDCService
+	directoryService      *services.DirectorySyncService
+	permissionService     *services.PermissionService
+	classificationService *services.ClassificationService
+	changeService         *services.ClassificationChangeService
+	exportService         *services.ExportService
+	auditService          *services.AuditService
+	securityService       *services.SecurityService
+	auditQueue            *services.AuditQueue
+	stateMachine          *services.StateMachineService
+	activityService       *services.ActivityService
+	approvalService       *services.ApprovalService
+	qualityGateService    *services.QualityGateService
+	authMiddleware        *middleware.AuthMiddleware
+	rbacMiddleware        *middleware.RBACMiddleware
 }
 
 // NewRouter creates a new Router
@@ -21,13 +36,42 @@ func NewRouter(
 	engine *gin.Engine,
 	userService *services.UserService,
 	projectService *services.ProjectService,
+	fileService *services.FileService,
+	oidcService *services.OIDCService,
+	directoryService *services.DirectorySyncService,
+	permissionService *services.PermissionService,
+	classificationService *services.ClassificationService,
+	changeService *services.ClassificationChangeService,
+	exportService *services.ExportService,
+	auditService *services.AuditService,
+	securityService *services.SecurityService,
+	auditQueue *services.AuditQueue,
+	stateMachine *services.StateMachineService,
+	activityService *services.ActivityService,
+	approvalService *services.ApprovalService,
+	qualityGateService *services.QualityGateService,
 	authMiddleware *middleware.AuthMiddleware,
 ) *Router {
 	return &Router{
-		engine:          engine,
-		userService:     userService,
-		projectService:  projectService,
-		authMiddleware:  authMiddleware,
+		engine:                engine,
+		userService:           userService,
+		projectService:        projectService,
+		fileService:           fileService,
+		oidcService:           oidcService,
+		directoryService:      directoryService,
+		permissionService:     permissionService,
+		classificationService: classificationService,
+		changeService:         changeService,
+		exportService:         exportService,
+		auditService:          auditService,
+		securityService:       securityService,
+		auditQueue:            auditQueue,
+		stateMachine:          stateMachine,
+		activityService:       activityService,
+		approvalService:       approvalService,
+		qualityGateService:    qualityGateService,
+		authMiddleware:        authMiddleware,
+		rbacMiddleware:        middleware.NewRBACMiddleware(permissionService),
 	}
 }
 
@@ -48,8 +92,26 @@ func (r *Router) SetupRoutes() {
 		// User routes (authenticated)
 		r.setupUserRoutes(v1)
 
+		// Organization routes (authenticated)
+		r.setupOrganizationRoutes(v1)
+
 		// Project routes (authenticated)
 		r.setupProjectRoutes(v1)
+
+		// Workflow and activity routes (authenticated)
+		r.setupWorkflowRoutes(v1)
+
+		// Permission policy routes (authenticated)
+		r.setupPermissionRoutes(v1)
+
+		// Data classification routes (authenticated)
+		r.setupClassificationRoutes(v1)
+
+		// Classified file export routes (authenticated)
+		r.setupExportRoutes(v1)
+
+		// Audit log routes (authenticated)
+		r.setupAuditRoutes(v1)
 	}
 }
 
@@ -57,13 +119,14 @@ func (r *Router) SetupRoutes() {
 func (r *Router) setupGlobalMiddleware() {
 	r.engine.Use(middleware.CORS())
 	r.engine.Use(middleware.SecurityHeaders())
+	r.engine.Use(middleware.ClientContext())
+	r.engine.Use(middleware.NewAuditMiddleware(r.auditQueue).Audit())
 	r.engine.Use(gin.Recovery())
 }
 
 // setupHealthRoutes configures health check routes
 func (r *Router) setupHealthRoutes() {
-	healthHandler := handlers.NewHealthHandler()
-	r.engine.GET("/api/v1/health", healthHandler.HealthCheck)
+	r.engine.GET("/api/v1/health", handlers.HealthCheck)
 }
 
 // setupAuthRoutes configures authentication routes
@@ -74,146 +137,295 @@ func (r *Router) setupAuthRoutes(group *gin.RouterGroup) {
 	{
 		auth.POST("/login", userHandler.Login)
 		auth.POST("/refresh", userHandler.RefreshToken)
+		auth.POST("/change-password", userHandler.ChangeRequiredPassword)
 		auth.POST("/logout", r.authMiddleware.Authenticate(), userHandler.Logout)
+		auth.POST("/heartbeat", r.authMiddleware.Authenticate(), userHandler.Heartbeat)
+		auth.GET("/session-info", r.authMiddleware.AuthenticatePassive(), userHandler.SessionInfo)
+
+		// Second login step (TOTP)
+		auth.POST("/mfa/verify", userHandler.VerifyMFA)
+		auth.POST("/mfa/enroll", userHandler.BeginLoginMFAEnrollment)
+		auth.POST("/mfa/enroll/confirm", userHandler.ConfirmLoginMFAEnrollment)
+
+		// Single sign-on (authorization code + PKCE)
+		oidcHandler := handlers.NewOIDCHandler(r.oidcService)
+		auth.GET("/oidc/authorize", oidcHandler.Authorize)
+		auth.POST("/oidc/callback", oidcHandler.Callback)
 	}
 }
 
 // setupUserRoutes configures user routes
 func (r *Router) setupUserRoutes(group *gin.RouterGroup) {
 	userHandler := handlers.NewUserHandler(r.userService, nil)
+	classificationHandler := handlers.NewClassificationHandler(r.classificationService, r.changeService)
+	can := r.rbacMiddleware.RequirePermission
 
 	users := group.Group("/users")
 	users.Use(r.authMiddleware.Authenticate())
 	{
 		// List users
-		users.GET("", userHandler.ListUsers)
+		users.GET("", can("user", "read"), userHandler.ListUsers)
 
 		// Current user
-		users.GET("/me", userHandler.CurrentUser)
-		users.PUT("/me", userHandler.UpdateCurrentUser)
+		users.GET("/me", can("profile", "read"), userHandler.CurrentUser)
+		users.PUT("/me", can("profile", "update"), userHandler.UpdateCurrentUser)
+		users.PUT("/me/password", can("profile", "update"), userHandler.ChangePassword)
+
+		// Personal access tokens
+		users.GET("/me/tokens", can("profile", "read"), userHandler.ListMyTokens)
+		users.POST("/me/tokens", can("profile", "update"), userHandler.CreateMyToken)
+		users.DELETE("/me/tokens/:tokenId", can("profile", "update"), userHandler.RevokeMyToken)
+
+		// Two-factor authentication
+		users.GET("/me/mfa", can("profile", "read"), userHandler.GetMyMFA)
+		users.POST("/me/mfa", can("profile", "update"), userHandler.BeginMyMFAEnrollment)
+		users.POST("/me/mfa/confirm", can("profile", "update"), userHandler.ConfirmMyMFAEnrollment)
+		users.DELETE("/me/mfa", can("profile", "update"), userHandler.DisableMyMFA)
+		users.POST("/me/mfa/recovery-codes", can("profile", "update"), userHandler.RegenerateMyRecoveryCodes)
 
 		// User projects
-		users.GET("/me/projects", r.projectHandler().GetUserProjects)
+		users.GET("/me/projects", can("profile", "read"), r.projectHandler().GetUserProjects)
 
-		// Create user (admin only)
-		users.POST("", r.requireRole("admin"), userHandler.CreateUser)
+		// Create user
+		users.POST("", can("user", "create"), userHandler.CreateUser)
 
-		// Single user routes
+		// Single user routes; a user acting on their own account is checked
+		// in the self domain
 		user := users.Group("/:id")
+		user.Use(r.rbacMiddleware.SelfScope("id"))
 		{
-			user.GET("", userHandler.GetUser)
-			user.PUT("", r.requireRoleOrSelf("admin"), userHandler.UpdateUser)
-			user.DELETE("", r.requireRole("admin"), userHandler.DeleteUser)
+			user.GET("", can("user", "read"), userHandler.GetUser)
+			user.PUT("", can("user", "update"), userHandler.UpdateUser)
+			user.DELETE("", can("user", "delete"), userHandler.DeleteUser)
+			user.POST("/unlock", can("user", "unlock"), userHandler.UnlockUser)
+			user.POST("/force-password-reset", can("user", "reset_password"), userHandler.ForcePasswordReset)
+			user.GET("/tokens", can("user", "manage_tokens"), userHandler.ListUserTokens)
+			user.DELETE("/tokens", can("user", "manage_tokens"), userHandler.RevokeUserTokens)
+			user.DELETE("/tokens/:tokenId", can("user", "manage_tokens"), userHandler.RevokeUserToken)
+			user.DELETE("/mfa", can("user", "reset_mfa"), userHandler.ResetUserMFA)
+			user.PUT("/clearance", can("user", "set_clearance"), classificationHandler.SetClearance)
 		}
 	}
 }
 
+// setupOrganizationRoutes configures organization routes
+func (r *Router) setupOrganizationRoutes(group *gin.RouterGroup) {
+	directoryHandler := handlers.NewDirectoryHandler(r.directoryService)
+	can := r.rbacMiddleware.RequirePermission
+
+	orgs := group.Group("/organizations")
+	orgs.Use(r.authMiddleware.Authenticate())
+	{
+		// Sync the organization tree and users from LDAP
+		orgs.POST("/sync", can("organization", "sync"), directoryHandler.Sync)
+	}
+}
+
 // setupProjectRoutes configures project routes
 func (r *Router) setupProjectRoutes(group *gin.RouterGroup) {
 	projectHandler := r.projectHandler()
+	fileHandler := handlers.NewFileHandler(r.fileService)
+	can := r.rbacMiddleware.RequirePermission
 
 	projects := group.Group("/projects")
 	projects.Use(r.authMiddleware.Authenticate())
 	{
 		// List and create projects
-		projects.GET("", projectHandler.GetProjects)
-		projects.POST("", projectHandler.CreateProject)
+		projects.GET("", can("project", "read"), projectHandler.GetProjects)
+		projects.POST("", can("project", "create"), projectHandler.CreateProject)
 
 		// Project stats
-		projects.GET("/stats", projectHandler.GetProjectStats)
+		projects.GET("/stats", can("project", "read"), projectHandler.GetProjectStats)
 
-		// Single project routes
+		// Single project routes, checked in the project's domain so project
+		// roles only apply to their own project
 		project := projects.Group("/:id")
+		project.Use(r.rbacMiddleware.ProjectScope("id"))
 		{
-			project.GET("", projectHandler.GetProject)
-			project.PUT("", projectHandler.UpdateProject)
-			project.DELETE("", projectHandler.DeleteProject)
+			project.GET("", can("project", "read"), projectHandler.GetProject)
+			project.PUT("", can("project", "update"), projectHandler.UpdateProject)
+			project.DELETE("", can("project", "delete"), projectHandler.DeleteProject)
 
 			// Progress
-			project.PUT("/progress", projectHandler.UpdateProgress)
+			project.PUT("/progress", can("project", "update"), projectHandler.UpdateProgress)
 
 			// Gantt chart data
-			project.GET("/gantt", projectHandler.GetProjectGantt)
+			project.GET("/gantt", can("project", "read"), projectHandler.GetProjectGantt)
+			project.GET("/schedule/critical-path", can("project", "read"), projectHandler.GetCriticalPath)
+			// Working calendar for rescheduling
+			project.GET("/calendar", can("project", "read"), projectHandler.GetCalendar)
+			project.PUT("/calendar", can("project", "update"), projectHandler.UpdateCalendar)
 
 			// Members
-			project.GET("/members", projectHandler.GetMembers)
-			project.POST("/members", projectHandler.AddMember)
-			project.DELETE("/members/:userId", projectHandler.RemoveMember)
-			project.PUT("/members/:userId/role", projectHandler.UpdateMemberRole)
+			project.GET("/members", can("member", "read"), projectHandler.GetMembers)
+			project.POST("/members", can("member", "create"), projectHandler.AddMember)
+			project.DELETE("/members/:userId", can("member", "delete"), projectHandler.RemoveMember)
+			project.PUT("/members/:userId/role", can("member", "update"), projectHandler.UpdateMemberRole)
 
 			// Activities
-			project.GET("/activities", projectHandler.GetProjectActivities)
-			project.POST("/activities", projectHandler.CreateActivity)
+			project.GET("/activities", can("activity", "read"), projectHandler.GetProjectActivities)
+			project.POST("/activities", can("activity", "create"), projectHandler.CreateActivity)
+			// Move an activity's dates and its successors; ?preview=true
+			// returns the changes without saving them
+			project.PUT("/activities/:activityId/schedule", can("activity", "update"), projectHandler.RescheduleActivity)
+
+			// Files; files classified internal or higher are only handed out
+			// through an approved export request
+			project.GET("/files", can("file", "read"), fileHandler.ListFiles)
+			project.POST("/files", can("file", "create"), fileHandler.UploadFile)
+			project.POST("/files/directory", can("file", "create"), fileHandler.CreateDirectory)
+			project.DELETE("/files/:fileId", can("file", "delete"), fileHandler.DeleteFile)
+			project.GET("/files/:fileId/download", can("file", "read"), fileHandler.DownloadFile)
 		}
 	}
 }
 
-// projectHandler creates a new ProjectHandler instance
-func (r *Router) projectHandler() *handlers.ProjectHandler {
-	return handlers.NewProjectHandler(r.projectService)
+// setupWorkflowRoutes configures workflow, activity, approval and quality
+// gate routes. Workflows and activities are checked in the domain of the
+// project owning them.
+func (r *Router) setupWorkflowRoutes(group *gin.RouterGroup) {
+	workflowHandler := handlers.NewWorkflowHandler(r.stateMachine)
+	activityHandler := handlers.NewActivityHandler(r.activityService)
+	approvalHandler := handlers.NewApprovalHandler(r.approvalService)
+	qualityGateHandler := handlers.NewQualityGateHandler(r.qualityGateService)
+	can := r.rbacMiddleware.RequirePermission
+
+	workflow := group.Group("/workflows/:id")
+	workflow.Use(r.authMiddleware.Authenticate(), r.rbacMiddleware.ProjectScopeOf("id", r.stateMachine.WorkflowProjectID))
+	{
+		// Dependency graph in topological order
+		workflow.GET("/graph", can("activity", "read"), workflowHandler.GetGraph)
+	}
+
+	activity := group.Group("/activities/:id")
+	activity.Use(r.authMiddleware.Authenticate(), r.rbacMiddleware.ProjectScopeOf("id", r.activityService.ActivityProjectID))
+	{
+		activity.GET("", can("activity", "read"), activityHandler.GetActivity)
+		activity.POST("/dependencies", can("activity", "update"), activityHandler.AddDependency)
+		// Next statuses open to the current user, and status changes
+		activity.GET("/transitions", can("activity", "read"), activityHandler.ListTransitions)
+		activity.POST("/transitions", can("activity", "update"), activityHandler.TransitionActivity)
+		activity.POST("/submit-for-approval", can("activity", "update"), approvalHandler.SubmitForApproval)
+		// Quality gates of a DCP, their evaluation and waiver requests
+		activity.GET("/quality-gates", can("activity", "read"), qualityGateHandler.ListGates)
+		activity.POST("/quality-gates", can("activity", "update"), qualityGateHandler.CreateGate)
+		activity.POST("/quality-gates/evaluate", can("activity", "update"), qualityGateHandler.Evaluate)
+		activity.POST("/quality-gates/:gate_id/waivers", can("activity", "update"), qualityGateHandler.RequestWaiver)
+	}
+
+	// Approvers need not be project members, so the service checks that
+	// the caller is the approver of the current step
+	approvals := group.Group("/approvals")
+	approvals.Use(r.authMiddleware.Authenticate())
+	{
+		approvals.GET("/pending", can("approval", "read"), approvalHandler.ListPending)
+		approvals.POST("/:id/approve", can("approval", "approve"), approvalHandler.Approve)
+		approvals.POST("/:id/reject", can("approval", "approve"), approvalHandler.Reject)
+	}
+
+	// Waivers are decided by the department leader they were sent to
+	waivers := group.Group("/quality-gate-waivers")
+	waivers.Use(r.authMiddleware.Authenticate())
+	{
+		waivers.GET("/pending", can("quality_gate_waiver", "read"), qualityGateHandler.ListPendingWaivers)
+		waivers.POST("/:id/approve", can("quality_gate_waiver", "approve"), qualityGateHandler.ApproveWaiver)
+		waivers.POST("/:id/reject", can("quality_gate_waiver", "approve"), qualityGateHandler.RejectWaiver)
+	}
 }
 
-// requireRole middleware requires specific role
-func (r *Router) requireRole(roles ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(401, gin.H{"code": 401, "message": "unauthorized"})
-			c.Abort()
-			return
-		}
+// setupPermissionRoutes configures permission policy administration
+func (r *Router) setupPermissionRoutes(group *gin.RouterGroup) {
+	permissionHandler := handlers.NewPermissionHandler(r.permissionService)
+	can := r.rbacMiddleware.RequirePermission
 
-		userRole := role.(string)
-		for _, r := range roles {
-			if string(r) == userRole {
-				c.Next()
-				return
-			}
-		}
+	permissions := group.Group("/permissions")
+	permissions.Use(r.authMiddleware.Authenticate())
+	{
+		permissions.GET("/policies", can("permission", "read"), permissionHandler.ListPolicies)
+		permissions.POST("/policies", can("permission", "update"), permissionHandler.AddPolicy)
+		permissions.DELETE("/policies", can("permission", "update"), permissionHandler.RemovePolicy)
 
-		c.JSON(403, gin.H{"code": 403, "message": "forbidden"})
-		c.Abort()
+		permissions.GET("/roles", can("permission", "read"), permissionHandler.ListRoleBindings)
+		permissions.POST("/roles", can("permission", "update"), permissionHandler.AddRoleBinding)
+		permissions.DELETE("/roles", can("permission", "update"), permissionHandler.RemoveRoleBinding)
 	}
 }
 
-// requireRoleOrSelf middleware requires specific role or self
-func (r *Router) requireRoleOrSelf(roles ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(401, gin.H{"code": 401, "message": "unauthorized"})
-			c.Abort()
-			return
-		}
+// setupClassificationRoutes configures named access grants and the
+// reclassification workflow
+func (r *Router) setupClassificationRoutes(group *gin.RouterGroup) {
+	classificationHandler := handlers.NewClassificationHandler(r.classificationService, r.changeService)
+	can := r.rbacMiddleware.RequirePermission
 
-		// Check if accessing self
-		paramID := c.Param("id")
-		if userID == paramID {
-			c.Next()
-			return
-		}
+	classification := group.Group("/classification")
+	classification.Use(r.authMiddleware.Authenticate())
+	{
+		// Changes; the service checks resource ownership and the approver
+		// of each stage
+		classification.GET("/changes", can("classification", "read"), classificationHandler.ListPendingChanges)
+		classification.POST("/changes", can("classification", "request"), classificationHandler.RequestChange)
+		classification.POST("/changes/:changeId/approve", can("classification", "review"), classificationHandler.ApproveChange)
+		classification.POST("/changes/:changeId/reject", can("classification", "review"), classificationHandler.RejectChange)
+		classification.POST("/changes/:changeId/cancel", can("classification", "request"), classificationHandler.CancelChange)
+
+		// Named individuals
+		classification.GET("/grants", can("classification", "grant"), classificationHandler.ListGrants)
+		classification.POST("/grants", can("classification", "grant"), classificationHandler.AddGrant)
+		classification.DELETE("/grants/:grantId", can("classification", "grant"), classificationHandler.RemoveGrant)
+
+		// Current level and change history of a project or file
+		classification.GET("/:resource_type/:resource_id", can("classification", "read"), classificationHandler.GetHistory)
+	}
+}
 
-		// Check role
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(401, gin.H{"code": 401, "message": "unauthorized"})
-			c.Abort()
-			return
-		}
+// setupExportRoutes configures export requests and one-time download links
+func (r *Router) setupExportRoutes(group *gin.RouterGroup) {
+	exportHandler := handlers.NewExportHandler(r.exportService)
+	can := r.rbacMiddleware.RequirePermission
 
-		userRole := role.(string)
-		for _, r := range roles {
-			if string(r) == userRole {
-				c.Next()
-				return
-			}
-		}
+	exports := group.Group("/exports")
+	exports.Use(r.authMiddleware.Authenticate())
+	{
+		// Requests; the service checks file access, the approver of each
+		// stage and that links are redeemed by the requester
+		exports.GET("", can("export", "request"), exportHandler.ListExports)
+		exports.POST("", can("export", "request"), exportHandler.RequestExport)
+		exports.POST("/:exportId/approve", can("export", "review"), exportHandler.ApproveExport)
+		exports.POST("/:exportId/reject", can("export", "review"), exportHandler.RejectExport)
+		exports.POST("/:exportId/cancel", can("export", "request"), exportHandler.CancelExport)
+		exports.POST("/:exportId/link", can("export", "request"), exportHandler.IssueLink)
+
+		// One-time download
+		exports.GET("/download/:token", can("export", "request"), exportHandler.Download)
+	}
+}
+
+// setupAuditRoutes configures audit log administration
+func (r *Router) setupAuditRoutes(group *gin.RouterGroup) {
+	auditHandler := handlers.NewAuditHandler(r.auditService, r.auditQueue)
+	securityHandler := handlers.NewSecurityHandler(r.securityService, r.userService.Sessions())
+	can := r.rbacMiddleware.RequirePermission
 
-		c.JSON(403, gin.H{"code": 403, "message": "forbidden"})
-		c.Abort()
+	audit := group.Group("/audit-logs")
+	audit.Use(r.authMiddleware.Authenticate())
+	{
+		// Paged entries filtered by user, action, resource, classification,
+		// severity and date
+		audit.GET("", can("audit", "read"), securityHandler.ListAuditLogs)
+		// Recompute the hash chain and report the first broken link
+		audit.GET("/verify", can("audit", "verify"), auditHandler.VerifyChain)
+		// Dropped, spilled and delayed request events
+		audit.GET("/metrics", can("audit", "read"), auditHandler.QueueMetrics)
+		// Stream filtered entries as CSV or JSON Lines
+		audit.GET("/export", can("audit", "read"), auditHandler.ExportLogs)
 	}
 }
 
+// projectHandler creates a new ProjectHandler instance
+func (r *Router) projectHandler() *handlers.ProjectHandler {
+	return handlers.NewProjectHandler(r.projectService)
+}
+
 // RoleHierarchy defines role hierarchy for permission checking
 var RoleHierarchy = map[string]int{
 	"other":       0,
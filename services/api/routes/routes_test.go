@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/middleware"
+	"rdp-platform/rdp-api/models"
+	"rdp-platform/rdp-api/services"
+)
+
+// RoutesTestSuite 路由权限测试套件，经由完整的中间件链调用接口
+type RoutesTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	userService *services.UserService
+	engine      *gin.Engine
+}
+
+func (s *RoutesTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:routes?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Session{}, &models.TokenBlacklist{}, &models.RefreshToken{}, &models.LoginLog{},
+		&models.PasswordHistory{}, &models.PersonalAccessToken{}, &models.UserMFA{}, &models.MFARecoveryCode{},
+		&models.CasbinRule{}, &models.AuditLog{}, &models.AuditChainHead{},
+	))
+	for _, table := range []string{"users", "sessions", "token_blacklists", "refresh_tokens", "login_logs", "password_histories",
+		"personal_access_tokens", "user_mfa", "mfa_recovery_codes", "casbin_rule", "audit_logs", "audit_chain_heads"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.userService = services.NewUserService(s.db, models.AuthConfig{
+		JWTSecret:       "test-secret",
+		AccessTokenTTL:  2 * time.Hour,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		Issuer:          "rdp-api-test",
+		Audience:        "rdp-users-test",
+	})
+	permissionService, err := services.NewPermissionService(s.db, models.PermissionConfig{})
+	require.NoError(s.T(), err)
+	auditQueue := services.NewAuditQueue(s.db, models.AuditConfig{SpillDir: s.T().TempDir()})
+
+	s.engine = gin.New()
+	router := NewRouter(s.engine, s.userService, services.NewProjectService(s.db), services.NewFileService(s.db, s.T().TempDir()),
+		services.NewOIDCService(s.db, models.OIDCConfig{}, s.userService), services.NewDirectorySyncService(s.db, models.LDAPConfig{}),
+		permissionService, services.NewClassificationService(s.db), services.NewClassificationChangeService(s.db, permissionService),
+		services.NewExportService(s.db, models.ExportConfig{}, permissionService), services.NewAuditService(s.db, models.AuditConfig{}),
+		services.NewSecurityService(s.db), auditQueue, services.NewStateMachineService(s.db), services.NewActivityService(s.db),
+		services.NewApprovalService(s.db), services.NewQualityGateService(s.db), middleware.NewAuthMiddleware(s.userService))
+	router.SetupRoutes()
+}
+
+func TestRoutesSuite(t *testing.T) {
+	suite.Run(t, new(RoutesTestSuite))
+}
+
+// login 创建指定角色的用户并返回其访问令牌
+func (s *RoutesTestSuite) login(username, role string) (*models.User, string) {
+	user, err := s.userService.CreateUser(context.Background(), models.CreateUserRequest{
+		Username: username,
+		Password: "TestPass123",
+		Role:     role,
+	})
+	require.NoError(s.T(), err)
+	tokens, err := s.userService.StartSession(context.Background(), user, "127.0.0.1", "test")
+	require.NoError(s.T(), err)
+	return user, tokens.AccessToken
+}
+
+// put 以令牌持有人身份发送PUT请求
+func (s *RoutesTestSuite) put(path, token string, body interface{}) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", path, bytes.NewBuffer(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// role 返回用户当前的角色
+func (s *RoutesTestSuite) role(user *models.User) string {
+	stored, err := s.userService.GetUserByID(context.Background(), user.ID.String())
+	require.NoError(s.T(), err)
+	return stored.Role
+}
+
+// TestUpdateUser_CannotChangeOwnRole 测试普通用户不能通过用户管理接口提升自己的角色
+func (s *RoutesTestSuite) TestUpdateUser_CannotChangeOwnRole() {
+	user, token := s.login("designer", models.RoleDesigner)
+
+	w := s.put("/api/v1/users/"+user.ID.String(), token, map[string]interface{}{"role": models.RoleAdmin})
+
+	assert.Equal(s.T(), http.StatusForbidden, w.Code)
+	assert.Equal(s.T(), models.RoleDesigner, s.role(user))
+}
+
+// TestUpdateCurrentUser_KeepsRole 测试修改个人资料时忽略角色字段
+func (s *RoutesTestSuite) TestUpdateCurrentUser_KeepsRole() {
+	user, token := s.login("designer", models.RoleDesigner)
+
+	w := s.put("/api/v1/users/me", token, map[string]interface{}{"display_name": "Designer", "role": models.RoleAdmin})
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), models.RoleDesigner, s.role(user))
+}
+
+// TestUpdateUser_AdminChangesRole 测试管理员可以修改其他用户的角色
+func (s *RoutesTestSuite) TestUpdateUser_AdminChangesRole() {
+	_, token := s.login("admin", models.RoleAdmin)
+	user, _ := s.login("designer", models.RoleDesigner)
+
+	w := s.put("/api/v1/users/"+user.ID.String(), token, map[string]interface{}{"role": models.RoleTeamLeader})
+
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), models.RoleTeamLeader, s.role(user))
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Personal access token errors
+var (
+	ErrPersonalTokenNotFound = errors.New("personal access token not found")
+	ErrPersonalTokenInvalid  = errors.New("invalid, expired or revoked personal access token")
+	ErrPersonalTokenRequest  = errors.New("invalid personal access token request")
+	ErrPersonalTokenLimit    = errors.New("personal access token limit reached")
+)
+
+// Default personal access token limits
+const (
+	DefaultPersonalTokenMaxLifetime = 365 * 24 * time.Hour
+	DefaultPersonalTokensPerUser    = 20
+
+	// personalTokenTouchInterval throttles last-used updates so busy
+	// scripts do not write on every request
+	personalTokenTouchInterval = time.Minute
+)
+
+// Audit actions for personal access tokens
+const (
+	AuditActionPersonalTokenCreated = "personal_token_created"
+	AuditActionPersonalTokenRevoked = "personal_token_revoked"
+)
+
+// withPersonalTokenDefaults fills unset personal token limits
+func withPersonalTokenDefaults(cfg models.AuthConfig) models.AuthConfig {
+	if cfg.PersonalTokens.MaxLifetime <= 0 {
+		cfg.PersonalTokens.MaxLifetime = DefaultPersonalTokenMaxLifetime
+	}
+	if cfg.PersonalTokens.MaxPerUser <= 0 {
+		cfg.PersonalTokens.MaxPerUser = DefaultPersonalTokensPerUser
+	}
+	return cfg
+}
+
+// CreatePersonalAccessToken mints a token for the user. The plaintext token
+// is only returned here; the database keeps its hash.
+func (s *UserService) CreatePersonalAccessToken(ctx context.Context, userID string, req *models.CreatePersonalAccessTokenRequest) (*models.CreatePersonalAccessTokenResponse, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range req.Scopes {
+		if !models.IsValidTokenScope(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrPersonalTokenRequest, scope)
+		}
+	}
+	lifetime := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	if lifetime <= 0 || lifetime > s.authConfig.PersonalTokens.MaxLifetime {
+		return nil, fmt.Errorf("%w: lifetime must be between 1 day and %d days",
+			ErrPersonalTokenRequest, int(s.authConfig.PersonalTokens.MaxLifetime.Hours()/24))
+	}
+
+	var active int64
+	if err := s.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active >= int64(s.authConfig.PersonalTokens.MaxPerUser) {
+		return nil, ErrPersonalTokenLimit
+	}
+
+	secret, err := randomURLSafe(32)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := models.PersonalAccessTokenPrefix + secret
+
+	token := &models.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		TokenHash: hashPersonalToken(plaintext),
+		Hint:      plaintext[len(plaintext)-4:],
+		Scopes:    req.Scopes,
+		ExpiresAt: time.Now().Add(lifetime),
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.WithContext(ctx).Create(token).Error; err != nil {
+		return nil, err
+	}
+
+	actorID, actorName := actorFromContext(ctx)
+	if err := s.security.LogAction(ctx, actorID, actorName, AuditActionPersonalTokenCreated, "personal_access_token", token.ID.String(), "internal"); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatePersonalAccessTokenResponse{PersonalAccessToken: token, Token: plaintext}, nil
+}
+
+// ListPersonalAccessTokens returns the user's tokens, newest first,
+// including expired and revoked ones
+func (s *UserService) ListPersonalAccessTokens(ctx context.Context, userID string) ([]models.PersonalAccessToken, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", uid).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokePersonalAccessToken revokes one of the user's tokens
+func (s *UserService) RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	tid, err := uuid.Parse(tokenID)
+	if err != nil {
+		return ErrPersonalTokenNotFound
+	}
+
+	var token models.PersonalAccessToken
+	if err := s.db.WithContext(ctx).First(&token, "id = ? AND user_id = ?", tid, uid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPersonalTokenNotFound
+		}
+		return err
+	}
+	if token.RevokedAt != nil {
+		return nil
+	}
+
+	return s.revokePersonalTokens(ctx, "id = ?", token.ID)
+}
+
+// RevokeAllPersonalAccessTokens revokes every active token of the user
+func (s *UserService) RevokeAllPersonalAccessTokens(ctx context.Context, userID string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	return s.revokePersonalTokens(ctx, "user_id = ?", uid)
+}
+
+// ValidatePersonalAccessToken checks a personal access token and returns
+// claims built from the owner's current record, so it can be used wherever
+// access token claims are expected
+func (s *UserService) ValidatePersonalAccessToken(ctx context.Context, plaintext string) (*models.JWTClaims, error) {
+	var token models.PersonalAccessToken
+	if err := s.db.WithContext(ctx).First(&token, "token_hash = ?", hashPersonalToken(plaintext)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPersonalTokenInvalid
+		}
+		return nil, err
+	}
+	if !token.IsActive() {
+		return nil, ErrPersonalTokenInvalid
+	}
+
+	user, err := s.GetUserByID(ctx, token.UserID.String())
+	if err != nil {
+		return nil, ErrPersonalTokenInvalid
+	}
+	if !user.IsActive {
+		return nil, ErrUserDisabled
+	}
+
+	s.touchPersonalToken(ctx, &token)
+
+	claims := &models.JWTClaims{
+		UserID:    user.ID.String(),
+		Username:  user.Username,
+		Role:      user.Role,
+		TokenType: models.TokenTypePersonal,
+		Scopes:    token.Scopes,
+	}
+	claims.ID = token.ID.String()
+	if user.Team != nil {
+		claims.Team = *user.Team
+	}
+	if user.ProductLine != nil {
+		claims.ProductLine = *user.ProductLine
+	}
+	return claims, nil
+}
+
+// touchPersonalToken records when and from where the token was last used.
+// Failures are ignored; they must not fail the request.
+func (s *UserService) touchPersonalToken(ctx context.Context, token *models.PersonalAccessToken) {
+	now := time.Now()
+	ip, _ := clientFromContext(ctx)
+	ipChanged := ip != nil && (token.LastUsedIP == nil || *token.LastUsedIP != *ip)
+	if !ipChanged && token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < personalTokenTouchInterval {
+		return
+	}
+
+	updates := map[string]interface{}{"last_used_at": now}
+	if ip != nil {
+		updates["last_used_ip"] = *ip
+	}
+	s.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).Where("id = ?", token.ID).Updates(updates)
+}
+
+// revokePersonalTokens marks the active tokens matching the condition
+// revoked and audits each one
+func (s *UserService) revokePersonalTokens(ctx context.Context, query string, args ...interface{}) error {
+	var ids []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).
+		Where(query, args...).
+		Where("revoked_at IS NULL").
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	actorID, actorName := actorFromContext(ctx)
+	updates := map[string]interface{}{"revoked_at": time.Now()}
+	if actorID != nil {
+		updates["revoked_by"] = *actorID
+	}
+	if err := s.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Updates(updates).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.security.LogAction(ctx, actorID, actorName, AuditActionPersonalTokenRevoked, "personal_access_token", id.String(), "internal"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashPersonalToken returns the hex SHA-256 of a token. Tokens carry 256
+// bits of randomness, so a fast unsalted hash is sufficient.
+func hashPersonalToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
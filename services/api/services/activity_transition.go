@@ -0,0 +1,339 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Activity transition errors
+var (
+	ErrInvalidActivityTransition = errors.New("invalid activity transition")
+	ErrTransitionNotPermitted    = errors.New("not permitted to make this activity transition")
+	ErrTransitionGuardFailed     = errors.New("activity transition guard failed")
+)
+
+// Notification types raised by activity transitions
+const (
+	NotificationActivityReviewRequested = "activity_review_requested"
+	NotificationActivityApproved        = "activity_approved"
+	NotificationActivityRejected        = "activity_rejected"
+)
+
+// Deliverable statuses counted as submitted
+var submittedDeliverableStatuses = []string{"submitted", "approved"}
+
+// TransitionActivity moves an activity to another status following the
+// activity state machine: the actor must be allowed to make the change and
+// its guards must pass. The change is recorded and the workflow advanced
+// in the same transaction.
+func (s *ActivityService) TransitionActivity(activityID string, to models.ActivityStatus, actorID, comment string) (*models.Activity, error) {
+	var activity *models.Activity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		activity, err = transitionActivity(tx, activityID, to, actorID, comment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// AvailableTransitions lists the statuses the user can move the activity
+// to now
+func (s *ActivityService) AvailableTransitions(activityID, userID string) ([]models.ActivityStatus, error) {
+	var activity models.Activity
+	if err := s.db.First(&activity, "id = ?", activityID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrActivityNotFound
+		}
+		return nil, err
+	}
+
+	available := []models.ActivityStatus{}
+	if err := checkActivityEditable(s.db, activity.ID); err != nil {
+		if errors.Is(err, ErrActivityFrozen) {
+			return available, nil
+		}
+		return nil, err
+	}
+	for i := range models.ActivityTransitions {
+		rule := &models.ActivityTransitions[i]
+		if rule.From != activity.Status || rule.Actor == models.ActivityActorSystem {
+			continue
+		}
+		allowed, err := activityActorAllowed(s.db, &activity, rule.Actor, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		if err := checkActivityGuards(s.db, &activity, rule.Guards); err != nil {
+			if errors.Is(err, ErrTransitionGuardFailed) {
+				continue
+			}
+			return nil, err
+		}
+		available = append(available, rule.To)
+	}
+
+	return available, nil
+}
+
+// ListTransitions returns the status history of an activity, oldest first
+func (s *ActivityService) ListTransitions(activityID string) ([]models.ActivityTransition, error) {
+	var transitions []models.ActivityTransition
+	if err := s.db.Where("activity_id = ?", activityID).Order("created_at ASC, id ASC").Find(&transitions).Error; err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// transitionActivity makes a user transition inside a transaction
+func transitionActivity(tx *gorm.DB, activityID string, to models.ActivityStatus, actorID, comment string) (*models.Activity, error) {
+	var activity models.Activity
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&activity, "id = ?", activityID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrActivityNotFound
+		}
+		return nil, err
+	}
+
+	if err := activity.CanTransitionTo(to); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidActivityTransition, err)
+	}
+	if err := checkActivityEditable(tx, activity.ID); err != nil {
+		return nil, err
+	}
+	rule := models.FindActivityTransition(activity.Status, to)
+	if rule.Actor == models.ActivityActorSystem {
+		return nil, fmt.Errorf("%w: %s to %s is made by the workflow engine", ErrInvalidActivityTransition, activity.Status, to)
+	}
+	allowed, err := activityActorAllowed(tx, &activity, rule.Actor, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrTransitionNotPermitted
+	}
+	if err := checkActivityGuards(tx, &activity, rule.Guards); err != nil {
+		return nil, err
+	}
+
+	if err := commitTransition(tx, &activity, to, actorID, comment); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// commitTransition applies a transition that has been checked: it saves
+// the activity with its new status, records and announces the change and
+// advances the workflow
+func commitTransition(tx *gorm.DB, activity *models.Activity, to models.ActivityStatus, actorID, comment string) error {
+	from := activity.Status
+	applyTransitionActions(activity, to)
+	if err := tx.Omit(clause.Associations).Save(activity).Error; err != nil {
+		return err
+	}
+	if err := recordTransition(tx, activity, from, actorID, comment); err != nil {
+		return err
+	}
+	if err := notifyTransition(tx, activity, comment); err != nil {
+		return err
+	}
+	return advanceWorkflow(tx, activity.WorkflowID)
+}
+
+// applyTransitionActions sets the new status and the timestamps and
+// progress that go with it
+func applyTransitionActions(activity *models.Activity, to models.ActivityStatus) {
+	switch to {
+	case models.ActivityStatusRunning:
+		if activity.Status == models.ActivityStatusRejected || activity.Status == models.ActivityStatusReviewing {
+			// Rework: the activity is no longer finished
+			activity.ActualEnd = nil
+		} else {
+			activity.Start()
+		}
+	case models.ActivityStatusCompleted:
+		activity.Complete()
+	case models.ActivityStatusReviewing:
+		if activity.ActualEnd == nil {
+			activity.Complete()
+		}
+	}
+	activity.Status = to
+}
+
+// notifyTransition tells the people who act next about a transition
+func notifyTransition(tx *gorm.DB, activity *models.Activity, comment string) error {
+	switch activity.Status {
+	case models.ActivityStatusReviewing:
+		// Approvers of an approval are notified by the approval itself
+		if activity.EffectiveApprovalPolicy() != nil {
+			return nil
+		}
+		var project models.Project
+		if err := tx.Select("leader_id").Where("id = ?", activity.ProjectID).Limit(1).Find(&project).Error; err != nil {
+			return err
+		}
+		if project.LeaderID == nil {
+			return nil
+		}
+		return notifyUser(tx, project.LeaderID.String(), NotificationActivityReviewRequested, fmt.Sprintf("活动「%s」已提交评审", activity.Name), "activity", activity.ID)
+	case models.ActivityStatusApproved:
+		return notifyActivityOwner(tx, activity, NotificationActivityApproved, fmt.Sprintf("活动「%s」已通过评审", activity.Name))
+	case models.ActivityStatusRejected:
+		title := fmt.Sprintf("活动「%s」被驳回", activity.Name)
+		if comment != "" {
+			title += "：" + comment
+		}
+		return notifyActivityOwner(tx, activity, NotificationActivityRejected, title)
+	}
+	return nil
+}
+
+// recordTransition stores a status change in the activity's history
+func recordTransition(tx *gorm.DB, activity *models.Activity, from models.ActivityStatus, actorID, comment string) error {
+	return tx.Create(&models.ActivityTransition{
+		ActivityID: activity.ID,
+		FromStatus: from,
+		ToStatus:   activity.Status,
+		ActorID:    actorID,
+		Comment:    comment,
+	}).Error
+}
+
+// activityActorAllowed checks if the user acts as the given actor for the
+// activity
+func activityActorAllowed(db *gorm.DB, activity *models.Activity, actor models.ActivityActor, userID string) (bool, error) {
+	switch actor {
+	case models.ActivityActorAssignee:
+		if activity.AssigneeID != nil && *activity.AssigneeID == userID {
+			return true, nil
+		}
+		if activity.AssigneeID == nil {
+			member, err := isProjectMember(db, activity.ProjectID, userID)
+			if err != nil || member {
+				return member, err
+			}
+		}
+		return isProjectManager(db, activity.ProjectID, userID)
+	case models.ActivityActorManager:
+		return isProjectManager(db, activity.ProjectID, userID)
+	}
+	return false, nil
+}
+
+// isProjectManager checks if the user is an administrator, the project's
+// leader or tech leader, or one of its managers
+func isProjectManager(db *gorm.DB, projectID, userID string) (bool, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return false, nil
+	}
+
+	var users []models.User
+	if err := db.Select("role").Where("id = ?", uid).Limit(1).Find(&users).Error; err != nil {
+		return false, err
+	}
+	if len(users) > 0 && users[0].Role == models.RoleAdmin {
+		return true, nil
+	}
+
+	var projects []models.Project
+	if err := db.Select("leader_id", "tech_leader_id").Where("id = ?", projectID).Limit(1).Find(&projects).Error; err != nil {
+		return false, err
+	}
+	if len(projects) > 0 {
+		project := projects[0]
+		if (project.LeaderID != nil && *project.LeaderID == uid) || (project.TechLeaderID != nil && *project.TechLeaderID == uid) {
+			return true, nil
+		}
+	}
+
+	var count int64
+	err = db.Model(&models.ProjectMember{}).
+		Where("project_id = ? AND user_id = ? AND role IN ?", projectID, uid, []string{"manager", "leader"}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// isProjectMember checks if the user is a member of the project
+func isProjectMember(db *gorm.DB, projectID, userID string) (bool, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return false, nil
+	}
+	var count int64
+	err = db.Model(&models.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, uid).Count(&count).Error
+	return count > 0, err
+}
+
+// checkActivityGuards returns ErrTransitionGuardFailed, naming the guard,
+// when one of them does not pass
+func checkActivityGuards(db *gorm.DB, activity *models.Activity, guards []models.ActivityGuard) error {
+	for _, guard := range guards {
+		var passed bool
+		var err error
+		switch guard {
+		case models.ActivityGuardStartDependencies:
+			passed, err = dependenciesMet(db, activity.ID, false)
+		case models.ActivityGuardFinishDependencies:
+			passed, err = dependenciesMet(db, activity.ID, true)
+		case models.ActivityGuardDeliverables:
+			passed, err = deliverablesSubmitted(db, activity.ID)
+		case models.ActivityGuardApproval:
+			passed, err = approvalPassed(db, activity)
+		case models.ActivityGuardQualityGates:
+			passed, err = qualityGatesPassed(db, activity)
+		default:
+			return fmt.Errorf("unknown activity guard %s", guard)
+		}
+		if err != nil {
+			return err
+		}
+		if !passed {
+			return fmt.Errorf("%w: %s", ErrTransitionGuardFailed, guard)
+		}
+	}
+	return nil
+}
+
+// deliverablesSubmitted checks if every deliverable of the activity has
+// been submitted
+func deliverablesSubmitted(db *gorm.DB, activityID string) (bool, error) {
+	var outstanding int64
+	err := db.Model(&models.Deliverable{}).
+		Where("activity_id = ? AND submitted_at IS NULL AND status NOT IN ?", activityID, submittedDeliverableStatuses).
+		Count(&outstanding).Error
+	return outstanding == 0, err
+}
+
+// approvalPassed checks if the activity's latest approval, or else its
+// latest review, approved it. Activities that need neither pass.
+func approvalPassed(db *gorm.DB, activity *models.Activity) (bool, error) {
+	var approvals []models.Approval
+	if err := db.Select("status").Where("activity_id = ?", activity.ID).Order("created_at DESC, id DESC").Limit(1).Find(&approvals).Error; err != nil {
+		return false, err
+	}
+	if len(approvals) > 0 {
+		return approvals[0].Status == models.ApprovalStatusApproved, nil
+	}
+
+	var reviews []models.Review
+	if err := db.Where("activity_id = ?", activity.ID).Order("created_at DESC").Limit(1).Find(&reviews).Error; err != nil {
+		return false, err
+	}
+	if len(reviews) == 0 {
+		return !activity.RequireReview && activity.EffectiveApprovalPolicy() == nil, nil
+	}
+	return reviews[0].Status == models.ReviewStatusApproved, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ActivityTransitionTestSuite 活动状态机测试套件
+type ActivityTransitionTestSuite struct {
+	suite.Suite
+	db         *gorm.DB
+	activities *ActivityService
+	projects   *ProjectService
+	project    *models.Project
+	workflow   *models.Workflow
+	leaderID   uuid.UUID
+	assigneeID uuid.UUID
+	memberID   uuid.UUID
+	outsiderID uuid.UUID
+}
+
+func (s *ActivityTransitionTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:activity_transition?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.Notification{}, &models.Workflow{},
+		&models.Activity{}, &models.Dependency{}, &models.Deliverable{}, &models.Review{}, &models.ActivityTransition{}, &models.Approval{},
+	))
+	for _, table := range []string{"projects", "project_members", "notifications", "workflows", "activities", "activity_dependencies", "deliverables", "reviews", "activity_transitions", "approvals"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.leaderID, s.assigneeID, s.memberID, s.outsiderID = uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	s.project = &models.Project{ID: uuid.New(), Code: "P-ACT", Name: "活动", Category: "module", LeaderID: &s.leaderID}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+	require.NoError(s.T(), s.db.Create(&models.ProjectMember{ID: uuid.New(), ProjectID: s.project.ID, UserID: s.memberID, Role: "member"}).Error)
+
+	s.activities = NewActivityService(s.db)
+	s.projects = NewProjectService(s.db)
+	s.workflow, err = NewStateMachineService(s.db).CreateWorkflow(s.project.ID.String(), "", "模块开发", "", s.leaderID.String())
+	require.NoError(s.T(), err)
+}
+
+func TestActivityTransitionSuite(t *testing.T) {
+	suite.Run(t, new(ActivityTransitionTestSuite))
+}
+
+// createActivity 创建分配给测试负责人的活动
+func (s *ActivityTransitionTestSuite) createActivity(name string, status models.ActivityStatus) *models.Activity {
+	assignee := s.assigneeID.String()
+	activity := &models.Activity{WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: name, Status: status, AssigneeID: &assignee}
+	require.NoError(s.T(), s.db.Create(activity).Error)
+	return activity
+}
+
+// available 返回用户可执行的后续状态
+func (s *ActivityTransitionTestSuite) available(activity *models.Activity, userID uuid.UUID) []models.ActivityStatus {
+	statuses, err := s.activities.AvailableTransitions(activity.ID, userID.String())
+	require.NoError(s.T(), err)
+	return statuses
+}
+
+// TestTransition_ActorsAndHistory 测试执行者校验、时间戳动作与流转历史
+func (s *ActivityTransitionTestSuite) TestTransition_ActorsAndHistory() {
+	activity := s.createActivity("设计", models.ActivityStatusReady)
+
+	_, err := s.activities.TransitionActivity(activity.ID, models.ActivityStatusRunning, s.outsiderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionNotPermitted)
+	// 已分配的活动只有负责人或项目经理可以执行
+	_, err = s.activities.TransitionActivity(activity.ID, models.ActivityStatusRunning, s.memberID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionNotPermitted)
+	_, err = s.activities.TransitionActivity(activity.ID, models.ActivityStatusSkipped, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionNotPermitted)
+	_, err = s.activities.TransitionActivity(activity.ID, models.ActivityStatusApproved, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrInvalidActivityTransition)
+	// 就绪与阻塞之间的流转由工作流引擎完成
+	_, err = s.activities.TransitionActivity(activity.ID, models.ActivityStatusPending, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrInvalidActivityTransition)
+
+	running, err := s.activities.TransitionActivity(activity.ID, models.ActivityStatusRunning, s.assigneeID.String(), "开工")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ActivityStatusRunning, running.Status)
+	assert.NotNil(s.T(), running.ActualStart)
+
+	completed, err := s.activities.TransitionActivity(activity.ID, models.ActivityStatusCompleted, s.assigneeID.String(), "")
+	require.NoError(s.T(), err)
+	assert.NotNil(s.T(), completed.ActualEnd)
+	assert.Equal(s.T(), 100, completed.Progress)
+
+	history, err := s.activities.ListTransitions(activity.ID)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), history, 2)
+	assert.Equal(s.T(), models.ActivityStatusReady, history[0].FromStatus)
+	assert.Equal(s.T(), models.ActivityStatusRunning, history[0].ToStatus)
+	assert.Equal(s.T(), s.assigneeID.String(), history[0].ActorID)
+	assert.Equal(s.T(), "开工", history[0].Comment)
+	assert.Equal(s.T(), models.ActivityStatusCompleted, history[1].ToStatus)
+}
+
+// TestTransition_Guards 测试依赖、交付物与评审守卫
+func (s *ActivityTransitionTestSuite) TestTransition_Guards() {
+	design := s.createActivity("设计", models.ActivityStatusRunning)
+	build := s.createActivity("实现", models.ActivityStatusPending)
+	_, err := s.activities.AddDependency(build.ID, design.ID, "", 0)
+	require.NoError(s.T(), err)
+
+	_, err = s.activities.TransitionActivity(build.ID, models.ActivityStatusRunning, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionGuardFailed)
+	assert.Contains(s.T(), err.Error(), string(models.ActivityGuardStartDependencies))
+
+	deliverable := &models.Deliverable{ActivityID: design.ID, Name: "设计报告", Type: "document", Status: "draft"}
+	require.NoError(s.T(), s.db.Create(deliverable).Error)
+	_, err = s.activities.TransitionActivity(design.ID, models.ActivityStatusCompleted, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionGuardFailed)
+	assert.Contains(s.T(), err.Error(), string(models.ActivityGuardDeliverables))
+
+	now := time.Now()
+	require.NoError(s.T(), s.db.Model(deliverable).Updates(map[string]interface{}{"status": "submitted", "submitted_at": now}).Error)
+	_, err = s.activities.TransitionActivity(design.ID, models.ActivityStatusReviewing, s.assigneeID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(build), "reviewing does not release finish_to_start successors")
+
+	// 需要评审的活动在评审通过前不能批准
+	require.NoError(s.T(), s.db.Model(design).Update("require_review", true).Error)
+	_, err = s.activities.TransitionActivity(design.ID, models.ActivityStatusApproved, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionGuardFailed)
+	assert.Contains(s.T(), err.Error(), string(models.ActivityGuardApproval))
+
+	review := &models.Review{ActivityID: design.ID, ProjectID: s.project.ID.String(), Type: models.ReviewTypeDCP, Status: models.ReviewStatusApproved, CreatedBy: s.leaderID.String()}
+	require.NoError(s.T(), s.db.Create(review).Error)
+	_, err = s.activities.TransitionActivity(design.ID, models.ActivityStatusApproved, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionNotPermitted)
+	_, err = s.activities.TransitionActivity(design.ID, models.ActivityStatusApproved, s.leaderID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ActivityStatusReady, s.status(build))
+
+	var kinds []string
+	require.NoError(s.T(), s.db.Model(&models.Notification{}).Where("user_id = ?", s.leaderID).Pluck("type", &kinds).Error)
+	assert.Contains(s.T(), kinds, NotificationActivityReviewRequested)
+}
+
+// TestAvailableTransitions_PerUser 测试按用户列出可执行的后续状态
+func (s *ActivityTransitionTestSuite) TestAvailableTransitions_PerUser() {
+	activity := s.createActivity("测试", models.ActivityStatusReady)
+
+	assert.Equal(s.T(), []models.ActivityStatus{models.ActivityStatusRunning}, s.available(activity, s.assigneeID))
+	assert.ElementsMatch(s.T(), []models.ActivityStatus{models.ActivityStatusRunning, models.ActivityStatusSkipped}, s.available(activity, s.leaderID))
+	assert.Empty(s.T(), s.available(activity, s.outsiderID))
+
+	// 未分配的活动对项目成员开放
+	require.NoError(s.T(), s.db.Model(activity).Update("assignee_id", nil).Error)
+	assert.Equal(s.T(), []models.ActivityStatus{models.ActivityStatusRunning}, s.available(activity, s.memberID))
+
+	_, err := s.activities.AvailableTransitions("missing", s.leaderID.String())
+	assert.ErrorIs(s.T(), err, ErrActivityNotFound)
+}
+
+// TestUpdateActivity_StatusGoesThroughStateMachine 测试项目活动更新的状态变更经由状态机
+func (s *ActivityTransitionTestSuite) TestUpdateActivity_StatusGoesThroughStateMachine() {
+	activity := s.createActivity("样机", models.ActivityStatusReady)
+	ctx := context.Background()
+
+	updated, err := s.projects.UpdateActivity(ctx, activity.ID, map[string]interface{}{"name": "样机试制", "status": "running"}, s.assigneeID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "样机试制", updated.Name)
+	assert.Equal(s.T(), models.ActivityStatusRunning, updated.Status)
+	assert.NotNil(s.T(), updated.ActualStart)
+
+	// 非法流转回滚同一请求中的字段修改
+	_, err = s.projects.UpdateActivity(ctx, activity.ID, map[string]interface{}{"name": "改名", "status": "approved"}, s.assigneeID.String())
+	assert.ErrorIs(s.T(), err, ErrInvalidActivityTransition)
+	assert.Equal(s.T(), "样机试制", s.name(activity))
+
+	_, err = s.projects.UpdateActivity(ctx, activity.ID, map[string]interface{}{"workflow_id": "other"}, s.assigneeID.String())
+	assert.Error(s.T(), err)
+	_, err = s.projects.UpdateActivity(ctx, "missing", map[string]interface{}{"name": "无"}, s.assigneeID.String())
+	assert.ErrorIs(s.T(), err, ErrActivityNotFound)
+}
+
+// status 读取活动当前状态
+func (s *ActivityTransitionTestSuite) status(activity *models.Activity) models.ActivityStatus {
+	var current models.Activity
+	require.NoError(s.T(), s.db.First(&current, "id = ?", activity.ID).Error)
+	return current.Status
+}
+
+// name 读取活动当前名称
+func (s *ActivityTransitionTestSuite) name(activity *models.Activity) string {
+	var current models.Activity
+	require.NoError(s.T(), s.db.First(&current, "id = ?", activity.ID).Error)
+	return current.Name
+}
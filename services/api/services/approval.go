@@ -0,0 +1,405 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Approval errors
+var (
+	ErrApprovalNotFound        = errors.New("approval not found")
+	ErrApprovalNotRequired     = errors.New("activity does not require approval")
+	ErrApprovalAlreadyPending  = errors.New("an approval is already pending for this activity")
+	ErrApprovalNotPending      = errors.New("approval is no longer pending")
+	ErrApproverNotResolved     = errors.New("no approver found for approval role")
+	ErrNotApprover             = errors.New("not an approver for the current step")
+	ErrApprovalCommentRequired = errors.New("a comment is required to reject an approval")
+	ErrActivityFrozen          = errors.New("activity cannot be edited while an approval is pending")
+)
+
+// NotificationApprovalRequested tells an approver that their decision is
+// needed
+const NotificationApprovalRequested = "approval_requested"
+
+// ApprovalService runs activity approvals (SRS-DEV-004): the assignee
+// submits the activity, the approvers its policy resolves to decide in
+// turn or in parallel, and the outcome approves the activity or sends it
+// back to running
+type ApprovalService struct {
+	db *gorm.DB
+}
+
+// NewApprovalService creates a new ApprovalService
+func NewApprovalService(db *gorm.DB) *ApprovalService {
+	return &ApprovalService{db: db}
+}
+
+// SubmitForApproval moves the activity to reviewing and asks its approvers
+// for a decision. The activity cannot be edited until they have decided.
+// Its quality gates are evaluated first; a failed gate that has not been
+// waived returns a QualityGateError and the activity stays where it is.
+func (s *ApprovalService) SubmitForApproval(activityID, userID, comment string) (*models.Approval, error) {
+	// Recorded apart from the submission so failures are kept too
+	results, err := evaluateQualityGates(s.db, activityID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.Blocks() {
+			return nil, &QualityGateError{Results: results}
+		}
+	}
+
+	var approval *models.Approval
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var activity models.Activity
+		if err := tx.First(&activity, "id = ?", activityID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrActivityNotFound
+			}
+			return err
+		}
+		policy := activity.EffectiveApprovalPolicy()
+		if policy == nil {
+			return ErrApprovalNotRequired
+		}
+		if err := checkActivityEditable(tx, activity.ID); err != nil {
+			if errors.Is(err, ErrActivityFrozen) {
+				return ErrApprovalAlreadyPending
+			}
+			return err
+		}
+
+		steps, err := resolveApprovers(tx, activity.ProjectID, policy.Roles)
+		if err != nil {
+			return err
+		}
+		if activity.Status != models.ActivityStatusReviewing {
+			if _, err := transitionActivity(tx, activity.ID, models.ActivityStatusReviewing, userID, comment); err != nil {
+				return err
+			}
+		}
+
+		approval = &models.Approval{
+			ActivityID:  activity.ID,
+			ProjectID:   activity.ProjectID,
+			Mode:        policy.Mode,
+			Quorum:      policy.Quorum,
+			Status:      models.ApprovalStatusPending,
+			Comment:     comment,
+			RequestedBy: userID,
+			Steps:       steps,
+		}
+		if approval.Mode == "" {
+			approval.Mode = models.ApprovalModeSerial
+		}
+		if err := tx.Create(approval).Error; err != nil {
+			return err
+		}
+		return notifyApprovers(tx, approval, activity.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// Approve records the user's approval. The approval is decided once every
+// serial step, or the quorum of a parallel one, has approved.
+func (s *ApprovalService) Approve(approvalID, userID, comment string) (*models.Approval, error) {
+	return s.decide(approvalID, userID, true, comment)
+}
+
+// Reject records the user's rejection with the reason for it. Once the
+// approval can no longer pass, the activity goes back to running.
+func (s *ApprovalService) Reject(approvalID, userID, comment string) (*models.Approval, error) {
+	if comment == "" {
+		return nil, ErrApprovalCommentRequired
+	}
+	return s.decide(approvalID, userID, false, comment)
+}
+
+// ListPending returns the pending approvals awaiting the user's decision
+func (s *ApprovalService) ListPending(userID string) ([]models.Approval, error) {
+	var approvals []models.Approval
+	steps := s.db.Model(&models.ApprovalStep{}).Select("approval_id").
+		Where("approver_id = ? AND status = ?", userID, models.ApprovalStatusPending)
+	if err := s.db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sequence ASC")
+	}).Preload("Activity").
+		Where("status = ? AND id IN (?)", models.ApprovalStatusPending, steps).
+		Order("created_at ASC").
+		Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+
+	// Later steps of a serial approval are not the user's turn yet
+	pending := make([]models.Approval, 0, len(approvals))
+	for _, approval := range approvals {
+		if activeStep(&approval, userID) != nil {
+			pending = append(pending, approval)
+		}
+	}
+	return pending, nil
+}
+
+// decide records a decision on the user's step and settles the approval
+// and its activity when the decision is final
+func (s *ApprovalService) decide(approvalID, userID string, approve bool, comment string) (*models.Approval, error) {
+	var approval models.Approval
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the approval before reading its steps, so parallel
+		// approvers are counted one after the other and the last one
+		// sees every earlier decision
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&models.Approval{}, "id = ?", approvalID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrApprovalNotFound
+			}
+			return err
+		}
+		if err := tx.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+			return db.Order("sequence ASC")
+		}).First(&approval, "id = ?", approvalID).Error; err != nil {
+			return err
+		}
+		if !approval.IsPending() {
+			return ErrApprovalNotPending
+		}
+		step := activeStep(&approval, userID)
+		if step == nil {
+			return ErrNotApprover
+		}
+
+		now := time.Now()
+		step.Status = models.ApprovalStatusRejected
+		if approve {
+			step.Status = models.ApprovalStatusApproved
+		}
+		step.Comment = comment
+		step.DecidedAt = &now
+		if err := tx.Save(step).Error; err != nil {
+			return err
+		}
+
+		approved, open := 0, 0
+		for i := range approval.Steps {
+			switch approval.Steps[i].Status {
+			case models.ApprovalStatusApproved:
+				approved++
+			case models.ApprovalStatusPending:
+				open++
+			}
+		}
+		updates := map[string]interface{}{}
+		currentStep := approval.CurrentStep
+		switch {
+		case approved >= approval.Required():
+			approval.Status = models.ApprovalStatusApproved
+		case !approve && (approval.Mode == models.ApprovalModeSerial || approved+open < approval.Required()):
+			approval.Status = models.ApprovalStatusRejected
+		case approval.Mode == models.ApprovalModeSerial:
+			approval.CurrentStep++
+			updates["current_step"] = approval.CurrentStep
+		}
+		if !approval.IsPending() {
+			approval.DecidedAt = &now
+			updates["status"] = approval.Status
+			updates["decided_at"] = now
+		}
+
+		// Guard against a concurrent decision on the same step
+		if len(updates) > 0 {
+			result := tx.Model(&models.Approval{}).
+				Where("id = ? AND status = ? AND current_step = ?", approval.ID, models.ApprovalStatusPending, currentStep).
+				Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrApprovalNotPending
+			}
+		}
+
+		var activity models.Activity
+		if err := tx.First(&activity, "id = ?", approval.ActivityID).Error; err != nil {
+			return err
+		}
+		if approval.IsPending() {
+			if approval.Mode == models.ApprovalModeSerial {
+				return notifyApprovers(tx, &approval, activity.Name)
+			}
+			return nil
+		}
+
+		// Steps still open when a quorum decided are no longer needed
+		if err := tx.Model(&models.ApprovalStep{}).
+			Where("approval_id = ? AND status = ?", approval.ID, models.ApprovalStatusPending).
+			Updates(map[string]interface{}{"status": models.ApprovalStatusSkipped, "decided_at": now}).Error; err != nil {
+			return err
+		}
+		for i := range approval.Steps {
+			if approval.Steps[i].Status == models.ApprovalStatusPending {
+				approval.Steps[i].Status = models.ApprovalStatusSkipped
+				approval.Steps[i].DecidedAt = &now
+			}
+		}
+		return settleActivity(tx, &activity, &approval, userID, comment)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &approval, nil
+}
+
+// settleActivity approves the activity of an approved approval, or
+// sends it back to running with the approver's comment when rejected.
+// Approvers act for the project's managers here.
+func settleActivity(tx *gorm.DB, activity *models.Activity, approval *models.Approval, userID, comment string) error {
+	to := models.ActivityStatusRunning
+	if approval.Status == models.ApprovalStatusApproved {
+		to = models.ActivityStatusApproved
+	}
+	if err := activity.CanTransitionTo(to); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidActivityTransition, err)
+	}
+	rule := models.FindActivityTransition(activity.Status, to)
+	if err := checkActivityGuards(tx, activity, rule.Guards); err != nil {
+		return err
+	}
+	if err := commitTransition(tx, activity, to, userID, comment); err != nil {
+		return err
+	}
+	if to == models.ActivityStatusRunning {
+		return notifyActivityOwner(tx, activity, NotificationActivityRejected, fmt.Sprintf("活动「%s」审批被驳回：%s", activity.Name, comment))
+	}
+	return nil
+}
+
+// activeStep returns the user's step that can be decided now, or nil
+func activeStep(approval *models.Approval, userID string) *models.ApprovalStep {
+	for i := range approval.Steps {
+		step := &approval.Steps[i]
+		if step.ApproverID == userID && approval.IsActive(step) {
+			return step
+		}
+	}
+	return nil
+}
+
+// notifyApprovers notifies the approvers whose decision is needed now
+func notifyApprovers(tx *gorm.DB, approval *models.Approval, activityName string) error {
+	for i := range approval.Steps {
+		step := &approval.Steps[i]
+		if !approval.IsActive(step) {
+			continue
+		}
+		if err := notifyUser(tx, step.ApproverID, NotificationApprovalRequested, fmt.Sprintf("活动「%s」等待您审批", activityName), "approval", approval.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveApprovers turns approval roles into steps for the project's
+// people in those roles. The department leader is the leader of the
+// project leader's organization. A person holding several roles approves
+// once, at their first one.
+func resolveApprovers(tx *gorm.DB, projectID string, roles []string) ([]models.ApprovalStep, error) {
+	var project models.Project
+	if err := tx.First(&project, "id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("project not found")
+		}
+		return nil, err
+	}
+
+	steps := make([]models.ApprovalStep, 0, len(roles))
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		approver := ""
+		switch role {
+		case models.ApprovalRoleLeader:
+			if project.LeaderID != nil {
+				approver = project.LeaderID.String()
+			}
+		case models.ApprovalRoleTechLeader:
+			if project.TechLeaderID != nil {
+				approver = project.TechLeaderID.String()
+			}
+		case models.ApprovalRoleProductLeader:
+			if project.ProductLeaderID != nil {
+				approver = project.ProductLeaderID.String()
+			}
+		case models.ApprovalRoleDeptLeader:
+			leader, err := departmentLeader(tx, &project)
+			if err != nil {
+				return nil, err
+			}
+			approver = leader
+		}
+		if approver == "" {
+			return nil, fmt.Errorf("%w: %s", ErrApproverNotResolved, role)
+		}
+		if seen[approver] {
+			continue
+		}
+		seen[approver] = true
+		steps = append(steps, models.ApprovalStep{
+			Sequence:   len(steps),
+			Role:       role,
+			ApproverID: approver,
+			Status:     models.ApprovalStatusPending,
+		})
+	}
+	if len(steps) == 0 {
+		return nil, ErrApproverNotResolved
+	}
+	return steps, nil
+}
+
+// departmentLeader returns the leader of the project leader's
+// organization, or "" when there is none
+func departmentLeader(tx *gorm.DB, project *models.Project) (string, error) {
+	if project.LeaderID == nil {
+		return "", nil
+	}
+	var leaders []models.User
+	if err := tx.Select("organization_id").Where("id = ?", *project.LeaderID).Limit(1).Find(&leaders).Error; err != nil {
+		return "", err
+	}
+	if len(leaders) == 0 || leaders[0].OrganizationID == nil {
+		return "", nil
+	}
+	var organizations []models.Organization
+	if err := tx.Select("leader_id").Where("id = ?", *leaders[0].OrganizationID).Limit(1).Find(&organizations).Error; err != nil {
+		return "", err
+	}
+	if len(organizations) == 0 || organizations[0].LeaderID == nil {
+		return "", nil
+	}
+	return organizations[0].LeaderID.String(), nil
+}
+
+// checkActivityEditable returns ErrActivityFrozen while an approval of the
+// activity is pending
+func checkActivityEditable(db *gorm.DB, activityID string) error {
+	var pending int64
+	if err := db.Model(&models.Approval{}).
+		Where("activity_id = ? AND status = ?", activityID, models.ApprovalStatusPending).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return ErrActivityFrozen
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ApprovalTestSuite 活动审批链测试套件
+type ApprovalTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	approvals    *ApprovalService
+	activities   *ActivityService
+	project      *models.Project
+	workflow     *models.Workflow
+	leaderID     uuid.UUID
+	techLeaderID uuid.UUID
+	deptLeaderID uuid.UUID
+	assigneeID   uuid.UUID
+}
+
+func (s *ApprovalTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:approval?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Organization{}, &models.Project{}, &models.ProjectMember{}, &models.Notification{},
+		&models.Workflow{}, &models.Activity{}, &models.Dependency{}, &models.Deliverable{}, &models.Review{},
+		&models.ActivityTransition{}, &models.Approval{}, &models.ApprovalStep{}, &models.QualityGate{},
+	))
+	for _, table := range []string{"users", "organizations", "projects", "project_members", "notifications", "workflows", "activities",
+		"activity_dependencies", "deliverables", "reviews", "activity_transitions", "approvals", "approval_steps", "quality_gates"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.leaderID, s.techLeaderID, s.deptLeaderID, s.assigneeID = uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	organization := &models.Organization{ID: uuid.New(), Name: "微波事业部", Code: "MW", LeaderID: &s.deptLeaderID}
+	require.NoError(s.T(), s.db.Create(organization).Error)
+	require.NoError(s.T(), s.db.Create(&models.User{ID: s.leaderID, Username: "leader", DisplayName: "项目负责人", Role: models.RoleDesigner, OrganizationID: &organization.ID}).Error)
+
+	s.project = &models.Project{ID: uuid.New(), Code: "P-DCP", Name: "决策点", Category: "module", LeaderID: &s.leaderID, TechLeaderID: &s.techLeaderID}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+
+	s.approvals = NewApprovalService(s.db)
+	s.activities = NewActivityService(s.db)
+	s.workflow, err = NewStateMachineService(s.db).CreateWorkflow(s.project.ID.String(), "", "模块开发", "", s.leaderID.String())
+	require.NoError(s.T(), err)
+}
+
+func TestApprovalSuite(t *testing.T) {
+	suite.Run(t, new(ApprovalTestSuite))
+}
+
+// createDCP 创建一个进行中的决策点活动
+func (s *ApprovalTestSuite) createDCP(policy *models.ApprovalPolicy) *models.Activity {
+	assignee := s.assigneeID.String()
+	activity := &models.Activity{
+		WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: "DCP1", Type: models.ActivityTypeDCP,
+		Status: models.ActivityStatusRunning, AssigneeID: &assignee, ApprovalPolicy: policy,
+	}
+	require.NoError(s.T(), s.db.Create(activity).Error)
+	return activity
+}
+
+// activity 读取活动当前状态
+func (s *ApprovalTestSuite) activity(activity *models.Activity) *models.Activity {
+	var current models.Activity
+	require.NoError(s.T(), s.db.First(&current, "id = ?", activity.ID).Error)
+	return &current
+}
+
+// pending 返回用户待审批的审批单ID
+func (s *ApprovalTestSuite) pending(userID uuid.UUID) []string {
+	approvals, err := s.approvals.ListPending(userID.String())
+	require.NoError(s.T(), err)
+	ids := make([]string, 0, len(approvals))
+	for _, approval := range approvals {
+		ids = append(ids, approval.ID)
+	}
+	return ids
+}
+
+// TestSerial_ApprovesInTurnAndFreezesActivity 测试串行审批按顺序进行且审批期间冻结活动
+func (s *ApprovalTestSuite) TestSerial_ApprovesInTurnAndFreezesActivity() {
+	dcp := s.createDCP(nil)
+
+	approval, err := s.approvals.SubmitForApproval(dcp.ID, s.assigneeID.String(), "请审批")
+	require.NoError(s.T(), err)
+	// 默认策略：技术负责人、项目负责人依次审批
+	require.Len(s.T(), approval.Steps, 2)
+	assert.Equal(s.T(), s.techLeaderID.String(), approval.Steps[0].ApproverID)
+	assert.Equal(s.T(), s.leaderID.String(), approval.Steps[1].ApproverID)
+	assert.Equal(s.T(), models.ActivityStatusReviewing, s.activity(dcp).Status)
+
+	_, err = s.approvals.SubmitForApproval(dcp.ID, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrApprovalAlreadyPending)
+	assert.ErrorIs(s.T(), s.activities.UpdateActivityProgress(dcp.ID, 50), ErrActivityFrozen)
+	_, err = s.activities.TransitionActivity(dcp.ID, models.ActivityStatusApproved, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrActivityFrozen)
+	_, err = NewProjectService(s.db).UpdateActivity(context.Background(), dcp.ID, map[string]interface{}{"name": "改名"}, s.leaderID.String())
+	assert.ErrorIs(s.T(), err, ErrActivityFrozen)
+
+	// 项目负责人须等待技术负责人
+	assert.Empty(s.T(), s.pending(s.leaderID))
+	_, err = s.approvals.Approve(approval.ID, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrNotApprover)
+	assert.Equal(s.T(), []string{approval.ID}, s.pending(s.techLeaderID))
+
+	_, err = s.approvals.Approve(approval.ID, s.techLeaderID.String(), "同意")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{approval.ID}, s.pending(s.leaderID))
+	assert.Equal(s.T(), models.ActivityStatusReviewing, s.activity(dcp).Status)
+
+	decided, err := s.approvals.Approve(approval.ID, s.leaderID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ApprovalStatusApproved, decided.Status)
+	assert.NotNil(s.T(), decided.DecidedAt)
+	assert.Equal(s.T(), models.ActivityStatusApproved, s.activity(dcp).Status)
+	assert.NoError(s.T(), s.activities.UpdateActivityProgress(dcp.ID, 100))
+
+	_, err = s.approvals.Approve(approval.ID, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrApprovalNotPending)
+}
+
+// TestReject_ReturnsActivityToRunning 测试驳回需填写意见并使活动回到进行中
+func (s *ApprovalTestSuite) TestReject_ReturnsActivityToRunning() {
+	dcp := s.createDCP(nil)
+	approval, err := s.approvals.SubmitForApproval(dcp.ID, s.assigneeID.String(), "")
+	require.NoError(s.T(), err)
+
+	_, err = s.approvals.Reject(approval.ID, s.techLeaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrApprovalCommentRequired)
+
+	decided, err := s.approvals.Reject(approval.ID, s.techLeaderID.String(), "测试覆盖不足")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ApprovalStatusRejected, decided.Status)
+	assert.Equal(s.T(), models.ApprovalStatusSkipped, decided.Steps[1].Status)
+	current := s.activity(dcp)
+	assert.Equal(s.T(), models.ActivityStatusRunning, current.Status)
+	assert.Nil(s.T(), current.ActualEnd)
+
+	var notification models.Notification
+	require.NoError(s.T(), s.db.Where("user_id = ? AND type = ?", s.assigneeID, NotificationActivityRejected).First(&notification).Error)
+	assert.Contains(s.T(), notification.Title, "测试覆盖不足")
+
+	var history []models.ActivityTransition
+	require.NoError(s.T(), s.db.Where("activity_id = ?", dcp.ID).Order("created_at ASC, id ASC").Find(&history).Error)
+	last := history[len(history)-1]
+	assert.Equal(s.T(), models.ActivityStatusReviewing, last.FromStatus)
+	assert.Equal(s.T(), models.ActivityStatusRunning, last.ToStatus)
+	assert.Equal(s.T(), "测试覆盖不足", last.Comment)
+
+	// 返工后可再次提交
+	_, err = s.approvals.SubmitForApproval(dcp.ID, s.assigneeID.String(), "已补充")
+	assert.NoError(s.T(), err)
+}
+
+// TestParallel_QuorumAndDeptLeader 测试并行审批的法定人数及部门负责人解析
+func (s *ApprovalTestSuite) TestParallel_QuorumAndDeptLeader() {
+	dcp := s.createDCP(&models.ApprovalPolicy{
+		Mode:   models.ApprovalModeParallel,
+		Roles:  []string{models.ApprovalRoleLeader, models.ApprovalRoleTechLeader, models.ApprovalRoleDeptLeader},
+		Quorum: 2,
+	})
+	approval, err := s.approvals.SubmitForApproval(dcp.ID, s.assigneeID.String(), "")
+	require.NoError(s.T(), err)
+	require.Len(s.T(), approval.Steps, 3)
+	assert.Equal(s.T(), s.deptLeaderID.String(), approval.Steps[2].ApproverID)
+	// 并行审批同时通知全部审批人
+	for _, approver := range []uuid.UUID{s.leaderID, s.techLeaderID, s.deptLeaderID} {
+		assert.Equal(s.T(), []string{approval.ID}, s.pending(approver))
+	}
+
+	// 一票驳回时仍可能达到法定人数
+	_, err = s.approvals.Reject(approval.ID, s.deptLeaderID.String(), "预算超支")
+	require.NoError(s.T(), err)
+	_, err = s.approvals.Approve(approval.ID, s.leaderID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ActivityStatusReviewing, s.activity(dcp).Status)
+
+	decided, err := s.approvals.Approve(approval.ID, s.techLeaderID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ApprovalStatusApproved, decided.Status)
+	assert.Equal(s.T(), models.ActivityStatusApproved, s.activity(dcp).Status)
+}
+
+// TestSubmit_RequiresPolicyAndApprovers 测试无需审批或无法解析审批人时拒绝提交
+func (s *ApprovalTestSuite) TestSubmit_RequiresPolicyAndApprovers() {
+	assignee := s.assigneeID.String()
+	task := &models.Activity{WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: "任务", Status: models.ActivityStatusRunning, AssigneeID: &assignee}
+	require.NoError(s.T(), s.db.Create(task).Error)
+	_, err := s.approvals.SubmitForApproval(task.ID, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrApprovalNotRequired)
+
+	dcp := s.createDCP(&models.ApprovalPolicy{Mode: models.ApprovalModeSerial, Roles: []string{models.ApprovalRoleProductLeader}})
+	_, err = s.approvals.SubmitForApproval(dcp.ID, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrApproverNotResolved)
+	assert.Equal(s.T(), models.ActivityStatusRunning, s.activity(dcp).Status)
+
+	_, err = s.approvals.SubmitForApproval("missing", s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrActivityNotFound)
+}
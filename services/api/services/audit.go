@@ -0,0 +1,459 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidAuditPeriod is returned when a verification period ends before
+// it starts
+var ErrInvalidAuditPeriod = errors.New("invalid audit log period")
+
+// DefaultAuditCheckpointInterval is how often completed days are
+// checkpointed when not configured
+const DefaultAuditCheckpointInterval = time.Hour
+
+const (
+	// auditChainID identifies the chain head row
+	auditChainID = "audit_logs"
+	// auditVerifyBatchSize is how many entries verification loads at once
+	auditVerifyBatchSize = 1000
+	// auditDayFormat names the day of a checkpoint
+	auditDayFormat = "2006-01-02"
+)
+
+// auditChainMu serializes appends within the process; the locked chain
+// head serializes them across instances
+var auditChainMu sync.Mutex
+
+// chainAuditLogs links the entries to the end of the hash chain and
+// inserts them in one transaction. The entries are stamped with the time
+// they join the chain so creation time follows the sequence; entries
+// without an occurrence time get the same.
+func chainAuditLogs(ctx context.Context, db *gorm.DB, entries ...*models.AuditLog) error {
+	auditChainMu.Lock()
+	defer auditChainMu.Unlock()
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		head, err := lockAuditChainHead(tx)
+		if err != nil {
+			return err
+		}
+
+		// Postgres keeps microseconds; hash what will be read back
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		for _, entry := range entries {
+			if entry.ID == uuid.Nil {
+				entry.ID = uuid.New()
+			}
+			if entry.Classification == "" {
+				entry.Classification = models.ClassificationInternal
+			}
+			entry.CreatedAt = now
+			occurredAt := now
+			if entry.OccurredAt != nil {
+				occurredAt = entry.OccurredAt.UTC().Truncate(time.Microsecond)
+			}
+			entry.OccurredAt = &occurredAt
+			entry.Sequence = head.Sequence + 1
+			entry.PrevHash = head.Hash
+			entry.Hash = auditLogHash(entry)
+			head.Sequence, head.Hash = entry.Sequence, entry.Hash
+		}
+		if err := tx.Create(entries).Error; err != nil {
+			return err
+		}
+		return tx.Model(head).Updates(map[string]interface{}{
+			"sequence":   head.Sequence,
+			"hash":       head.Hash,
+			"updated_at": now,
+		}).Error
+	})
+}
+
+// lockAuditChainHead loads the chain head for update, starting the chain
+// on first use
+func lockAuditChainHead(tx *gorm.DB) (*models.AuditChainHead, error) {
+	var head models.AuditChainHead
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, "id = ?", auditChainID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.AuditChainHead{ID: auditChainID}).Error; err != nil {
+			return nil, err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, "id = ?", auditChainID).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// auditLogContent is the hashed representation of an entry; the field
+// order is fixed so the hash is reproducible
+type auditLogContent struct {
+	ID             uuid.UUID       `json:"id"`
+	Sequence       int64           `json:"sequence"`
+	UserID         *uuid.UUID      `json:"user_id"`
+	Username       *string         `json:"username"`
+	IPAddress      *string         `json:"ip_address"`
+	UserAgent      *string         `json:"user_agent"`
+	Action         string          `json:"action"`
+	Resource       string          `json:"resource"`
+	ResourceID     *string         `json:"resource_id"`
+	Method         *string         `json:"method"`
+	Path           *string         `json:"path"`
+	RequestBody    *string         `json:"request_body"`
+	ResponseCode   *int            `json:"response_code"`
+	ErrorMessage   *string         `json:"error_message"`
+	Classification string          `json:"classification"`
+	Severity       string          `json:"severity,omitempty"`
+	Details        json.RawMessage `json:"details,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	OccurredAt     string          `json:"occurred_at,omitempty"`
+}
+
+// auditLogHash returns SHA-256 over the previous hash and the entry's
+// content. Fields added after the chain was introduced are left out
+// when empty so older entries keep their hash.
+func auditLogHash(entry *models.AuditLog) string {
+	content := auditLogContent{
+		ID:             entry.ID,
+		Sequence:       entry.Sequence,
+		UserID:         entry.UserID,
+		Username:       entry.Username,
+		IPAddress:      entry.IPAddress,
+		UserAgent:      entry.UserAgent,
+		Action:         entry.Action,
+		Resource:       entry.Resource,
+		ResourceID:     entry.ResourceID,
+		Method:         entry.Method,
+		Path:           entry.Path,
+		RequestBody:    entry.RequestBody,
+		ResponseCode:   entry.ResponseCode,
+		ErrorMessage:   entry.ErrorMessage,
+		Classification: entry.Classification,
+		Severity:       entry.Severity,
+		CreatedAt:      entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if entry.OccurredAt != nil {
+		content.OccurredAt = entry.OccurredAt.UTC().Format(time.RFC3339Nano)
+	}
+	if entry.Details != nil {
+		// Maps marshal with sorted keys, so the details hash the same after
+		// a round trip through jsonb
+		content.Details, _ = json.Marshal(entry.Details)
+	}
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(append([]byte(entry.PrevHash), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditService seals the audit hash chain with daily checkpoints and
+// verifies it. Entries written before the chain existed (sequence 0) are
+// not covered.
+type AuditService struct {
+	db     *gorm.DB
+	config models.AuditConfig
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(db *gorm.DB, config models.AuditConfig) *AuditService {
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = DefaultAuditCheckpointInterval
+	}
+	if config.RetentionMonths <= 0 {
+		config.RetentionMonths = DefaultAuditRetentionMonths
+	}
+	if config.PartitionsAhead <= 0 {
+		config.PartitionsAhead = DefaultAuditPartitionsAhead
+	}
+	if config.ArchiveDir == "" {
+		config.ArchiveDir = DefaultAuditArchiveDir
+	}
+	if config.PartitionInterval <= 0 {
+		config.PartitionInterval = DefaultAuditPartitionInterval
+	}
+	return &AuditService{db: db, config: config}
+}
+
+// RunCheckpoints checkpoints every completed day until ctx is cancelled
+func (s *AuditService) RunCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.WriteCheckpoints(ctx, time.Now()); err != nil {
+			log.Printf("audit checkpoint failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteCheckpoints signs the chain head at the end of each day (UTC)
+// before now that has no checkpoint yet, returning how many were written
+func (s *AuditService) WriteCheckpoints(ctx context.Context, now time.Time) (int, error) {
+	db := s.db.WithContext(ctx)
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	var last models.AuditCheckpoint
+	var day time.Time
+	err := db.Order("day DESC").First(&last).Error
+	switch {
+	case err == nil:
+		previous, err := time.Parse(auditDayFormat, last.Day)
+		if err != nil {
+			return 0, err
+		}
+		day = previous.AddDate(0, 0, 1)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var first models.AuditLog
+		if err := db.Where("sequence > 0").Order("sequence ASC").First(&first).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		day = first.CreatedAt.UTC().Truncate(24 * time.Hour)
+	default:
+		return 0, err
+	}
+
+	written := 0
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		var entry models.AuditLog
+		if err := db.Select("sequence", "hash").
+			Where("sequence > 0 AND created_at < ?", day.AddDate(0, 0, 1)).
+			Order("sequence DESC").
+			Limit(1).
+			Find(&entry).Error; err != nil {
+			return written, err
+		}
+
+		checkpoint := models.AuditCheckpoint{
+			ID:            uuid.New(),
+			Day:           day.Format(auditDayFormat),
+			Sequence:      entry.Sequence,
+			Hash:          entry.Hash,
+			PrevSignature: last.Signature,
+		}
+		checkpoint.Signature = s.sign(&checkpoint)
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&checkpoint)
+		if result.Error != nil {
+			return written, result.Error
+		}
+		written += int(result.RowsAffected)
+
+		// Another instance may have written the day first; continue from
+		// the stored checkpoint
+		last = models.AuditCheckpoint{}
+		if err := db.First(&last, "day = ?", checkpoint.Day).Error; err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Verify recomputes the chain over the entries created in [from, to) and
+// checks the checkpoints of the days in between. The report names the
+// first broken link in sequence order: a modified entry, a missing
+// (deleted) entry, a link that does not match its predecessor or a
+// checkpoint that is not genuine.
+func (s *AuditService) Verify(ctx context.Context, from, to time.Time) (*models.AuditVerification, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidAuditPeriod
+	}
+	from, to = from.UTC(), to.UTC()
+	db := s.db.WithContext(ctx)
+	report := &models.AuditVerification{From: from, To: to, Valid: true}
+	fail := func(sequence int64, id *uuid.UUID, reason string) {
+		if report.FirstBroken == nil || sequence < report.FirstBroken.Sequence {
+			report.FirstBroken = &models.AuditChainBreak{Sequence: sequence, LogID: id, Reason: reason}
+		}
+		report.Valid = false
+	}
+
+	if err := s.verifyEntries(db, report, from, to, fail); err != nil {
+		return nil, err
+	}
+	if err := s.verifyCheckpoints(db, report, from, to, fail); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// verifyEntries walks the chain from the first entry of the period
+func (s *AuditService) verifyEntries(db *gorm.DB, report *models.AuditVerification, from, to time.Time, fail func(int64, *uuid.UUID, string)) error {
+	var first models.AuditLog
+	if err := db.Where("sequence > 0 AND created_at >= ? AND created_at < ?", from, to).
+		Order("sequence ASC").
+		First(&first).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// The first entry must follow on from the one before the period, which
+	// may have been archived with its partition
+	last, expectedPrev := first.Sequence-1, ""
+	if last > 0 {
+		previous, err := s.entryAt(db, last)
+		if err != nil {
+			return err
+		}
+		switch {
+		case previous != nil:
+			if auditLogHash(previous) != previous.Hash {
+				fail(last, &previous.ID, "entry modified")
+				return nil
+			}
+			expectedPrev = previous.Hash
+		default:
+			archive, err := s.archiveCovering(db, last)
+			if err != nil {
+				return err
+			}
+			if archive == nil || archive.LastSequence != last {
+				fail(last, nil, "entry missing")
+				return nil
+			}
+			expectedPrev = archive.LastHash
+		}
+	}
+
+	for {
+		var batch []models.AuditLog
+		if err := db.Where("sequence > ? AND created_at < ?", last, to).
+			Order("sequence ASC").
+			Limit(auditVerifyBatchSize).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for i := range batch {
+			entry := &batch[i]
+			switch {
+			case entry.Sequence != last+1:
+				fail(last+1, nil, "entry missing")
+			case entry.PrevHash != expectedPrev:
+				fail(entry.Sequence, &entry.ID, "previous hash does not match")
+			case auditLogHash(entry) != entry.Hash:
+				fail(entry.Sequence, &entry.ID, "entry modified")
+			}
+			if !report.Valid {
+				return nil
+			}
+			report.Checked++
+			last, expectedPrev = entry.Sequence, entry.Hash
+		}
+	}
+
+	// Entries deleted from the end of the period only show as a gap
+	// before the next entry of the chain
+	var head models.AuditChainHead
+	if err := db.Limit(1).Find(&head, "id = ?", auditChainID).Error; err != nil {
+		return err
+	}
+	if head.Sequence > last {
+		next, err := s.entryAt(db, last+1)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			fail(last+1, nil, "entry missing")
+		}
+	}
+	return nil
+}
+
+// verifyCheckpoints checks the signatures of the checkpoints of the period
+// and that the entries they sealed are unchanged
+func (s *AuditService) verifyCheckpoints(db *gorm.DB, report *models.AuditVerification, from, to time.Time, fail func(int64, *uuid.UUID, string)) error {
+	firstDay := from.UTC().Format(auditDayFormat)
+	lastDay := to.Add(-time.Nanosecond).UTC().Format(auditDayFormat)
+
+	var checkpoints []models.AuditCheckpoint
+	if err := db.Where("day >= ? AND day <= ?", firstDay, lastDay).Order("day ASC").Find(&checkpoints).Error; err != nil {
+		return err
+	}
+	var previous models.AuditCheckpoint
+	if err := db.Where("day < ?", firstDay).Order("day DESC").Limit(1).Find(&previous).Error; err != nil {
+		return err
+	}
+
+	prevSignature := previous.Signature
+	for i := range checkpoints {
+		checkpoint := &checkpoints[i]
+		report.Checkpoints++
+		if checkpoint.PrevSignature != prevSignature || !hmac.Equal([]byte(s.sign(checkpoint)), []byte(checkpoint.Signature)) {
+			fail(checkpoint.Sequence, nil, fmt.Sprintf("checkpoint %s is not genuine", checkpoint.Day))
+			return nil
+		}
+		prevSignature = checkpoint.Signature
+
+		if checkpoint.Sequence == 0 {
+			continue
+		}
+		entry, err := s.entryAt(db, checkpoint.Sequence)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			// Archived entries are covered by the archive's manifest
+			archive, err := s.archiveCovering(db, checkpoint.Sequence)
+			if err != nil {
+				return err
+			}
+			if archive != nil && (archive.LastSequence != checkpoint.Sequence || archive.LastHash == checkpoint.Hash) {
+				continue
+			}
+		}
+		switch {
+		case entry == nil:
+			fail(checkpoint.Sequence, nil, "entry missing")
+		case entry.Hash != checkpoint.Hash || auditLogHash(entry) != entry.Hash:
+			fail(checkpoint.Sequence, &entry.ID, fmt.Sprintf("entry does not match checkpoint %s", checkpoint.Day))
+		}
+	}
+	return nil
+}
+
+// entryAt returns the entry with the sequence number, or nil if there is
+// none
+func (s *AuditService) entryAt(db *gorm.DB, sequence int64) (*models.AuditLog, error) {
+	var entries []models.AuditLog
+	if err := db.Where("sequence = ?", sequence).Limit(1).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// sign returns the checkpoint's HMAC-SHA256 signature
+func (s *AuditService) sign(checkpoint *models.AuditCheckpoint) string {
+	mac := hmac.New(sha256.New, []byte(s.config.CheckpointKey))
+	fmt.Fprintf(mac, "%s|%d|%s|%s", checkpoint.Day, checkpoint.Sequence, checkpoint.Hash, checkpoint.PrevSignature)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// Audit log export formats
+const (
+	AuditExportCSV   = "csv"
+	AuditExportJSONL = "jsonl"
+)
+
+// AuditActionAuditLogExported records that the audit log itself was exported
+const AuditActionAuditLogExported = "audit_log_exported"
+
+// ErrInvalidExportFormat is returned for an unknown audit export format
+var ErrInvalidExportFormat = errors.New("export format must be csv or jsonl")
+
+// auditExportFlushRows is how many rows are written between flushes to the
+// client
+const auditExportFlushRows = 500
+
+// auditExportColumns is the CSV header
+var auditExportColumns = []string{
+	"id", "sequence", "created_at", "occurred_at", "user_id", "username",
+	"ip_address", "user_agent", "action", "resource", "resource_id", "method",
+	"path", "response_code", "classification", "severity", "details",
+	"error_message", "prev_hash", "hash",
+}
+
+// ExportLogs streams the filtered audit log to w in chain order, one row at
+// a time so the result is never held in memory. It returns the number of
+// entries written; an error after the first row leaves a truncated export.
+func (s *AuditService) ExportLogs(ctx context.Context, filters map[string]interface{}, format string, w io.Writer) (int64, error) {
+	var write func(*models.AuditLog) error
+	var flush func() error
+	switch format {
+	case AuditExportCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(auditExportColumns); err != nil {
+			return 0, err
+		}
+		write = func(entry *models.AuditLog) error { return writer.Write(auditCSVRecord(entry)) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case AuditExportJSONL:
+		encoder := json.NewEncoder(w)
+		write = func(entry *models.AuditLog) error { return encoder.Encode(entry) }
+		flush = func() error { return nil }
+	default:
+		return 0, ErrInvalidExportFormat
+	}
+
+	db := s.db.WithContext(ctx)
+	rows, err := filterAuditLogs(db.Model(&models.AuditLog{}), filters).
+		Order("created_at ASC, sequence ASC").
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var written int64
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := db.ScanRows(rows, &entry); err != nil {
+			return written, err
+		}
+		if err := write(&entry); err != nil {
+			return written, err
+		}
+		written++
+		if written%auditExportFlushRows == 0 {
+			if err := flushExport(w, flush); err != nil {
+				return written, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return written, err
+	}
+	if err := flushExport(w, flush); err != nil {
+		return written, err
+	}
+
+	s.auditExport(ctx, filters, format, written)
+	return written, nil
+}
+
+// flushExport pushes buffered rows through to the client
+func flushExport(w io.Writer, flush func() error) error {
+	if err := flush(); err != nil {
+		return err
+	}
+	if flusher, ok := w.(interface{ Flush() }); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// auditExport records who exported which part of the audit log
+func (s *AuditService) auditExport(ctx context.Context, filters map[string]interface{}, format string, rows int64) {
+	details := (&models.AuditDetails{}).With("format", format).With("rows", rows)
+	for key, value := range filters {
+		details.With(key, value)
+	}
+	entry := newAuditEvent(ctx, AuditActionAuditLogExported, "audit_log", "", models.ClassificationConfidential, details)
+	entry.ResourceID = nil
+	if err := chainAuditLogs(ctx, s.db, entry); err != nil {
+		log.Printf("failed to record %s: %v", AuditActionAuditLogExported, err)
+		return
+	}
+	publishAuditEvent(auditLogEvent(entry))
+}
+
+// auditCSVRecord flattens an entry into the export columns
+func auditCSVRecord(entry *models.AuditLog) []string {
+	var details string
+	if entry.Details != nil {
+		data, _ := json.Marshal(entry.Details)
+		details = string(data)
+	}
+	var occurredAt, userID, responseCode string
+	if entry.OccurredAt != nil {
+		occurredAt = entry.OccurredAt.UTC().Format(time.RFC3339Nano)
+	}
+	if entry.UserID != nil {
+		userID = entry.UserID.String()
+	}
+	if entry.ResponseCode != nil {
+		responseCode = strconv.Itoa(*entry.ResponseCode)
+	}
+
+	return []string{
+		entry.ID.String(),
+		strconv.FormatInt(entry.Sequence, 10),
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		occurredAt,
+		userID,
+		stringValue(entry.Username),
+		stringValue(entry.IPAddress),
+		stringValue(entry.UserAgent),
+		entry.Action,
+		entry.Resource,
+		stringValue(entry.ResourceID),
+		stringValue(entry.Method),
+		stringValue(entry.Path),
+		responseCode,
+		entry.Classification,
+		entry.Severity,
+		details,
+		stringValue(entry.ErrorMessage),
+		entry.PrevHash,
+		entry.Hash,
+	}
+}
+
+// stringValue returns the string or "" for nil
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// AuditExportFilename names an export download
+func AuditExportFilename(format string, now time.Time) string {
+	return fmt.Sprintf("audit-logs-%s.%s", now.UTC().Format("20060102-150405"), format)
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Defaults for audit partition maintenance when not configured
+const (
+	DefaultAuditRetentionMonths   = 12
+	DefaultAuditPartitionsAhead   = 3
+	DefaultAuditArchiveDir        = "data/audit-archive"
+	DefaultAuditPartitionInterval = 24 * time.Hour
+)
+
+// auditPartitionPattern matches the monthly partitions of audit_logs
+var auditPartitionPattern = regexp.MustCompile(`^audit_logs_(\d{4})_(\d{2})$`)
+
+// auditPartition is a monthly partition covering [From, To)
+type auditPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// auditPartitionFor returns the partition of the month containing t (UTC)
+func auditPartitionFor(t time.Time) auditPartition {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return auditPartition{
+		Name: fmt.Sprintf("audit_logs_%04d_%02d", from.Year(), int(from.Month())),
+		From: from,
+		To:   from.AddDate(0, 1, 0),
+	}
+}
+
+// RunPartitionMaintenance maintains the partitions on the configured
+// interval until ctx is cancelled
+func (s *AuditService) RunPartitionMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PartitionInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.MaintainPartitions(ctx, time.Now()); err != nil {
+			log.Printf("audit partition maintenance failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaintainPartitions creates the monthly partitions of audit_logs from the
+// current month to PartitionsAhead months ahead, and archives and drops
+// the partitions that ended more than RetentionMonths months before the
+// current month. It does nothing unless audit_logs is a partitioned
+// Postgres table.
+func (s *AuditService) MaintainPartitions(ctx context.Context, now time.Time) (*models.AuditPartitionReport, error) {
+	db := s.db.WithContext(ctx)
+	report := &models.AuditPartitionReport{Created: []string{}, Archived: []string{}}
+	partitioned, err := auditLogsPartitioned(db)
+	if err != nil || !partitioned {
+		return report, err
+	}
+
+	current := auditPartitionFor(now)
+	for i := 0; i <= s.config.PartitionsAhead; i++ {
+		partition := auditPartitionFor(current.From.AddDate(0, i, 0))
+		created, err := createAuditPartition(db, partition)
+		if err != nil {
+			return report, err
+		}
+		if created {
+			report.Created = append(report.Created, partition.Name)
+		}
+	}
+
+	partitions, err := attachedAuditPartitions(db)
+	if err != nil {
+		return report, err
+	}
+	cutoff := current.From.AddDate(0, -s.config.RetentionMonths, 0)
+	for _, partition := range partitions {
+		if partition.To.After(cutoff) {
+			continue
+		}
+		archive, err := s.archivePartition(ctx, partition)
+		if err != nil {
+			return report, fmt.Errorf("archive %s: %w", partition.Name, err)
+		}
+		if err := dropAuditPartition(db, archive); err != nil {
+			return report, fmt.Errorf("drop %s: %w", partition.Name, err)
+		}
+		report.Archived = append(report.Archived, partition.Name)
+	}
+	return report, nil
+}
+
+// archivePartition writes the partition's entries to a gzip-compressed
+// JSON Lines file with a signed manifest next to it, returning the
+// manifest. Rewriting an existing archive is safe: the partition is only
+// dropped once its archive is recorded.
+func (s *AuditService) archivePartition(ctx context.Context, partition auditPartition) (*models.AuditArchive, error) {
+	if err := os.MkdirAll(s.config.ArchiveDir, 0o700); err != nil {
+		return nil, err
+	}
+	archive := &models.AuditArchive{
+		ID:        uuid.New(),
+		Partition: partition.Name,
+		From:      partition.From,
+		To:        partition.To,
+		File:      partition.Name + ".jsonl.gz",
+	}
+	path := filepath.Join(s.config.ArchiveDir, archive.File)
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	hasher := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(file, hasher))
+	if err := s.writePartition(ctx, partition, archive, json.NewEncoder(gz)); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+
+	archive.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	archive.ArchivedAt = time.Now().UTC()
+	archive.Signature = s.signArchive(archive)
+
+	manifest, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(s.config.ArchiveDir, partition.Name+".manifest.json")
+	if err := os.WriteFile(manifestPath, manifest, 0o600); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// writePartition streams the partition's entries in chain order and
+// records the chain positions they cover
+func (s *AuditService) writePartition(ctx context.Context, partition auditPartition, archive *models.AuditArchive, encoder *json.Encoder) error {
+	db := s.db.WithContext(ctx)
+	rows, err := db.Table(partition.Name).Order("created_at ASC, sequence ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := db.ScanRows(rows, &entry); err != nil {
+			return err
+		}
+		if err := encoder.Encode(&entry); err != nil {
+			return err
+		}
+		archive.Rows++
+		if entry.Sequence == 0 {
+			continue
+		}
+		if archive.FirstSequence == 0 || entry.Sequence < archive.FirstSequence {
+			archive.FirstSequence = entry.Sequence
+		}
+		if entry.Sequence > archive.LastSequence {
+			archive.LastSequence, archive.LastHash = entry.Sequence, entry.Hash
+		}
+	}
+	return rows.Err()
+}
+
+// signArchive returns the manifest's HMAC-SHA256 signature
+func (s *AuditService) signArchive(archive *models.AuditArchive) string {
+	mac := hmac.New(sha256.New, []byte(s.config.CheckpointKey))
+	fmt.Fprintf(mac, "%s|%d|%d|%d|%s|%s", archive.Partition, archive.Rows,
+		archive.FirstSequence, archive.LastSequence, archive.LastHash, archive.SHA256)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// archiveCovering returns the genuine archive holding the chain position,
+// or nil if it was not archived
+func (s *AuditService) archiveCovering(db *gorm.DB, sequence int64) (*models.AuditArchive, error) {
+	var archives []models.AuditArchive
+	if err := db.Where("first_sequence <= ? AND last_sequence >= ?", sequence, sequence).
+		Limit(1).
+		Find(&archives).Error; err != nil {
+		return nil, err
+	}
+	if len(archives) == 0 || !hmac.Equal([]byte(s.signArchive(&archives[0])), []byte(archives[0].Signature)) {
+		return nil, nil
+	}
+	return &archives[0], nil
+}
+
+// auditLogsPartitioned reports whether audit_logs is a partitioned
+// Postgres table
+func auditLogsPartitioned(db *gorm.DB) (bool, error) {
+	if db.Dialector.Name() != "postgres" {
+		return false, nil
+	}
+	var count int64
+	err := db.Raw(`SELECT count(*) FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		WHERE c.relname = 'audit_logs' AND pg_table_is_visible(c.oid)`).Scan(&count).Error
+	return count > 0, err
+}
+
+// createAuditPartition creates the partition unless it exists, reporting
+// whether it was created
+func createAuditPartition(db *gorm.DB, partition auditPartition) (bool, error) {
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM pg_class WHERE relname = ? AND pg_table_is_visible(oid)", partition.Name).
+		Scan(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	// The name is built from the month, never from input
+	err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF audit_logs FOR VALUES FROM (?) TO (?)", partition.Name),
+		partition.From, partition.To).Error
+	return err == nil, err
+}
+
+// attachedAuditPartitions lists the monthly partitions of audit_logs
+func attachedAuditPartitions(db *gorm.DB) ([]auditPartition, error) {
+	var names []string
+	if err := db.Raw(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'audit_logs' AND pg_table_is_visible(p.oid)
+		ORDER BY c.relname`).Scan(&names).Error; err != nil {
+		return nil, err
+	}
+
+	var partitions []auditPartition
+	for _, name := range names {
+		match := auditPartitionPattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		if month < 1 || month > 12 {
+			continue
+		}
+		partitions = append(partitions, auditPartitionFor(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)))
+	}
+	return partitions, nil
+}
+
+// dropAuditPartition detaches and drops an archived partition, recording
+// its manifest in the same transaction
+func dropAuditPartition(db *gorm.DB, archive *models.AuditArchive) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE audit_logs DETACH PARTITION " + archive.Partition).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "partition"}},
+			UpdateAll: true,
+		}).Create(archive).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DROP TABLE " + archive.Partition).Error
+	})
+}
@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"gorm.io/gorm"
+)
+
+// Defaults for the asynchronous audit pipeline when not configured
+const (
+	DefaultAuditQueueSize      = 10000
+	DefaultAuditBatchSize      = 200
+	DefaultAuditFlushInterval  = time.Second
+	DefaultAuditEnqueueTimeout = 50 * time.Millisecond
+	DefaultAuditDelayThreshold = 5 * time.Second
+	DefaultAuditSpillDir       = "data/audit-spill"
+)
+
+const (
+	// auditSpillExt marks complete spill files; files are written under a
+	// temporary name and renamed so replay never sees a partial file
+	auditSpillExt = ".jsonl"
+	// auditSpillCorruptExt sets aside spill files that cannot be decoded
+	auditSpillCorruptExt = ".corrupt"
+)
+
+// AuditQueue writes request audit events in batches off the request path.
+// The queue is bounded: when it is full a request waits briefly for room
+// and then spills its event to disk. Batches that cannot be inserted,
+// for example while Postgres is unavailable, are spilled too and replayed
+// in order before newer events once the database is back.
+type AuditQueue struct {
+	db     *gorm.DB
+	config models.AuditConfig
+	events chan *models.AuditLog
+	done   chan struct{}
+
+	// ctx is cancelled when a drain runs out of time; whatever is left is
+	// spilled instead of written
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards closed so no event is sent on the closed channel
+	mu     sync.RWMutex
+	closed bool
+
+	spillSeq   atomic.Uint64
+	spillFiles atomic.Int64
+
+	enqueued atomic.Uint64
+	written  atomic.Uint64
+	spilled  atomic.Uint64
+	replayed atomic.Uint64
+	dropped  atomic.Uint64
+	delayed  atomic.Uint64
+	maxDelay atomic.Int64
+
+	statsMu     sync.Mutex
+	lastError   string
+	lastFlushAt *time.Time
+}
+
+// NewAuditQueue creates a new AuditQueue; Run must be started to write
+// the queued events
+func NewAuditQueue(db *gorm.DB, config models.AuditConfig) *AuditQueue {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultAuditQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultAuditBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultAuditFlushInterval
+	}
+	if config.EnqueueTimeout <= 0 {
+		config.EnqueueTimeout = DefaultAuditEnqueueTimeout
+	}
+	if config.DelayThreshold <= 0 {
+		config.DelayThreshold = DefaultAuditDelayThreshold
+	}
+	if config.SpillDir == "" {
+		config.SpillDir = DefaultAuditSpillDir
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &AuditQueue{
+		db:     db,
+		config: config,
+		events: make(chan *models.AuditLog, config.QueueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	q.spillFiles.Store(int64(len(q.spillPaths())))
+	return q
+}
+
+// Enqueue hands an event to the writer without waiting for the database.
+// The event must not be modified afterwards.
+func (q *AuditQueue) Enqueue(entry *models.AuditLog) {
+	if entry.OccurredAt == nil {
+		now := time.Now().UTC()
+		entry.OccurredAt = &now
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.events <- entry:
+			q.enqueued.Add(1)
+			return
+		default:
+		}
+
+		timer := time.NewTimer(q.config.EnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case q.events <- entry:
+			q.enqueued.Add(1)
+			return
+		case <-timer.C:
+		}
+	}
+
+	// Full or already drained: keep the event on disk for replay
+	if err := q.spill([]*models.AuditLog{entry}); err != nil {
+		q.dropped.Add(1)
+		q.setError(err)
+		log.Printf("audit event dropped: %v", err)
+	}
+}
+
+// Run writes queued events until the queue is closed and drained. Spill
+// files left by a previous run are replayed with the first flush.
+func (q *AuditQueue) Run() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.AuditLog, 0, q.config.BatchSize)
+	flush := func() {
+		q.flush(batch)
+		batch = make([]*models.AuditLog, 0, q.config.BatchSize)
+	}
+
+	for {
+		select {
+		case entry, ok := <-q.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= q.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be
+// written. If ctx ends first the remaining events are spilled to disk and
+// ctx's error is returned.
+func (q *AuditQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+		return ctx.Err()
+	}
+}
+
+// Metrics returns the pipeline's counters and backlog
+func (q *AuditQueue) Metrics() *models.AuditQueueMetrics {
+	metrics := &models.AuditQueueMetrics{
+		Enqueued:      q.enqueued.Load(),
+		Written:       q.written.Load(),
+		Spilled:       q.spilled.Load(),
+		Replayed:      q.replayed.Load(),
+		Dropped:       q.dropped.Load(),
+		Delayed:       q.delayed.Load(),
+		MaxDelayMS:    time.Duration(q.maxDelay.Load()).Milliseconds(),
+		QueueDepth:    len(q.events),
+		QueueCapacity: cap(q.events),
+		SpillFiles:    int(q.spillFiles.Load()),
+	}
+
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+	metrics.LastError = q.lastError
+	if q.lastFlushAt != nil {
+		lastFlushAt := *q.lastFlushAt
+		metrics.LastFlushAt = &lastFlushAt
+	}
+	return metrics
+}
+
+// flush replays the spill backlog and then writes the batch. While the
+// backlog cannot be replayed the batch joins it, so events reach the chain
+// in the order they were queued.
+func (q *AuditQueue) flush(batch []*models.AuditLog) {
+	if q.spillFiles.Load() > 0 && !q.replay() {
+		if len(batch) > 0 {
+			q.spillBatch(batch)
+		}
+		return
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := q.write(batch); err != nil {
+		q.setError(err)
+		log.Printf("audit batch write failed, spilling %d events: %v", len(batch), err)
+		q.spillBatch(batch)
+		return
+	}
+	q.written.Add(uint64(len(batch)))
+}
+
+// write appends the batch to the hash chain and records how late its
+// events were
+func (q *AuditQueue) write(batch []*models.AuditLog) error {
+	if err := q.ctx.Err(); err != nil {
+		return err
+	}
+	if err := chainAuditLogs(q.ctx, q.db, batch...); err != nil {
+		return err
+	}
+
+	for _, entry := range batch {
+		delay := entry.CreatedAt.Sub(*entry.OccurredAt)
+		if delay > q.config.DelayThreshold {
+			q.delayed.Add(1)
+		}
+		for {
+			longest := q.maxDelay.Load()
+			if int64(delay) <= longest || q.maxDelay.CompareAndSwap(longest, int64(delay)) {
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	q.statsMu.Lock()
+	q.lastFlushAt = &now
+	q.lastError = ""
+	q.statsMu.Unlock()
+	return nil
+}
+
+// replay writes the spill files oldest first, reporting whether the
+// backlog is cleared
+func (q *AuditQueue) replay() bool {
+	for _, path := range q.spillPaths() {
+		entries, err := readAuditSpill(path)
+		if err != nil {
+			log.Printf("audit spill file %s set aside: %v", path, err)
+			if err := os.Rename(path, path+auditSpillCorruptExt); err != nil {
+				q.setError(err)
+				return false
+			}
+			q.spillFiles.Add(-1)
+			continue
+		}
+
+		if err := q.write(entries); err != nil {
+			q.setError(err)
+			return false
+		}
+		if err := os.Remove(path); err != nil {
+			// The entries are in the chain; replaying them again would
+			// duplicate them
+			log.Printf("audit spill file %s replayed but not removed: %v", path, err)
+			q.setError(err)
+			return false
+		}
+		q.spillFiles.Add(-1)
+		q.replayed.Add(uint64(len(entries)))
+		q.written.Add(uint64(len(entries)))
+	}
+	return true
+}
+
+// spillBatch keeps a batch that could not be written, dropping it only
+// if the disk fails too
+func (q *AuditQueue) spillBatch(batch []*models.AuditLog) {
+	if err := q.spill(batch); err != nil {
+		q.dropped.Add(uint64(len(batch)))
+		q.setError(err)
+		log.Printf("audit spill failed, dropped %d events: %v", len(batch), err)
+	}
+}
+
+// spill writes the entries to a new spill file, one JSON object per line
+func (q *AuditQueue) spill(entries []*models.AuditLog) error {
+	if err := os.MkdirAll(q.config.SpillDir, 0o700); err != nil {
+		return err
+	}
+
+	// Names sort in the order the files were written
+	name := fmt.Sprintf("audit-%020d-%010d", time.Now().UnixNano(), q.spillSeq.Add(1))
+	tmp := filepath.Join(q.config.SpillDir, name+".tmp")
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(q.config.SpillDir, name+auditSpillExt))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	q.spillFiles.Add(1)
+	q.spilled.Add(uint64(len(entries)))
+	return nil
+}
+
+// spillPaths lists the spill files in the order they were written
+func (q *AuditQueue) spillPaths() []string {
+	dirEntries, err := os.ReadDir(q.config.SpillDir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			q.setError(err)
+		}
+		return nil
+	}
+
+	var paths []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && strings.HasSuffix(dirEntry.Name(), auditSpillExt) {
+			paths = append(paths, filepath.Join(q.config.SpillDir, dirEntry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// setError records the last failure for the metrics
+func (q *AuditQueue) setError(err error) {
+	q.statsMu.Lock()
+	q.lastError = err.Error()
+	q.statsMu.Unlock()
+}
+
+// readAuditSpill decodes a spill file
+func readAuditSpill(path string) ([]*models.AuditLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*models.AuditLog
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var entry models.AuditLog
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// AuditQueueTestSuite 异步审计队列测试套件
+type AuditQueueTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	config models.AuditConfig
+}
+
+func (s *AuditQueueTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:audit_queue?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.AuditLog{}, &models.AuditChainHead{}))
+	for _, table := range []string{"audit_logs", "audit_chain_heads"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.config = models.AuditConfig{
+		QueueSize:     100,
+		BatchSize:     3,
+		FlushInterval: 10 * time.Millisecond,
+		SpillDir:      s.T().TempDir(),
+	}
+}
+
+func TestAuditQueueSuite(t *testing.T) {
+	suite.Run(t, new(AuditQueueTestSuite))
+}
+
+// event 创建一条请求审计事件
+func (s *AuditQueueTestSuite) event(path string) *models.AuditLog {
+	method := "GET"
+	return &models.AuditLog{Action: method, Resource: "projects", Method: &method, Path: &path}
+}
+
+// count 返回已写入的审计日志数
+func (s *AuditQueueTestSuite) count() int64 {
+	var n int64
+	require.NoError(s.T(), s.db.Model(&models.AuditLog{}).Count(&n).Error)
+	return n
+}
+
+// TestQueue_BatchesAndDrainsOnClose 测试分批写入并在关闭时排空队列
+func (s *AuditQueueTestSuite) TestQueue_BatchesAndDrainsOnClose() {
+	s.config.FlushInterval = time.Hour
+	queue := NewAuditQueue(s.db, s.config)
+	go queue.Run()
+
+	for i := 0; i < 7; i++ {
+		queue.Enqueue(s.event("/api/v1/projects"))
+	}
+	require.NoError(s.T(), queue.Close(context.Background()))
+
+	assert.Equal(s.T(), int64(7), s.count())
+	var entries []models.AuditLog
+	require.NoError(s.T(), s.db.Order("sequence ASC").Find(&entries).Error)
+	for i, entry := range entries {
+		assert.Equal(s.T(), int64(i+1), entry.Sequence)
+		assert.Equal(s.T(), auditLogHash(&entry), entry.Hash)
+		require.NotNil(s.T(), entry.OccurredAt)
+		assert.False(s.T(), entry.OccurredAt.After(entry.CreatedAt))
+	}
+
+	metrics := queue.Metrics()
+	assert.Equal(s.T(), uint64(7), metrics.Enqueued)
+	assert.Equal(s.T(), uint64(7), metrics.Written)
+	assert.Zero(s.T(), metrics.Dropped)
+	assert.Zero(s.T(), metrics.QueueDepth)
+
+	// 关闭后的事件落盘，不会丢失
+	queue.Enqueue(s.event("/api/v1/projects"))
+	assert.Equal(s.T(), uint64(1), queue.Metrics().Spilled)
+}
+
+// TestQueue_SpillsWhileDatabaseUnavailable 测试数据库不可用时落盘并在恢复后重放
+func (s *AuditQueueTestSuite) TestQueue_SpillsWhileDatabaseUnavailable() {
+	require.NoError(s.T(), s.db.Migrator().DropTable(&models.AuditLog{}))
+	queue := NewAuditQueue(s.db, s.config)
+	go queue.Run()
+
+	late := s.event("/api/v1/projects/late")
+	occurredAt := time.Now().Add(-time.Minute)
+	late.OccurredAt = &occurredAt
+	queue.Enqueue(late)
+	queue.Enqueue(s.event("/api/v1/projects"))
+
+	require.Eventually(s.T(), func() bool {
+		return queue.Metrics().Spilled == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NotEmpty(s.T(), queue.Metrics().LastError)
+	assert.Positive(s.T(), queue.Metrics().SpillFiles)
+
+	// 数据库恢复后按顺序重放
+	require.NoError(s.T(), s.db.AutoMigrate(&models.AuditLog{}))
+	require.Eventually(s.T(), func() bool {
+		return queue.Metrics().SpillFiles == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NoError(s.T(), queue.Close(context.Background()))
+
+	var entries []models.AuditLog
+	require.NoError(s.T(), s.db.Order("sequence ASC").Find(&entries).Error)
+	require.Len(s.T(), entries, 2)
+	assert.Equal(s.T(), "/api/v1/projects/late", *entries[0].Path)
+	assert.WithinDuration(s.T(), occurredAt, *entries[0].OccurredAt, time.Millisecond)
+
+	metrics := queue.Metrics()
+	assert.Equal(s.T(), uint64(2), metrics.Replayed)
+	assert.Equal(s.T(), uint64(2), metrics.Written)
+	assert.Equal(s.T(), uint64(1), metrics.Delayed)
+	assert.GreaterOrEqual(s.T(), metrics.MaxDelayMS, time.Minute.Milliseconds())
+	assert.Empty(s.T(), metrics.LastError)
+}
+
+// TestQueue_FullQueueSpillsThenDrops 测试队列已满时落盘，磁盘也不可用时计为丢弃
+func (s *AuditQueueTestSuite) TestQueue_FullQueueSpillsThenDrops() {
+	s.config.QueueSize = 1
+	s.config.EnqueueTimeout = time.Millisecond
+	queue := NewAuditQueue(s.db, s.config)
+
+	queue.Enqueue(s.event("/api/v1/projects/1"))
+	queue.Enqueue(s.event("/api/v1/projects/2"))
+	metrics := queue.Metrics()
+	assert.Equal(s.T(), uint64(1), metrics.Enqueued)
+	assert.Equal(s.T(), uint64(1), metrics.Spilled)
+	assert.Equal(s.T(), 1, metrics.QueueDepth)
+
+	// 落盘目录不可写
+	blocked := filepath.Join(s.T().TempDir(), "file")
+	require.NoError(s.T(), os.WriteFile(blocked, nil, 0o600))
+	full := NewAuditQueue(s.db, models.AuditConfig{QueueSize: 1, EnqueueTimeout: time.Millisecond, SpillDir: filepath.Join(blocked, "spill")})
+	full.Enqueue(s.event("/api/v1/projects/3"))
+	full.Enqueue(s.event("/api/v1/projects/4"))
+	assert.Equal(s.T(), uint64(1), full.Metrics().Dropped)
+
+	// 排空时一并写入落盘的事件
+	go queue.Run()
+	require.NoError(s.T(), queue.Close(context.Background()))
+	assert.Equal(s.T(), int64(2), s.count())
+	assert.Equal(s.T(), uint64(1), queue.Metrics().Replayed)
+}
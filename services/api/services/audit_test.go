@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// AuditServiceTestSuite 审计日志哈希链测试套件
+type AuditServiceTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	security *SecurityService
+	service  *AuditService
+}
+
+func (s *AuditServiceTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:audit_service?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.AuditLog{}, &models.AuditChainHead{}, &models.AuditCheckpoint{}, &models.AuditArchive{}))
+	for _, table := range []string{"audit_logs", "audit_chain_heads", "audit_checkpoints", "audit_archives"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.security = NewSecurityService(s.db)
+	s.service = NewAuditService(s.db, models.AuditConfig{CheckpointKey: "test-key", ArchiveDir: s.T().TempDir()})
+}
+
+func TestAuditServiceSuite(t *testing.T) {
+	suite.Run(t, new(AuditServiceTestSuite))
+}
+
+// record 写入n条审计日志
+func (s *AuditServiceTestSuite) record(n int) []*models.AuditLog {
+	entries := make([]*models.AuditLog, n)
+	for i := range entries {
+		resourceID := fmt.Sprintf("doc-%d", i)
+		entries[i] = &models.AuditLog{Action: "update", Resource: "document", ResourceID: &resourceID}
+		require.NoError(s.T(), s.security.CreateAuditLog(context.Background(), entries[i]))
+	}
+	return entries
+}
+
+// verify 校验从今天起三天内的审计日志
+func (s *AuditServiceTestSuite) verify() *models.AuditVerification {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	report, err := s.service.Verify(context.Background(), today, today.AddDate(0, 0, 3))
+	require.NoError(s.T(), err)
+	return report
+}
+
+// TestChain_LinksEntries 测试每条日志链接前一条日志的哈希
+func (s *AuditServiceTestSuite) TestChain_LinksEntries() {
+	entries := s.record(3)
+	assert.Equal(s.T(), int64(1), entries[0].Sequence)
+	assert.Empty(s.T(), entries[0].PrevHash)
+	assert.Equal(s.T(), entries[0].Hash, entries[1].PrevHash)
+	assert.Equal(s.T(), entries[1].Hash, entries[2].PrevHash)
+	assert.Equal(s.T(), models.ClassificationInternal, entries[2].Classification)
+
+	report := s.verify()
+	assert.True(s.T(), report.Valid)
+	assert.Equal(s.T(), int64(3), report.Checked)
+	assert.Nil(s.T(), report.FirstBroken)
+
+	_, err := s.service.Verify(context.Background(), time.Now(), time.Now().Add(-time.Hour))
+	assert.ErrorIs(s.T(), err, ErrInvalidAuditPeriod)
+}
+
+// TestVerify_ReportsFirstBrokenLink 测试篡改、删除日志后报告第一个断链位置
+func (s *AuditServiceTestSuite) TestVerify_ReportsFirstBrokenLink() {
+	entries := s.record(5)
+
+	require.NoError(s.T(), s.db.Model(&models.AuditLog{}).Where("id = ?", entries[3].ID).Update("action", "read").Error)
+	report := s.verify()
+	assert.False(s.T(), report.Valid)
+	require.NotNil(s.T(), report.FirstBroken)
+	assert.Equal(s.T(), int64(4), report.FirstBroken.Sequence)
+	assert.Equal(s.T(), entries[3].ID, *report.FirstBroken.LogID)
+	assert.Equal(s.T(), "entry modified", report.FirstBroken.Reason)
+
+	// 更早的删除优先报告
+	require.NoError(s.T(), s.db.Delete(&models.AuditLog{}, "id = ?", entries[1].ID).Error)
+	report = s.verify()
+	require.NotNil(s.T(), report.FirstBroken)
+	assert.Equal(s.T(), int64(2), report.FirstBroken.Sequence)
+	assert.Equal(s.T(), "entry missing", report.FirstBroken.Reason)
+	assert.Equal(s.T(), int64(1), report.Checked)
+}
+
+// TestVerify_DetectsTruncation 测试删除末尾日志可被链头发现
+func (s *AuditServiceTestSuite) TestVerify_DetectsTruncation() {
+	entries := s.record(3)
+	require.NoError(s.T(), s.db.Delete(&models.AuditLog{}, "id = ?", entries[2].ID).Error)
+
+	report := s.verify()
+	assert.False(s.T(), report.Valid)
+	require.NotNil(s.T(), report.FirstBroken)
+	assert.Equal(s.T(), int64(3), report.FirstBroken.Sequence)
+	assert.Equal(s.T(), "entry missing", report.FirstBroken.Reason)
+}
+
+// TestCheckpoints_DetectRewrittenChain 测试每日检查点可发现重新计算过的整条哈希链
+func (s *AuditServiceTestSuite) TestCheckpoints_DetectRewrittenChain() {
+	entries := s.record(2)
+
+	written, err := s.service.WriteCheckpoints(context.Background(), time.Now().Add(48*time.Hour))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, written)
+	written, err = s.service.WriteCheckpoints(context.Background(), time.Now().Add(48*time.Hour))
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), written)
+
+	var checkpoints []models.AuditCheckpoint
+	require.NoError(s.T(), s.db.Order("day ASC").Find(&checkpoints).Error)
+	require.Len(s.T(), checkpoints, 2)
+	assert.Equal(s.T(), entries[1].Hash, checkpoints[0].Hash)
+	assert.Equal(s.T(), checkpoints[0].Signature, checkpoints[1].PrevSignature)
+
+	report := s.verify()
+	assert.True(s.T(), report.Valid)
+	assert.Equal(s.T(), 2, report.Checkpoints)
+
+	// 篡改内容后重新计算整条链，链本身自洽但与检查点不符
+	entries[0].Action = "delete"
+	entries[0].Hash = auditLogHash(entries[0])
+	entries[1].PrevHash = entries[0].Hash
+	entries[1].Hash = auditLogHash(entries[1])
+	for _, entry := range entries {
+		require.NoError(s.T(), s.db.Model(&models.AuditLog{}).Where("id = ?", entry.ID).
+			Updates(map[string]interface{}{"action": entry.Action, "prev_hash": entry.PrevHash, "hash": entry.Hash}).Error)
+	}
+	report = s.verify()
+	assert.False(s.T(), report.Valid)
+	require.NotNil(s.T(), report.FirstBroken)
+	assert.Equal(s.T(), int64(2), report.FirstBroken.Sequence)
+	assert.Contains(s.T(), report.FirstBroken.Reason, "checkpoint")
+
+	// 没有签名密钥无法伪造检查点
+	forger := NewAuditService(s.db, models.AuditConfig{CheckpointKey: "guessed"})
+	checkpoints[0].Hash = entries[1].Hash
+	checkpoints[0].Signature = forger.sign(&checkpoints[0])
+	require.NoError(s.T(), s.db.Save(&checkpoints[0]).Error)
+	report = s.verify()
+	require.NotNil(s.T(), report.FirstBroken)
+	assert.Contains(s.T(), report.FirstBroken.Reason, "is not genuine")
+}
+
+// TestExport_StreamsFilteredLogs 测试按条件导出CSV与JSON Lines并记录导出事件
+func (s *AuditServiceTestSuite) TestExport_StreamsFilteredLogs() {
+	entries := s.record(3)
+	require.NoError(s.T(), s.security.CreateAuditLog(context.Background(), &models.AuditLog{Action: "login", Resource: "session"}))
+
+	var out bytes.Buffer
+	written, err := s.service.ExportLogs(context.Background(), map[string]interface{}{"resource": "document"}, AuditExportCSV, &out)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(3), written)
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(s.T(), err)
+	require.Len(s.T(), records, 4)
+	assert.Equal(s.T(), auditExportColumns, records[0])
+	assert.Equal(s.T(), entries[0].ID.String(), records[1][0])
+	assert.Equal(s.T(), "doc-2", records[3][10])
+	assert.Equal(s.T(), entries[2].Hash, records[3][19])
+
+	// 导出本身被审计，并出现在后续导出中
+	out.Reset()
+	written, err = s.service.ExportLogs(context.Background(), nil, AuditExportJSONL, &out)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(5), written)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(s.T(), lines, 5)
+	assert.Contains(s.T(), lines[4], AuditActionAuditLogExported)
+
+	var exported []models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ?", AuditActionAuditLogExported).Order("sequence ASC").Find(&exported).Error)
+	require.Len(s.T(), exported, 2)
+	require.NotNil(s.T(), exported[0].Details)
+	assert.Equal(s.T(), "document", exported[0].Details.Context["resource"])
+	assert.Equal(s.T(), AuditExportCSV, exported[0].Details.Context["format"])
+	assert.Equal(s.T(), models.ClassificationConfidential, exported[0].Classification)
+	assert.True(s.T(), s.verify().Valid)
+
+	_, err = s.service.ExportLogs(context.Background(), nil, "xml", &out)
+	assert.ErrorIs(s.T(), err, ErrInvalidExportFormat)
+}
+
+// TestArchive_VerifiesAcrossArchivedPartition 测试归档分区后哈希链仍可跨越缺口校验
+func (s *AuditServiceTestSuite) TestArchive_VerifiesAcrossArchivedPartition() {
+	entries := s.record(4)
+
+	// 用前两条日志模拟一个已过保留期的月分区
+	partition := auditPartitionFor(time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC))
+	assert.Equal(s.T(), "audit_logs_2025_01", partition.Name)
+	var ddl string
+	require.NoError(s.T(), s.db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'audit_logs'").Scan(&ddl).Error)
+	require.NoError(s.T(), s.db.Exec(strings.Replace(ddl, "`audit_logs`", "`"+partition.Name+"`", 1)).Error)
+	defer s.db.Migrator().DropTable(partition.Name)
+	require.NoError(s.T(), s.db.Exec("INSERT INTO "+partition.Name+" SELECT * FROM audit_logs WHERE sequence <= 2").Error)
+
+	archive, err := s.service.archivePartition(context.Background(), partition)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(2), archive.Rows)
+	assert.Equal(s.T(), int64(1), archive.FirstSequence)
+	assert.Equal(s.T(), int64(2), archive.LastSequence)
+	assert.Equal(s.T(), entries[1].Hash, archive.LastHash)
+
+	// 归档文件与清单完整
+	data, err := os.ReadFile(filepath.Join(s.service.config.ArchiveDir, archive.File))
+	require.NoError(s.T(), err)
+	sum := sha256.Sum256(data)
+	assert.Equal(s.T(), hex.EncodeToString(sum[:]), archive.SHA256)
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	scanner := bufio.NewScanner(gz)
+	var lines int
+	for scanner.Scan() {
+		lines++
+	}
+	assert.Equal(s.T(), 2, lines)
+	assert.FileExists(s.T(), filepath.Join(s.service.config.ArchiveDir, partition.Name+".manifest.json"))
+
+	// 移除分区后链仍然有效
+	require.NoError(s.T(), s.db.Create(archive).Error)
+	require.NoError(s.T(), s.db.Delete(&models.AuditLog{}, "sequence <= ?", 2).Error)
+	report := s.verify()
+	assert.True(s.T(), report.Valid)
+	assert.Equal(s.T(), int64(2), report.Checked)
+
+	// 伪造的清单不能弥合缺口
+	require.NoError(s.T(), s.db.Model(archive).Update("last_hash", entries[0].Hash).Error)
+	report = s.verify()
+	assert.False(s.T(), report.Valid)
+	require.NotNil(s.T(), report.FirstBroken)
+	assert.Equal(s.T(), int64(2), report.FirstBroken.Sequence)
+	assert.Equal(s.T(), "entry missing", report.FirstBroken.Reason)
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Token errors
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrTokenBlacklisted = errors.New("token has been revoked")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again; the token family is revoked as a precaution
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// ValidateCredentials checks a username/password pair and returns the user.
+// Every attempt is written to login_logs; repeated password failures inside
+// the lockout window lock the account.
+func (s *UserService) ValidateCredentials(ctx context.Context, username, password string) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, "username = ?", username).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := s.recordLogin(ctx, nil, username, false, LoginFailureUnknownUser); err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if user.IsLocked() {
+		if err := s.recordLogin(ctx, &user, username, false, LoginFailureAccountLocked); err != nil {
+			return nil, err
+		}
+		return nil, ErrAccountLocked
+	}
+	if user.LockedUntil != nil {
+		// Cooldown has passed
+		if err := s.unlockAccount(ctx, &user); err != nil {
+			return nil, err
+		}
+	}
+
+	if !user.CheckPassword(password) {
+		if err := s.recordLogin(ctx, &user, username, false, LoginFailureInvalidPassword); err != nil {
+			return nil, err
+		}
+		locked, err := s.lockIfThresholdReached(ctx, &user, LoginProviderLocal, LoginFailureInvalidPassword)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, ErrAccountLocked
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		if err := s.recordLogin(ctx, &user, username, false, LoginFailureUserDisabled); err != nil {
+			return nil, err
+		}
+		return nil, ErrUserDisabled
+	}
+
+	if err := s.recordLogin(ctx, &user, username, true, ""); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GenerateTokenPair opens a session for the user and issues its first
+// access/refresh token pair
+func (s *UserService) GenerateTokenPair(user *models.User) (*models.LoginResponse, error) {
+	return s.StartSession(context.Background(), user, "", "")
+}
+
+// StartSession opens a session for the user from the given client and issues
+// an access token and a refresh token bound to it. The pair starts a new
+// refresh token family; the oldest session is evicted when the user already
+// holds the maximum number of concurrent sessions.
+func (s *UserService) StartSession(ctx context.Context, user *models.User, ipAddress, userAgent string) (*models.LoginResponse, error) {
+	familyID := uuid.New().String()
+	session, err := s.sessions.StartSession(ctx, user.ID, familyID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := session.ID.String()
+
+	accessToken, _, err := s.signToken(user, models.TokenTypeAccess, familyID, sessionID, s.authConfig.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshClaims, err := s.signToken(user, models.TokenTypeRefresh, familyID, sessionID, s.authConfig.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(newRefreshTokenRecord(user, refreshClaims, nil)).Error; err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.authConfig.AccessTokenTTL.Seconds()),
+		TokenType:    "Bearer",
+		User:         user.ToResponse(),
+	}, nil
+}
+
+// RefreshAccessToken rotates a refresh token: the presented token is marked
+// used and a new access/refresh pair in the same family is returned.
+// Presenting a token that was already rotated revokes the whole family.
+// Claims are rebuilt from the current user record so role changes take effect.
+func (s *UserService) RefreshAccessToken(ctx context.Context, refreshToken string) (*models.RefreshTokenResponse, error) {
+	claims, err := s.parseToken(refreshToken, models.TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked, err := s.revocations.contains(ctx, claims.ID, claims.FamilyID); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, ErrTokenBlacklisted
+	}
+
+	if err := s.sessions.TouchSession(ctx, claims.SessionID); err != nil {
+		return nil, err
+	}
+
+	var record models.RefreshToken
+	if err := s.db.WithContext(ctx).First(&record, "jti = ?", claims.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if record.UsedAt != nil || record.RevokedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, &record, claims)
+	}
+
+	user, err := s.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrUserDisabled
+	}
+
+	newRefreshToken, newClaims, err := s.signToken(user, models.TokenTypeRefresh, record.FamilyID, claims.SessionID, s.authConfig.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The conditional update makes rotation single-use even when two
+		// requests race with the same token
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("jti = ? AND used_at IS NULL AND revoked_at IS NULL", record.JTI).
+			Updates(map[string]interface{}{
+				"used_at":     now,
+				"replaced_by": newClaims.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		return tx.Create(newRefreshTokenRecord(user, newClaims, &record.JTI)).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, s.handleRefreshTokenReuse(ctx, &record, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, _, err := s.signToken(user, models.TokenTypeAccess, record.FamilyID, claims.SessionID, s.authConfig.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int(s.authConfig.AccessTokenTTL.Seconds()),
+		TokenType:    "Bearer",
+	}, nil
+}
+
+// ValidateToken validates an access token and its session, counting the
+// call as session activity, and returns the token claims
+func (s *UserService) ValidateToken(ctx context.Context, tokenString string) (*models.JWTClaims, error) {
+	return s.validateAccessToken(ctx, tokenString, true)
+}
+
+// ValidateTokenPassive validates an access token and its session without
+// extending the session's idle timeout
+func (s *UserService) ValidateTokenPassive(ctx context.Context, tokenString string) (*models.JWTClaims, error) {
+	return s.validateAccessToken(ctx, tokenString, false)
+}
+
+// GetSessionInfo returns the remaining lifetime of a session
+func (s *UserService) GetSessionInfo(ctx context.Context, sessionID string) (*models.SessionInfo, error) {
+	return s.sessions.GetSessionInfo(ctx, sessionID)
+}
+
+// validateAccessToken checks the token, the revocation list and the session
+func (s *UserService) validateAccessToken(ctx context.Context, tokenString string, touch bool) (*models.JWTClaims, error) {
+	claims, err := s.parseToken(tokenString, models.TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.revocations.contains(ctx, claims.ID, claims.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenBlacklisted
+	}
+
+	if touch {
+		err = s.sessions.TouchSession(ctx, claims.SessionID)
+	} else {
+		_, err = s.sessions.ValidateSession(ctx, claims.SessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the given access token and the refresh token family it
+// was issued with
+func (s *UserService) Logout(ctx context.Context, accessToken string) error {
+	claims, err := s.parseToken(accessToken, models.TokenTypeAccess)
+	if err != nil {
+		return err
+	}
+	if err := s.revokeToken(ctx, claims); err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, claims)
+}
+
+// RevokeRefreshToken revokes the given refresh token and its family
+func (s *UserService) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	claims, err := s.parseToken(refreshToken, models.TokenTypeRefresh)
+	if err != nil {
+		return err
+	}
+	if err := s.revokeToken(ctx, claims); err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, claims)
+}
+
+// handleRefreshTokenReuse revokes the family of a replayed refresh token
+// and records the attempt as a failed login
+func (s *UserService) handleRefreshTokenReuse(ctx context.Context, record *models.RefreshToken, claims *models.JWTClaims) error {
+	if err := s.revokeFamily(ctx, claims); err != nil {
+		return err
+	}
+
+	reason := "refresh_token_reuse"
+	userID := record.UserID
+	entry := models.LoginLog{
+		ID:            uuid.New(),
+		UserID:        &userID,
+		Username:      claims.Username,
+		Success:       false,
+		FailureReason: &reason,
+		Provider:      LoginProviderLocal,
+	}
+	if err := s.db.WithContext(ctx).Create(&entry).Error; err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// newRefreshTokenRecord builds the tracking row for an issued refresh token
+func newRefreshTokenRecord(user *models.User, claims *models.JWTClaims, parentJTI *string) *models.RefreshToken {
+	return &models.RefreshToken{
+		ID:        uuid.New(),
+		JTI:       claims.ID,
+		FamilyID:  claims.FamilyID,
+		UserID:    user.ID,
+		ParentJTI: parentJTI,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+}
+
+// signToken creates a signed JWT for the user and returns it with its claims
+func (s *UserService) signToken(user *models.User, tokenType, familyID, sessionID string, ttl time.Duration) (string, *models.JWTClaims, error) {
+	now := time.Now()
+	claims := &models.JWTClaims{
+		UserID:    user.ID.String(),
+		Username:  user.Username,
+		Role:      user.Role,
+		TokenType: tokenType,
+		FamilyID:  familyID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   user.ID.String(),
+			Issuer:    s.authConfig.Issuer,
+			Audience:  jwt.ClaimStrings{s.authConfig.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	if user.Team != nil {
+		claims.Team = *user.Team
+	}
+	if user.ProductLine != nil {
+		claims.ProductLine = *user.ProductLine
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(s.authConfig.JWTSecret))
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// parseToken verifies signature, expiry, issuer, audience and token type
+func (s *UserService) parseToken(tokenString, tokenType string) (*models.JWTClaims, error) {
+	claims := &models.JWTClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			return []byte(s.authConfig.JWTSecret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.authConfig.Issuer),
+		jwt.WithAudience(s.authConfig.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+	if !token.Valid || claims.TokenType != tokenType || claims.ID == "" || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	if _, err := uuid.Parse(claims.UserID); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// revokeToken adds the token's JTI to the blacklist until it expires
+func (s *UserService) revokeToken(ctx context.Context, claims *models.JWTClaims) error {
+	return s.blacklist(ctx, claims.ID, claims.TokenType, claims.UserID, claims.ExpiresAt.Time)
+}
+
+// revokeFamily marks every refresh token of the family and its session
+// revoked, and blacklists the family ID so access tokens issued with it
+// stop working
+func (s *UserService) revokeFamily(ctx context.Context, claims *models.JWTClaims) error {
+	if claims.FamilyID == "" {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", claims.FamilyID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("token = ?", claims.FamilyID).
+		Update("is_revoked", true).Error; err != nil {
+		return err
+	}
+
+	// Rotation can extend a family up to one refresh TTL past now
+	expiresAt := now.Add(s.authConfig.RefreshTokenTTL)
+	return s.blacklist(ctx, claims.FamilyID, models.BlacklistTypeFamily, claims.UserID, expiresAt)
+}
+
+// blacklist persists a revocation and adds it to the in-process cache
+func (s *UserService) blacklist(ctx context.Context, id, entryType, userID string, expiresAt time.Time) error {
+	entry := models.TokenBlacklist{
+		ID:        uuid.New(),
+		JTI:       id,
+		TokenType: entryType,
+		ExpiresAt: expiresAt,
+	}
+	if uid, err := uuid.Parse(userID); err == nil {
+		entry.UserID = &uid
+	}
+
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "jti"}},
+		DoNothing: true,
+	}).Create(&entry).Error; err != nil {
+		return err
+	}
+
+	s.revocations.add(id, expiresAt)
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCalendar is returned for a working calendar that cannot be
+// saved
+var ErrInvalidCalendar = errors.New("invalid working calendar")
+
+// maxCalendarScan bounds the search for a working day, so a calendar full
+// of holidays cannot loop for ever
+const maxCalendarScan = 366
+
+// GetWorkCalendar returns the project's working calendar, or the default
+// Monday to Friday one when it has none
+func (s *ProjectService) GetWorkCalendar(ctx context.Context, projectID string) (*models.WorkCalendar, error) {
+	if _, err := uuid.Parse(projectID); err != nil {
+		return nil, errors.New("invalid project ID")
+	}
+	return projectCalendar(s.db.WithContext(ctx), projectID)
+}
+
+// UpdateWorkCalendar replaces the project's working calendar. It applies
+// to activities rescheduled from now on.
+func (s *ProjectService) UpdateWorkCalendar(ctx context.Context, projectID string, req *models.UpdateWorkCalendarRequest, userID string) (*models.WorkCalendar, error) {
+	if _, err := uuid.Parse(projectID); err != nil {
+		return nil, errors.New("invalid project ID")
+	}
+	if len(req.Weekdays) == 0 {
+		return nil, fmt.Errorf("%w: at least one working weekday is required", ErrInvalidCalendar)
+	}
+	for _, weekday := range req.Weekdays {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return nil, fmt.Errorf("%w: weekday %d out of range", ErrInvalidCalendar, weekday)
+		}
+	}
+	for _, date := range slices.Concat(req.Holidays, req.Workdays) {
+		if _, err := time.Parse(models.CalendarDateLayout, date); err != nil {
+			return nil, fmt.Errorf("%w: %s is not a YYYY-MM-DD date", ErrInvalidCalendar, date)
+		}
+	}
+
+	var calendar models.WorkCalendar
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", projectID).Limit(1).Find(&calendar).Error; err != nil {
+			return err
+		}
+		calendar.ProjectID = projectID
+		calendar.Weekdays = req.Weekdays
+		calendar.Holidays = req.Holidays
+		calendar.Workdays = req.Workdays
+		calendar.UpdatedBy = userID
+		return tx.Save(&calendar).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+// projectCalendar loads the working calendar of a project
+func projectCalendar(db *gorm.DB, projectID string) (*models.WorkCalendar, error) {
+	var calendar models.WorkCalendar
+	result := db.Where("project_id = ?", projectID).Limit(1).Find(&calendar)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &models.WorkCalendar{
+			ProjectID: projectID,
+			Weekdays:  models.DefaultWorkingWeekdays,
+			Holidays:  []string{},
+			Workdays:  []string{},
+		}, nil
+	}
+	return &calendar, nil
+}
+
+// nextWorkday returns the day of t if it is a working day, else the next
+// working day
+func nextWorkday(calendar *models.WorkCalendar, t time.Time) time.Time {
+	t = truncateDay(t)
+	for i := 0; i < maxCalendarScan && !calendar.IsWorkday(t); i++ {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// previousWorkday returns the day of t if it is a working day, else the
+// previous working day
+func previousWorkday(calendar *models.WorkCalendar, t time.Time) time.Time {
+	t = truncateDay(t)
+	for i := 0; i < maxCalendarScan && !calendar.IsWorkday(t); i++ {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// addWorkdays moves n working days from the first working day on or
+// after t; n may be negative
+func addWorkdays(calendar *models.WorkCalendar, t time.Time, n int) time.Time {
+	t = nextWorkday(calendar, t)
+	for ; n > 0; n-- {
+		t = nextWorkday(calendar, t.AddDate(0, 0, 1))
+	}
+	for ; n < 0; n++ {
+		t = previousWorkday(calendar, t.AddDate(0, 0, -1))
+	}
+	return t
+}
+
+// workdaysBetween counts the working days from one date up to, but not
+// including, another
+func workdaysBetween(calendar *models.WorkCalendar, from, to time.Time) int {
+	days := 0
+	for t, end := truncateDay(from), truncateDay(to); t.Before(end); t = t.AddDate(0, 0, 1) {
+		if calendar.IsWorkday(t) {
+			days++
+		}
+	}
+	return days
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// policyAdapter stores casbin policies in the casbin_rule table
+type policyAdapter struct {
+	db *gorm.DB
+}
+
+var _ persist.BatchAdapter = (*policyAdapter)(nil)
+
+// LoadPolicy loads all rules into the model
+func (a *policyAdapter) LoadPolicy(m model.Model) error {
+	var rules []models.CasbinRule
+	if err := a.db.Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := persist.LoadPolicyArray(ruleToArray(rule), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePolicy replaces all stored rules with the model's rules
+func (a *policyAdapter) SavePolicy(m model.Model) error {
+	var rules []models.CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			for _, values := range ast.Policy {
+				rules = append(rules, newCasbinRule(ptype, values))
+			}
+		}
+	}
+
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.CasbinRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+}
+
+// AddPolicy stores one rule
+func (a *policyAdapter) AddPolicy(sec, ptype string, values []string) error {
+	rule := newCasbinRule(ptype, values)
+	return a.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rule).Error
+}
+
+// RemovePolicy deletes one rule
+func (a *policyAdapter) RemovePolicy(sec, ptype string, values []string) error {
+	rule := newCasbinRule(ptype, values)
+	return a.db.Where(map[string]interface{}{
+		"ptype": rule.Ptype, "v0": rule.V0, "v1": rule.V1, "v2": rule.V2,
+		"v3": rule.V3, "v4": rule.V4, "v5": rule.V5,
+	}).Delete(&models.CasbinRule{}).Error
+}
+
+// AddPolicies stores several rules in one transaction
+func (a *policyAdapter) AddPolicies(sec, ptype string, rules [][]string) error {
+	rows := make([]models.CasbinRule, 0, len(rules))
+	for _, values := range rules {
+		rows = append(rows, newCasbinRule(ptype, values))
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return a.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// RemovePolicies deletes several rules in one transaction
+func (a *policyAdapter) RemovePolicies(sec, ptype string, rules [][]string) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		adapter := &policyAdapter{db: tx}
+		for _, values := range rules {
+			if err := adapter.RemovePolicy(sec, ptype, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveFilteredPolicy deletes the rules whose fields starting at
+// fieldIndex match fieldValues; empty values match anything
+func (a *policyAdapter) RemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	query := a.db.Where("ptype = ?", ptype)
+	for i, value := range fieldValues {
+		column := fieldIndex + i
+		if value == "" || column > 5 {
+			continue
+		}
+		query = query.Where(fmt.Sprintf("v%d = ?", column), value)
+	}
+	return query.Delete(&models.CasbinRule{}).Error
+}
+
+// newCasbinRule maps a policy line to its row
+func newCasbinRule(ptype string, values []string) models.CasbinRule {
+	rule := models.CasbinRule{Ptype: ptype}
+	fields := []*string{&rule.V0, &rule.V1, &rule.V2, &rule.V3, &rule.V4, &rule.V5}
+	for i, value := range values {
+		if i < len(fields) {
+			*fields[i] = value
+		}
+	}
+	return rule
+}
+
+// ruleToArray maps a row back to a policy line, dropping unused fields
+func ruleToArray(rule models.CasbinRule) []string {
+	line := []string{rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5}
+	end := len(line)
+	for end > 1 && strings.TrimSpace(line[end-1]) == "" {
+		end--
+	}
+	return line[:end]
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Classification errors
+var (
+	ErrClassificationDenied  = errors.New("access denied by data classification")
+	ErrInvalidClassification = errors.New("invalid classification level")
+	ErrGrantExists           = errors.New("classification grant already exists")
+	ErrGrantNotFound         = errors.New("classification grant not found")
+)
+
+// Audit actions for classification checks and changes
+const (
+	AuditActionClassificationDenied = "classification_denied"
+	AuditActionClearanceChanged     = "clearance_changed"
+	AuditActionGrantAdded           = "classification_grant_added"
+	AuditActionGrantRemoved         = "classification_grant_removed"
+)
+
+// ClassificationService applies the SRS-SECURITY-001 access matrix:
+// public data is visible to everyone, internal data to members of the
+// owning department or the project, secret data to project members and
+// confidential data to named individuals only. A user never sees data
+// above their clearance.
+type ClassificationService struct {
+	db       *gorm.DB
+	security *SecurityService
+}
+
+// NewClassificationService creates a new ClassificationService
+func NewClassificationService(db *gorm.DB) *ClassificationService {
+	return &ClassificationService{
+		db:       db,
+		security: NewSecurityService(db),
+	}
+}
+
+// ScopeProjects limits a project query to the projects the caller may see.
+// Calls without an authenticated user (background jobs) are not limited.
+func (s *ClassificationService) ScopeProjects(ctx context.Context, query *gorm.DB) (*gorm.DB, error) {
+	viewer, err := s.viewer(ctx)
+	if err != nil || viewer == nil {
+		return query, err
+	}
+
+	// As in projectLevel, a missing or unknown level counts as internal
+	level := "(CASE WHEN projects.classification_level IN ? THEN projects.classification_level ELSE ? END)"
+	levelArgs := []interface{}{classificationLevelNames(), models.ClassificationInternal}
+	conditions := []string{level + " = ?"}
+	args := append(slices.Clone(levelArgs), models.ClassificationPublic)
+
+	named := "projects.leader_id = ? OR projects.tech_leader_id = ? OR projects.product_leader_id = ? OR " +
+		"projects.id IN (SELECT resource_id FROM classification_grants WHERE resource_type = ? AND user_id = ?)"
+	namedArgs := []interface{}{viewer.ID, viewer.ID, viewer.ID, models.ClassifiedProject, viewer.ID}
+	member := "projects.created_by = ? OR projects.id IN (SELECT project_id FROM project_members WHERE user_id = ?) OR " + named
+	memberArgs := append([]interface{}{viewer.ID, viewer.ID}, namedArgs...)
+
+	if viewer.HasClearance(models.ClassificationInternal) {
+		department := member
+		departmentArgs := memberArgs
+		if viewer.OrganizationID != nil {
+			department = "projects.organization_id = ? OR " + member
+			departmentArgs = append([]interface{}{*viewer.OrganizationID}, memberArgs...)
+		}
+		conditions = append(conditions, "("+level+" = ? AND ("+department+"))")
+		args = append(args, levelArgs...)
+		args = append(args, models.ClassificationInternal)
+		args = append(args, departmentArgs...)
+	}
+	if viewer.HasClearance(models.ClassificationSecret) {
+		conditions = append(conditions, "("+level+" = ? AND ("+member+"))")
+		args = append(args, levelArgs...)
+		args = append(args, models.ClassificationSecret)
+		args = append(args, memberArgs...)
+	}
+	if viewer.HasClearance(models.ClassificationConfidential) {
+		conditions = append(conditions, "("+level+" = ? AND ("+named+"))")
+		args = append(args, levelArgs...)
+		args = append(args, models.ClassificationConfidential)
+		args = append(args, namedArgs...)
+	}
+
+	return query.Where("("+strings.Join(conditions, " OR ")+")", args...), nil
+}
+
+// AuthorizeProject returns ErrClassificationDenied if the caller may not
+// access the project. Denials are written to the audit log.
+func (s *ClassificationService) AuthorizeProject(ctx context.Context, project *models.Project) error {
+	viewer, err := s.viewer(ctx)
+	if err != nil || viewer == nil {
+		return err
+	}
+
+	level := projectLevel(project)
+	allowed, err := s.canAccess(ctx, viewer, project, level, nil)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return s.deny(ctx, viewer, models.ClassifiedProject, project.ID, level)
+	}
+	return nil
+}
+
+// AuthorizeFile returns ErrClassificationDenied if the caller may not
+// access the file. A file is classified at its own level or its project's,
+// whichever is higher; a grant on either one names the user.
+func (s *ClassificationService) AuthorizeFile(ctx context.Context, file *models.ProjectFile) error {
+	viewer, err := s.viewer(ctx)
+	if err != nil || viewer == nil {
+		return err
+	}
+
+	var project models.Project
+	if err := s.db.WithContext(ctx).First(&project, "id = ?", file.ProjectID).Error; err != nil {
+		return err
+	}
+
+	level := fileLevel(&project, file)
+	allowed, err := s.canAccess(ctx, viewer, &project, level, &file.ID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return s.deny(ctx, viewer, models.ClassifiedFile, file.ID, level)
+	}
+	return nil
+}
+
+// FileLevel returns the classification the file is handled at, its own or
+// its project's
+func (s *ClassificationService) FileLevel(ctx context.Context, file *models.ProjectFile) (string, error) {
+	var project models.Project
+	if err := s.db.WithContext(ctx).First(&project, "id = ?", file.ProjectID).Error; err != nil {
+		return "", err
+	}
+	return fileLevel(&project, file), nil
+}
+
+// FilterFiles drops the files of a project the caller may not access.
+// Filtering a listing is not a denial and is not audited.
+func (s *ClassificationService) FilterFiles(ctx context.Context, project *models.Project, files []models.ProjectFile) ([]models.ProjectFile, error) {
+	viewer, err := s.viewer(ctx)
+	if err != nil || viewer == nil {
+		return files, err
+	}
+
+	visible := make([]models.ProjectFile, 0, len(files))
+	for i := range files {
+		allowed, err := s.canAccess(ctx, viewer, project, fileLevel(project, &files[i]), &files[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			visible = append(visible, files[i])
+		}
+	}
+	return visible, nil
+}
+
+// SetClearance changes the highest classification level a user may access
+func (s *ClassificationService) SetClearance(ctx context.Context, userID, level string) (*models.User, error) {
+	if !models.IsValidClassification(level) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClassification, level)
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", uid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(&user).Update("clearance_level", level).Error; err != nil {
+		return nil, err
+	}
+	details := (&models.AuditDetails{}).Change("clearance_level", user.ClearanceLevel, level)
+	user.ClearanceLevel = level
+
+	s.audit(ctx, AuditActionClearanceChanged, "user", user.ID.String(), details)
+	return &user, nil
+}
+
+// ListGrants returns the named individuals of a resource
+func (s *ClassificationService) ListGrants(ctx context.Context, resourceType, resourceID string) ([]models.ClassificationGrant, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC")
+	if resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resourceID != "" {
+		rid, err := uuid.Parse(resourceID)
+		if err != nil {
+			return nil, errors.New("invalid resource ID")
+		}
+		query = query.Where("resource_id = ?", rid)
+	}
+
+	var grants []models.ClassificationGrant
+	if err := query.Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// AddGrant names a user for a resource
+func (s *ClassificationService) AddGrant(ctx context.Context, req models.ClassificationGrantRequest) (*models.ClassificationGrant, error) {
+	if req.ResourceType != models.ClassifiedProject && req.ResourceType != models.ClassifiedFile {
+		return nil, fmt.Errorf("unsupported resource type: %s", req.ResourceType)
+	}
+	resourceID, err := uuid.Parse(req.ResourceID)
+	if err != nil {
+		return nil, errors.New("invalid resource ID")
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var users int64
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Count(&users).Error; err != nil {
+		return nil, err
+	}
+	if users == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	var existing int64
+	if err := s.db.WithContext(ctx).Model(&models.ClassificationGrant{}).
+		Where("resource_type = ? AND resource_id = ? AND user_id = ?", req.ResourceType, resourceID, userID).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrGrantExists
+	}
+
+	grantedBy, _ := actorFromContext(ctx)
+	grant := models.ClassificationGrant{
+		ID:           uuid.New(),
+		ResourceType: req.ResourceType,
+		ResourceID:   resourceID,
+		UserID:       userID,
+		Reason:       req.Reason,
+		GrantedBy:    grantedBy,
+	}
+	if err := s.db.WithContext(ctx).Create(&grant).Error; err != nil {
+		return nil, err
+	}
+
+	details := (&models.AuditDetails{}).
+		Change("grant", nil, userID).
+		With("grant_id", grant.ID).
+		With("reason", grant.Reason)
+	s.audit(ctx, AuditActionGrantAdded, req.ResourceType, resourceID.String(), details)
+	return &grant, nil
+}
+
+// RemoveGrant revokes a named individual's access
+func (s *ClassificationService) RemoveGrant(ctx context.Context, grantID string) error {
+	gid, err := uuid.Parse(grantID)
+	if err != nil {
+		return ErrGrantNotFound
+	}
+
+	var grant models.ClassificationGrant
+	if err := s.db.WithContext(ctx).First(&grant, "id = ?", gid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGrantNotFound
+		}
+		return err
+	}
+	if err := s.db.WithContext(ctx).Delete(&grant).Error; err != nil {
+		return err
+	}
+
+	details := (&models.AuditDetails{}).
+		Change("grant", grant.UserID, nil).
+		With("grant_id", grant.ID)
+	s.audit(ctx, AuditActionGrantRemoved, grant.ResourceType, grant.ResourceID.String(), details)
+	return nil
+}
+
+// viewer returns the authenticated caller, or nil for system calls. A
+// token whose user no longer exists only sees public data.
+func (s *ClassificationService) viewer(ctx context.Context) (*models.User, error) {
+	actorID, actorName := actorFromContext(ctx)
+	if actorID == nil {
+		return nil, nil
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Select("id", "username", "role", "clearance_level", "organization_id").First(&user, "id = ?", *actorID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{ID: *actorID, ClearanceLevel: models.ClassificationPublic}
+		if actorName != nil {
+			user.Username = *actorName
+		}
+		return &user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// canAccess applies the access matrix to a project, or to a file of it
+// when fileID is set
+func (s *ClassificationService) canAccess(ctx context.Context, viewer *models.User, project *models.Project, level string, fileID *uuid.UUID) (bool, error) {
+	if !viewer.HasClearance(level) {
+		return false, nil
+	}
+
+	switch level {
+	case models.ClassificationPublic:
+		return true, nil
+	case models.ClassificationInternal:
+		if viewer.OrganizationID != nil && project.OrganizationID != nil && *viewer.OrganizationID == *project.OrganizationID {
+			return true, nil
+		}
+		fallthrough
+	case models.ClassificationSecret:
+		if project.CreatedBy != nil && *project.CreatedBy == viewer.ID {
+			return true, nil
+		}
+		var members int64
+		if err := s.db.WithContext(ctx).Model(&models.ProjectMember{}).
+			Where("project_id = ? AND user_id = ?", project.ID, viewer.ID).
+			Count(&members).Error; err != nil {
+			return false, err
+		}
+		if members > 0 {
+			return true, nil
+		}
+	}
+
+	for _, leader := range []*uuid.UUID{project.LeaderID, project.TechLeaderID, project.ProductLeaderID} {
+		if leader != nil && *leader == viewer.ID {
+			return true, nil
+		}
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.ClassificationGrant{}).
+		Where("user_id = ? AND resource_type = ? AND resource_id = ?", viewer.ID, models.ClassifiedProject, project.ID)
+	if fileID != nil {
+		query = query.Or("user_id = ? AND resource_type = ? AND resource_id = ?", viewer.ID, models.ClassifiedFile, *fileID)
+	}
+	var grants int64
+	if err := query.Count(&grants).Error; err != nil {
+		return false, err
+	}
+	return grants > 0, nil
+}
+
+// deny records a refused access and returns ErrClassificationDenied
+func (s *ClassificationService) deny(ctx context.Context, viewer *models.User, resourceType string, resourceID uuid.UUID, level string) error {
+	username := viewer.Username
+	reason := fmt.Sprintf("clearance %s, resource classified %s", viewer.ClearanceLevel, level)
+	details := (&models.AuditDetails{}).
+		With("clearance_level", viewer.ClearanceLevel).
+		With("classification", level)
+	entry := newAuditEvent(ctx, AuditActionClassificationDenied, resourceType, resourceID.String(), level, details)
+	entry.UserID, entry.Username = &viewer.ID, &username
+	entry.ErrorMessage = &reason
+	if err := s.security.CreateAuditLog(ctx, entry); err != nil {
+		log.Printf("failed to record classification denial: %v", err)
+	}
+	return ErrClassificationDenied
+}
+
+// audit records a clearance or grant change
+func (s *ClassificationService) audit(ctx context.Context, action, resource, resourceID string, details *models.AuditDetails) {
+	entry := newAuditEvent(ctx, action, resource, resourceID, models.ClassificationInternal, details)
+	if err := s.security.CreateAuditLog(ctx, entry); err != nil {
+		log.Printf("failed to record %s: %v", action, err)
+	}
+}
+
+// projectLevel returns the project's classification, treating an unset
+// level as the default internal
+func projectLevel(project *models.Project) string {
+	if !models.IsValidClassification(project.ClassificationLevel) {
+		return models.ClassificationInternal
+	}
+	return project.ClassificationLevel
+}
+
+// classificationLevelNames returns the known classification levels
+func classificationLevelNames() []string {
+	names := make([]string, 0, len(models.ClassificationLevels))
+	for name := range models.ClassificationLevels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fileLevel returns the file's own classification or its project's,
+// whichever is higher
+func fileLevel(project *models.Project, file *models.ProjectFile) string {
+	level := projectLevel(project)
+	if file.ClassificationLevel != nil && models.ClassificationLevels[*file.ClassificationLevel] > models.ClassificationLevels[level] {
+		level = *file.ClassificationLevel
+	}
+	return level
+}
@@ -0,0 +1,457 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Classification change errors
+var (
+	ErrChangeNotFound          = errors.New("classification change not found")
+	ErrChangeAlreadyPending    = errors.New("a classification change is already pending for this resource")
+	ErrChangeNotPending        = errors.New("classification change is no longer pending")
+	ErrClassificationUnchanged = errors.New("resource already has this classification level")
+	ErrNotResourceOwner        = errors.New("only the resource owner may change its classification")
+	ErrNotStageApprover        = errors.New("not an approver for the current stage")
+	ErrSelfApproval            = errors.New("the requester may not approve their own request")
+	ErrApproverAlreadySigned   = errors.New("approver already signed off an earlier stage")
+)
+
+// Audit actions for classification changes
+const (
+	AuditActionClassificationRequested = "classification_change_requested"
+	AuditActionClassificationApproved  = "classification_change_approved"
+	AuditActionClassificationRejected  = "classification_change_rejected"
+	AuditActionClassificationCancelled = "classification_change_cancelled"
+	AuditActionClassificationChanged   = "classification_changed"
+)
+
+// stageActions maps each approval stage to the permission its approvers
+// need on the classification object
+var stageActions = map[string]string{
+	models.ApprovalStageDeptLeader:     "approve",
+	models.ApprovalStageSecurityOffice: "approve_security",
+}
+
+// approvalStages returns the sign-offs a change needs (SRS-SECURITY-001).
+// Anything touching confidential data, raising or lowering, also needs the
+// security office after the department leader.
+func approvalStages(from, to string) []string {
+	if from == models.ClassificationConfidential || to == models.ClassificationConfidential {
+		return []string{models.ApprovalStageDeptLeader, models.ApprovalStageSecurityOffice}
+	}
+	return []string{models.ApprovalStageDeptLeader}
+}
+
+// ClassificationChangeService runs the reclassification workflow: the
+// owner proposes a level, the approvers of each stage sign off in turn and
+// only then is the new level applied
+type ClassificationChangeService struct {
+	db             *gorm.DB
+	permissions    *PermissionService
+	classification *ClassificationService
+	security       *SecurityService
+}
+
+// NewClassificationChangeService creates a new ClassificationChangeService
+func NewClassificationChangeService(db *gorm.DB, permissions *PermissionService) *ClassificationChangeService {
+	return &ClassificationChangeService{
+		db:             db,
+		permissions:    permissions,
+		classification: NewClassificationService(db),
+		security:       NewSecurityService(db),
+	}
+}
+
+// classifiedResource is a project or one of its files
+type classifiedResource struct {
+	project *models.Project
+	file    *models.ProjectFile
+	level   string
+}
+
+// RequestChange proposes a new classification level. The caller must own
+// the resource, i.e. manage its project, and be cleared for the new level.
+func (s *ClassificationChangeService) RequestChange(ctx context.Context, req models.ClassificationChangeRequest) (*models.ClassificationChange, error) {
+	if !models.IsValidClassification(req.Level) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClassification, req.Level)
+	}
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := s.authorizedResource(ctx, req.ResourceType, req.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := s.permissions.Enforce(ctx, actor.ID.String(), actor.Role, models.ProjectDomain(resource.project.ID.String()), "classification", "update")
+	if err != nil {
+		return nil, err
+	}
+	if !owner {
+		return nil, ErrNotResourceOwner
+	}
+	if !actor.HasClearance(req.Level) {
+		return nil, fmt.Errorf("%w: %s is above your clearance", ErrInvalidClassification, req.Level)
+	}
+	if req.Level == resource.level {
+		return nil, ErrClassificationUnchanged
+	}
+	if resource.file != nil && models.ClassificationLevels[req.Level] < models.ClassificationLevels[projectLevel(resource.project)] {
+		return nil, fmt.Errorf("%w: a file cannot be classified below its project", ErrInvalidClassification)
+	}
+
+	resourceID := resource.project.ID
+	if resource.file != nil {
+		resourceID = resource.file.ID
+	}
+	var pending int64
+	if err := s.db.WithContext(ctx).Model(&models.ClassificationChange{}).
+		Where("resource_type = ? AND resource_id = ? AND status = ?", req.ResourceType, resourceID, models.ClassificationChangePending).
+		Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrChangeAlreadyPending
+	}
+
+	change := models.ClassificationChange{
+		ID:           uuid.New(),
+		ResourceType: req.ResourceType,
+		ResourceID:   resourceID,
+		FromLevel:    resource.level,
+		ToLevel:      req.Level,
+		Reason:       req.Reason,
+		Status:       models.ClassificationChangePending,
+		Stages:       approvalStages(resource.level, req.Level),
+		RequestedBy:  actor.ID,
+	}
+	if err := s.db.WithContext(ctx).Create(&change).Error; err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, AuditActionClassificationRequested, &change)
+	return &change, nil
+}
+
+// ApproveChange signs off the current stage. The last approval applies
+// the new level.
+func (s *ClassificationChangeService) ApproveChange(ctx context.Context, changeID string, comment *string) (*models.ClassificationChange, error) {
+	return s.decide(ctx, changeID, true, comment)
+}
+
+// RejectChange ends the change without applying it
+func (s *ClassificationChangeService) RejectChange(ctx context.Context, changeID string, comment *string) (*models.ClassificationChange, error) {
+	return s.decide(ctx, changeID, false, comment)
+}
+
+// CancelChange withdraws a pending change; only the requester may do so
+func (s *ClassificationChangeService) CancelChange(ctx context.Context, changeID string) (*models.ClassificationChange, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	change, err := s.getChange(ctx, s.db.WithContext(ctx), changeID)
+	if err != nil {
+		return nil, err
+	}
+	if change.RequestedBy != actor.ID {
+		return nil, ErrNotResourceOwner
+	}
+	if change.Status != models.ClassificationChangePending {
+		return nil, ErrChangeNotPending
+	}
+
+	now := time.Now()
+	change.Status = models.ClassificationChangeCancelled
+	change.DecidedAt = &now
+	if err := s.db.WithContext(ctx).Model(change).
+		Updates(map[string]interface{}{"status": change.Status, "decided_at": now}).Error; err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, AuditActionClassificationCancelled, change)
+	return change, nil
+}
+
+// ListPendingChanges returns the pending changes the caller requested or
+// may approve at their current stage
+func (s *ClassificationChangeService) ListPendingChanges(ctx context.Context) ([]models.ClassificationChange, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.ClassificationChange
+	if err := s.db.WithContext(ctx).Preload("Approvals").
+		Where("status = ?", models.ClassificationChangePending).
+		Order("created_at ASC").
+		Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	visible := make([]models.ClassificationChange, 0, len(changes))
+	for _, change := range changes {
+		if change.RequestedBy == actor.ID {
+			visible = append(visible, change)
+			continue
+		}
+		allowed, err := s.permissions.Enforce(ctx, actor.ID.String(), actor.Role, models.DomainAll, "classification", stageActions[change.PendingStage()])
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			visible = append(visible, change)
+		}
+	}
+	return visible, nil
+}
+
+// GetHistory returns the resource's current level and all changes
+// proposed for it. The caller must be able to access the resource.
+func (s *ClassificationChangeService) GetHistory(ctx context.Context, resourceType, resourceID string) (*models.ClassificationHistory, error) {
+	resource, err := s.authorizedResource(ctx, resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &models.ClassificationHistory{
+		ResourceType: resourceType,
+		ResourceID:   resource.project.ID,
+		Level:        resource.level,
+	}
+	if resource.file != nil {
+		history.ResourceID = resource.file.ID
+	}
+	if err := s.db.WithContext(ctx).Preload("Approvals", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).
+		Where("resource_type = ? AND resource_id = ?", resourceType, history.ResourceID).
+		Order("created_at DESC").
+		Find(&history.Changes).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// decide records an approver's decision on the current stage
+func (s *ClassificationChangeService) decide(ctx context.Context, changeID string, approve bool, comment *string) (*models.ClassificationChange, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var change *models.ClassificationChange
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		change, err = s.getChange(ctx, tx, changeID)
+		if err != nil {
+			return err
+		}
+		stage, stageIndex := change.PendingStage(), change.CurrentStage
+		if stage == "" {
+			return ErrChangeNotPending
+		}
+		if change.RequestedBy == actor.ID {
+			return ErrSelfApproval
+		}
+		for _, earlier := range change.Approvals {
+			if earlier.ApproverID == actor.ID {
+				return ErrApproverAlreadySigned
+			}
+		}
+		allowed, err := s.permissions.Enforce(ctx, actor.ID.String(), actor.Role, models.DomainAll, "classification", stageActions[stage])
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrNotStageApprover
+		}
+
+		approval := models.ClassificationApproval{
+			ID:         uuid.New(),
+			ChangeID:   change.ID,
+			Stage:      stage,
+			ApproverID: actor.ID,
+			Approved:   approve,
+			Comment:    comment,
+		}
+		if err := tx.Create(&approval).Error; err != nil {
+			return err
+		}
+		change.Approvals = append(change.Approvals, approval)
+
+		updates := map[string]interface{}{}
+		switch {
+		case !approve:
+			change.Status = models.ClassificationChangeRejected
+		case change.CurrentStage+1 < len(change.Stages):
+			change.CurrentStage++
+			updates["current_stage"] = change.CurrentStage
+		default:
+			change.Status = models.ClassificationChangeApproved
+			if err := s.apply(tx, change); err != nil {
+				return err
+			}
+		}
+		if change.Status != models.ClassificationChangePending {
+			now := time.Now()
+			change.DecidedAt = &now
+			updates["status"] = change.Status
+			updates["decided_at"] = now
+		}
+
+		// Guard against a concurrent decision on the same stage
+		result := tx.Model(&models.ClassificationChange{}).
+			Where("id = ? AND status = ? AND current_stage = ?", change.ID, models.ClassificationChangePending, stageIndex).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrChangeNotPending
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch change.Status {
+	case models.ClassificationChangeApproved:
+		s.audit(ctx, AuditActionClassificationChanged, change)
+	case models.ClassificationChangeRejected:
+		s.audit(ctx, AuditActionClassificationRejected, change)
+	default:
+		s.audit(ctx, AuditActionClassificationApproved, change)
+	}
+	return change, nil
+}
+
+// apply writes the approved level to the resource
+func (s *ClassificationChangeService) apply(tx *gorm.DB, change *models.ClassificationChange) error {
+	switch change.ResourceType {
+	case models.ClassifiedProject:
+		return tx.Model(&models.Project{}).Where("id = ?", change.ResourceID).
+			Update("classification_level", change.ToLevel).Error
+	case models.ClassifiedFile:
+		return tx.Model(&models.ProjectFile{}).Where("id = ?", change.ResourceID).
+			Update("classification_level", change.ToLevel).Error
+	}
+	return fmt.Errorf("unsupported resource type: %s", change.ResourceType)
+}
+
+// getChange loads a change with its approvals
+func (s *ClassificationChangeService) getChange(ctx context.Context, db *gorm.DB, changeID string) (*models.ClassificationChange, error) {
+	id, err := uuid.Parse(changeID)
+	if err != nil {
+		return nil, ErrChangeNotFound
+	}
+
+	var change models.ClassificationChange
+	if err := db.Preload("Approvals", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).First(&change, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChangeNotFound
+		}
+		return nil, err
+	}
+	return &change, nil
+}
+
+// actor returns the authenticated caller; the workflow has no system
+// actions
+func (s *ClassificationChangeService) actor(ctx context.Context) (*models.User, error) {
+	actor, err := s.classification.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if actor == nil {
+		return nil, ErrUserNotFound
+	}
+	return actor, nil
+}
+
+// authorizedResource loads a project or file and checks the caller may
+// access it at its current level
+func (s *ClassificationChangeService) authorizedResource(ctx context.Context, resourceType, resourceID string) (*classifiedResource, error) {
+	id, err := uuid.Parse(resourceID)
+	if err != nil {
+		return nil, errors.New("invalid resource ID")
+	}
+
+	resource := &classifiedResource{project: &models.Project{}}
+	switch resourceType {
+	case models.ClassifiedProject:
+		if err := s.db.WithContext(ctx).First(resource.project, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("project not found")
+			}
+			return nil, err
+		}
+		if err := s.classification.AuthorizeProject(ctx, resource.project); err != nil {
+			return nil, err
+		}
+		resource.level = projectLevel(resource.project)
+	case models.ClassifiedFile:
+		resource.file = &models.ProjectFile{}
+		if err := s.db.WithContext(ctx).First(resource.file, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("file not found")
+			}
+			return nil, err
+		}
+		if err := s.classification.AuthorizeFile(ctx, resource.file); err != nil {
+			return nil, err
+		}
+		if err := s.db.WithContext(ctx).First(resource.project, "id = ?", resource.file.ProjectID).Error; err != nil {
+			return nil, err
+		}
+		resource.level = fileLevel(resource.project, resource.file)
+	default:
+		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+	}
+	return resource, nil
+}
+
+// audit records a step of the workflow. The entry is classified at the
+// higher of the two levels since it names the resource.
+func (s *ClassificationChangeService) audit(ctx context.Context, action string, change *models.ClassificationChange) {
+	level := change.FromLevel
+	if models.ClassificationLevels[change.ToLevel] > models.ClassificationLevels[level] {
+		level = change.ToLevel
+	}
+
+	details := &models.AuditDetails{}
+	if n := len(change.Approvals); n > 0 && action != AuditActionClassificationRequested && action != AuditActionClassificationCancelled {
+		last := change.Approvals[n-1]
+		details = auditApproval("classification_change", last.Stage, last.Approved, last.Comment)
+	}
+	details.With("change_id", change.ID).With("status", change.Status)
+	if change.Reason != nil {
+		details.With("reason", *change.Reason)
+	}
+	if action == AuditActionClassificationChanged {
+		approvers := make([]string, len(change.Approvals))
+		for i, approval := range change.Approvals {
+			approvers[i] = approval.ApproverID.String()
+		}
+		details.Change("classification_level", change.FromLevel, change.ToLevel).With("approvers", approvers)
+	} else {
+		details.With("from_level", change.FromLevel).With("to_level", change.ToLevel)
+	}
+
+	entry := newAuditEvent(ctx, action, change.ResourceType, change.ResourceID.String(), level, details)
+	if err := s.security.CreateAuditLog(ctx, entry); err != nil {
+		log.Printf("failed to record %s: %v", action, err)
+	}
+}
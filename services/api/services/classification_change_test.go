@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ClassificationChangeTestSuite 密级变更审批测试套件
+type ClassificationChangeTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	permissions *PermissionService
+	service     *ClassificationChangeService
+	owner       *models.User
+	leader      *models.User
+	project     *models.Project
+}
+
+func (s *ClassificationChangeTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:classification_change?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.ProjectFile{},
+		&models.ClassificationGrant{}, &models.ClassificationChange{}, &models.ClassificationApproval{},
+		&models.CasbinRule{}, &models.AuditLog{}, &models.AuditChainHead{},
+	))
+	for _, table := range []string{
+		"users", "projects", "project_members", "project_files", "classification_grants",
+		"classification_changes", "classification_approvals", "casbin_rule", "audit_logs", "audit_chain_heads",
+	} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.permissions, err = NewPermissionService(s.db, models.PermissionConfig{})
+	require.NoError(s.T(), err)
+	s.service = NewClassificationChangeService(s.db, s.permissions)
+
+	s.owner = s.createUser("owner", models.RoleDesigner, models.ClassificationConfidential)
+	s.leader = s.createUser("leader", models.RoleDeptLeader, models.ClassificationInternal)
+	department := uuid.New()
+	s.project = &models.Project{ID: uuid.New(), Code: "RDP-CLS-001", Name: "Radar", Category: "product_dev", ClassificationLevel: models.ClassificationInternal,
+		OrganizationID: &department}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+	require.NoError(s.T(), s.db.Create(&models.ProjectMember{ID: uuid.New(), ProjectID: s.project.ID, UserID: s.owner.ID, Role: "manager"}).Error)
+}
+
+func TestClassificationChangeSuite(t *testing.T) {
+	suite.Run(t, new(ClassificationChangeTestSuite))
+}
+
+// createUser 创建指定角色和许可级别的用户
+func (s *ClassificationChangeTestSuite) createUser(name, role, clearance string) *models.User {
+	user := &models.User{ID: uuid.New(), Username: name, DisplayName: name, Role: role, ClearanceLevel: clearance}
+	require.NoError(s.T(), s.db.Create(user).Error)
+	return user
+}
+
+// as 返回以指定用户身份发起请求的上下文
+func (s *ClassificationChangeTestSuite) as(user *models.User) context.Context {
+	ctx := context.WithValue(context.Background(), "user_id", user.ID.String())
+	return context.WithValue(ctx, "username", user.Username)
+}
+
+func (s *ClassificationChangeTestSuite) projectLevel() string {
+	var project models.Project
+	require.NoError(s.T(), s.db.First(&project, "id = ?", s.project.ID).Error)
+	return project.ClassificationLevel
+}
+
+func (s *ClassificationChangeTestSuite) request(user *models.User, level string) (*models.ClassificationChange, error) {
+	return s.service.RequestChange(s.as(user), models.ClassificationChangeRequest{
+		ResourceType: models.ClassifiedProject,
+		ResourceID:   s.project.ID.String(),
+		Level:        level,
+	})
+}
+
+// TestSecret_DeptLeaderApproves 测试升为秘密级只需部门领导审批
+func (s *ClassificationChangeTestSuite) TestSecret_DeptLeaderApproves() {
+	change, err := s.request(s.owner, models.ClassificationSecret)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{models.ApprovalStageDeptLeader}, change.Stages)
+	assert.Equal(s.T(), models.ClassificationInternal, change.FromLevel)
+
+	// 审批通过前密级不变
+	assert.Equal(s.T(), models.ClassificationInternal, s.projectLevel())
+
+	designer := s.createUser("designer", models.RoleDesigner, models.ClassificationInternal)
+	_, err = s.service.ApproveChange(s.as(designer), change.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrNotStageApprover)
+	_, err = s.service.ApproveChange(s.as(s.owner), change.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrSelfApproval)
+
+	comment := "同意"
+	approved, err := s.service.ApproveChange(s.as(s.leader), change.ID.String(), &comment)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ClassificationChangeApproved, approved.Status)
+	assert.Equal(s.T(), models.ClassificationSecret, s.projectLevel())
+
+	_, err = s.service.ApproveChange(s.as(s.leader), change.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrChangeNotPending)
+
+	history, err := s.service.GetHistory(s.as(s.owner), models.ClassifiedProject, s.project.ID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ClassificationSecret, history.Level)
+	require.Len(s.T(), history.Changes, 1)
+	assert.Equal(s.T(), models.ClassificationInternal, history.Changes[0].FromLevel)
+	assert.Equal(s.T(), models.ClassificationSecret, history.Changes[0].ToLevel)
+	require.Len(s.T(), history.Changes[0].Approvals, 1)
+	assert.Equal(s.T(), s.leader.ID, history.Changes[0].Approvals[0].ApproverID)
+}
+
+// TestConfidential_SecurityOfficeSignsLast 测试机密级需部门领导与保密办依次审批
+func (s *ClassificationChangeTestSuite) TestConfidential_SecurityOfficeSignsLast() {
+	officer := s.createUser("officer", models.RoleDesigner, models.ClassificationInternal)
+	require.NoError(s.T(), s.permissions.AddRoleBinding(context.Background(), models.RoleBinding{
+		Subject: models.UserSubject(officer.ID.String()),
+		Role:    models.RoleSecurityOffice,
+		Domain:  models.DomainAll,
+	}))
+
+	change, err := s.request(s.owner, models.ClassificationConfidential)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{models.ApprovalStageDeptLeader, models.ApprovalStageSecurityOffice}, change.Stages)
+
+	// 保密办不能越过部门领导
+	_, err = s.service.ApproveChange(s.as(officer), change.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrNotStageApprover)
+
+	change, err = s.service.ApproveChange(s.as(s.leader), change.ID.String(), nil)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ClassificationChangePending, change.Status)
+	assert.Equal(s.T(), models.ApprovalStageSecurityOffice, change.PendingStage())
+	assert.Equal(s.T(), models.ClassificationInternal, s.projectLevel())
+
+	pending, err := s.service.ListPendingChanges(s.as(officer))
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), pending, 1)
+	pending, err = s.service.ListPendingChanges(s.as(s.leader))
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), pending)
+
+	_, err = s.service.ApproveChange(s.as(s.leader), change.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrApproverAlreadySigned)
+
+	change, err = s.service.ApproveChange(s.as(officer), change.ID.String(), nil)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ClassificationChangeApproved, change.Status)
+	assert.Equal(s.T(), models.ClassificationConfidential, s.projectLevel())
+
+	var entries []models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ?", AuditActionClassificationChanged).Find(&entries).Error)
+	require.Len(s.T(), entries, 1)
+	assert.Equal(s.T(), models.AuditSeverityWarn, entries[0].Severity)
+	require.NotNil(s.T(), entries[0].Details)
+	assert.Equal(s.T(), models.AuditChange{Before: models.ClassificationInternal, After: models.ClassificationConfidential},
+		entries[0].Details.Changes["classification_level"])
+	assert.Len(s.T(), entries[0].Details.Context["approvers"], 2)
+	assert.Equal(s.T(), models.ApprovalStageSecurityOffice, entries[0].Details.Context["stage"])
+	assert.Equal(s.T(), auditLogHash(&entries[0]), entries[0].Hash)
+}
+
+// TestRequest_Rules 测试变更申请的约束条件
+func (s *ClassificationChangeTestSuite) TestRequest_Rules() {
+	// 同部门可读但非负责人的用户
+	outsider := s.createUser("outsider", models.RoleDesigner, models.ClassificationConfidential)
+	require.NoError(s.T(), s.db.Model(outsider).Update("organization_id", *s.project.OrganizationID).Error)
+	_, err := s.request(outsider, models.ClassificationSecret)
+	assert.ErrorIs(s.T(), err, ErrNotResourceOwner)
+
+	_, err = s.request(s.owner, models.ClassificationInternal)
+	assert.ErrorIs(s.T(), err, ErrClassificationUnchanged)
+
+	change, err := s.request(s.owner, models.ClassificationPublic)
+	require.NoError(s.T(), err)
+	_, err = s.request(s.owner, models.ClassificationSecret)
+	assert.ErrorIs(s.T(), err, ErrChangeAlreadyPending)
+
+	rejected, err := s.service.RejectChange(s.as(s.leader), change.ID.String(), nil)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ClassificationChangeRejected, rejected.Status)
+	assert.Equal(s.T(), models.ClassificationInternal, s.projectLevel())
+
+	// 驳回后可重新申请，申请人可撤回
+	change, err = s.request(s.owner, models.ClassificationSecret)
+	require.NoError(s.T(), err)
+	_, err = s.service.CancelChange(s.as(s.leader), change.ID.String())
+	assert.ErrorIs(s.T(), err, ErrNotResourceOwner)
+	cancelled, err := s.service.CancelChange(s.as(s.owner), change.ID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ClassificationChangeCancelled, cancelled.Status)
+
+	// 普通更新不能绕过审批修改密级
+	updated, err := NewProjectService(s.db).UpdateProject(s.as(s.owner), s.project.ID.String(),
+		map[string]interface{}{"classification_level": models.ClassificationPublic, "name": "Radar II"}, "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Radar II", updated.Name)
+	assert.Equal(s.T(), models.ClassificationInternal, s.projectLevel())
+}
+
+// TestFile_CannotGoBelowProject 测试文件密级不能低于所属项目
+func (s *ClassificationChangeTestSuite) TestFile_CannotGoBelowProject() {
+	file := &models.ProjectFile{ID: uuid.New(), ProjectID: s.project.ID, Name: "spec.pdf", Path: "/"}
+	require.NoError(s.T(), s.db.Create(file).Error)
+
+	_, err := s.service.RequestChange(s.as(s.owner), models.ClassificationChangeRequest{
+		ResourceType: models.ClassifiedFile, ResourceID: file.ID.String(), Level: models.ClassificationPublic,
+	})
+	assert.ErrorIs(s.T(), err, ErrInvalidClassification)
+
+	change, err := s.service.RequestChange(s.as(s.owner), models.ClassificationChangeRequest{
+		ResourceType: models.ClassifiedFile, ResourceID: file.ID.String(), Level: models.ClassificationSecret,
+	})
+	require.NoError(s.T(), err)
+	_, err = s.service.ApproveChange(s.as(s.leader), change.ID.String(), nil)
+	require.NoError(s.T(), err)
+
+	var stored models.ProjectFile
+	require.NoError(s.T(), s.db.First(&stored, "id = ?", file.ID).Error)
+	require.NotNil(s.T(), stored.ClassificationLevel)
+	assert.Equal(s.T(), models.ClassificationSecret, *stored.ClassificationLevel)
+	assert.Equal(s.T(), models.ClassificationInternal, s.projectLevel())
+}
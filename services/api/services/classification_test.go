@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ClassificationServiceTestSuite 密级访问控制测试套件
+type ClassificationServiceTestSuite struct {
+	suite.Suite
+	db             *gorm.DB
+	service        *ClassificationService
+	projectService *ProjectService
+	fileService    *FileService
+	department     uuid.UUID
+}
+
+func (s *ClassificationServiceTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:classification?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.ProjectFile{},
+		&models.ClassificationGrant{}, &models.AuditLog{}, &models.AuditChainHead{},
+	))
+	for _, table := range []string{"users", "projects", "project_members", "project_files", "classification_grants", "audit_logs", "audit_chain_heads"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.service = NewClassificationService(s.db)
+	s.projectService = NewProjectService(s.db)
+	s.fileService = NewFileService(s.db, s.T().TempDir())
+	s.department = uuid.New()
+}
+
+func TestClassificationServiceSuite(t *testing.T) {
+	suite.Run(t, new(ClassificationServiceTestSuite))
+}
+
+// createUser 创建指定许可级别的用户，默认与项目同属一个部门
+func (s *ClassificationServiceTestSuite) createUser(name, clearance string) *models.User {
+	department := s.department
+	user := &models.User{ID: uuid.New(), Username: name, DisplayName: name, Role: models.RoleDesigner, ClearanceLevel: clearance,
+		OrganizationID: &department}
+	require.NoError(s.T(), s.db.Create(user).Error)
+	return user
+}
+
+// createProject 创建指定密级的项目
+func (s *ClassificationServiceTestSuite) createProject(code, level string, leaderID *uuid.UUID) *models.Project {
+	department := s.department
+	project := &models.Project{ID: uuid.New(), Code: code, Name: code, Category: "product_dev", ClassificationLevel: level, LeaderID: leaderID,
+		OrganizationID: &department}
+	require.NoError(s.T(), s.db.Create(project).Error)
+	return project
+}
+
+// addMember 添加项目成员
+func (s *ClassificationServiceTestSuite) addMember(project *models.Project, user *models.User) {
+	require.NoError(s.T(), s.db.Create(&models.ProjectMember{ID: uuid.New(), ProjectID: project.ID, UserID: user.ID, Role: "member"}).Error)
+}
+
+// as 返回以指定用户身份发起请求的上下文
+func (s *ClassificationServiceTestSuite) as(user *models.User) context.Context {
+	ctx := context.WithValue(context.Background(), "user_id", user.ID.String())
+	return context.WithValue(ctx, "username", user.Username)
+}
+
+func (s *ClassificationServiceTestSuite) visibleCodes(ctx context.Context) []string {
+	projects, total, err := s.projectService.ListProjects(ctx, 1, 50, map[string]interface{}{})
+	require.NoError(s.T(), err)
+	codes := make([]string, 0, len(projects))
+	for _, p := range projects {
+		codes = append(codes, p.Code)
+	}
+	assert.Equal(s.T(), int64(len(codes)), total)
+	return codes
+}
+
+func (s *ClassificationServiceTestSuite) deniedCount() int64 {
+	var count int64
+	s.db.Model(&models.AuditLog{}).Where("action = ?", AuditActionClassificationDenied).Count(&count)
+	return count
+}
+
+// TestListProjects_FiltersByMatrix 测试项目列表按密级矩阵过滤
+func (s *ClassificationServiceTestSuite) TestListProjects_FiltersByMatrix() {
+	guest := s.createUser("guest", models.ClassificationPublic)
+	designer := s.createUser("designer", models.ClassificationInternal)
+	member := s.createUser("member", models.ClassificationSecret)
+	named := s.createUser("named", models.ClassificationConfidential)
+
+	s.createProject("PUB", models.ClassificationPublic, nil)
+	s.createProject("INT", models.ClassificationInternal, nil)
+	secret := s.createProject("SEC", models.ClassificationSecret, nil)
+	s.createProject("SEC-OTHER", models.ClassificationSecret, nil)
+	s.createProject("CONF", models.ClassificationConfidential, &named.ID)
+	s.createProject("CONF-OTHER", models.ClassificationConfidential, nil)
+	s.addMember(secret, member)
+	s.addMember(secret, designer)
+
+	assert.ElementsMatch(s.T(), []string{"PUB"}, s.visibleCodes(s.as(guest)))
+	// 许可级别不足时，项目成员身份也不能看到秘密项目
+	assert.ElementsMatch(s.T(), []string{"PUB", "INT"}, s.visibleCodes(s.as(designer)))
+	assert.ElementsMatch(s.T(), []string{"PUB", "INT", "SEC"}, s.visibleCodes(s.as(member)))
+	assert.ElementsMatch(s.T(), []string{"PUB", "INT", "CONF"}, s.visibleCodes(s.as(named)))
+
+	// 系统调用不受限制
+	assert.Len(s.T(), s.visibleCodes(context.Background()), 6)
+
+	// 列表过滤不计入拒绝审计
+	assert.Equal(s.T(), int64(0), s.deniedCount())
+}
+
+// TestListProjects_UnknownLevelIsInternal 测试密级为空或无效的项目在列表与详情中均按内部处理
+func (s *ClassificationServiceTestSuite) TestListProjects_UnknownLevelIsInternal() {
+	guest := s.createUser("guest", models.ClassificationPublic)
+	designer := s.createUser("designer", models.ClassificationInternal)
+
+	missing := s.createProject("NULL", models.ClassificationInternal, nil)
+	unknown := s.createProject("BOGUS", models.ClassificationInternal, nil)
+	require.NoError(s.T(), s.db.Exec("UPDATE projects SET classification_level = NULL WHERE id = ?", missing.ID).Error)
+	require.NoError(s.T(), s.db.Exec("UPDATE projects SET classification_level = 'bogus' WHERE id = ?", unknown.ID).Error)
+
+	assert.Empty(s.T(), s.visibleCodes(s.as(guest)))
+	assert.ElementsMatch(s.T(), []string{"NULL", "BOGUS"}, s.visibleCodes(s.as(designer)))
+	_, err := s.projectService.GetProjectByID(s.as(designer), unknown.ID.String())
+	assert.NoError(s.T(), err)
+	_, err = s.projectService.GetProjectByID(s.as(guest), missing.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+}
+
+// TestInternal_OtherDepartmentDenied 测试其他部门的用户不能访问内部项目，除非是项目成员
+func (s *ClassificationServiceTestSuite) TestInternal_OtherDepartmentDenied() {
+	colleague := s.createUser("colleague", models.ClassificationInternal)
+	outsider := s.createUser("outsider", models.ClassificationSecret)
+	other := uuid.New()
+	require.NoError(s.T(), s.db.Model(outsider).Update("organization_id", other).Error)
+	nobody := s.createUser("nobody", models.ClassificationInternal)
+	require.NoError(s.T(), s.db.Model(nobody).Update("organization_id", nil).Error)
+
+	project := s.createProject("INT", models.ClassificationInternal, nil)
+	s.createProject("PUB", models.ClassificationPublic, nil)
+
+	assert.ElementsMatch(s.T(), []string{"PUB", "INT"}, s.visibleCodes(s.as(colleague)))
+	assert.ElementsMatch(s.T(), []string{"PUB"}, s.visibleCodes(s.as(outsider)))
+	assert.ElementsMatch(s.T(), []string{"PUB"}, s.visibleCodes(s.as(nobody)))
+
+	_, err := s.projectService.GetProjectByID(s.as(outsider), project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+	_, err = s.projectService.GetProjectByID(s.as(nobody), project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+	assert.Equal(s.T(), int64(2), s.deniedCount())
+
+	// 加入项目后可跨部门访问
+	s.addMember(project, outsider)
+	_, err = s.projectService.GetProjectByID(s.as(outsider), project.ID.String())
+	assert.NoError(s.T(), err)
+	assert.ElementsMatch(s.T(), []string{"PUB", "INT"}, s.visibleCodes(s.as(outsider)))
+}
+
+// TestGetProject_DeniedIsAudited 测试直接访问越权项目返回拒绝并记录审计
+func (s *ClassificationServiceTestSuite) TestGetProject_DeniedIsAudited() {
+	designer := s.createUser("designer", models.ClassificationInternal)
+	member := s.createUser("member", models.ClassificationSecret)
+	outsider := s.createUser("outsider", models.ClassificationSecret)
+	project := s.createProject("SEC", models.ClassificationSecret, nil)
+	s.addMember(project, member)
+
+	got, err := s.projectService.GetProjectByID(s.as(member), project.ID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), project.ID, got.ID)
+
+	_, err = s.projectService.GetProjectByID(s.as(outsider), project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+	_, err = s.projectService.GetProjectByID(s.as(designer), project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+
+	var entry models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ? AND user_id = ?", AuditActionClassificationDenied, outsider.ID).First(&entry).Error)
+	assert.Equal(s.T(), models.ClassifiedProject, entry.Resource)
+	assert.Equal(s.T(), project.ID.String(), *entry.ResourceID)
+	assert.Equal(s.T(), models.ClassificationSecret, entry.Classification)
+	assert.Equal(s.T(), int64(2), s.deniedCount())
+}
+
+// TestGrant_NamesIndividual 测试机密项目仅对指定人员开放
+func (s *ClassificationServiceTestSuite) TestGrant_NamesIndividual() {
+	user := s.createUser("analyst", models.ClassificationConfidential)
+	project := s.createProject("CONF", models.ClassificationConfidential, nil)
+	s.addMember(project, user)
+
+	// 项目成员身份不足以访问机密项目
+	_, err := s.projectService.GetProjectByID(s.as(user), project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+
+	grant, err := s.service.AddGrant(context.Background(), models.ClassificationGrantRequest{
+		ResourceType: models.ClassifiedProject,
+		ResourceID:   project.ID.String(),
+		UserID:       user.ID.String(),
+	})
+	require.NoError(s.T(), err)
+	_, err = s.service.AddGrant(context.Background(), models.ClassificationGrantRequest{
+		ResourceType: models.ClassifiedProject,
+		ResourceID:   project.ID.String(),
+		UserID:       user.ID.String(),
+	})
+	assert.ErrorIs(s.T(), err, ErrGrantExists)
+
+	_, err = s.projectService.GetProjectByID(s.as(user), project.ID.String())
+	assert.NoError(s.T(), err)
+	assert.ElementsMatch(s.T(), []string{"CONF"}, s.visibleCodes(s.as(user)))
+
+	// 降低许可级别后授权不再生效
+	_, err = s.service.SetClearance(context.Background(), user.ID.String(), models.ClassificationSecret)
+	require.NoError(s.T(), err)
+	_, err = s.projectService.GetProjectByID(s.as(user), project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+
+	_, err = s.service.SetClearance(context.Background(), user.ID.String(), "top_secret")
+	assert.ErrorIs(s.T(), err, ErrInvalidClassification)
+
+	require.NoError(s.T(), s.service.RemoveGrant(context.Background(), grant.ID.String()))
+	assert.ErrorIs(s.T(), s.service.RemoveGrant(context.Background(), grant.ID.String()), ErrGrantNotFound)
+}
+
+// TestFiles_ClassifiedAboveProject 测试文件密级高于项目时的过滤与拒绝
+func (s *ClassificationServiceTestSuite) TestFiles_ClassifiedAboveProject() {
+	designer := s.createUser("designer", models.ClassificationSecret)
+	member := s.createUser("member", models.ClassificationSecret)
+	project := s.createProject("INT", models.ClassificationInternal, nil)
+	s.addMember(project, member)
+
+	plain, err := s.fileService.UploadFile(s.as(member), project.ID.String(), "/", "plan.txt", strings.NewReader("plan"))
+	require.NoError(s.T(), err)
+	secret, err := s.fileService.UploadFile(s.as(member), project.ID.String(), "/", "design.txt", strings.NewReader("design"))
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.Model(secret).Update("classification_level", models.ClassificationSecret).Error)
+
+	files, err := s.fileService.ListProjectFiles(s.as(designer), project.ID.String(), "/")
+	require.NoError(s.T(), err)
+	require.Len(s.T(), files, 1)
+	assert.Equal(s.T(), plain.ID, files[0].ID)
+
+	files, err = s.fileService.ListProjectFiles(s.as(member), project.ID.String(), "/")
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), files, 2)
+
+	_, err = s.fileService.DownloadFile(s.as(designer), project.ID.String(), secret.ID.String())
+	assert.ErrorIs(s.T(), err, ErrClassificationDenied)
+	assert.ErrorIs(s.T(), s.fileService.DeleteFile(s.as(designer), project.ID.String(), secret.ID.String()), ErrClassificationDenied)
+
+	// 有权访问的成员也须经导出审批才能下载
+	_, err = s.fileService.DownloadFile(s.as(member), project.ID.String(), secret.ID.String())
+	assert.ErrorIs(s.T(), err, ErrExportApprovalRequired)
+
+	// 文件只能通过其所属项目访问
+	other := s.createProject("OTH", models.ClassificationInternal, nil)
+	_, err = s.fileService.DownloadFile(s.as(member), other.ID.String(), plain.ID.String())
+	assert.EqualError(s.T(), err, "file not found")
+
+	var entry models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ?", AuditActionClassificationDenied).First(&entry).Error)
+	assert.Equal(s.T(), models.ClassifiedFile, entry.Resource)
+	assert.Equal(s.T(), int64(2), s.deniedCount())
+}
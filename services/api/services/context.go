@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// clientFromContext returns the caller's IP address and user agent, stored
+// on the request context by middleware.ClientContext
+func clientFromContext(ctx context.Context) (ipAddress, userAgent *string) {
+	if ip, ok := ctx.Value("ip_address").(string); ok && ip != "" {
+		ipAddress = &ip
+	}
+	if ua, ok := ctx.Value("user_agent").(string); ok && ua != "" {
+		userAgent = &ua
+	}
+	return ipAddress, userAgent
+}
+
+// actorFromContext returns the authenticated caller, stored on the request
+// context by AuthMiddleware; both are nil for system actions
+func actorFromContext(ctx context.Context) (*uuid.UUID, *string) {
+	var actorID *uuid.UUID
+	var actorName *string
+	if id, ok := ctx.Value("user_id").(string); ok {
+		if uid, err := uuid.Parse(id); err == nil {
+			actorID = &uid
+		}
+	}
+	if name, ok := ctx.Value("username").(string); ok && name != "" {
+		actorName = &name
+	}
+	return actorID, actorName
+}
@@ -0,0 +1,689 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Directory sync errors
+var (
+	ErrDirectoryDisabled    = errors.New("directory sync is not configured")
+	ErrDirectoryUnavailable = errors.New("directory is unavailable")
+	ErrDirectorySyncRunning = errors.New("a directory sync is already running")
+)
+
+// DirectorySyncService builds the organization tree and user accounts from
+// an LDAP/AD directory. Only records it created or adopted (those with a
+// directory_dn) are deactivated when they disappear from the directory.
+// Local records are adopted by username or code only when the config opts
+// in, as OIDC login refuses to take over local accounts.
+type DirectorySyncService struct {
+	db     *gorm.DB
+	config models.LDAPConfig
+	dial   DirectoryDialer
+
+	running sync.Mutex
+}
+
+// NewDirectorySyncService creates a new DirectorySyncService
+func NewDirectorySyncService(db *gorm.DB, config models.LDAPConfig) *DirectorySyncService {
+	if config.OrgFilter == "" {
+		config.OrgFilter = "(objectClass=organizationalUnit)"
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(objectClass=inetOrgPerson)"
+	}
+	if config.OrgCodeAttr == "" {
+		config.OrgCodeAttr = "ou"
+	}
+	if config.OrgNameAttr == "" {
+		config.OrgNameAttr = "description"
+	}
+	if config.OrgLeaderAttr == "" {
+		config.OrgLeaderAttr = "managedBy"
+	}
+	if config.UsernameAttr == "" {
+		config.UsernameAttr = "uid"
+	}
+	if config.DisplayNameAttr == "" {
+		config.DisplayNameAttr = "displayName"
+	}
+	if config.EmailAttr == "" {
+		config.EmailAttr = "mail"
+	}
+	if config.PhoneAttr == "" {
+		config.PhoneAttr = "telephoneNumber"
+	}
+
+	return &DirectorySyncService{
+		db:     db,
+		config: config,
+		dial:   dialLDAP,
+	}
+}
+
+// directoryPlan is the set of writes a sync would make
+type directoryPlan struct {
+	newOrgs   []*models.Organization
+	newUsers  []*models.User
+	changes   []models.DirectoryChange
+	conflicts []models.DirectoryChange
+	warnings  []string
+}
+
+// directoryPlanner holds the lookup tables used while building a plan
+type directoryPlanner struct {
+	config models.LDAPConfig
+	baseDN string
+	plan   *directoryPlan
+
+	orgs         []models.Organization
+	orgsByDN     map[string]*models.Organization
+	orgsByCode   map[string]*models.Organization
+	plannedOrgs  map[string]*models.Organization // normalized DN -> planned state
+	orgOrder     []string
+	claimedOrgs  map[uuid.UUID]bool
+	orgLeaders   map[string]string
+	orgCodeOwner map[string]uuid.UUID
+
+	users         []models.User
+	usersByDN     map[string]*models.User
+	usersByName   map[string]*models.User
+	claimedUsers  map[uuid.UUID]bool
+	userIDsByDN   map[string]uuid.UUID
+	userIDsByName map[string]uuid.UUID
+}
+
+// Sync reads the directory and reconciles organizations and users. With
+// dryRun set nothing is written and the report lists the planned changes.
+func (s *DirectorySyncService) Sync(ctx context.Context, dryRun bool) (*models.DirectorySyncReport, error) {
+	if !s.config.Enabled() {
+		return nil, ErrDirectoryDisabled
+	}
+	if !s.running.TryLock() {
+		return nil, ErrDirectorySyncRunning
+	}
+	defer s.running.Unlock()
+
+	report := &models.DirectorySyncReport{DryRun: dryRun, StartedAt: time.Now()}
+
+	orgEntries, userEntries, err := s.readDirectory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.plan(ctx, orgEntries, userEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		if err := s.apply(ctx, plan); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Changes = plan.changes
+	if report.Changes == nil {
+		report.Changes = []models.DirectoryChange{}
+	}
+	report.Conflicts = plan.conflicts
+	report.Warnings = plan.warnings
+	report.Summary = make(map[string]int)
+	for _, change := range plan.changes {
+		report.Summary[change.Resource+"_"+change.Action]++
+	}
+	for _, conflict := range plan.conflicts {
+		report.Summary[conflict.Resource+"_"+conflict.Action]++
+	}
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// RunSchedule syncs on the configured interval until ctx is done
+func (s *DirectorySyncService) RunSchedule(ctx context.Context) {
+	if !s.config.Enabled() || s.config.SyncInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Sync(ctx, false)
+			if err != nil {
+				log.Printf("directory sync failed: %v", err)
+				continue
+			}
+			log.Printf("directory sync finished: %d changes, %d warnings", len(report.Changes), len(report.Warnings))
+		}
+	}
+}
+
+// readDirectory fetches the OU and user entries under the base DN
+func (s *DirectorySyncService) readDirectory(ctx context.Context) ([]models.LDAPEntry, []models.LDAPEntry, error) {
+	client, err := s.dial(ctx, s.config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	defer client.Close()
+
+	orgEntries, err := client.Search(ctx, s.config.BaseDN, s.config.OrgFilter,
+		[]string{s.config.OrgCodeAttr, s.config.OrgNameAttr, s.config.OrgLeaderAttr})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	userEntries, err := client.Search(ctx, s.config.BaseDN, s.config.UserFilter,
+		[]string{s.config.UsernameAttr, s.config.DisplayNameAttr, s.config.EmailAttr, s.config.PhoneAttr})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	return orgEntries, userEntries, nil
+}
+
+// plan compares the directory with the database and collects the changes
+func (s *DirectorySyncService) plan(ctx context.Context, orgEntries, userEntries []models.LDAPEntry) (*directoryPlan, error) {
+	p := &directoryPlanner{
+		config:        s.config,
+		baseDN:        normalizeDN(s.config.BaseDN),
+		plan:          &directoryPlan{},
+		orgsByDN:      make(map[string]*models.Organization),
+		orgsByCode:    make(map[string]*models.Organization),
+		plannedOrgs:   make(map[string]*models.Organization),
+		claimedOrgs:   make(map[uuid.UUID]bool),
+		orgLeaders:    make(map[string]string),
+		orgCodeOwner:  make(map[string]uuid.UUID),
+		usersByDN:     make(map[string]*models.User),
+		usersByName:   make(map[string]*models.User),
+		claimedUsers:  make(map[uuid.UUID]bool),
+		userIDsByDN:   make(map[string]uuid.UUID),
+		userIDsByName: make(map[string]uuid.UUID),
+	}
+
+	if err := s.db.WithContext(ctx).Find(&p.orgs).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Find(&p.users).Error; err != nil {
+		return nil, err
+	}
+	for i := range p.orgs {
+		org := &p.orgs[i]
+		if org.DirectoryDN != nil {
+			p.orgsByDN[normalizeDN(*org.DirectoryDN)] = org
+		}
+		p.orgsByCode[org.Code] = org
+		p.orgCodeOwner[org.Code] = org.ID
+	}
+	for i := range p.users {
+		user := &p.users[i]
+		if user.DirectoryDN != nil {
+			p.usersByDN[normalizeDN(*user.DirectoryDN)] = user
+		}
+		p.usersByName[user.Username] = user
+	}
+
+	p.planOrganizations(orgEntries)
+	p.planUsers(userEntries)
+	p.planLeaders()
+	p.planDeactivations()
+	return p.plan, nil
+}
+
+// warn records an entry the sync could not handle
+func (p *directoryPlanner) warn(format string, args ...interface{}) {
+	p.plan.warnings = append(p.plan.warnings, fmt.Sprintf(format, args...))
+}
+
+// inDirectory reports whether a stored DN is among the entries being synced
+func inDirectory(dn *string, entries map[string]bool) bool {
+	return dn != nil && entries[normalizeDN(*dn)]
+}
+
+// conflict records an entry that matches a local record the sync may not
+// adopt, and reports whether the entry must be skipped
+func (p *directoryPlanner) conflict(resource string, id uuid.UUID, dn, name string, localDN *string) bool {
+	if localDN != nil || p.config.AdoptLocalRecords {
+		return false
+	}
+	p.plan.conflicts = append(p.plan.conflicts, models.DirectoryChange{
+		Resource: resource,
+		Action:   models.DirectoryActionConflict,
+		ID:       id.String(),
+		DN:       dn,
+		Name:     name,
+	})
+	p.warn("skipped %s: %s %q already exists locally; set its directory_dn to link it", dn, resource, name)
+	return true
+}
+
+// planOrganizations creates or updates one organization per OU. An OU
+// matches by its DN, or adopts a hand-maintained organization with the
+// same code when AdoptLocalRecords is set.
+func (p *directoryPlanner) planOrganizations(entries []models.LDAPEntry) {
+	// Parents must be planned before their children
+	sort.SliceStable(entries, func(i, j int) bool {
+		return dnDepth(entries[i].DN) < dnDepth(entries[j].DN)
+	})
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[normalizeDN(entry.DN)] = true
+	}
+
+	for _, entry := range entries {
+		dn := normalizeDN(entry.DN)
+		if dn == p.baseDN || !strings.HasSuffix(dn, ","+p.baseDN) {
+			continue
+		}
+
+		code := entry.Get(p.config.OrgCodeAttr)
+		if code == "" || len(code) > 50 {
+			p.warn("skipped %s: invalid %s %q", entry.DN, p.config.OrgCodeAttr, code)
+			continue
+		}
+		name := entry.Get(p.config.OrgNameAttr)
+		if name == "" {
+			name = code
+		}
+
+		var parentID *uuid.UUID
+		level := 1
+		if parent := nearestAncestor(dn, p.baseDN, p.plannedOrgs); parent != nil {
+			parentID = &parent.ID
+			level = parent.Level + 1
+		}
+
+		existing := p.orgsByDN[dn]
+		if existing == nil {
+			if byCode := p.orgsByCode[code]; byCode != nil && !p.claimedOrgs[byCode.ID] && !inDirectory(byCode.DirectoryDN, present) {
+				if p.conflict("organization", byCode.ID, entry.DN, code, byCode.DirectoryDN) {
+					continue
+				}
+				existing = byCode
+			}
+		}
+		if owner, taken := p.orgCodeOwner[code]; taken && (existing == nil || owner != existing.ID) {
+			p.warn("skipped %s: code %q is used by another organization", entry.DN, code)
+			continue
+		}
+
+		var planned *models.Organization
+		if existing == nil {
+			planned = &models.Organization{
+				ID:          uuid.New(),
+				Name:        name,
+				Code:        code,
+				ParentID:    parentID,
+				Level:       level,
+				IsActive:    true,
+				DirectoryDN: &entry.DN,
+			}
+			p.plan.newOrgs = append(p.plan.newOrgs, planned)
+			p.plan.changes = append(p.plan.changes, models.DirectoryChange{
+				Resource: "organization",
+				Action:   models.DirectoryActionCreate,
+				ID:       planned.ID.String(),
+				DN:       entry.DN,
+				Name:     name,
+				Fields: map[string]interface{}{
+					"code":      code,
+					"parent_id": parentID,
+					"level":     level,
+				},
+			})
+		} else {
+			fields := make(map[string]interface{})
+			diffField(fields, "name", existing.Name, name)
+			diffField(fields, "code", existing.Code, code)
+			diffField(fields, "parent_id", existing.ParentID, parentID)
+			diffField(fields, "level", existing.Level, level)
+			diffField(fields, "is_active", existing.IsActive, true)
+			diffField(fields, "directory_dn", existing.DirectoryDN, &entry.DN)
+			p.addUpdate("organization", existing.ID, entry.DN, name, fields)
+
+			copied := *existing
+			copied.ParentID, copied.Level, copied.DirectoryDN = parentID, level, &entry.DN
+			planned = &copied
+		}
+
+		p.plannedOrgs[dn] = planned
+		p.orgOrder = append(p.orgOrder, dn)
+		p.claimedOrgs[planned.ID] = true
+		p.orgCodeOwner[code] = planned.ID
+		if leader := entry.Get(p.config.OrgLeaderAttr); leader != "" {
+			p.orgLeaders[dn] = leader
+		}
+	}
+}
+
+// planUsers creates or updates one user per directory person and places it
+// in the organization of its nearest OU. A local account with the same
+// username is adopted only when AdoptLocalRecords is set.
+func (p *directoryPlanner) planUsers(entries []models.LDAPEntry) {
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[normalizeDN(entry.DN)] = true
+	}
+	nameOwner := make(map[string]uuid.UUID, len(p.users))
+	for _, user := range p.users {
+		nameOwner[user.Username] = user.ID
+	}
+
+	for _, entry := range entries {
+		dn := normalizeDN(entry.DN)
+		username := entry.Get(p.config.UsernameAttr)
+		if username == "" || len(username) > 50 {
+			p.warn("skipped %s: invalid %s %q", entry.DN, p.config.UsernameAttr, username)
+			continue
+		}
+
+		existing := p.usersByDN[dn]
+		if existing == nil {
+			if byName := p.usersByName[username]; byName != nil && !p.claimedUsers[byName.ID] && !inDirectory(byName.DirectoryDN, present) {
+				if p.conflict("user", byName.ID, entry.DN, username, byName.DirectoryDN) {
+					continue
+				}
+				existing = byName
+			}
+		}
+		if owner, taken := nameOwner[username]; taken && (existing == nil || owner != existing.ID) {
+			p.warn("skipped %s: username %q is used by another account", entry.DN, username)
+			continue
+		}
+
+		displayName := entry.Get(p.config.DisplayNameAttr)
+		if displayName == "" {
+			displayName = username
+		}
+		email := optionalString(entry.Get(p.config.EmailAttr))
+		phone := optionalString(entry.Get(p.config.PhoneAttr))
+
+		var orgID *uuid.UUID
+		if org := nearestAncestor(dn, p.baseDN, p.plannedOrgs); org != nil {
+			orgID = &org.ID
+		}
+
+		var id uuid.UUID
+		if existing == nil {
+			user := &models.User{
+				ID:             uuid.New(),
+				Username:       username,
+				DisplayName:    displayName,
+				Email:          email,
+				Phone:          phone,
+				Role:           models.RoleDesigner,
+				OrganizationID: orgID,
+				IsActive:       true,
+				DirectoryDN:    &entry.DN,
+			}
+			p.plan.newUsers = append(p.plan.newUsers, user)
+			p.plan.changes = append(p.plan.changes, models.DirectoryChange{
+				Resource: "user",
+				Action:   models.DirectoryActionCreate,
+				ID:       user.ID.String(),
+				DN:       entry.DN,
+				Name:     username,
+				Fields: map[string]interface{}{
+					"display_name":    displayName,
+					"email":           email,
+					"organization_id": orgID,
+				},
+			})
+			id = user.ID
+		} else {
+			// Blank contact attributes do not clear values entered locally
+			fields := make(map[string]interface{})
+			diffField(fields, "username", existing.Username, username)
+			diffField(fields, "display_name", existing.DisplayName, displayName)
+			if email != nil {
+				diffField(fields, "email", existing.Email, email)
+			}
+			if phone != nil {
+				diffField(fields, "phone", existing.Phone, phone)
+			}
+			diffField(fields, "organization_id", existing.OrganizationID, orgID)
+			diffField(fields, "is_active", existing.IsActive, true)
+			diffField(fields, "directory_dn", existing.DirectoryDN, &entry.DN)
+			p.addUpdate("user", existing.ID, entry.DN, username, fields)
+			id = existing.ID
+		}
+
+		p.claimedUsers[id] = true
+		p.userIDsByDN[dn] = id
+		p.userIDsByName[username] = id
+		nameOwner[username] = id
+	}
+}
+
+// planLeaders resolves each OU's leader attribute, which holds a user DN
+// (managedBy) or, in simpler schemas, a username
+func (p *directoryPlanner) planLeaders() {
+	for _, dn := range p.orgOrder {
+		org := p.plannedOrgs[dn]
+
+		var leaderID *uuid.UUID
+		if leader, ok := p.orgLeaders[dn]; ok {
+			if id, found := p.userIDsByDN[normalizeDN(leader)]; found {
+				leaderID = &id
+			} else if id, found := p.userIDsByName[leader]; found {
+				leaderID = &id
+			} else {
+				p.warn("leader %q of %s is not a synced user", leader, dn)
+			}
+		}
+		if leaderID == nil && org.LeaderID != nil && !p.claimedUsers[*org.LeaderID] {
+			// Keep a hand-assigned leader who is not managed by the directory
+			continue
+		}
+		p.setLeader(org, leaderID)
+	}
+}
+
+// planDeactivations deactivates directory-managed records that are gone
+// from the directory. Hand-maintained records are left alone.
+func (p *directoryPlanner) planDeactivations() {
+	for _, org := range p.orgs {
+		if org.DirectoryDN == nil || !org.IsActive || p.claimedOrgs[org.ID] {
+			continue
+		}
+		p.plan.changes = append(p.plan.changes, models.DirectoryChange{
+			Resource: "organization",
+			Action:   models.DirectoryActionDeactivate,
+			ID:       org.ID.String(),
+			DN:       *org.DirectoryDN,
+			Name:     org.Name,
+			Fields:   map[string]interface{}{"is_active": false},
+		})
+	}
+	for _, user := range p.users {
+		if user.DirectoryDN == nil || !user.IsActive || p.claimedUsers[user.ID] {
+			continue
+		}
+		p.plan.changes = append(p.plan.changes, models.DirectoryChange{
+			Resource: "user",
+			Action:   models.DirectoryActionDeactivate,
+			ID:       user.ID.String(),
+			DN:       *user.DirectoryDN,
+			Name:     user.Username,
+			Fields:   map[string]interface{}{"is_active": false},
+		})
+	}
+}
+
+// addUpdate records an update change if any field differs
+func (p *directoryPlanner) addUpdate(resource string, id uuid.UUID, dn, name string, fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	p.plan.changes = append(p.plan.changes, models.DirectoryChange{
+		Resource: resource,
+		Action:   models.DirectoryActionUpdate,
+		ID:       id.String(),
+		DN:       dn,
+		Name:     name,
+		Fields:   fields,
+	})
+}
+
+// setLeader sets leader_id on a planned organization, merging it into the
+// create or update change already recorded for it
+func (p *directoryPlanner) setLeader(org *models.Organization, leaderID *uuid.UUID) {
+	fields := make(map[string]interface{})
+	diffField(fields, "leader_id", org.LeaderID, leaderID)
+	if len(fields) == 0 {
+		return
+	}
+	org.LeaderID = leaderID
+
+	for i := range p.plan.changes {
+		change := &p.plan.changes[i]
+		if change.Resource == "organization" && change.ID == org.ID.String() {
+			change.Fields["leader_id"] = leaderID
+			return
+		}
+	}
+	p.addUpdate("organization", org.ID, *org.DirectoryDN, org.Name, fields)
+}
+
+// apply writes the plan in one transaction. Organizations go first so that
+// parent and user organization references resolve.
+func (s *DirectorySyncService) apply(ctx context.Context, plan *directoryPlan) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, org := range plan.newOrgs {
+			if err := tx.Create(org).Error; err != nil {
+				return err
+			}
+		}
+		for _, user := range plan.newUsers {
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, change := range plan.changes {
+			if change.Action == models.DirectoryActionCreate {
+				continue
+			}
+			var model interface{} = &models.Organization{}
+			if change.Resource == "user" {
+				model = &models.User{}
+			}
+			if err := tx.Model(model).Where("id = ?", change.ID).Updates(change.Fields).Error; err != nil {
+				return err
+			}
+			// Sign deactivated users out
+			if change.Resource == "user" && change.Action == models.DirectoryActionDeactivate {
+				if err := tx.Model(&models.Session{}).Where("user_id = ?", change.ID).Update("is_revoked", true).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// diffField records key in fields when the new value differs from the old.
+// Pointer values are compared by what they point to.
+func diffField(fields map[string]interface{}, key string, oldValue, newValue interface{}) {
+	if derefValue(oldValue) != derefValue(newValue) {
+		fields[key] = newValue
+	}
+}
+
+// derefValue turns the optional column types used by the sync into
+// comparable values
+func derefValue(v interface{}) interface{} {
+	switch p := v.(type) {
+	case *string:
+		if p == nil {
+			return nil
+		}
+		return *p
+	case *uuid.UUID:
+		if p == nil {
+			return nil
+		}
+		return *p
+	}
+	return v
+}
+
+// optionalString returns nil for an empty string
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nearestAncestor returns the closest planned organization above dn
+func nearestAncestor(dn, baseDN string, orgs map[string]*models.Organization) *models.Organization {
+	for parent := parentDN(dn); parent != "" && parent != baseDN; parent = parentDN(parent) {
+		if org, ok := orgs[parent]; ok {
+			return org
+		}
+	}
+	return nil
+}
+
+// splitDN splits a DN into its RDNs, honouring backslash escapes
+func splitDN(dn string) []string {
+	var rdns []string
+	start, escaped := 0, false
+	for i := 0; i < len(dn); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case dn[i] == '\\':
+			escaped = true
+		case dn[i] == ',':
+			rdns = append(rdns, strings.TrimSpace(dn[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(dn[start:]); rest != "" {
+		rdns = append(rdns, rest)
+	}
+	return rdns
+}
+
+// normalizeDN lower-cases a DN and removes spaces around separators so
+// equal DNs compare equal
+func normalizeDN(dn string) string {
+	rdns := splitDN(dn)
+	for i, rdn := range rdns {
+		if k, v, ok := strings.Cut(rdn, "="); ok {
+			rdn = strings.TrimSpace(k) + "=" + strings.TrimSpace(v)
+		}
+		rdns[i] = strings.ToLower(rdn)
+	}
+	return strings.Join(rdns, ",")
+}
+
+// parentDN returns the normalized DN one level up, or "" at the root
+func parentDN(dn string) string {
+	rdns := splitDN(dn)
+	if len(rdns) <= 1 {
+		return ""
+	}
+	return strings.Join(rdns[1:], ",")
+}
+
+// dnDepth counts the RDNs in a DN
+func dnDepth(dn string) int {
+	return len(splitDN(dn))
+}
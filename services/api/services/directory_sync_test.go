@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// fakeDirectory is an in-process LDAP stand-in. It understands the
+// (objectClass=X) filters used by the default configuration.
+type fakeDirectory struct {
+	entries []models.LDAPEntry
+}
+
+func (d *fakeDirectory) add(dn string, attrs map[string]string) {
+	entry := models.LDAPEntry{DN: dn, Attributes: make(map[string][]string)}
+	for k, v := range attrs {
+		entry.Attributes[strings.ToLower(k)] = []string{v}
+	}
+	d.entries = append(d.entries, entry)
+}
+
+func (d *fakeDirectory) remove(dn string) {
+	for i, e := range d.entries {
+		if e.DN == dn {
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *fakeDirectory) Search(ctx context.Context, baseDN, filter string, attributes []string) ([]models.LDAPEntry, error) {
+	class := strings.TrimSuffix(strings.TrimPrefix(filter, "(objectClass="), ")")
+	var result []models.LDAPEntry
+	for _, e := range d.entries {
+		if strings.EqualFold(e.Get("objectClass"), class) && strings.HasSuffix(normalizeDN(e.DN), normalizeDN(baseDN)) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	return nil
+}
+
+const testBaseDN = "ou=rd-dept,dc=rdp,dc=local"
+
+// DirectorySyncTestSuite LDAP目录同步测试套件
+type DirectorySyncTestSuite struct {
+	suite.Suite
+	db        *gorm.DB
+	directory *fakeDirectory
+	service   *DirectorySyncService
+	ctx       context.Context
+}
+
+func (s *DirectorySyncTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:directory?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.User{}, &models.Organization{}, &models.Session{}))
+	s.db.Exec("DELETE FROM users")
+	s.db.Exec("DELETE FROM organizations")
+	s.db.Exec("DELETE FROM sessions")
+
+	// 研发部 -> 硬件室 -> 射频组
+	s.directory = &fakeDirectory{}
+	s.directory.add("ou=hw,"+testBaseDN, map[string]string{
+		"objectClass": "organizationalUnit", "ou": "hw", "description": "硬件室",
+	})
+	s.directory.add("ou=rf,ou=hw,"+testBaseDN, map[string]string{
+		"objectClass": "organizationalUnit", "ou": "rf", "description": "射频组",
+		"managedBy": "uid=alice,ou=rf,ou=hw," + testBaseDN,
+	})
+	s.directory.add("uid=alice,ou=rf,ou=hw,"+testBaseDN, map[string]string{
+		"objectClass": "inetOrgPerson", "uid": "alice", "displayName": "Alice", "mail": "alice@rdp.local",
+	})
+	s.directory.add("uid=bob,ou=hw,"+testBaseDN, map[string]string{
+		"objectClass": "inetOrgPerson", "uid": "bob", "displayName": "Bob",
+	})
+
+	s.service = NewDirectorySyncService(s.db, models.LDAPConfig{URL: "ldap://stand-in", BaseDN: testBaseDN})
+	s.service.dial = func(ctx context.Context, config models.LDAPConfig) (DirectoryClient, error) {
+		return s.directory, nil
+	}
+	s.ctx = context.Background()
+}
+
+func TestDirectorySyncSuite(t *testing.T) {
+	suite.Run(t, new(DirectorySyncTestSuite))
+}
+
+func (s *DirectorySyncTestSuite) org(code string) models.Organization {
+	var org models.Organization
+	require.NoError(s.T(), s.db.First(&org, "code = ?", code).Error)
+	return org
+}
+
+func (s *DirectorySyncTestSuite) user(username string) models.User {
+	var user models.User
+	require.NoError(s.T(), s.db.First(&user, "username = ?", username).Error)
+	return user
+}
+
+// TestSync_BuildsTree 测试从OU构建组织树并放置用户
+func (s *DirectorySyncTestSuite) TestSync_BuildsTree() {
+	report, err := s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, report.Summary["organization_create"])
+	assert.Equal(s.T(), 2, report.Summary["user_create"])
+	assert.Empty(s.T(), report.Warnings)
+
+	hw, rf := s.org("hw"), s.org("rf")
+	alice, bob := s.user("alice"), s.user("bob")
+
+	assert.Equal(s.T(), "硬件室", hw.Name)
+	assert.Equal(s.T(), 1, hw.Level)
+	assert.Nil(s.T(), hw.ParentID)
+	assert.Equal(s.T(), 2, rf.Level)
+	require.NotNil(s.T(), rf.ParentID)
+	assert.Equal(s.T(), hw.ID, *rf.ParentID)
+	require.NotNil(s.T(), rf.LeaderID)
+	assert.Equal(s.T(), alice.ID, *rf.LeaderID)
+
+	require.NotNil(s.T(), alice.OrganizationID)
+	assert.Equal(s.T(), rf.ID, *alice.OrganizationID)
+	require.NotNil(s.T(), bob.OrganizationID)
+	assert.Equal(s.T(), hw.ID, *bob.OrganizationID)
+	assert.True(s.T(), bob.IsActive)
+
+	// 目录无变化时再次同步不产生变更
+	report, err = s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), report.Changes)
+}
+
+// TestSync_DryRun 测试预演模式只报告不写入
+func (s *DirectorySyncTestSuite) TestSync_DryRun() {
+	report, err := s.service.Sync(s.ctx, true)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), report.DryRun)
+	assert.Len(s.T(), report.Changes, 4)
+
+	var orgs, users int64
+	s.db.Model(&models.Organization{}).Count(&orgs)
+	s.db.Model(&models.User{}).Count(&users)
+	assert.Zero(s.T(), orgs)
+	assert.Zero(s.T(), users)
+}
+
+// TestSync_DeactivatesDepartedUsers 测试离职用户被停用而本地账户不受影响
+func (s *DirectorySyncTestSuite) TestSync_DeactivatesDepartedUsers() {
+	local := models.User{ID: uuid.New(), Username: "admin", DisplayName: "Admin", Role: models.RoleAdmin, IsActive: true}
+	require.NoError(s.T(), s.db.Create(&local).Error)
+
+	_, err := s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+
+	session := models.Session{UserID: s.user("bob").ID, Token: "bob-session", ExpiresAt: time.Now().Add(time.Hour), LastActiveAt: time.Now()}
+	require.NoError(s.T(), s.db.Create(&session).Error)
+
+	s.directory.remove("uid=bob,ou=hw," + testBaseDN)
+	report, err := s.service.Sync(s.ctx, true)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), report.Changes, 1)
+	assert.Equal(s.T(), models.DirectoryActionDeactivate, report.Changes[0].Action)
+	assert.Equal(s.T(), "bob", report.Changes[0].Name)
+	assert.True(s.T(), s.user("bob").IsActive)
+
+	_, err = s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	assert.False(s.T(), s.user("bob").IsActive)
+	assert.True(s.T(), s.user("admin").IsActive)
+	// 停用的用户被强制下线
+	require.NoError(s.T(), s.db.First(&session, "id = ?", session.ID).Error)
+	assert.True(s.T(), session.IsRevoked)
+}
+
+// TestSync_AdoptsExistingOrganization 测试开启接管后按编码接管手工维护的组织
+func (s *DirectorySyncTestSuite) TestSync_AdoptsExistingOrganization() {
+	s.service.config.AdoptLocalRecords = true
+	manual := models.Organization{ID: uuid.New(), Name: "硬件", Code: "hw", Level: 1, IsActive: true}
+	require.NoError(s.T(), s.db.Create(&manual).Error)
+
+	report, err := s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, report.Summary["organization_create"])
+	assert.Equal(s.T(), 1, report.Summary["organization_update"])
+
+	hw := s.org("hw")
+	assert.Equal(s.T(), manual.ID, hw.ID)
+	assert.Equal(s.T(), "硬件室", hw.Name)
+	require.NotNil(s.T(), hw.DirectoryDN)
+	assert.Equal(s.T(), manual.ID, *s.org("rf").ParentID)
+}
+
+// TestSync_ReportsLocalOrganizationConflict 测试默认不接管同编码的手工组织
+func (s *DirectorySyncTestSuite) TestSync_ReportsLocalOrganizationConflict() {
+	manual := models.Organization{ID: uuid.New(), Name: "硬件", Code: "hw", Level: 1, IsActive: true}
+	require.NoError(s.T(), s.db.Create(&manual).Error)
+
+	report, err := s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), report.Conflicts, 1)
+	assert.Equal(s.T(), manual.ID.String(), report.Conflicts[0].ID)
+	assert.Equal(s.T(), "ou=hw,"+testBaseDN, report.Conflicts[0].DN)
+	assert.Equal(s.T(), 1, report.Summary["organization_conflict"])
+
+	hw := s.org("hw")
+	assert.Equal(s.T(), "硬件", hw.Name)
+	assert.Nil(s.T(), hw.DirectoryDN)
+}
+
+// TestSync_DoesNotAdoptBootstrapAdmin 测试目录中的同名条目不会接管、修改或停用初始管理员
+func (s *DirectorySyncTestSuite) TestSync_DoesNotAdoptBootstrapAdmin() {
+	email := "admin@rdp.local"
+	admin := models.User{ID: uuid.New(), Username: "admin", DisplayName: "Admin", Email: &email, Role: models.RoleAdmin, IsActive: true}
+	require.NoError(s.T(), s.db.Create(&admin).Error)
+	s.directory.add("uid=admin,ou=hw,"+testBaseDN, map[string]string{
+		"objectClass": "inetOrgPerson", "uid": "admin", "displayName": "Intruder", "mail": "intruder@example.com",
+	})
+
+	report, err := s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), report.Conflicts, 1)
+	assert.Equal(s.T(), models.DirectoryActionConflict, report.Conflicts[0].Action)
+	assert.Equal(s.T(), admin.ID.String(), report.Conflicts[0].ID)
+	assert.Equal(s.T(), 1, report.Summary["user_conflict"])
+	for _, change := range report.Changes {
+		assert.NotEqual(s.T(), admin.ID.String(), change.ID)
+	}
+
+	stored := s.user("admin")
+	assert.Equal(s.T(), "Admin", stored.DisplayName)
+	require.NotNil(s.T(), stored.Email)
+	assert.Equal(s.T(), email, *stored.Email)
+	assert.Nil(s.T(), stored.DirectoryDN)
+	assert.Nil(s.T(), stored.OrganizationID)
+
+	// 条目从目录中消失后管理员仍保持启用
+	session := models.Session{UserID: admin.ID, Token: "admin-session", ExpiresAt: time.Now().Add(time.Hour), LastActiveAt: time.Now()}
+	require.NoError(s.T(), s.db.Create(&session).Error)
+	s.directory.remove("uid=admin,ou=hw," + testBaseDN)
+	_, err = s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), s.user("admin").IsActive)
+	require.NoError(s.T(), s.db.First(&session, "id = ?", session.ID).Error)
+	assert.False(s.T(), session.IsRevoked)
+}
+
+// TestSync_LinksLocalUserByDN 测试通过设置directory_dn显式关联本地账户
+func (s *DirectorySyncTestSuite) TestSync_LinksLocalUserByDN() {
+	dn := "uid=bob,ou=hw," + testBaseDN
+	local := models.User{ID: uuid.New(), Username: "bob", DisplayName: "Robert", Role: models.RoleDesigner, IsActive: true, DirectoryDN: &dn}
+	require.NoError(s.T(), s.db.Create(&local).Error)
+
+	report, err := s.service.Sync(s.ctx, false)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), report.Conflicts)
+
+	bob := s.user("bob")
+	assert.Equal(s.T(), local.ID, bob.ID)
+	assert.Equal(s.T(), "Bob", bob.DisplayName)
+}
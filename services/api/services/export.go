@@ -0,0 +1,500 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultExportLinkTTL is how long a download link stays valid when not
+// configured
+const DefaultExportLinkTTL = 15 * time.Minute
+
+// Export errors
+var (
+	ErrExportApprovalRequired = errors.New("an approved export request is required to download this file")
+	ErrExportNotRequired      = errors.New("public files can be downloaded without an export request")
+	ErrExportNotFound         = errors.New("export request not found")
+	ErrExportAlreadyOpen      = errors.New("an export request for this file is already open")
+	ErrExportNotPending       = errors.New("export request is no longer pending")
+	ErrExportNotApproved      = errors.New("export request has not been approved")
+	ErrNotExportRequester     = errors.New("only the requester may use this export request")
+	ErrExportLinkInvalid      = errors.New("download link is invalid, expired or already used")
+)
+
+// Audit actions for exports
+const (
+	AuditActionExportRequested  = "export_requested"
+	AuditActionExportApproved   = "export_approved"
+	AuditActionExportRejected   = "export_rejected"
+	AuditActionExportCancelled  = "export_cancelled"
+	AuditActionExportLinkIssued = "export_link_issued"
+	AuditActionFileExported     = "file_exported"
+)
+
+// exportStageActions maps each approval stage to the permission its
+// approvers need on the export object
+var exportStageActions = map[string]string{
+	models.ApprovalStageTeamLeader:     "approve",
+	models.ApprovalStageDeptLeader:     "approve_secret",
+	models.ApprovalStageSecurityOffice: "approve_security",
+}
+
+// exportStages returns the sign-offs an export of the level needs
+// (SRS-SECURITY-001); public files need none
+func exportStages(level string) []string {
+	switch level {
+	case models.ClassificationInternal:
+		return []string{models.ApprovalStageTeamLeader}
+	case models.ClassificationSecret:
+		return []string{models.ApprovalStageDeptLeader}
+	case models.ClassificationConfidential:
+		return []string{models.ApprovalStageDeptLeader, models.ApprovalStageSecurityOffice}
+	}
+	return nil
+}
+
+// ExportDownload is an exported file ready to be sent to the client
+type ExportDownload struct {
+	Filename    string
+	ContentType string
+	Content     io.ReadCloser
+	Watermarked bool
+}
+
+// ExportService runs the export workflow for files classified internal or
+// higher: the user requests an export, the approvers of each stage sign
+// off in turn and the user then downloads the file once through a
+// time-limited link. Secret and confidential files are watermarked with
+// the user's name and the time of download.
+type ExportService struct {
+	db             *gorm.DB
+	config         models.ExportConfig
+	permissions    *PermissionService
+	classification *ClassificationService
+	security       *SecurityService
+}
+
+// NewExportService creates a new ExportService
+func NewExportService(db *gorm.DB, config models.ExportConfig, permissions *PermissionService) *ExportService {
+	if config.LinkTTL <= 0 {
+		config.LinkTTL = DefaultExportLinkTTL
+	}
+	return &ExportService{
+		db:             db,
+		config:         config,
+		permissions:    permissions,
+		classification: NewClassificationService(db),
+		security:       NewSecurityService(db),
+	}
+}
+
+// RequestExport asks to export a file. The caller must be able to access
+// the file; public files need no request.
+func (s *ExportService) RequestExport(ctx context.Context, req models.CreateExportRequest) (*models.ExportRequest, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	file, level, err := s.authorizedFile(ctx, req.FileID)
+	if err != nil {
+		return nil, err
+	}
+	stages := exportStages(level)
+	if len(stages) == 0 {
+		return nil, ErrExportNotRequired
+	}
+
+	var open int64
+	if err := s.db.WithContext(ctx).Model(&models.ExportRequest{}).
+		Where("file_id = ? AND requested_by = ? AND status IN ?", file.ID, actor.ID, []string{models.ExportPending, models.ExportApproved}).
+		Count(&open).Error; err != nil {
+		return nil, err
+	}
+	if open > 0 {
+		return nil, ErrExportAlreadyOpen
+	}
+
+	export := models.ExportRequest{
+		ID:          uuid.New(),
+		FileID:      file.ID,
+		ProjectID:   file.ProjectID,
+		Level:       level,
+		Reason:      req.Reason,
+		Status:      models.ExportPending,
+		Stages:      stages,
+		RequestedBy: actor.ID,
+	}
+	if err := s.db.WithContext(ctx).Create(&export).Error; err != nil {
+		return nil, err
+	}
+
+	details := (&models.AuditDetails{}).With("filename", file.Name).With("reason", export.Reason)
+	s.audit(ctx, AuditActionExportRequested, &export, details)
+	return &export, nil
+}
+
+// ApproveExport signs off the current stage
+func (s *ExportService) ApproveExport(ctx context.Context, exportID string, comment *string) (*models.ExportRequest, error) {
+	return s.decide(ctx, exportID, true, comment)
+}
+
+// RejectExport ends the request
+func (s *ExportService) RejectExport(ctx context.Context, exportID string, comment *string) (*models.ExportRequest, error) {
+	return s.decide(ctx, exportID, false, comment)
+}
+
+// CancelExport withdraws a request, pending or approved but not yet
+// downloaded; only the requester may do so
+func (s *ExportService) CancelExport(ctx context.Context, exportID string) (*models.ExportRequest, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	export, err := s.getExport(ctx, s.db.WithContext(ctx), exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export.RequestedBy != actor.ID {
+		return nil, ErrNotExportRequester
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.ExportRequest{}).
+		Where("id = ? AND status IN ?", export.ID, []string{models.ExportPending, models.ExportApproved}).
+		Updates(map[string]interface{}{"status": models.ExportCancelled, "token_hash": nil})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrExportNotPending
+	}
+	export.Status = models.ExportCancelled
+	export.TokenHash = nil
+
+	s.audit(ctx, AuditActionExportCancelled, export, nil)
+	return export, nil
+}
+
+// ListExports returns the caller's open requests and the pending requests
+// they may approve at their current stage
+func (s *ExportService) ListExports(ctx context.Context) ([]models.ExportRequest, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var exports []models.ExportRequest
+	if err := s.db.WithContext(ctx).Preload("Approvals").
+		Where("status = ? OR (status = ? AND requested_by = ?)", models.ExportPending, models.ExportApproved, actor.ID).
+		Order("created_at ASC").
+		Find(&exports).Error; err != nil {
+		return nil, err
+	}
+
+	visible := make([]models.ExportRequest, 0, len(exports))
+	for _, export := range exports {
+		if export.RequestedBy == actor.ID {
+			visible = append(visible, export)
+			continue
+		}
+		allowed, err := s.permissions.Enforce(ctx, actor.ID.String(), actor.Role, models.DomainAll, "export", exportStageActions[export.PendingStage()])
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			visible = append(visible, export)
+		}
+	}
+	return visible, nil
+}
+
+// IssueLink creates the one-time download link of an approved request.
+// Issuing a new link invalidates the previous one.
+func (s *ExportService) IssueLink(ctx context.Context, exportID string) (*models.ExportLinkResponse, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	export, err := s.getExport(ctx, s.db.WithContext(ctx), exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export.RequestedBy != actor.ID {
+		return nil, ErrNotExportRequester
+	}
+	if export.Status != models.ExportApproved {
+		return nil, ErrExportNotApproved
+	}
+
+	token, err := randomURLSafe(32)
+	if err != nil {
+		return nil, err
+	}
+	hash := hashPersonalToken(token)
+	expiresAt := time.Now().Add(s.config.LinkTTL)
+	result := s.db.WithContext(ctx).Model(&models.ExportRequest{}).
+		Where("id = ? AND status = ?", export.ID, models.ExportApproved).
+		Updates(map[string]interface{}{"token_hash": hash, "link_expires_at": expiresAt})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrExportNotApproved
+	}
+	export.LinkExpiresAt = &expiresAt
+
+	s.audit(ctx, AuditActionExportLinkIssued, export, nil)
+	return &models.ExportLinkResponse{
+		URL:       "/api/v1/exports/download/" + token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Download redeems a download link. The link only works once, before it
+// expires and for the user who requested the export. Access is checked
+// again, and a file reclassified above the approved level needs a new
+// request.
+func (s *ExportService) Download(ctx context.Context, token string) (*ExportDownload, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashPersonalToken(token)
+	var export models.ExportRequest
+	if err := s.db.WithContext(ctx).Preload("Approvals").First(&export, "token_hash = ?", hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExportLinkInvalid
+		}
+		return nil, err
+	}
+	if export.RequestedBy != actor.ID || export.Status != models.ExportApproved ||
+		export.LinkExpiresAt == nil || time.Now().After(*export.LinkExpiresAt) {
+		return nil, ErrExportLinkInvalid
+	}
+
+	file, level, err := s.authorizedFile(ctx, export.FileID.String())
+	if err != nil {
+		return nil, err
+	}
+	if models.ClassificationLevels[level] > models.ClassificationLevels[export.Level] {
+		return nil, fmt.Errorf("%w: file has been reclassified %s", ErrExportApprovalRequired, level)
+	}
+
+	download := &ExportDownload{Filename: file.Name, ContentType: file.ContentType}
+	reader, err := os.Open(file.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	download.Content = reader
+	if models.ClassificationLevels[level] >= models.ClassificationLevels[models.ClassificationSecret] {
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		marked, err := applyWatermark(content, file.Name, watermarkText(actor.Username, time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		download.Content = io.NopCloser(bytes.NewReader(marked))
+		download.Watermarked = true
+	}
+
+	// Redeem the link only once the file is ready, so a failure above
+	// leaves it usable
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.ExportRequest{}).
+		Where("id = ? AND status = ? AND token_hash = ?", export.ID, models.ExportApproved, hash).
+		Updates(map[string]interface{}{"status": models.ExportDownloaded, "downloaded_at": now, "token_hash": nil})
+	if result.Error != nil {
+		download.Content.Close()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		download.Content.Close()
+		return nil, ErrExportLinkInvalid
+	}
+	export.Status = models.ExportDownloaded
+	export.DownloadedAt = &now
+
+	approvers := make([]string, len(export.Approvals))
+	for i, approval := range export.Approvals {
+		approvers[i] = approval.ApproverID.String()
+	}
+	details := (&models.AuditDetails{}).
+		With("filename", download.Filename).
+		With("approvers", approvers).
+		With("watermarked", download.Watermarked)
+	s.audit(ctx, AuditActionFileExported, &export, details)
+	return download, nil
+}
+
+// decide records an approver's decision on the current stage
+func (s *ExportService) decide(ctx context.Context, exportID string, approve bool, comment *string) (*models.ExportRequest, error) {
+	actor, err := s.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var export *models.ExportRequest
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		export, err = s.getExport(ctx, tx, exportID)
+		if err != nil {
+			return err
+		}
+		stage, stageIndex := export.PendingStage(), export.CurrentStage
+		if stage == "" {
+			return ErrExportNotPending
+		}
+		if export.RequestedBy == actor.ID {
+			return ErrSelfApproval
+		}
+		for _, earlier := range export.Approvals {
+			if earlier.ApproverID == actor.ID {
+				return ErrApproverAlreadySigned
+			}
+		}
+		allowed, err := s.permissions.Enforce(ctx, actor.ID.String(), actor.Role, models.DomainAll, "export", exportStageActions[stage])
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrNotStageApprover
+		}
+
+		approval := models.ExportApproval{
+			ID:         uuid.New(),
+			ExportID:   export.ID,
+			Stage:      stage,
+			ApproverID: actor.ID,
+			Approved:   approve,
+			Comment:    comment,
+		}
+		if err := tx.Create(&approval).Error; err != nil {
+			return err
+		}
+		export.Approvals = append(export.Approvals, approval)
+
+		updates := map[string]interface{}{}
+		switch {
+		case !approve:
+			export.Status = models.ExportRejected
+		case export.CurrentStage+1 < len(export.Stages):
+			export.CurrentStage++
+			updates["current_stage"] = export.CurrentStage
+		default:
+			export.Status = models.ExportApproved
+		}
+		if export.Status != models.ExportPending {
+			now := time.Now()
+			export.DecidedAt = &now
+			updates["status"] = export.Status
+			updates["decided_at"] = now
+		}
+
+		// Guard against a concurrent decision on the same stage
+		result := tx.Model(&models.ExportRequest{}).
+			Where("id = ? AND status = ? AND current_stage = ?", export.ID, models.ExportPending, stageIndex).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrExportNotPending
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	last := export.Approvals[len(export.Approvals)-1]
+	details := auditApproval("export", last.Stage, last.Approved, last.Comment)
+	if export.Status == models.ExportRejected {
+		s.audit(ctx, AuditActionExportRejected, export, details)
+	} else {
+		s.audit(ctx, AuditActionExportApproved, export, details)
+	}
+	return export, nil
+}
+
+// getExport loads a request with its approvals
+func (s *ExportService) getExport(ctx context.Context, db *gorm.DB, exportID string) (*models.ExportRequest, error) {
+	id, err := uuid.Parse(exportID)
+	if err != nil {
+		return nil, ErrExportNotFound
+	}
+
+	var export models.ExportRequest
+	if err := db.Preload("Approvals", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).First(&export, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// authorizedFile loads a file and checks the caller may access it,
+// returning its classification
+func (s *ExportService) authorizedFile(ctx context.Context, fileID string) (*models.ProjectFile, string, error) {
+	id, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, "", errors.New("invalid file ID")
+	}
+
+	var file models.ProjectFile
+	if err := s.db.WithContext(ctx).First(&file, "id = ? AND is_directory = ?", id, false).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errors.New("file not found")
+		}
+		return nil, "", err
+	}
+	if err := s.classification.AuthorizeFile(ctx, &file); err != nil {
+		return nil, "", err
+	}
+	level, err := s.classification.FileLevel(ctx, &file)
+	if err != nil {
+		return nil, "", err
+	}
+	return &file, level, nil
+}
+
+// actor returns the authenticated caller; exports are always made by a
+// user
+func (s *ExportService) actor(ctx context.Context) (*models.User, error) {
+	actor, err := s.classification.viewer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if actor == nil {
+		return nil, ErrUserNotFound
+	}
+	return actor, nil
+}
+
+// audit records a step of the workflow, referencing the export request.
+// The entry is classified at the file's level since it names the file.
+func (s *ExportService) audit(ctx context.Context, action string, export *models.ExportRequest, details *models.AuditDetails) {
+	if details == nil {
+		details = &models.AuditDetails{}
+	}
+	details.With("export_id", export.ID).With("level", export.Level).With("status", export.Status)
+	entry := newAuditEvent(ctx, action, models.ClassifiedFile, export.FileID.String(), export.Level, details)
+	if err := s.security.CreateAuditLog(ctx, entry); err != nil {
+		log.Printf("failed to record %s: %v", action, err)
+	}
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ExportServiceTestSuite 涉密文件导出审批测试套件
+type ExportServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	permissions *PermissionService
+	service     *ExportService
+	files       *FileService
+	member      *models.User
+	project     *models.Project
+}
+
+func (s *ExportServiceTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:export_service?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.ProjectFile{},
+		&models.ClassificationGrant{}, &models.ExportRequest{}, &models.ExportApproval{},
+		&models.CasbinRule{}, &models.AuditLog{}, &models.AuditChainHead{},
+	))
+	for _, table := range []string{
+		"users", "projects", "project_members", "project_files", "classification_grants",
+		"export_requests", "export_approvals", "casbin_rule", "audit_logs", "audit_chain_heads",
+	} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.permissions, err = NewPermissionService(s.db, models.PermissionConfig{})
+	require.NoError(s.T(), err)
+	s.service = NewExportService(s.db, models.ExportConfig{}, s.permissions)
+	s.files = NewFileService(s.db, s.T().TempDir())
+
+	s.member = s.createUser("member", models.RoleDesigner, models.ClassificationConfidential)
+	s.project = &models.Project{ID: uuid.New(), Code: "RDP-EXP-001", Name: "Radar", Category: "product_dev", ClassificationLevel: models.ClassificationInternal}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+	require.NoError(s.T(), s.db.Create(&models.ProjectMember{ID: uuid.New(), ProjectID: s.project.ID, UserID: s.member.ID, Role: "member"}).Error)
+}
+
+func TestExportServiceSuite(t *testing.T) {
+	suite.Run(t, new(ExportServiceTestSuite))
+}
+
+// createUser 创建指定角色和许可级别的用户
+func (s *ExportServiceTestSuite) createUser(name, role, clearance string) *models.User {
+	user := &models.User{ID: uuid.New(), Username: name, DisplayName: name, Role: role, ClearanceLevel: clearance}
+	require.NoError(s.T(), s.db.Create(user).Error)
+	return user
+}
+
+// as 返回以指定用户身份发起请求的上下文
+func (s *ExportServiceTestSuite) as(user *models.User) context.Context {
+	ctx := context.WithValue(context.Background(), "user_id", user.ID.String())
+	return context.WithValue(ctx, "username", user.Username)
+}
+
+// upload 上传文件并设置其密级
+func (s *ExportServiceTestSuite) upload(name, content, level string) *models.ProjectFile {
+	file, err := s.files.UploadFile(s.as(s.member), s.project.ID.String(), "/", name, strings.NewReader(content))
+	require.NoError(s.T(), err)
+	if level != s.project.ClassificationLevel {
+		require.NoError(s.T(), s.db.Model(file).Update("classification_level", level).Error)
+	}
+	return file
+}
+
+// approvedLink 申请导出，由各级审批人依次批准后签发下载链接，返回链接令牌
+func (s *ExportServiceTestSuite) approvedLink(file *models.ProjectFile, approvers ...*models.User) (*models.ExportRequest, string) {
+	export, err := s.service.RequestExport(s.as(s.member), models.CreateExportRequest{FileID: file.ID.String()})
+	require.NoError(s.T(), err)
+	for _, approver := range approvers {
+		export, err = s.service.ApproveExport(s.as(approver), export.ID.String(), nil)
+		require.NoError(s.T(), err)
+	}
+	require.Equal(s.T(), models.ExportApproved, export.Status)
+
+	link, err := s.service.IssueLink(s.as(s.member), export.ID.String())
+	require.NoError(s.T(), err)
+	return export, strings.TrimPrefix(link.URL, "/api/v1/exports/download/")
+}
+
+func (s *ExportServiceTestSuite) read(download *ExportDownload) string {
+	defer download.Content.Close()
+	content, err := io.ReadAll(download.Content)
+	require.NoError(s.T(), err)
+	return string(content)
+}
+
+// TestSecret_ApprovedOnceAndWatermarked 测试秘密级文件经部门领导审批后只能下载一次且带水印
+func (s *ExportServiceTestSuite) TestSecret_ApprovedOnceAndWatermarked() {
+	leader := s.createUser("leader", models.RoleDeptLeader, models.ClassificationInternal)
+	teamLeader := s.createUser("team", models.RoleTeamLeader, models.ClassificationInternal)
+	file := s.upload("design.txt", "design\n", models.ClassificationSecret)
+
+	// 直接下载须先申请导出
+	_, err := s.files.DownloadFile(s.as(s.member), s.project.ID.String(), file.ID.String())
+	assert.ErrorIs(s.T(), err, ErrExportApprovalRequired)
+
+	export, err := s.service.RequestExport(s.as(s.member), models.CreateExportRequest{FileID: file.ID.String()})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{models.ApprovalStageDeptLeader}, export.Stages)
+	_, err = s.service.RequestExport(s.as(s.member), models.CreateExportRequest{FileID: file.ID.String()})
+	assert.ErrorIs(s.T(), err, ErrExportAlreadyOpen)
+
+	_, err = s.service.IssueLink(s.as(s.member), export.ID.String())
+	assert.ErrorIs(s.T(), err, ErrExportNotApproved)
+	_, err = s.service.ApproveExport(s.as(teamLeader), export.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrNotStageApprover)
+	_, err = s.service.ApproveExport(s.as(s.member), export.ID.String(), nil)
+	assert.ErrorIs(s.T(), err, ErrSelfApproval)
+
+	export, err = s.service.ApproveExport(s.as(leader), export.ID.String(), nil)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ExportApproved, export.Status)
+
+	link, err := s.service.IssueLink(s.as(s.member), export.ID.String())
+	require.NoError(s.T(), err)
+	token := strings.TrimPrefix(link.URL, "/api/v1/exports/download/")
+
+	// 链接只属于申请人
+	_, err = s.service.Download(s.as(leader), token)
+	assert.ErrorIs(s.T(), err, ErrExportLinkInvalid)
+
+	download, err := s.service.Download(s.as(s.member), token)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), download.Watermarked)
+	lines := strings.Split(strings.TrimSpace(s.read(download)), "\n")
+	require.Len(s.T(), lines, 3)
+	assert.Contains(s.T(), lines[0], "member ")
+	assert.Equal(s.T(), "design", lines[1])
+	assert.Equal(s.T(), lines[0], lines[2])
+
+	_, err = s.service.Download(s.as(s.member), token)
+	assert.ErrorIs(s.T(), err, ErrExportLinkInvalid)
+
+	var entry models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ?", AuditActionFileExported).First(&entry).Error)
+	require.NotNil(s.T(), entry.Details)
+	assert.Equal(s.T(), export.ID.String(), entry.Details.Context["export_id"])
+	assert.Equal(s.T(), []interface{}{leader.ID.String()}, entry.Details.Context["approvers"])
+	assert.Equal(s.T(), true, entry.Details.Context["watermarked"])
+	assert.Equal(s.T(), models.AuditSeverityInfo, entry.Severity)
+	assert.Equal(s.T(), models.ClassificationSecret, entry.Classification)
+}
+
+// TestInternal_LinkExpiresAndIsReissued 测试内部级文件由组长审批，链接过期后可重新签发
+func (s *ExportServiceTestSuite) TestInternal_LinkExpiresAndIsReissued() {
+	teamLeader := s.createUser("team", models.RoleTeamLeader, models.ClassificationInternal)
+	file := s.upload("plan.txt", "plan", models.ClassificationInternal)
+
+	export, token := s.approvedLink(file, teamLeader)
+	assert.Equal(s.T(), []string{models.ApprovalStageTeamLeader}, export.Stages)
+
+	require.NoError(s.T(), s.db.Model(&models.ExportRequest{}).Where("id = ?", export.ID).
+		Update("link_expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err := s.service.Download(s.as(s.member), token)
+	assert.ErrorIs(s.T(), err, ErrExportLinkInvalid)
+
+	link, err := s.service.IssueLink(s.as(s.member), export.ID.String())
+	require.NoError(s.T(), err)
+	fresh := strings.TrimPrefix(link.URL, "/api/v1/exports/download/")
+	_, err = s.service.Download(s.as(s.member), token)
+	assert.ErrorIs(s.T(), err, ErrExportLinkInvalid)
+
+	// 内部级不加水印
+	download, err := s.service.Download(s.as(s.member), fresh)
+	require.NoError(s.T(), err)
+	assert.False(s.T(), download.Watermarked)
+	assert.Equal(s.T(), "plan", s.read(download))
+
+	// 公开文件无需申请
+	public := s.upload("readme.txt", "hello", models.ClassificationInternal)
+	require.NoError(s.T(), s.db.Model(&models.Project{}).Where("id = ?", s.project.ID).
+		Update("classification_level", models.ClassificationPublic).Error)
+	_, err = s.service.RequestExport(s.as(s.member), models.CreateExportRequest{FileID: public.ID.String()})
+	assert.ErrorIs(s.T(), err, ErrExportNotRequired)
+	reader, err := s.files.DownloadFile(s.as(s.member), s.project.ID.String(), public.ID.String())
+	require.NoError(s.T(), err)
+	reader.Close()
+}
+
+// TestConfidential_SecurityOfficeAndReclassification 测试机密级需保密办审批，审批后升密须重新申请
+func (s *ExportServiceTestSuite) TestConfidential_SecurityOfficeAndReclassification() {
+	leader := s.createUser("leader", models.RoleDeptLeader, models.ClassificationInternal)
+	officer := s.createUser("officer", models.RoleDesigner, models.ClassificationInternal)
+	require.NoError(s.T(), s.permissions.AddRoleBinding(context.Background(), models.RoleBinding{
+		Subject: models.UserSubject(officer.ID.String()),
+		Role:    models.RoleSecurityOffice,
+		Domain:  models.DomainAll,
+	}))
+	require.NoError(s.T(), s.db.Create(&models.ClassificationGrant{
+		ID: uuid.New(), ResourceType: models.ClassifiedProject, ResourceID: s.project.ID, UserID: s.member.ID,
+	}).Error)
+
+	file := s.upload("keys.txt", "keys", models.ClassificationConfidential)
+	export, err := s.service.RequestExport(s.as(s.member), models.CreateExportRequest{FileID: file.ID.String()})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{models.ApprovalStageDeptLeader, models.ApprovalStageSecurityOffice}, export.Stages)
+
+	export, err = s.service.ApproveExport(s.as(leader), export.ID.String(), nil)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ApprovalStageSecurityOffice, export.PendingStage())
+
+	pending, err := s.service.ListExports(s.as(officer))
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), pending, 1)
+
+	comment := "用途不明"
+	export, err = s.service.RejectExport(s.as(officer), export.ID.String(), &comment)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ExportRejected, export.Status)
+
+	// 秘密级审批后文件升为机密，原链接失效
+	require.NoError(s.T(), s.db.Model(file).Update("classification_level", models.ClassificationSecret).Error)
+	_, token := s.approvedLink(file, leader)
+	require.NoError(s.T(), s.db.Model(file).Update("classification_level", models.ClassificationConfidential).Error)
+	_, err = s.service.Download(s.as(s.member), token)
+	assert.ErrorIs(s.T(), err, ErrExportApprovalRequired)
+}
+
+// TestWatermark_Formats 测试各类文件的水印
+func (s *ExportServiceTestSuite) TestWatermark_Formats() {
+	text := watermarkText("member", time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC))
+	assert.Equal(s.T(), "member 2024-05-01 09:30:00", text)
+
+	// PDF
+	marked, err := applyWatermark(minimalPDF(), "spec.pdf", text)
+	require.NoError(s.T(), err)
+	pdfPath := filepath.Join(s.T().TempDir(), "spec.pdf")
+	require.NoError(s.T(), os.WriteFile(pdfPath, marked, 0644))
+	hasWatermarks, err := api.HasWatermarksFile(pdfPath, nil)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), hasWatermarks)
+
+	// 图片
+	canvas := image.NewRGBA(image.Rect(0, 0, 300, 120))
+	for i := range canvas.Pix {
+		canvas.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	require.NoError(s.T(), png.Encode(&buf, canvas))
+	marked, err = applyWatermark(buf.Bytes(), "photo.PNG", text)
+	require.NoError(s.T(), err)
+	decoded, err := png.Decode(bytes.NewReader(marked))
+	require.NoError(s.T(), err)
+	stamped := 0
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 300; x++ {
+			if decoded.At(x, y) != (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+				stamped++
+			}
+		}
+	}
+	assert.Greater(s.T(), stamped, 0)
+
+	// Word：页眉页脚
+	marked, err = applyWatermark(zipOf(map[string]string{
+		"[Content_Types].xml":          `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"></Types>`,
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"></Relationships>`,
+		"word/document.xml":            `<w:document><w:body><w:p/><w:sectPr w:rsidR="1"><w:headerReference w:type="default" r:id="rId9"/><w:pgSz/></w:sectPr></w:body></w:document>`,
+	}), "report.docx", text)
+	require.NoError(s.T(), err)
+	parts := unzip(s.T(), marked)
+	assert.Contains(s.T(), parts[docxHeaderPart], text)
+	assert.Contains(s.T(), parts[docxFooterPart], text)
+	assert.NotContains(s.T(), parts["word/document.xml"], "rId9")
+	assert.Contains(s.T(), parts["word/document.xml"], `<w:sectPr w:rsidR="1"><w:headerReference w:type="default" r:id="rIdRdpWatermarkHeader"/>`)
+	assert.Contains(s.T(), parts["word/_rels/document.xml.rels"], `Target="rdp-watermark-footer.xml"`)
+	assert.Contains(s.T(), parts["[Content_Types].xml"], `PartName="/word/rdp-watermark-header.xml"`)
+
+	// Excel：页眉页脚须位于drawing之前
+	marked, err = applyWatermark(zipOf(map[string]string{
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData/><pageMargins/><headerFooter><oddHeader>old</oddHeader></headerFooter><drawing r:id="rId1"/></worksheet>`,
+	}), "budget.xlsx", "R&D "+text)
+	require.NoError(s.T(), err)
+	sheet := unzip(s.T(), marked)["xl/worksheets/sheet1.xml"]
+	assert.NotContains(s.T(), sheet, "old")
+	assert.Contains(s.T(), sheet, "<oddHeader>&amp;CR&amp;&amp;D "+text+"</oddHeader><oddFooter>")
+	assert.Less(s.T(), strings.Index(sheet, "<headerFooter"), strings.Index(sheet, "<drawing"))
+
+	// 无法加水印的格式
+	_, err = applyWatermark([]byte{0x00, 0x01, 0x02, 0xff}, "firmware.bin", text)
+	assert.ErrorIs(s.T(), err, ErrWatermarkUnsupported)
+}
+
+// minimalPDF 生成只有一个空白页的PDF
+func minimalPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func zipOf(entries map[string]string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range entries {
+		w, _ := writer.Create(name)
+		io.WriteString(w, content)
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+func unzip(t *testing.T, content []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	parts := map[string]string{}
+	for _, entry := range reader.File {
+		rc, err := entry.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		parts[entry.Name] = string(data)
+	}
+	return parts
+}
@@ -5,10 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -16,15 +17,19 @@ import (
 
 // FileService handles file management business logic
 type FileService struct {
-	db        *gorm.DB
-	basePath  string
+	db             *gorm.DB
+	basePath       string
+	classification *ClassificationService
+	security       *SecurityService
 }
 
 // NewFileService creates a new FileService
 func NewFileService(db *gorm.DB, basePath string) *FileService {
 	return &FileService{
-		db:        db,
-		basePath:  basePath,
+		db:             db,
+		basePath:       basePath,
+		classification: NewClassificationService(db),
+		security:       NewSecurityService(db),
 	}
 }
 
@@ -35,6 +40,10 @@ func (s *FileService) ListProjectFiles(ctx context.Context, projectID string, pa
 	if err != nil {
 		return nil, errors.New("invalid project ID")
 	}
+	project, err := s.authorizeProject(ctx, projectUID)
+	if err != nil {
+		return nil, err
+	}
 
 	query := s.db.Model(&models.ProjectFile{}).Where("project_id = ?", projectUID)
 
@@ -49,6 +58,12 @@ func (s *FileService) ListProjectFiles(ctx context.Context, projectID string, pa
 		return nil, err
 	}
 
+	// Leave out files classified above the caller's access
+	files, err = s.classification.FilterFiles(ctx, project, files)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert to generic File type
 	result := make([]models.File, len(files))
 	for i, f := range files {
@@ -73,6 +88,9 @@ func (s *FileService) UploadFile(ctx context.Context, projectID, path, filename
 	if err != nil {
 		return nil, errors.New("invalid project ID")
 	}
+	if _, err := s.authorizeProject(ctx, projectUID); err != nil {
+		return nil, err
+	}
 
 	// Generate file ID
 	fileID := uuid.New()
@@ -128,6 +146,9 @@ func (s *FileService) CreateDirectory(ctx context.Context, projectID, path, name
 	if err != nil {
 		return nil, errors.New("invalid project ID")
 	}
+	if _, err := s.authorizeProject(ctx, projectUID); err != nil {
+		return nil, err
+	}
 
 	// Check if directory already exists
 	var existing models.ProjectFile
@@ -161,20 +182,27 @@ func (s *FileService) CreateDirectory(ctx context.Context, projectID, path, name
 	return &projectDir, nil
 }
 
-// DeleteFile deletes a file or directory
-func (s *FileService) DeleteFile(ctx context.Context, fileID string) error {
+// DeleteFile deletes a file or directory of a project
+func (s *FileService) DeleteFile(ctx context.Context, projectID, fileID string) error {
+	projectUID, err := uuid.Parse(projectID)
+	if err != nil {
+		return errors.New("invalid project ID")
+	}
 	uid, err := uuid.Parse(fileID)
 	if err != nil {
 		return errors.New("invalid file ID")
 	}
 
 	var file models.ProjectFile
-	if err := s.db.First(&file, "id = ?", uid).Error; err != nil {
+	if err := s.db.First(&file, "id = ? AND project_id = ?", uid, projectUID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("file not found")
 		}
 		return err
 	}
+	if err := s.classification.AuthorizeFile(ctx, &file); err != nil {
+		return err
+	}
 
 	// Delete physical file/directory
 	if file.IsDirectory {
@@ -195,25 +223,70 @@ func (s *FileService) DeleteFile(ctx context.Context, fileID string) error {
 	return nil
 }
 
-// DownloadFile returns a reader for a file
-func (s *FileService) DownloadFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+// DownloadFile returns a reader for a public file. Users can only get
+// files classified internal or higher through an approved export request
+// (see ExportService).
+func (s *FileService) DownloadFile(ctx context.Context, projectID, fileID string) (io.ReadCloser, error) {
+	projectUID, err := uuid.Parse(projectID)
+	if err != nil {
+		return nil, errors.New("invalid project ID")
+	}
 	uid, err := uuid.Parse(fileID)
 	if err != nil {
 		return nil, errors.New("invalid file ID")
 	}
 
 	var file models.ProjectFile
-	if err := s.db.First(&file, "id = ? AND is_directory = ?", uid, false).Error; err != nil {
+	if err := s.db.First(&file, "id = ? AND project_id = ? AND is_directory = ?", uid, projectUID, false).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("file not found")
 		}
 		return nil, err
 	}
+	if err := s.classification.AuthorizeFile(ctx, &file); err != nil {
+		return nil, err
+	}
+	level, err := s.classification.FileLevel(ctx, &file)
+	if err != nil {
+		return nil, err
+	}
+	actorID, _ := actorFromContext(ctx)
+	if actorID != nil && level != models.ClassificationPublic {
+		return nil, ErrExportApprovalRequired
+	}
 
 	reader, err := os.Open(file.StoragePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
+	if actorID != nil {
+		// Public files need no export approval
+		details := (&models.AuditDetails{}).
+			With("filename", file.Name).
+			With("level", level).
+			With("status", "not_required")
+		entry := newAuditEvent(ctx, AuditActionFileExported, models.ClassifiedFile, file.ID.String(), level, details)
+		if err := s.security.CreateAuditLog(ctx, entry); err != nil {
+			log.Printf("failed to record %s: %v", AuditActionFileExported, err)
+		}
+	}
+
 	return reader, nil
 }
+
+// authorizeProject loads the project and checks the caller may access its
+// files
+func (s *FileService) authorizeProject(ctx context.Context, projectID uuid.UUID) (*models.Project, error) {
+	var project models.Project
+	if err := s.db.WithContext(ctx).First(&project, "id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("project not found")
+		}
+		return nil, err
+	}
+	if err := s.classification.AuthorizeProject(ctx, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
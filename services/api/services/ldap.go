@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"net/url"
+	"strings"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DirectoryClient searches an LDAP directory. It is an interface so the sync
+// can run against an in-process directory in tests.
+type DirectoryClient interface {
+	Search(ctx context.Context, baseDN, filter string, attributes []string) ([]models.LDAPEntry, error)
+	Close() error
+}
+
+// DirectoryDialer opens an authenticated DirectoryClient
+type DirectoryDialer func(ctx context.Context, config models.LDAPConfig) (DirectoryClient, error)
+
+// ldapClient is the DirectoryClient backed by a real LDAP connection
+type ldapClient struct {
+	conn *ldap.Conn
+}
+
+// dialLDAP connects and binds with the configured service account
+func dialLDAP(ctx context.Context, config models.LDAPConfig) (DirectoryClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if u, err := url.Parse(config.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	if config.Timeout > 0 {
+		conn.SetTimeout(config.Timeout)
+	}
+
+	if config.StartTLS && strings.HasPrefix(strings.ToLower(config.URL), "ldap://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if config.BindDN != "" {
+		if err := conn.Bind(config.BindDN, config.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return &ldapClient{conn: conn}, nil
+}
+
+// Search runs a paged subtree search so large directories are not cut off
+// by the server's size limit
+func (c *ldapClient) Search(ctx context.Context, baseDN, filter string, attributes []string) ([]models.LDAPEntry, error) {
+	req := ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+	result, err := c.conn.SearchWithPaging(req, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.LDAPEntry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		entry := models.LDAPEntry{DN: e.DN, Attributes: make(map[string][]string, len(e.Attributes))}
+		for _, attr := range e.Attributes {
+			entry.Attributes[strings.ToLower(attr.Name)] = attr.Values
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Close unbinds and closes the connection
+func (c *ldapClient) Close() error {
+	return c.conn.Close()
+}
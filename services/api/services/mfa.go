@@ -0,0 +1,533 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MFA errors
+var (
+	ErrMFAInvalidCode    = errors.New("invalid two-factor code")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFARequired       = errors.New("two-factor authentication is required for this role")
+	ErrMFANotEnrolling   = errors.New("no two-factor enrollment in progress")
+)
+
+// Default MFA settings
+const (
+	DefaultMFAChallengeTTL      = 5 * time.Minute
+	DefaultMFARecoveryCodeCount = 10
+	DefaultMFAIssuer            = "RDP"
+)
+
+// Audit actions for MFA events
+const (
+	AuditActionMFAEnabled              = "mfa_enabled"
+	AuditActionMFADisabled             = "mfa_disabled"
+	AuditActionMFAReset                = "mfa_reset"
+	AuditActionMFARecoveryCodesRenewed = "mfa_recovery_codes_renewed"
+	AuditActionMFARecoveryCodeRedeemed = "mfa_recovery_code_redeemed"
+)
+
+// recoveryCodeAlphabet avoids characters that are easily confused
+const recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// withMFADefaults fills unset MFA settings
+func withMFADefaults(cfg models.AuthConfig) models.AuthConfig {
+	if cfg.MFA.RequiredRoles == nil {
+		cfg.MFA.RequiredRoles = []string{models.RoleAdmin, models.RoleDeptLeader}
+	}
+	if cfg.MFA.Issuer == "" {
+		cfg.MFA.Issuer = DefaultMFAIssuer
+	}
+	if cfg.MFA.ChallengeTTL <= 0 {
+		cfg.MFA.ChallengeTTL = DefaultMFAChallengeTTL
+	}
+	if cfg.MFA.RecoveryCodeCount <= 0 {
+		cfg.MFA.RecoveryCodeCount = DefaultMFARecoveryCodeCount
+	}
+	if cfg.MFA.EncryptionKey == "" {
+		cfg.MFA.EncryptionKey = cfg.JWTSecret
+	}
+	return cfg
+}
+
+// MFARequiredForRole checks if the MFA policy makes a second factor
+// mandatory for the role
+func (s *UserService) MFARequiredForRole(role string) bool {
+	for _, r := range s.authConfig.MFA.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// BeginMFAChallenge is called after the password step. It returns nil when
+// the user needs no second factor, otherwise a short-lived challenge token
+// that can only be used to verify a code or, for a user whose role requires
+// MFA but who has not enrolled, to enroll.
+func (s *UserService) BeginMFAChallenge(ctx context.Context, user *models.User) (*models.MFAChallengeResponse, error) {
+	mfa, err := s.getUserMFA(ctx, user.ID)
+	if err != nil && !errors.Is(err, ErrMFANotEnabled) {
+		return nil, err
+	}
+
+	tokenType := models.TokenTypeMFAChallenge
+	if mfa == nil || !mfa.Enabled {
+		if !s.MFARequiredForRole(user.Role) {
+			return nil, nil
+		}
+		tokenType = models.TokenTypeMFAEnrollment
+	}
+
+	// The challenge ID fills the session claim; no session exists yet
+	token, _, err := s.signToken(user, tokenType, "", uuid.New().String(), s.authConfig.MFA.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAChallengeResponse{
+		MFARequired:        true,
+		EnrollmentRequired: tokenType == models.TokenTypeMFAEnrollment,
+		ChallengeToken:     token,
+		ExpiresIn:          int(s.authConfig.MFA.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+// VerifyMFAChallenge completes the second login step with a TOTP code or a
+// recovery code and returns the user. Failures are written to login_logs
+// and count towards the account lockout.
+func (s *UserService) VerifyMFAChallenge(ctx context.Context, challengeToken, code, recoveryCode string) (*models.User, error) {
+	claims, user, err := s.parseMFAToken(ctx, challengeToken, models.TokenTypeMFAChallenge)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsLocked() {
+		if err := s.recordLoginVia(ctx, LoginProviderTOTP, user, user.Username, false, LoginFailureAccountLocked); err != nil {
+			return nil, err
+		}
+		return nil, ErrAccountLocked
+	}
+
+	mfa, err := s.getUserMFA(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !mfa.Enabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	var ok bool
+	switch {
+	case code != "":
+		ok, err = s.consumeTOTP(ctx, mfa, code)
+	case recoveryCode != "":
+		ok, err = s.consumeRecoveryCode(ctx, user, recoveryCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if err := s.recordLoginVia(ctx, LoginProviderTOTP, user, user.Username, false, LoginFailureInvalidMFACode); err != nil {
+			return nil, err
+		}
+		locked, err := s.lockIfThresholdReached(ctx, user, LoginProviderTOTP, LoginFailureInvalidMFACode)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, ErrAccountLocked
+		}
+		return nil, ErrMFAInvalidCode
+	}
+
+	// Challenge tokens are single use
+	if err := s.revokeToken(ctx, claims); err != nil {
+		return nil, err
+	}
+	if err := s.recordLoginVia(ctx, LoginProviderTOTP, user, user.Username, true, ""); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// BeginMFAEnrollmentWithChallenge starts enrollment for a user who must set
+// up MFA before they can log in
+func (s *UserService) BeginMFAEnrollmentWithChallenge(ctx context.Context, challengeToken string) (*models.MFAEnrollmentResponse, error) {
+	_, user, err := s.parseMFAToken(ctx, challengeToken, models.TokenTypeMFAEnrollment)
+	if err != nil {
+		return nil, err
+	}
+	return s.BeginMFAEnrollment(ctx, user.ID.String())
+}
+
+// CompleteMFAEnrollment confirms an enrollment started with a challenge
+// token and returns the user, ready for a session, with recovery codes
+func (s *UserService) CompleteMFAEnrollment(ctx context.Context, challengeToken, code string) (*models.User, []string, error) {
+	claims, user, err := s.parseMFAToken(ctx, challengeToken, models.TokenTypeMFAEnrollment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codes, err := s.ConfirmMFAEnrollment(ctx, user.ID.String(), code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.revokeToken(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+	return user, codes.RecoveryCodes, nil
+}
+
+// BeginMFAEnrollment generates a new TOTP secret for the user. It stays
+// inactive until confirmed with ConfirmMFAEnrollment.
+func (s *UserService) BeginMFAEnrollment(ctx context.Context, userID string) (*models.MFAEnrollmentResponse, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.getUserMFA(ctx, user.ID)
+	if err != nil && !errors.Is(err, ErrMFANotEnabled) {
+		return nil, err
+	}
+	if existing != nil && existing.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	box, err := newSecretBox(s.authConfig.MFA.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := box.seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserMFA{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserMFA{
+			UserID:          user.ID,
+			EncryptedSecret: encrypted,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.authConfig.MFA.Issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmMFAEnrollment activates the pending secret once the user proves
+// their authenticator produces valid codes, and issues recovery codes
+func (s *UserService) ConfirmMFAEnrollment(ctx context.Context, userID, code string) (*models.MFARecoveryCodesResponse, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	mfa, err := s.getUserMFA(ctx, user.ID)
+	if errors.Is(err, ErrMFANotEnabled) {
+		return nil, ErrMFANotEnrolling
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	ok, err := s.consumeTOTP(ctx, mfa, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFAInvalidCode
+	}
+
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.UserMFA{}).Where("user_id = ?", user.ID).Updates(map[string]interface{}{
+		"enabled":      true,
+		"confirmed_at": now,
+		"updated_at":   now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auditUserEvent(ctx, AuditActionMFAEnabled, user, auditMFAChange(false, true)); err != nil {
+		return nil, err
+	}
+	return &models.MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns MFA off after checking a current code. Users whose role
+// requires MFA cannot disable it; an administrator can reset it instead.
+func (s *UserService) DisableMFA(ctx context.Context, userID, code string) error {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if s.MFARequiredForRole(user.Role) {
+		return ErrMFARequired
+	}
+	if err := s.verifyCurrentCode(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := s.deleteUserMFA(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.auditUserEvent(ctx, AuditActionMFADisabled, user, auditMFAChange(true, false))
+}
+
+// ResetMFA removes a user's MFA enrollment, e.g. after a lost device. If
+// their role requires MFA they must enroll again at next login.
+func (s *UserService) ResetMFA(ctx context.Context, userID string) error {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteUserMFA(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.auditUserEvent(ctx, AuditActionMFAReset, user, auditMFAChange(true, false))
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) (*models.MFARecoveryCodesResponse, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyCurrentCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auditUserEvent(ctx, AuditActionMFARecoveryCodesRenewed, user, nil); err != nil {
+		return nil, err
+	}
+	return &models.MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// GetMFAStatus returns whether the user has MFA enabled and must have it
+func (s *UserService) GetMFAStatus(ctx context.Context, userID string) (*models.MFAStatus, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.MFAStatus{Required: s.MFARequiredForRole(user.Role)}
+	mfa, err := s.getUserMFA(ctx, user.ID)
+	if errors.Is(err, ErrMFANotEnabled) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Enabled = mfa.Enabled
+
+	var remaining int64
+	if err := s.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&remaining).Error; err != nil {
+		return nil, err
+	}
+	status.RecoveryCodesRemaining = int(remaining)
+	return status, nil
+}
+
+// parseMFAToken validates a challenge or enrollment token and loads its user
+func (s *UserService) parseMFAToken(ctx context.Context, tokenString, tokenType string) (*models.JWTClaims, *models.User, error) {
+	claims, err := s.parseToken(tokenString, tokenType)
+	if err != nil {
+		return nil, nil, err
+	}
+	revoked, err := s.revocations.contains(ctx, claims.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, ErrTokenBlacklisted
+	}
+
+	user, err := s.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	if !user.IsActive {
+		return nil, nil, ErrUserDisabled
+	}
+	return claims, user, nil
+}
+
+// getUserMFA loads the user's MFA record, enabled or pending. It returns
+// ErrMFANotEnabled when there is none.
+func (s *UserService) getUserMFA(ctx context.Context, userID uuid.UUID) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	if err := s.db.WithContext(ctx).First(&mfa, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// verifyCurrentCode checks a TOTP code for a user with MFA enabled
+func (s *UserService) verifyCurrentCode(ctx context.Context, user *models.User, code string) error {
+	mfa, err := s.getUserMFA(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !mfa.Enabled {
+		return ErrMFANotEnabled
+	}
+	ok, err := s.consumeTOTP(ctx, mfa, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMFAInvalidCode
+	}
+	return nil
+}
+
+// consumeTOTP accepts a code at most once: the matched time step must be
+// newer than the last accepted one
+func (s *UserService) consumeTOTP(ctx context.Context, mfa *models.UserMFA, code string) (bool, error) {
+	box, err := newSecretBox(s.authConfig.MFA.EncryptionKey)
+	if err != nil {
+		return false, err
+	}
+	secret, err := box.open(mfa.EncryptedSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := matchTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false, nil
+	}
+	result := s.db.WithContext(ctx).Model(&models.UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", mfa.UserID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// consumeRecoveryCode redeems an unused recovery code
+func (s *UserService) consumeRecoveryCode(ctx context.Context, user *models.User, code string) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	return true, s.auditUserEvent(ctx, AuditActionMFARecoveryCodeRedeemed, user, nil)
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and generates a
+// new set, returning the plaintext codes
+func (s *UserService) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, s.authConfig.MFA.RecoveryCodeCount)
+	records := make([]models.MFARecoveryCode, len(codes))
+	now := time.Now()
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.MFARecoveryCode{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CodeHash:  hashRecoveryCode(code),
+			CreatedAt: now,
+		}
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// deleteUserMFA removes the secret and recovery codes of a user
+func (s *UserService) deleteUserMFA(ctx context.Context, userID uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error
+	})
+}
+
+// auditMFAChange records an enrollment change
+func auditMFAChange(before, after bool) *models.AuditDetails {
+	return (&models.AuditDetails{}).Change("mfa_enabled", before, after)
+}
+
+// generateRecoveryCode returns a random code formatted as XXXXX-XXXXX
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, v := range raw {
+		if i == 5 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+	return b.String(), nil
+}
+
+// hashRecoveryCode normalizes and hashes a recovery code so it matches
+// regardless of case and separators
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// fakeOIDCProvider is a local stand-in for Casdoor: it serves discovery,
+// JWKS and a token endpoint that checks the PKCE verifier
+type fakeOIDCProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu      sync.Mutex
+	pending map[string]fakeAuthorization // code -> authorization
+}
+
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newFakeOIDCProvider(t *testing.T, clientID string) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &fakeOIDCProvider{key: key, clientID: clientID, pending: make(map[string]fakeAuthorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/login/oauth/authorize",
+			"token_endpoint":         p.server.URL + "/api/login/oauth/access_token",
+			"jwks_uri":               p.server.URL + "/.well-known/jwks",
+		})
+	})
+	mux.HandleFunc("/.well-known/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/api/login/oauth/access_token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// authorize simulates the user signing in at the provider and returns the
+// authorization code the browser would bring back
+func (p *fakeOIDCProvider) authorize(t *testing.T, authorizationURL string, claims jwt.MapClaims) string {
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	q := u.Query()
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+	require.Equal(t, p.clientID, q.Get("client_id"))
+
+	code := "code-" + q.Get("state")
+	p.mu.Lock()
+	p.pending[code] = fakeAuthorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *fakeOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	p.mu.Lock()
+	auth, ok := p.pending[r.Form.Get("code")]
+	delete(p.pending, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   p.clientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": auth.nonce,
+	}
+	for k, v := range auth.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	idToken, _ := token.SignedString(p.key)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "opaque",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// OIDCServiceTestSuite OIDC单点登录测试套件
+type OIDCServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	provider    *fakeOIDCProvider
+	oidcService *OIDCService
+	ctx         context.Context
+}
+
+func (s *OIDCServiceTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:oidc?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.User{}, &models.TokenBlacklist{}, &models.RefreshToken{},
+		&models.LoginLog{}, &models.Session{}, &models.OIDCLoginState{}, &models.UserMFA{}))
+	for _, table := range []string{"users", "refresh_tokens", "login_logs", "sessions", "oidc_login_states", "user_mfa"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.provider = newFakeOIDCProvider(s.T(), "rdp-client")
+	userService := NewUserService(s.db, models.AuthConfig{
+		JWTSecret:       "test-secret",
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+		Issuer:          "rdp-api-test",
+		Audience:        "rdp-users-test",
+	})
+	s.oidcService = NewOIDCService(s.db, models.OIDCConfig{
+		IssuerURL:    s.provider.server.URL,
+		ClientID:     "rdp-client",
+		ClientSecret: "rdp-secret",
+		RedirectURL:  "http://localhost:3000/auth/callback",
+		ProviderName: "casdoor",
+		RoleMappings: map[string]string{
+			"rdp/leaders": models.RoleTeamLeader,
+			"rdp/admins":  models.RoleAdmin,
+		},
+		TeamMappings:     map[string]string{"rdp/tech": models.TeamTechDev},
+		AllowedRedirects: []string{"https://portal.rdp.local"},
+	}, userService)
+	s.ctx = context.Background()
+}
+
+func TestOIDCServiceSuite(t *testing.T) {
+	suite.Run(t, new(OIDCServiceTestSuite))
+}
+
+// login 走完一次授权码流程
+func (s *OIDCServiceTestSuite) login(claims jwt.MapClaims) (*models.OIDCLoginResponse, error) {
+	auth, err := s.oidcService.AuthorizationURL(s.ctx, "/projects")
+	require.NoError(s.T(), err)
+	code := s.provider.authorize(s.T(), auth.AuthorizationURL, claims)
+	return s.oidcService.Login(s.ctx, code, auth.State)
+}
+
+// TestLogin_ProvisionsUser 测试首次登录自动创建用户并映射组
+func (s *OIDCServiceTestSuite) TestLogin_ProvisionsUser() {
+	resp, err := s.login(jwt.MapClaims{
+		"sub":         "casdoor-uid-1",
+		"name":        "zhangsan",
+		"displayName": "张三",
+		"email":       "zhangsan@rdp.local",
+		"groups":      []string{"rdp/leaders", "rdp/tech"},
+	})
+	require.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), resp.AccessToken)
+	assert.Equal(s.T(), "/projects", resp.RedirectTo)
+
+	var user models.User
+	require.NoError(s.T(), s.db.First(&user, "casdoor_id = ?", "casdoor-uid-1").Error)
+	assert.Equal(s.T(), "zhangsan", user.Username)
+	assert.Equal(s.T(), "张三", user.DisplayName)
+	assert.Equal(s.T(), models.RoleTeamLeader, user.Role)
+	require.NotNil(s.T(), user.Team)
+	assert.Equal(s.T(), models.TeamTechDev, *user.Team)
+
+	var logs int64
+	s.db.Model(&models.LoginLog{}).Where("user_id = ? AND provider = ? AND success = ?", user.ID, "casdoor", true).Count(&logs)
+	assert.Equal(s.T(), int64(1), logs)
+}
+
+// TestLogin_SyncsAttributes 测试再次登录时同步IdP属性
+func (s *OIDCServiceTestSuite) TestLogin_SyncsAttributes() {
+	_, err := s.login(jwt.MapClaims{"sub": "casdoor-uid-2", "name": "lisi", "groups": []string{"rdp/tech"}})
+	require.NoError(s.T(), err)
+
+	_, err = s.login(jwt.MapClaims{"sub": "casdoor-uid-2", "name": "lisi", "groups": []string{"rdp/admins"}})
+	require.NoError(s.T(), err)
+
+	var user models.User
+	require.NoError(s.T(), s.db.First(&user, "casdoor_id = ?", "casdoor-uid-2").Error)
+	assert.Equal(s.T(), models.RoleAdmin, user.Role)
+	assert.Nil(s.T(), user.Team)
+}
+
+// TestLogin_StateIsSingleUse 测试state只能使用一次
+func (s *OIDCServiceTestSuite) TestLogin_StateIsSingleUse() {
+	auth, err := s.oidcService.AuthorizationURL(s.ctx, "")
+	require.NoError(s.T(), err)
+	code := s.provider.authorize(s.T(), auth.AuthorizationURL, jwt.MapClaims{"sub": "casdoor-uid-3", "name": "wangwu"})
+
+	_, err = s.oidcService.Login(s.ctx, code, auth.State)
+	require.NoError(s.T(), err)
+
+	_, err = s.oidcService.Login(s.ctx, code, auth.State)
+	assert.ErrorIs(s.T(), err, ErrOIDCInvalidState)
+}
+
+// TestLogin_RejectsLocalAccountTakeover 测试不会把IdP身份绑定到同名本地账户
+func (s *OIDCServiceTestSuite) TestLogin_RejectsLocalAccountTakeover() {
+	local := models.User{Username: "admin", DisplayName: "Admin", Role: models.RoleAdmin, IsActive: true}
+	local.ID = uuid.New()
+	require.NoError(s.T(), s.db.Create(&local).Error)
+
+	_, err := s.login(jwt.MapClaims{"sub": "casdoor-uid-4", "name": "admin"})
+	assert.ErrorIs(s.T(), err, ErrOIDCAccountConflict)
+}
+
+// TestLogin_WrongVerifierFails 测试PKCE校验失败
+func (s *OIDCServiceTestSuite) TestLogin_WrongVerifierFails() {
+	auth, err := s.oidcService.AuthorizationURL(s.ctx, "")
+	require.NoError(s.T(), err)
+	code := s.provider.authorize(s.T(), auth.AuthorizationURL, jwt.MapClaims{"sub": "casdoor-uid-5", "name": "zhaoliu"})
+
+	// 篡改保存的verifier，模拟授权码被第三方截获
+	s.db.Model(&models.OIDCLoginState{}).Where("state = ?", auth.State).Update("code_verifier", "attacker-verifier")
+
+	_, err = s.oidcService.Login(s.ctx, code, auth.State)
+	assert.ErrorIs(s.T(), err, ErrOIDCExchangeFailed)
+}
+
+// TestLogin_LockedUserRefused 测试被锁定的账户不能通过SSO绕过锁定
+func (s *OIDCServiceTestSuite) TestLogin_LockedUserRefused() {
+	_, err := s.login(jwt.MapClaims{"sub": "casdoor-uid-6", "name": "sunqi"})
+	require.NoError(s.T(), err)
+	until := time.Now().Add(15 * time.Minute)
+	s.db.Model(&models.User{}).Where("casdoor_id = ?", "casdoor-uid-6").Update("locked_until", until)
+
+	resp, err := s.login(jwt.MapClaims{"sub": "casdoor-uid-6", "name": "sunqi"})
+	assert.ErrorIs(s.T(), err, ErrAccountLocked)
+	assert.Nil(s.T(), resp)
+
+	var logs int64
+	s.db.Model(&models.LoginLog{}).Where("username = ? AND failure_reason = ?", "sunqi", LoginFailureAccountLocked).Count(&logs)
+	assert.Equal(s.T(), int64(1), logs)
+}
+
+// TestLogin_MFARequiredReturnsChallenge 测试需要二次验证的用户只拿到挑战令牌
+func (s *OIDCServiceTestSuite) TestLogin_MFARequiredReturnsChallenge() {
+	resp, err := s.login(jwt.MapClaims{"sub": "casdoor-uid-7", "name": "zhouba", "groups": []string{"rdp/admins"}})
+	require.NoError(s.T(), err)
+	assert.Nil(s.T(), resp.LoginResponse)
+	require.NotNil(s.T(), resp.MFA)
+	assert.True(s.T(), resp.MFA.EnrollmentRequired)
+	assert.NotEmpty(s.T(), resp.MFA.ChallengeToken)
+	assert.Equal(s.T(), "/projects", resp.RedirectTo)
+
+	var sessions int64
+	s.db.Model(&models.Session{}).Count(&sessions)
+	assert.Equal(s.T(), int64(0), sessions)
+}
+
+// TestAuthorizationURL_ValidatesRedirect 测试登录后跳转地址只能是站内路径或白名单域名
+func (s *OIDCServiceTestSuite) TestAuthorizationURL_ValidatesRedirect() {
+	for _, redirectTo := range []string{"/projects?tab=1", "https://portal.rdp.local/home"} {
+		_, err := s.oidcService.AuthorizationURL(s.ctx, redirectTo)
+		assert.NoError(s.T(), err, redirectTo)
+	}
+	for _, redirectTo := range []string{
+		"https://evil.example.com/", "//evil.example.com", "/\\evil.example.com", "javascript:alert(1)",
+		"https://portal.rdp.local@evil.example.com/", "http://portal.rdp.local.evil.example.com", "projects",
+	} {
+		_, err := s.oidcService.AuthorizationURL(s.ctx, redirectTo)
+		assert.ErrorIs(s.T(), err, ErrOIDCInvalidRedirect, redirectTo)
+	}
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Password and lockout errors
+var (
+	ErrPasswordPolicy         = errors.New("password does not meet the password policy")
+	ErrPasswordReused         = errors.New("password was used recently")
+	ErrAccountLocked          = errors.New("account is temporarily locked")
+	ErrPasswordChangeRequired = errors.New("password change required")
+	ErrPasswordNotUpdatable   = errors.New("password can only be changed through the password endpoints")
+)
+
+// Default password and lockout rules
+const (
+	DefaultPasswordMinLength   = 8
+	DefaultPasswordHistorySize = 5
+	DefaultMaxFailedLogins     = 5
+	DefaultLoginFailureWindow  = 15 * time.Minute
+	DefaultLockoutCooldown     = 30 * time.Minute
+)
+
+// Login providers recorded in LoginLog
+const (
+	LoginProviderLocal = "local"
+	LoginProviderTOTP  = "totp"
+)
+
+// Login failure reasons recorded in LoginLog
+const (
+	LoginFailureInvalidPassword = "invalid_password"
+	LoginFailureInvalidMFACode  = "invalid_mfa_code"
+	LoginFailureUnknownUser     = "unknown_user"
+	LoginFailureAccountLocked   = "account_locked"
+	LoginFailureUserDisabled    = "user_disabled"
+)
+
+// Audit actions for account security events
+const (
+	AuditActionAccountLocked       = "account_locked"
+	AuditActionAccountUnlocked     = "account_unlocked"
+	AuditActionPasswordChanged     = "password_changed"
+	AuditActionPasswordResetForced = "password_reset_forced"
+)
+
+// withPasswordDefaults fills unset numeric policy values
+func withPasswordDefaults(cfg models.AuthConfig) models.AuthConfig {
+	if cfg.Password.MinLength <= 0 {
+		cfg.Password.MinLength = DefaultPasswordMinLength
+	}
+	if cfg.Password.HistorySize <= 0 {
+		cfg.Password.HistorySize = DefaultPasswordHistorySize
+	}
+	if cfg.Lockout.MaxFailedAttempts <= 0 {
+		cfg.Lockout.MaxFailedAttempts = DefaultMaxFailedLogins
+	}
+	if cfg.Lockout.Window <= 0 {
+		cfg.Lockout.Window = DefaultLoginFailureWindow
+	}
+	if cfg.Lockout.Cooldown <= 0 {
+		cfg.Lockout.Cooldown = DefaultLockoutCooldown
+	}
+	return cfg
+}
+
+// ValidatePasswordPolicy checks a password against the complexity rules
+func ValidatePasswordPolicy(policy models.PasswordPolicy, password string) error {
+	var missing []string
+	if len([]rune(password)) < policy.MinLength {
+		missing = append(missing, fmt.Sprintf("at least %d characters", policy.MinLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSpecial = true
+		}
+	}
+	if policy.RequireUpper && !hasUpper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSpecial && !hasSpecial {
+		missing = append(missing, "a special character")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: requires %s", ErrPasswordPolicy, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// UpdatePassword changes a user's password after verifying the old one
+func (s *UserService) UpdatePassword(ctx context.Context, id string, oldPassword, newPassword string) error {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !user.CheckPassword(oldPassword) {
+		return ErrInvalidCredentials
+	}
+
+	before := *user
+	if err := s.changePassword(ctx, user, newPassword, false); err != nil {
+		return err
+	}
+	return s.auditUserEvent(ctx, AuditActionPasswordChanged, user, auditPasswordChange(&before, user))
+}
+
+// ResetPassword sets a temporary password chosen by an administrator. The
+// user must change it at next login and all existing sessions are revoked.
+func (s *UserService) ResetPassword(ctx context.Context, id string, newPassword string) error {
+	return s.ForcePasswordReset(ctx, id, newPassword)
+}
+
+// ForcePasswordReset requires the user to change their password at next
+// login, optionally replacing it with a temporary one, and revokes all
+// existing sessions and personal access tokens
+func (s *UserService) ForcePasswordReset(ctx context.Context, id string, temporaryPassword string) error {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	before := *user
+	if temporaryPassword != "" {
+		if err := s.changePassword(ctx, user, temporaryPassword, true); err != nil {
+			return err
+		}
+	} else {
+		if err := s.db.WithContext(ctx).Model(user).Update("must_change_password", true).Error; err != nil {
+			return err
+		}
+		user.MustChangePassword = true
+	}
+
+	if err := s.sessions.RevokeAllUserSessions(ctx, id); err != nil {
+		return err
+	}
+	if err := s.RevokeAllPersonalAccessTokens(ctx, id); err != nil {
+		return err
+	}
+	details := auditPasswordChange(&before, user).With("sessions_revoked", true)
+	return s.auditUserEvent(ctx, AuditActionPasswordResetForced, user, details)
+}
+
+// UnlockAccount lifts a lockout before its cooldown ends
+func (s *UserService) UnlockAccount(ctx context.Context, id string) error {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.unlockAccount(ctx, user)
+}
+
+// changePassword enforces the policy and history, stores the new hash and
+// moves the previous one into the history
+func (s *UserService) changePassword(ctx context.Context, user *models.User, newPassword string, mustChange bool) error {
+	if err := ValidatePasswordPolicy(s.authConfig.Password, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkPasswordHistory(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	previousHash := user.PasswordHash
+	if err := user.SetPassword(newPassword); err != nil {
+		return err
+	}
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password_hash":        user.PasswordHash,
+			"password_changed_at":  now,
+			"must_change_password": mustChange,
+		}).Error; err != nil {
+			return err
+		}
+
+		if previousHash != nil && *previousHash != "" {
+			entry := models.PasswordHistory{
+				ID:           uuid.New(),
+				UserID:       user.ID,
+				PasswordHash: *previousHash,
+				CreatedAt:    now,
+			}
+			if err := tx.Create(&entry).Error; err != nil {
+				return err
+			}
+		}
+
+		// Only HistorySize-1 old hashes are needed next to the current one
+		var stale []uuid.UUID
+		if err := tx.Model(&models.PasswordHistory{}).
+			Where("user_id = ?", user.ID).
+			Order("created_at DESC").
+			Offset(s.authConfig.Password.HistorySize-1).
+			Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			return tx.Where("id IN ?", stale).Delete(&models.PasswordHistory{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	user.PasswordChangedAt = &now
+	user.MustChangePassword = mustChange
+	return nil
+}
+
+// auditPasswordChange records when the password changed and whether the
+// user must change it again; the password itself is never recorded
+func auditPasswordChange(before, after *models.User) *models.AuditDetails {
+	return auditDiff(before, after, "password_changed_at", "must_change_password")
+}
+
+// checkPasswordHistory rejects the current password and the most recent
+// previous ones
+func (s *UserService) checkPasswordHistory(ctx context.Context, user *models.User, password string) error {
+	if user.CheckPassword(password) {
+		return ErrPasswordReused
+	}
+
+	var history []models.PasswordHistory
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(s.authConfig.Password.HistorySize - 1).
+		Find(&history).Error; err != nil {
+		return err
+	}
+	for _, h := range history {
+		if bcrypt.CompareHashAndPassword([]byte(h.PasswordHash), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// recordLogin writes a LoginLog entry for a local login attempt
+func (s *UserService) recordLogin(ctx context.Context, user *models.User, username string, success bool, failureReason string) error {
+	return s.recordLoginVia(ctx, LoginProviderLocal, user, username, success, failureReason)
+}
+
+// recordLoginVia writes a LoginLog entry for a login through the given
+// provider, forwarded to the audit sinks like other security events
+func (s *UserService) recordLoginVia(ctx context.Context, provider string, user *models.User, username string, success bool, failureReason string) error {
+	entry := models.LoginLog{
+		Username: username,
+		Success:  success,
+		Provider: provider,
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+	}
+	if failureReason != "" {
+		entry.FailureReason = &failureReason
+	}
+	entry.IPAddress, entry.UserAgent = clientFromContext(ctx)
+
+	return s.security.CreateLoginLog(ctx, &entry)
+}
+
+// lockIfThresholdReached counts failed attempts with the given reason inside
+// the sliding window and locks the account once the limit is hit. Failures
+// before the last successful login through the same provider or the last
+// unlock do not count.
+func (s *UserService) lockIfThresholdReached(ctx context.Context, user *models.User, provider, failureReason string) (bool, error) {
+	now := time.Now()
+	since := now.Add(-s.authConfig.Lockout.Window)
+	if user.UnlockedAt != nil && user.UnlockedAt.After(since) {
+		since = *user.UnlockedAt
+	}
+
+	var lastSuccess models.LoginLog
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND provider = ? AND success = ? AND created_at > ?", user.ID, provider, true, since).
+		Order("created_at DESC").
+		First(&lastSuccess).Error
+	if err == nil {
+		since = lastSuccess.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	var failures int64
+	if err := s.db.WithContext(ctx).Model(&models.LoginLog{}).
+		Where("user_id = ? AND success = ? AND failure_reason = ? AND created_at > ?",
+			user.ID, false, failureReason, since).
+		Count(&failures).Error; err != nil {
+		return false, err
+	}
+	if failures < int64(s.authConfig.Lockout.MaxFailedAttempts) {
+		return false, nil
+	}
+
+	lockedUntil := now.Add(s.authConfig.Lockout.Cooldown)
+	result := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", user.ID, now).
+		Update("locked_until", lockedUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request locked it first
+		return true, nil
+	}
+
+	user.LockedUntil = &lockedUntil
+	details := (&models.AuditDetails{}).
+		Change("locked_until", nil, lockedUntil).
+		With("failed_attempts", failures).
+		With("provider", provider)
+	return true, s.auditUserEvent(ctx, AuditActionAccountLocked, user, details)
+}
+
+// unlockAccount clears a lockout, either on admin request or once the
+// cooldown has passed
+func (s *UserService) unlockAccount(ctx context.Context, user *models.User) error {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND locked_until IS NOT NULL", user.ID).
+		Updates(map[string]interface{}{
+			"locked_until": nil,
+			"unlocked_at":  now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	details := (&models.AuditDetails{}).Change("locked_until", user.LockedUntil, nil)
+	user.LockedUntil = nil
+	user.UnlockedAt = &now
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	return s.auditUserEvent(ctx, AuditActionAccountUnlocked, user, details)
+}
+
+// auditUserEvent records an account security event against the target user.
+// The actor is the authenticated caller, or nil for system actions.
+func (s *UserService) auditUserEvent(ctx context.Context, action string, target *models.User, details *models.AuditDetails) error {
+	entry := newAuditEvent(ctx, action, "user", target.ID.String(), models.ClassificationInternal, details)
+	return s.security.CreateAuditLog(ctx, entry)
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Permission errors
+var (
+	ErrPolicyInvalid   = errors.New("invalid policy rule")
+	ErrPolicyExists    = errors.New("policy rule already exists")
+	ErrPolicyNotFound  = errors.New("policy rule not found")
+	ErrPolicyProtected = errors.New("policy rule is protected")
+)
+
+// Audit actions for policy changes
+const (
+	AuditActionPolicyAdded        = "permission_policy_added"
+	AuditActionPolicyRemoved      = "permission_policy_removed"
+	AuditActionRoleBindingAdded   = "role_binding_added"
+	AuditActionRoleBindingRemoved = "role_binding_removed"
+)
+
+// DefaultPolicyReloadInterval is how often policies are reloaded from the
+// database when not configured
+const DefaultPolicyReloadInterval = time.Minute
+
+// permissionModel is RBAC with domains. Role links may use a domain
+// pattern (e.g. * or project:*) so the role hierarchy applies everywhere,
+// while user bindings can be limited to a single project.
+const permissionModel = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && keyMatch(r.dom, p.dom) && keyMatch(r.obj, p.obj) && (r.act == p.act || p.act == "*")
+`
+
+// superuserPolicy cannot be removed through the API so administrators
+// cannot lock themselves out
+var superuserPolicy = []string{models.RoleAdmin, models.DomainAll, "*", "*"}
+
+// defaultPolicies mirror database/seeds/roles.sql. They are only written
+// when the policy table is empty; afterwards the table is authoritative.
+// "review" lets a role reach the approval endpoints of a multi-stage
+// workflow; the service then checks the action of the pending stage.
+var defaultPolicies = [][]string{
+	superuserPolicy,
+	{models.RoleOther, models.DomainAll, "profile", "*"},
+	{models.RoleOther, models.DomainAll, "user", "read"},
+	{models.RoleOther, models.DomainAll, "project", "read"},
+	{models.RoleDesigner, models.DomainAll, "project", "create"},
+	{models.RoleDeptLeader, models.DomainAll, "project", "approve"},
+	{models.RoleOther, models.DomainAll, "classification", "read"},
+	{models.RoleOther, models.DomainAll, "classification", "request"},
+	{models.RoleDeptLeader, models.DomainAll, "classification", "review"},
+	{models.RoleSecurityOffice, models.DomainAll, "classification", "review"},
+	{models.RoleDeptLeader, models.DomainAll, "classification", "approve"},
+	{models.RoleSecurityOffice, models.DomainAll, "classification", "approve_security"},
+	{models.RoleOther, models.DomainAll, "export", "request"},
+	{models.RoleTeamLeader, models.DomainAll, "export", "review"},
+	{models.RoleSecurityOffice, models.DomainAll, "export", "review"},
+	{models.RoleTeamLeader, models.DomainAll, "export", "approve"},
+	{models.RoleDeptLeader, models.DomainAll, "export", "approve_secret"},
+	{models.RoleSecurityOffice, models.DomainAll, "export", "approve_security"},
+	{models.RoleOther, models.DomainAll, "approval", "read"},
+	{models.RoleDesigner, models.DomainAll, "approval", "approve"},
+	{models.RoleOther, models.DomainAll, "quality_gate_waiver", "read"},
+	{models.RoleDeptLeader, models.DomainAll, "quality_gate_waiver", "approve"},
+
+	{models.ProjectRoleSubject("observer"), "project:*", "project", "read"},
+	{models.ProjectRoleSubject("observer"), "project:*", "member", "read"},
+	{models.ProjectRoleSubject("observer"), "project:*", "activity", "read"},
+	{models.ProjectRoleSubject("observer"), "project:*", "file", "read"},
+	{models.ProjectRoleSubject("member"), "project:*", "activity", "update"},
+	{models.ProjectRoleSubject("member"), "project:*", "file", "create"},
+	{models.ProjectRoleSubject("manager"), "project:*", "project", "*"},
+	{models.ProjectRoleSubject("manager"), "project:*", "member", "*"},
+	{models.ProjectRoleSubject("manager"), "project:*", "activity", "*"},
+	{models.ProjectRoleSubject("manager"), "project:*", "file", "*"},
+	{models.ProjectRoleSubject("manager"), "project:*", "classification", "update"},
+}
+
+// retiredPolicies were seeded by earlier releases and are removed on
+// start. Updating oneself through PUT /users/:id let a user change their
+// own role; profile edits go through PUT /users/me.
+var retiredPolicies = [][]string{
+	{models.RoleOther, models.DomainSelf, "user", "update"},
+}
+
+// defaultRoleLinks define role inheritance: the subject gets every right
+// of the role
+var defaultRoleLinks = [][]string{
+	{models.RoleAdmin, models.RoleDeptLeader, models.DomainAll},
+	{models.RoleDeptLeader, models.RoleTeamLeader, models.DomainAll},
+	{models.RoleTeamLeader, models.RoleDesigner, models.DomainAll},
+	{models.RoleDesigner, models.RoleOther, models.DomainAll},
+
+	{models.ProjectRoleSubject("leader"), models.ProjectRoleSubject("manager"), models.DomainAll},
+	{models.ProjectRoleSubject("manager"), models.ProjectRoleSubject("member"), models.DomainAll},
+	{models.ProjectRoleSubject("developer"), models.ProjectRoleSubject("member"), models.DomainAll},
+	{models.ProjectRoleSubject("tester"), models.ProjectRoleSubject("member"), models.DomainAll},
+	{models.ProjectRoleSubject("member"), models.ProjectRoleSubject("observer"), models.DomainAll},
+}
+
+// PermissionService evaluates and manages casbin policies
+type PermissionService struct {
+	db       *gorm.DB
+	config   models.PermissionConfig
+	enforcer *casbin.SyncedEnforcer
+	security *SecurityService
+}
+
+// NewPermissionService loads the policies from the database, seeding the
+// defaults on first start
+func NewPermissionService(db *gorm.DB, config models.PermissionConfig) (*PermissionService, error) {
+	if config.ReloadInterval <= 0 {
+		config.ReloadInterval = DefaultPolicyReloadInterval
+	}
+
+	m, err := model.NewModelFromString(permissionModel)
+	if err != nil {
+		return nil, err
+	}
+	enforcer, err := casbin.NewSyncedEnforcer(m, &policyAdapter{db: db})
+	if err != nil {
+		return nil, err
+	}
+	enforcer.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+	if err := enforcer.LoadPolicy(); err != nil {
+		return nil, err
+	}
+
+	s := &PermissionService{
+		db:       db,
+		config:   config,
+		enforcer: enforcer,
+		security: NewSecurityService(db),
+	}
+	if err := s.seedDefaults(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Enforce checks whether the user may perform action on object within
+// domain. The user is checked through their global role, any bindings made
+// for them directly and, inside a project domain, their project role.
+func (s *PermissionService) Enforce(ctx context.Context, userID, role, domain, object, action string) (bool, error) {
+	subjects := []string{models.UserSubject(userID), role}
+	if projectID, ok := strings.CutPrefix(domain, "project:"); ok {
+		memberRole, err := s.projectRole(ctx, projectID, userID)
+		if err != nil {
+			return false, err
+		}
+		if memberRole != "" {
+			subjects = append(subjects, models.ProjectRoleSubject(memberRole))
+		}
+	}
+
+	for _, subject := range subjects {
+		allowed, err := s.enforcer.Enforce(subject, domain, object, action)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListPolicies returns all permission rules
+func (s *PermissionService) ListPolicies() ([]models.PolicyRule, error) {
+	rules, err := s.enforcer.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]models.PolicyRule, 0, len(rules))
+	for _, r := range rules {
+		policies = append(policies, models.PolicyRule{Subject: r[0], Domain: r[1], Object: r[2], Action: r[3]})
+	}
+	return policies, nil
+}
+
+// AddPolicy stores a permission rule
+func (s *PermissionService) AddPolicy(ctx context.Context, rule models.PolicyRule) error {
+	values := []string{rule.Subject, rule.Domain, rule.Object, rule.Action}
+	if err := validatePolicyValues(values); err != nil {
+		return err
+	}
+	added, err := s.enforcer.AddPolicy(values)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrPolicyExists
+	}
+	return s.audit(ctx, AuditActionPolicyAdded, models.PolicyTypePermission, values)
+}
+
+// RemovePolicy deletes a permission rule
+func (s *PermissionService) RemovePolicy(ctx context.Context, rule models.PolicyRule) error {
+	values := []string{rule.Subject, rule.Domain, rule.Object, rule.Action}
+	if strings.Join(values, ",") == strings.Join(superuserPolicy, ",") {
+		return ErrPolicyProtected
+	}
+	removed, err := s.enforcer.RemovePolicy(values)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPolicyNotFound
+	}
+	return s.audit(ctx, AuditActionPolicyRemoved, models.PolicyTypePermission, values)
+}
+
+// ListRoleBindings returns all role inheritance rules
+func (s *PermissionService) ListRoleBindings() ([]models.RoleBinding, error) {
+	rules, err := s.enforcer.GetGroupingPolicy()
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]models.RoleBinding, 0, len(rules))
+	for _, r := range rules {
+		bindings = append(bindings, models.RoleBinding{Subject: r[0], Role: r[1], Domain: r[2]})
+	}
+	return bindings, nil
+}
+
+// AddRoleBinding makes a subject inherit a role within a domain
+func (s *PermissionService) AddRoleBinding(ctx context.Context, binding models.RoleBinding) error {
+	values := []string{binding.Subject, binding.Role, binding.Domain}
+	if err := validatePolicyValues(values); err != nil {
+		return err
+	}
+	if binding.Subject == binding.Role {
+		return fmt.Errorf("%w: a role cannot inherit itself", ErrPolicyInvalid)
+	}
+	added, err := s.enforcer.AddGroupingPolicy(values)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrPolicyExists
+	}
+	return s.audit(ctx, AuditActionRoleBindingAdded, models.PolicyTypeRole, values)
+}
+
+// RemoveRoleBinding deletes a role inheritance rule
+func (s *PermissionService) RemoveRoleBinding(ctx context.Context, binding models.RoleBinding) error {
+	values := []string{binding.Subject, binding.Role, binding.Domain}
+	removed, err := s.enforcer.RemoveGroupingPolicy(values)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPolicyNotFound
+	}
+	return s.audit(ctx, AuditActionRoleBindingRemoved, models.PolicyTypeRole, values)
+}
+
+// RunPolicySync periodically reloads policies so changes made through
+// another instance take effect
+func (s *PermissionService) RunPolicySync(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.enforcer.LoadPolicy(); err != nil {
+				log.Printf("policy reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// projectRole returns the user's role in the project, or "" for
+// non-members. The project leader counts as leader even without a
+// membership row.
+func (s *PermissionService) projectRole(ctx context.Context, projectID, userID string) (string, error) {
+	pid, err := uuid.Parse(projectID)
+	if err != nil {
+		return "", nil
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return "", nil
+	}
+
+	var member models.ProjectMember
+	err = s.db.WithContext(ctx).Select("role").First(&member, "project_id = ? AND user_id = ?", pid, uid).Error
+	if err == nil {
+		return member.Role, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	var leaders int64
+	if err := s.db.WithContext(ctx).Model(&models.Project{}).
+		Where("id = ? AND leader_id = ?", pid, uid).
+		Count(&leaders).Error; err != nil {
+		return "", err
+	}
+	if leaders > 0 {
+		return "leader", nil
+	}
+	return "", nil
+}
+
+// seedDefaults writes the default policies into an empty policy table
+func (s *PermissionService) seedDefaults() error {
+	var count int64
+	if err := s.db.Model(&models.CasbinRule{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return s.removeRetiredPolicies()
+	}
+
+	if _, err := s.enforcer.AddPolicies(defaultPolicies); err != nil {
+		return err
+	}
+	_, err := s.enforcer.AddGroupingPolicies(defaultRoleLinks)
+	return err
+}
+
+// removeRetiredPolicies deletes the retired default rules from an existing
+// policy table
+func (s *PermissionService) removeRetiredPolicies() error {
+	for _, values := range retiredPolicies {
+		removed, err := s.enforcer.RemovePolicy(values)
+		if err != nil {
+			return err
+		}
+		if removed {
+			log.Printf("removed retired permission policy %s", strings.Join(values, ", "))
+		}
+	}
+	return nil
+}
+
+// audit records a policy change. The subject is the resource ID; the full
+// rule is recorded as the changed value since it does not fit the ID column.
+func (s *PermissionService) audit(ctx context.Context, action, ptype string, values []string) error {
+	line := ptype + ", " + strings.Join(values, ", ")
+	details := &models.AuditDetails{}
+	switch action {
+	case AuditActionPolicyAdded, AuditActionRoleBindingAdded:
+		details.Change("policy", nil, line)
+	default:
+		details.Change("policy", line, nil)
+	}
+	entry := newAuditEvent(ctx, action, "casbin_rule", values[0], models.ClassificationInternal, details)
+	return s.security.CreateAuditLog(ctx, entry)
+}
+
+// validatePolicyValues rejects empty fields and commas, which casbin's
+// CSV-based tooling cannot represent
+func validatePolicyValues(values []string) error {
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("%w: empty field", ErrPolicyInvalid)
+		}
+		if strings.Contains(v, ",") {
+			return fmt.Errorf("%w: fields may not contain commas", ErrPolicyInvalid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// PermissionServiceTestSuite 权限引擎测试套件
+type PermissionServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service *PermissionService
+	ctx     context.Context
+}
+
+func (s *PermissionServiceTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:permission?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.CasbinRule{}, &models.Project{}, &models.ProjectMember{}, &models.AuditLog{}, &models.AuditChainHead{}))
+	s.db.Exec("DELETE FROM casbin_rule")
+	s.db.Exec("DELETE FROM projects")
+	s.db.Exec("DELETE FROM project_members")
+	s.db.Exec("DELETE FROM audit_logs")
+
+	s.service, err = NewPermissionService(s.db, models.PermissionConfig{})
+	require.NoError(s.T(), err)
+	s.ctx = context.Background()
+}
+
+func TestPermissionServiceSuite(t *testing.T) {
+	suite.Run(t, new(PermissionServiceTestSuite))
+}
+
+func (s *PermissionServiceTestSuite) allowed(userID, role, domain, object, action string) bool {
+	ok, err := s.service.Enforce(s.ctx, userID, role, domain, object, action)
+	require.NoError(s.T(), err)
+	return ok
+}
+
+// TestEnforce_RoleHierarchy 测试全局角色继承
+func (s *PermissionServiceTestSuite) TestEnforce_RoleHierarchy() {
+	uid := uuid.New().String()
+
+	assert.True(s.T(), s.allowed(uid, models.RoleAdmin, models.DomainAll, "permission", "update"))
+	assert.True(s.T(), s.allowed(uid, models.RoleTeamLeader, models.DomainAll, "project", "create"))
+	assert.True(s.T(), s.allowed(uid, models.RoleDeptLeader, models.DomainAll, "project", "read"))
+	assert.False(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "project", "create"))
+	assert.False(s.T(), s.allowed(uid, models.RoleDeptLeader, models.DomainAll, "user", "delete"))
+
+	// 普通用户不能通过用户管理接口修改账号，包括自己的账号
+	assert.False(s.T(), s.allowed(uid, models.RoleOther, models.DomainSelf, "user", "update"))
+	assert.False(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "user", "update"))
+}
+
+// TestEnforce_ApprovalActions 测试审批接口需要审批权限，申请人无法审批
+func (s *PermissionServiceTestSuite) TestEnforce_ApprovalActions() {
+	uid := uuid.New().String()
+
+	assert.True(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "classification", "request"))
+	assert.False(s.T(), s.allowed(uid, models.RoleDesigner, models.DomainAll, "classification", "review"))
+	assert.True(s.T(), s.allowed(uid, models.RoleDeptLeader, models.DomainAll, "classification", "review"))
+	assert.True(s.T(), s.allowed(uid, models.RoleSecurityOffice, models.DomainAll, "classification", "review"))
+	// 保密办只能审批保密办环节
+	assert.False(s.T(), s.allowed(uid, models.RoleSecurityOffice, models.DomainAll, "classification", "approve"))
+
+	assert.False(s.T(), s.allowed(uid, models.RoleDesigner, models.DomainAll, "export", "review"))
+	assert.True(s.T(), s.allowed(uid, models.RoleDeptLeader, models.DomainAll, "export", "review"))
+
+	assert.True(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "approval", "read"))
+	assert.False(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "approval", "approve"))
+	assert.True(s.T(), s.allowed(uid, models.RoleDesigner, models.DomainAll, "approval", "approve"))
+	assert.False(s.T(), s.allowed(uid, models.RoleTeamLeader, models.DomainAll, "quality_gate_waiver", "approve"))
+	assert.True(s.T(), s.allowed(uid, models.RoleDeptLeader, models.DomainAll, "quality_gate_waiver", "approve"))
+}
+
+// TestEnforce_ProjectDomain 测试项目角色只在所属项目内生效
+func (s *PermissionServiceTestSuite) TestEnforce_ProjectDomain() {
+	uid, projectA, projectB := uuid.New(), uuid.New(), uuid.New()
+	require.NoError(s.T(), s.db.Create(&models.ProjectMember{
+		ID: uuid.New(), ProjectID: projectA, UserID: uid, Role: "manager",
+	}).Error)
+
+	domainA := models.ProjectDomain(projectA.String())
+	domainB := models.ProjectDomain(projectB.String())
+
+	assert.True(s.T(), s.allowed(uid.String(), models.RoleDesigner, domainA, "project", "update"))
+	assert.True(s.T(), s.allowed(uid.String(), models.RoleDesigner, domainA, "member", "create"))
+	assert.True(s.T(), s.allowed(uid.String(), models.RoleDesigner, domainA, "activity", "read"))
+	assert.False(s.T(), s.allowed(uid.String(), models.RoleDesigner, domainB, "project", "update"))
+	assert.False(s.T(), s.allowed(uid.String(), models.RoleDesigner, domainB, "activity", "read"))
+
+	// 项目负责人无需成员记录
+	led := models.Project{ID: uuid.New(), Code: "RDP-TEST-001", Name: "Test", Category: "product_dev", LeaderID: &uid}
+	require.NoError(s.T(), s.db.Create(&led).Error)
+	assert.True(s.T(), s.allowed(uid.String(), models.RoleDesigner, models.ProjectDomain(led.ID.String()), "project", "delete"))
+
+	// 全局角色仍然适用于任意项目
+	assert.True(s.T(), s.allowed(uid.String(), models.RoleDesigner, domainB, "project", "read"))
+	assert.True(s.T(), s.allowed(uuid.New().String(), models.RoleAdmin, domainB, "project", "delete"))
+}
+
+// TestRoleBinding_PersistsAndScopes 测试通过管理接口绑定角色并持久化
+func (s *PermissionServiceTestSuite) TestRoleBinding_PersistsAndScopes() {
+	uid, projectID := uuid.New().String(), uuid.New().String()
+	domain := models.ProjectDomain(projectID)
+	assert.False(s.T(), s.allowed(uid, models.RoleDesigner, domain, "activity", "update"))
+
+	binding := models.RoleBinding{
+		Subject: models.UserSubject(uid),
+		Role:    models.ProjectRoleSubject("tester"),
+		Domain:  domain,
+	}
+	require.NoError(s.T(), s.service.AddRoleBinding(s.ctx, binding))
+	assert.ErrorIs(s.T(), s.service.AddRoleBinding(s.ctx, binding), ErrPolicyExists)
+
+	assert.True(s.T(), s.allowed(uid, models.RoleDesigner, domain, "activity", "update"))
+	assert.False(s.T(), s.allowed(uid, models.RoleDesigner, domain, "project", "update"))
+	assert.False(s.T(), s.allowed(uid, models.RoleDesigner, models.ProjectDomain(uuid.New().String()), "activity", "update"))
+
+	// 新实例从数据库加载相同策略
+	reloaded, err := NewPermissionService(s.db, models.PermissionConfig{})
+	require.NoError(s.T(), err)
+	ok, err := reloaded.Enforce(s.ctx, uid, models.RoleDesigner, domain, "activity", "update")
+	require.NoError(s.T(), err)
+	assert.True(s.T(), ok)
+
+	require.NoError(s.T(), s.service.RemoveRoleBinding(s.ctx, binding))
+	assert.False(s.T(), s.allowed(uid, models.RoleDesigner, domain, "activity", "update"))
+
+	var audits int64
+	s.db.Model(&models.AuditLog{}).Where("resource = ?", "casbin_rule").Count(&audits)
+	assert.Equal(s.T(), int64(2), audits)
+}
+
+// TestPolicy_AddRemove 测试策略增删及超级管理员策略保护
+func (s *PermissionServiceTestSuite) TestPolicy_AddRemove() {
+	uid := uuid.New().String()
+	rule := models.PolicyRule{Subject: models.RoleOther, Domain: models.DomainAll, Object: "project", Action: "create"}
+
+	require.NoError(s.T(), s.service.AddPolicy(s.ctx, rule))
+	assert.True(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "project", "create"))
+
+	require.NoError(s.T(), s.service.RemovePolicy(s.ctx, rule))
+	assert.False(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "project", "create"))
+
+	var removed models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ?", AuditActionPolicyRemoved).First(&removed).Error)
+	assert.Equal(s.T(), models.AuditSeverityWarn, removed.Severity)
+	assert.Equal(s.T(), models.AuditChange{Before: "p, other, *, project, create", After: nil}, removed.Details.Changes["policy"])
+	assert.ErrorIs(s.T(), s.service.RemovePolicy(s.ctx, rule), ErrPolicyNotFound)
+
+	err := s.service.AddPolicy(s.ctx, models.PolicyRule{Subject: "a,b", Domain: "*", Object: "x", Action: "y"})
+	assert.ErrorIs(s.T(), err, ErrPolicyInvalid)
+
+	err = s.service.RemovePolicy(s.ctx, models.PolicyRule{Subject: models.RoleAdmin, Domain: models.DomainAll, Object: "*", Action: "*"})
+	assert.ErrorIs(s.T(), err, ErrPolicyProtected)
+}
+
+// TestRetiredPolicies_RemovedOnStart 测试已有策略表中的废弃默认策略在启动时被移除
+func (s *PermissionServiceTestSuite) TestRetiredPolicies_RemovedOnStart() {
+	uid := uuid.New().String()
+	retired := models.PolicyRule{Subject: models.RoleOther, Domain: models.DomainSelf, Object: "user", Action: "update"}
+	require.NoError(s.T(), s.service.AddPolicy(s.ctx, retired))
+	require.True(s.T(), s.allowed(uid, models.RoleOther, models.DomainSelf, "user", "update"))
+
+	var err error
+	s.service, err = NewPermissionService(s.db, models.PermissionConfig{})
+	require.NoError(s.T(), err)
+
+	assert.False(s.T(), s.allowed(uid, models.RoleOther, models.DomainSelf, "user", "update"))
+	assert.True(s.T(), s.allowed(uid, models.RoleOther, models.DomainAll, "user", "read"), "other defaults are kept")
+}
+
+// TestMemberRoleChange_AuditedWithDiff 测试项目成员角色变更记录变更前后的值
+func (s *PermissionServiceTestSuite) TestMemberRoleChange_AuditedWithDiff() {
+	projects := NewProjectService(s.db)
+	projectID, userID := uuid.New(), uuid.New()
+	require.NoError(s.T(), s.db.Create(&models.ProjectMember{ID: uuid.New(), ProjectID: projectID, UserID: userID, Role: "developer"}).Error)
+
+	require.NoError(s.T(), projects.UpdateMemberRole(s.ctx, projectID.String(), userID.String(), "manager", ""))
+
+	var entry models.AuditLog
+	require.NoError(s.T(), s.db.Where("action = ?", AuditActionMemberRoleChanged).First(&entry).Error)
+	assert.Equal(s.T(), models.ClassifiedProject, entry.Resource)
+	assert.Equal(s.T(), projectID.String(), *entry.ResourceID)
+	assert.Equal(s.T(), models.AuditSeverityWarn, entry.Severity)
+	require.NotNil(s.T(), entry.Details)
+	assert.Equal(s.T(), models.AuditChange{Before: "developer", After: "manager"}, entry.Details.Changes["role"])
+	assert.Equal(s.T(), userID.String(), entry.Details.Context["user_id"])
+	// 详情经过JSON往返后哈希不变
+	assert.Equal(s.T(), auditLogHash(&entry), entry.Hash)
+
+	// 角色未变化不记录
+	require.NoError(s.T(), projects.UpdateMemberRole(s.ctx, projectID.String(), userID.String(), "manager", ""))
+	var count int64
+	s.db.Model(&models.AuditLog{}).Where("action = ?", AuditActionMemberRoleChanged).Count(&count)
+	assert.Equal(s.T(), int64(1), count)
+}
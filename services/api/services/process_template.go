@@ -2,14 +2,22 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrInvalidTemplate is returned when a template's activities fail validation
+var ErrInvalidTemplate = errors.New("invalid process template")
+
 // ProcessTemplateService handles process template business logic
 type ProcessTemplateService struct {
 	db *gorm.DB
@@ -94,6 +102,10 @@ func (s *ProcessTemplateService) CreateTemplate(ctx context.Context, template *m
 		return errors.New("template code already exists")
 	}
 
+	if _, err := orderTemplateActivities(template.Activities); err != nil {
+		return err
+	}
+
 	template.ID = uuid.New()
 
 	// If this is set as default, unset other defaults
@@ -113,6 +125,19 @@ func (s *ProcessTemplateService) UpdateTemplate(ctx context.Context, id string,
 		return nil, errors.New("invalid template ID")
 	}
 
+	// Validate activities and store them as their canonical JSON
+	if raw, ok := updates["activities"]; ok {
+		activities, err := parseTemplateActivities(raw)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(activities)
+		if err != nil {
+			return nil, err
+		}
+		updates["activities"] = string(data)
+	}
+
 	// If setting as default, unset other defaults
 	if isDefault, ok := updates["is_default"].(bool); ok && isDefault {
 		template, _ := s.GetTemplateByID(ctx, id)
@@ -151,3 +176,274 @@ func (s *ProcessTemplateService) DeleteTemplate(ctx context.Context, id string)
 
 	return nil
 }
+
+// parseTemplateActivities decodes and validates activities given as a
+// generic JSON value
+func parseTemplateActivities(raw interface{}) (models.TemplateActivities, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var activities models.TemplateActivities
+	if err := json.Unmarshal(data, &activities); err != nil || activities == nil {
+		return nil, fmt.Errorf("%w: activities must be a list of activity definitions", ErrInvalidTemplate)
+	}
+	if _, err := orderTemplateActivities(activities); err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// orderTemplateActivities validates the template activities and returns
+// their indexes in dependency order
+func orderTemplateActivities(activities models.TemplateActivities) ([]int, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidTemplate}, args...)...)
+	}
+
+	index := make(map[string]int, len(activities))
+	for i, activity := range activities {
+		if activity.ID == "" {
+			return nil, invalid("activity %d has no id", i+1)
+		}
+		if _, ok := index[activity.ID]; ok {
+			return nil, invalid("duplicate activity id %s", activity.ID)
+		}
+		index[activity.ID] = i
+	}
+
+	successors := make([][]int, len(activities))
+	inDegree := make([]int, len(activities))
+	for i := range activities {
+		activity := &activities[i]
+		if strings.TrimSpace(activity.Name) == "" {
+			return nil, invalid("activity %s has no name", activity.ID)
+		}
+
+		switch activity.ActivityType() {
+		case models.ActivityTypeTask, models.ActivityTypeDCP, models.ActivityTypeReview, models.ActivityTypeApproval:
+			if activity.Duration < 0 {
+				return nil, invalid("activity %s has a negative duration", activity.ID)
+			}
+		case models.ActivityTypeMilestone:
+			if activity.Duration != 0 {
+				return nil, invalid("milestone %s must have zero duration", activity.ID)
+			}
+		default:
+			return nil, invalid("activity %s has unknown type %s", activity.ID, activity.Type)
+		}
+
+		seen := make(map[string]bool)
+		for _, dep := range activities.Dependencies(i) {
+			j, ok := index[dep.ActivityID]
+			if !ok {
+				return nil, invalid("activity %s depends on unknown activity %s", activity.ID, dep.ActivityID)
+			}
+			if j == i {
+				return nil, invalid("activity %s depends on itself", activity.ID)
+			}
+			if seen[dep.ActivityID] {
+				return nil, invalid("activity %s depends on %s more than once", activity.ID, dep.ActivityID)
+			}
+			if dep.Type != "" && !slices.Contains(models.ValidDependencyTypes, dep.Type) {
+				return nil, invalid("activity %s has unknown dependency type %s", activity.ID, dep.Type)
+			}
+			seen[dep.ActivityID] = true
+			successors[j] = append(successors[j], i)
+			inDegree[i]++
+		}
+
+		for _, deliverable := range activity.Deliverables {
+			if strings.TrimSpace(deliverable.Name) == "" {
+				return nil, invalid("activity %s has a deliverable without a name", activity.ID)
+			}
+		}
+
+		if err := validateApprovalPolicy(activity); err != nil {
+			return nil, invalid("activity %s %v", activity.ID, err)
+		}
+	}
+
+	// Kahn's algorithm; whatever is left over lies on a cycle
+	order := make([]int, 0, len(activities))
+	for i := range activities {
+		if inDegree[i] == 0 {
+			order = append(order, i)
+		}
+	}
+	for k := 0; k < len(order); k++ {
+		for _, next := range successors[order[k]] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				order = append(order, next)
+			}
+		}
+	}
+	if len(order) < len(activities) {
+		var cycle []string
+		for i, degree := range inDegree {
+			if degree > 0 {
+				cycle = append(cycle, activities[i].ID)
+			}
+		}
+		return nil, invalid("dependency cycle among activities %s", strings.Join(cycle, ", "))
+	}
+
+	return order, nil
+}
+
+// validateApprovalPolicy checks the approval requirement of an activity
+func validateApprovalPolicy(activity *models.TemplateActivity) error {
+	policy := activity.Approval
+	activityType := activity.ActivityType()
+	if policy == nil {
+		if activityType == models.ActivityTypeApproval {
+			return errors.New("requires an approval policy")
+		}
+		return nil
+	}
+	if activityType != models.ActivityTypeApproval && activityType != models.ActivityTypeDCP {
+		return errors.New("cannot require approval unless it is a dcp or approval activity")
+	}
+	if policy.Mode != models.ApprovalModeSerial && policy.Mode != models.ApprovalModeParallel {
+		return fmt.Errorf("has unknown approval mode %s", policy.Mode)
+	}
+	if len(policy.Roles) == 0 {
+		return errors.New("requires at least one approver role")
+	}
+	for i, role := range policy.Roles {
+		if !slices.Contains(models.ValidApprovalRoles, role) {
+			return fmt.Errorf("has unknown approver role %s", role)
+		}
+		if slices.Contains(policy.Roles[:i], role) {
+			return fmt.Errorf("lists approver role %s more than once", role)
+		}
+	}
+	if policy.Quorum < 0 || policy.Quorum > len(policy.Roles) {
+		return errors.New("has an approval quorum outside the number of approvers")
+	}
+	if policy.Quorum > 0 && policy.Mode != models.ApprovalModeParallel {
+		return errors.New("can only set a quorum on a parallel approval")
+	}
+	return nil
+}
+
+// instantiateTemplate creates the project's workflow from a process
+// template: one activity per template activity with its dependencies and
+// deliverables, planned forward from the project start date. Each DCP gets
+// a quality gate with the default checks.
+func instantiateTemplate(tx *gorm.DB, project *models.Project, template *models.ProcessTemplate, userID string) (*models.Workflow, error) {
+	order, err := orderTemplateActivities(template.Activities)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now().UTC().Truncate(24 * time.Hour)
+	if project.StartDate != nil {
+		start = *project.StartDate
+	}
+
+	workflow := &models.Workflow{
+		ProjectID:  project.ID.String(),
+		TemplateID: template.ID.String(),
+		Name:       template.Name,
+		State:      models.WorkflowStateDraft,
+		CreatedBy:  userID,
+	}
+	if template.Description != nil {
+		workflow.Description = *template.Description
+	}
+	if err := tx.Create(workflow).Error; err != nil {
+		return nil, err
+	}
+
+	// Forward pass in days from the project start
+	activities := template.Activities
+	index := make(map[string]int, len(activities))
+	for i, activity := range activities {
+		index[activity.ID] = i
+	}
+	offsets := make([]int, len(activities))
+	for _, i := range order {
+		duration := activities[i].Duration
+		for _, dep := range activities.Dependencies(i) {
+			j := index[dep.ActivityID]
+			earliest := linkStart(dep.Type, dep.Lag, offsets[j], offsets[j]+activities[j].Duration, duration)
+			offsets[i] = max(offsets[i], earliest)
+		}
+	}
+
+	ids := make([]string, len(activities))
+	for i := range activities {
+		definition := &activities[i]
+		plannedStart := start.AddDate(0, 0, offsets[i])
+		plannedEnd := plannedStart.AddDate(0, 0, definition.Duration)
+		status := models.ActivityStatusPending
+		if len(activities.Dependencies(i)) == 0 {
+			status = models.ActivityStatusReady
+		}
+
+		activity := &models.Activity{
+			WorkflowID:         workflow.ID,
+			ProjectID:          workflow.ProjectID,
+			Name:               definition.Name,
+			Description:        definition.Description,
+			Type:               definition.ActivityType(),
+			Status:             status,
+			Sequence:           i + 1,
+			PlannedStart:       &plannedStart,
+			PlannedEnd:         &plannedEnd,
+			CreatedBy:          userID,
+			TemplateActivityID: definition.ID,
+			RequireReview:      definition.RequireReview,
+			ApprovalPolicy:     definition.Approval,
+		}
+		for _, deliverable := range definition.Deliverables {
+			activity.Deliverables = append(activity.Deliverables, models.Deliverable{
+				Name:        deliverable.Name,
+				Description: deliverable.Description,
+				Type:        deliverable.Type,
+				Status:      "pending",
+			})
+		}
+		if err := tx.Create(activity).Error; err != nil {
+			return nil, err
+		}
+		if activity.Type == models.ActivityTypeDCP {
+			if err := tx.Create(&models.QualityGate{
+				ProjectID:  activity.ProjectID,
+				ActivityID: activity.ID,
+				Name:       activity.Name + "质量门禁",
+				Checks:     models.DefaultQualityChecks,
+				CreatedBy:  userID,
+			}).Error; err != nil {
+				return nil, err
+			}
+		}
+		ids[i] = activity.ID
+		workflow.Activities = append(workflow.Activities, *activity)
+	}
+
+	var dependencies []models.Dependency
+	for i := range activities {
+		for _, dep := range activities.Dependencies(i) {
+			depType := dep.Type
+			if depType == "" {
+				depType = models.DependencyFinishToStart
+			}
+			dependencies = append(dependencies, models.Dependency{
+				ActivityID:     ids[i],
+				DependsOnID:    ids[index[dep.ActivityID]],
+				DependencyType: depType,
+				Lag:            dep.Lag,
+			})
+		}
+	}
+	if len(dependencies) > 0 {
+		if err := tx.Create(&dependencies).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return workflow, nil
+}
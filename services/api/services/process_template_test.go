@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ProcessTemplateTestSuite 流程模板校验与实例化测试套件
+type ProcessTemplateTestSuite struct {
+	suite.Suite
+	db             *gorm.DB
+	service        *ProcessTemplateService
+	projectService *ProjectService
+	ctx            context.Context
+}
+
+func (s *ProcessTemplateTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:process_template?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.ProcessTemplate{},
+		&models.Workflow{}, &models.Activity{}, &models.Deliverable{}, &models.Dependency{}, &models.QualityGate{},
+	))
+	for _, table := range []string{"users", "projects", "project_members", "process_templates", "workflows", "activities", "deliverables", "activity_dependencies", "quality_gates"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.service = NewProcessTemplateService(s.db)
+	s.projectService = NewProjectService(s.db)
+	s.ctx = context.Background()
+}
+
+func TestProcessTemplateSuite(t *testing.T) {
+	suite.Run(t, new(ProcessTemplateTestSuite))
+}
+
+// dependsOn 构造显式前置依赖列表
+func dependsOn(deps ...models.TemplateDependency) *[]models.TemplateDependency {
+	return &deps
+}
+
+// TestCreateTemplate_RejectsInvalidActivities 测试创建模板时校验活动定义
+func (s *ProcessTemplateTestSuite) TestCreateTemplate_RejectsInvalidActivities() {
+	cases := map[string]models.TemplateActivities{
+		"duplicate id": {{ID: "A", Name: "a"}, {ID: "A", Name: "b"}},
+		"unknown type": {{ID: "A", Name: "a", Type: "meeting"}},
+		"milestone":    {{ID: "A", Name: "a", Type: models.ActivityTypeMilestone, Duration: 3}},
+		"unknown dependency": {
+			{ID: "A", Name: "a", DependsOn: dependsOn(models.TemplateDependency{ActivityID: "Z"})},
+		},
+		"cycle": {
+			{ID: "A", Name: "a", DependsOn: dependsOn(models.TemplateDependency{ActivityID: "B"})},
+			{ID: "B", Name: "b"},
+		},
+		"approval without policy": {{ID: "A", Name: "a", Type: models.ActivityTypeApproval}},
+		"quorum on serial approval": {{ID: "A", Name: "a", Type: models.ActivityTypeDCP, Approval: &models.ApprovalPolicy{
+			Mode: models.ApprovalModeSerial, Roles: []string{models.ApprovalRoleLeader, models.ApprovalRoleTechLeader}, Quorum: 1,
+		}}},
+	}
+	for name, activities := range cases {
+		err := s.service.CreateTemplate(s.ctx, &models.ProcessTemplate{Name: name, Code: name, Category: "module", Activities: activities})
+		assert.ErrorIs(s.T(), err, ErrInvalidTemplate, name)
+	}
+
+	var count int64
+	s.db.Model(&models.ProcessTemplate{}).Count(&count)
+	assert.Zero(s.T(), count)
+}
+
+// TestUpdateTemplate_ValidatesActivities 测试更新模板时校验并保存活动定义
+func (s *ProcessTemplateTestSuite) TestUpdateTemplate_ValidatesActivities() {
+	template := &models.ProcessTemplate{Name: "模块", Code: "MOD", Category: "module", Activities: models.TemplateActivities{}}
+	require.NoError(s.T(), s.service.CreateTemplate(s.ctx, template))
+
+	_, err := s.service.UpdateTemplate(s.ctx, template.ID.String(), map[string]interface{}{
+		"activities": []interface{}{map[string]interface{}{"id": "A", "name": "a", "duration": -1}},
+	})
+	assert.ErrorIs(s.T(), err, ErrInvalidTemplate)
+
+	updated, err := s.service.UpdateTemplate(s.ctx, template.ID.String(), map[string]interface{}{
+		"activities": []interface{}{
+			map[string]interface{}{"id": "ACT001", "name": "需求分析", "duration": 5, "require_review": true},
+			map[string]interface{}{"id": "ACT002", "name": "方案设计", "duration": 10},
+		},
+	})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), updated.Activities, 2)
+	assert.Equal(s.T(), "ACT002", updated.Activities[1].ID)
+	assert.True(s.T(), updated.Activities[0].RequireReview)
+}
+
+// TestCreateProject_InstantiatesWorkflow 测试按流程模板创建项目时生成工作流、活动、依赖与交付物
+func (s *ProcessTemplateTestSuite) TestCreateProject_InstantiatesWorkflow() {
+	template := &models.ProcessTemplate{Name: "产品开发", Code: "PRD", Category: "product_dev", Activities: models.TemplateActivities{
+		{ID: "ACT001", Name: "需求分析", Duration: 10, Deliverables: []models.TemplateDeliverable{{Name: "需求规格说明书", Type: "document"}}},
+		{ID: "ACT002", Name: "硬件设计", Duration: 15},
+		{ID: "ACT003", Name: "软件设计", Duration: 5, DependsOn: dependsOn(
+			models.TemplateDependency{ActivityID: "ACT002", Type: models.DependencyStartToStart, Lag: 2},
+		)},
+		{ID: "DCP1", Name: "方案评审", Type: models.ActivityTypeDCP, Duration: 2,
+			DependsOn: dependsOn(
+				models.TemplateDependency{ActivityID: "ACT002"},
+				models.TemplateDependency{ActivityID: "ACT003"},
+			),
+			Approval: &models.ApprovalPolicy{Mode: models.ApprovalModeParallel, Roles: []string{models.ApprovalRoleLeader, models.ApprovalRoleTechLeader}},
+		},
+		{ID: "M1", Name: "方案冻结", Type: models.ActivityTypeMilestone},
+	}}
+	require.NoError(s.T(), s.service.CreateTemplate(s.ctx, template))
+
+	startDate := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	project := &models.Project{Code: "P-001", Name: "雷达", Category: "product_dev", StartDate: &startDate, ProcessTemplateID: &template.ID}
+	require.NoError(s.T(), s.projectService.CreateProject(s.ctx, project, uuid.New().String()))
+
+	var workflow models.Workflow
+	require.NoError(s.T(), s.db.Preload("Activities", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sequence ASC")
+	}).Preload("Activities.Deliverables").Preload("Activities.Dependencies").
+		First(&workflow, "project_id = ?", project.ID.String()).Error)
+	assert.Equal(s.T(), template.ID.String(), workflow.TemplateID)
+	require.Len(s.T(), workflow.Activities, 5)
+
+	day := func(days int) time.Time { return startDate.AddDate(0, 0, days) }
+	byID := make(map[string]models.Activity)
+	for _, activity := range workflow.Activities {
+		byID[activity.TemplateActivityID] = activity
+	}
+
+	requirement := byID["ACT001"]
+	assert.Equal(s.T(), models.ActivityStatusReady, requirement.Status)
+	assert.True(s.T(), day(0).Equal(*requirement.PlannedStart))
+	assert.True(s.T(), day(10).Equal(*requirement.PlannedEnd))
+	require.Len(s.T(), requirement.Deliverables, 1)
+	assert.Equal(s.T(), "需求规格说明书", requirement.Deliverables[0].Name)
+
+	// 未声明依赖时顺接上一活动
+	hardware := byID["ACT002"]
+	assert.Equal(s.T(), models.ActivityStatusPending, hardware.Status)
+	assert.True(s.T(), day(10).Equal(*hardware.PlannedStart))
+	require.Len(s.T(), hardware.Dependencies, 1)
+	assert.Equal(s.T(), requirement.ID, hardware.Dependencies[0].DependsOnID)
+
+	// 开始-开始依赖在前置活动开始两天后开始
+	software := byID["ACT003"]
+	assert.True(s.T(), day(12).Equal(*software.PlannedStart))
+	assert.Equal(s.T(), models.DependencyStartToStart, software.Dependencies[0].DependencyType)
+	assert.Equal(s.T(), 2, software.Dependencies[0].Lag)
+
+	dcp := byID["DCP1"]
+	assert.True(s.T(), day(25).Equal(*dcp.PlannedStart))
+	assert.True(s.T(), day(27).Equal(*dcp.PlannedEnd))
+	require.NotNil(s.T(), dcp.ApprovalPolicy)
+	assert.Equal(s.T(), models.ApprovalModeParallel, dcp.ApprovalPolicy.Mode)
+	assert.Len(s.T(), dcp.Dependencies, 2)
+	// 决策点带有默认质量门禁
+	var gates []models.QualityGate
+	require.NoError(s.T(), s.db.Where("activity_id = ?", dcp.ID).Find(&gates).Error)
+	require.Len(s.T(), gates, 1)
+	assert.Equal(s.T(), models.DefaultQualityChecks, gates[0].Checks)
+
+	milestone := byID["M1"]
+	assert.Equal(s.T(), models.ActivityTypeMilestone, milestone.Type)
+	assert.True(s.T(), milestone.PlannedStart.Equal(*milestone.PlannedEnd))
+	assert.True(s.T(), day(27).Equal(*milestone.PlannedStart))
+}
+
+// TestCreateProject_UnknownTemplateRollsBack 测试流程模板不存在时不创建项目
+func (s *ProcessTemplateTestSuite) TestCreateProject_UnknownTemplateRollsBack() {
+	templateID := uuid.New()
+	project := &models.Project{Code: "P-002", Name: "天线", Category: "module", ProcessTemplateID: &templateID}
+	assert.Error(s.T(), s.projectService.CreateProject(s.ctx, project, ""))
+
+	var count int64
+	s.db.Model(&models.Project{}).Count(&count)
+	assert.Zero(s.T(), count)
+	s.db.Model(&models.Workflow{}).Count(&count)
+	assert.Zero(s.T(), count)
+}
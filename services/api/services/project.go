@@ -4,30 +4,48 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Audit actions for project membership, which grants project permissions
+const (
+	AuditActionMemberAdded       = "project_member_added"
+	AuditActionMemberRemoved     = "project_member_removed"
+	AuditActionMemberRoleChanged = "project_member_role_changed"
+)
+
 // ProjectService handles project business logic
 type ProjectService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	classification *ClassificationService
+	security       *SecurityService
 }
 
 // NewProjectService creates a new ProjectService
 func NewProjectService(db *gorm.DB) *ProjectService {
-	return &ProjectService{db: db}
+	return &ProjectService{
+		db:             db,
+		classification: NewClassificationService(db),
+		security:       NewSecurityService(db),
+	}
 }
 
-// ListProjects returns paginated projects
+// ListProjects returns paginated projects, leaving out those above the
+// caller's clearance
 func (s *ProjectService) ListProjects(ctx context.Context, page, pageSize int, filters map[string]interface{}) ([]models.Project, int64, error) {
 	var projects []models.Project
 	var total int64
 
-	query := s.db.Model(&models.Project{})
+	query, err := s.classification.ScopeProjects(ctx, s.db.Model(&models.Project{}))
+	if err != nil {
+		return nil, 0, err
+	}
 
 	// Apply filters
 	if status, ok := filters["status"].(string); ok && status != "" {
@@ -82,6 +100,10 @@ func (s *ProjectService) GetProjectByID(ctx context.Context, id string) (*models
 		return nil, err
 	}
 
+	if err := s.classification.AuthorizeProject(ctx, &project); err != nil {
+		return nil, err
+	}
+
 	return &project, nil
 }
 
@@ -96,6 +118,10 @@ func (s *ProjectService) GetProjectByCode(ctx context.Context, code string) (*mo
 		return nil, err
 	}
 
+	if err := s.classification.AuthorizeProject(ctx, &project); err != nil {
+		return nil, err
+	}
+
 	return &project, nil
 }
 
@@ -199,11 +225,18 @@ func (s *ProjectService) CreateProject(ctx context.Context, project *models.Proj
 		project.ClassificationLevel = "internal"
 	}
 
-	// Set created_by
+	// Set created_by; the project belongs to the creator's department
+	// unless one was given
 	if userID != "" {
 		uid, err := uuid.Parse(userID)
 		if err == nil {
 			project.CreatedBy = &uid
+			if project.OrganizationID == nil {
+				var creator models.User
+				if err := s.db.Select("organization_id").First(&creator, "id = ?", uid).Error; err == nil {
+					project.OrganizationID = creator.OrganizationID
+				}
+			}
 		}
 	}
 
@@ -230,6 +263,20 @@ func (s *ProjectService) CreateProject(ctx context.Context, project *models.Proj
 				}
 			}
 		}
+
+		// Instantiate the workflow from the process template
+		if project.ProcessTemplateID != nil {
+			var template models.ProcessTemplate
+			if err := tx.First(&template, "id = ? AND is_active = ?", *project.ProcessTemplateID, true).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("process template not found")
+				}
+				return err
+			}
+			if _, err := instantiateTemplate(tx, project, &template, userID); err != nil {
+				return fmt.Errorf("failed to instantiate process template: %w", err)
+			}
+		}
 		
 		return nil
 	})
@@ -258,6 +305,8 @@ func (s *ProjectService) UpdateProject(ctx context.Context, id string, updates m
 	delete(updates, "created_at")
 	delete(updates, "code")
 	delete(updates, "created_by")
+	// Reclassification needs approval, see ClassificationChangeService
+	delete(updates, "classification_level")
 
 	result := s.db.Model(&models.Project{}).Where("id = ?", uid).Updates(updates)
 	if result.Error != nil {
@@ -401,6 +450,7 @@ func (s *ProjectService) AddProjectMember(ctx context.Context, projectID, userID
 	if err := s.db.Create(&member).Error; err != nil {
 		return nil, err
 	}
+	s.auditMember(ctx, AuditActionMemberAdded, &member, (&models.AuditDetails{}).Change("role", nil, role))
 
 	// Load user info
 	var user models.User
@@ -451,7 +501,15 @@ func (s *ProjectService) RemoveMember(ctx context.Context, projectID, userID str
 		}
 	}
 
-	result := s.db.Where("project_id = ? AND user_id = ?", projectUID, userUID).Delete(&models.ProjectMember{})
+	var member models.ProjectMember
+	if err := s.db.First(&member, "project_id = ? AND user_id = ?", projectUID, userUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("member not found")
+		}
+		return err
+	}
+
+	result := s.db.Where("id = ?", member.ID).Delete(&models.ProjectMember{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -459,6 +517,7 @@ func (s *ProjectService) RemoveMember(ctx context.Context, projectID, userID str
 		return errors.New("member not found")
 	}
 
+	s.auditMember(ctx, AuditActionMemberRemoved, &member, (&models.AuditDetails{}).Change("role", member.Role, nil))
 	return nil
 }
 
@@ -497,8 +556,18 @@ func (s *ProjectService) UpdateMemberRole(ctx context.Context, projectID, userID
 		return errors.New("invalid role")
 	}
 
+	var member models.ProjectMember
+	if err := s.db.First(&member, "project_id = ? AND user_id = ?", projectUID, userUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("member not found")
+		}
+		return err
+	}
+
+	// Only change the role that was read, so the audited previous value is
+	// the one replaced
 	result := s.db.Model(&models.ProjectMember{}).
-		Where("project_id = ? AND user_id = ?", projectUID, userUID).
+		Where("id = ? AND role = ?", member.ID, member.Role).
 		Update("role", newRole)
 	if result.Error != nil {
 		return result.Error
@@ -507,9 +576,22 @@ func (s *ProjectService) UpdateMemberRole(ctx context.Context, projectID, userID
 		return errors.New("member not found")
 	}
 
+	if member.Role != newRole {
+		s.auditMember(ctx, AuditActionMemberRoleChanged, &member, (&models.AuditDetails{}).Change("role", member.Role, newRole))
+	}
 	return nil
 }
 
+// auditMember records a membership change against the project; the
+// details name the member
+func (s *ProjectService) auditMember(ctx context.Context, action string, member *models.ProjectMember, details *models.AuditDetails) {
+	details.With("user_id", member.UserID)
+	entry := newAuditEvent(ctx, action, models.ClassifiedProject, member.ProjectID.String(), models.ClassificationInternal, details)
+	if err := s.security.CreateAuditLog(ctx, entry); err != nil {
+		log.Printf("failed to record %s: %v", action, err)
+	}
+}
+
 // UpdateProjectProgress updates project progress based on activities completion
 func (s *ProjectService) UpdateProjectProgress(ctx context.Context, projectID string, progress int, userID string) (*models.Project, error) {
 	// Validate progress
@@ -574,6 +656,7 @@ func calculateProgressFromActivities(activities []models.Activity) int {
 	}
 	
 	totalWeight := 0
+	// Completed work in percent of an activity's weight
 	completedWeight := 0
 	
 	for _, activity := range activities {
@@ -583,10 +666,10 @@ func calculateProgressFromActivities(activities []models.Activity) int {
 		
 		switch activity.Status {
 		case "completed":
-			completedWeight += weight
+			completedWeight += weight * 100
 		case "in_progress":
 			// Partial credit based on activity progress
-			completedWeight += weight * activity.Progress / 100
+			completedWeight += weight * activity.Progress
 		}
 	}
 	
@@ -594,7 +677,7 @@ func calculateProgressFromActivities(activities []models.Activity) int {
 		return 0
 	}
 	
-	return completedWeight * 100 / totalWeight
+	return completedWeight / totalWeight
 }
 
 // GetUserProjects returns all projects a user is a member of
@@ -605,7 +688,12 @@ func (s *ProjectService) GetUserProjects(ctx context.Context, userID string) ([]
 		return nil, errors.New("invalid user ID")
 	}
 
-	if err := s.db.Joins("JOIN project_members ON project_members.project_id = projects.id").
+	query, err := s.classification.ScopeProjects(ctx, s.db.Model(&models.Project{}))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := query.Joins("JOIN project_members ON project_members.project_id = projects.id").
 		Where("project_members.user_id = ?", userUID).
 		Order("projects.created_at DESC").
 		Find(&projects).Error; err != nil {
@@ -623,7 +711,7 @@ func (s *ProjectService) GetProjectActivities(ctx context.Context, projectID str
 		return nil, errors.New("invalid project ID")
 	}
 
-	if err := s.db.Where("project_id = ?", projectUID).Order("sort_order ASC").Find(&activities).Error; err != nil {
+	if err := s.db.Preload("Dependencies").Where("project_id = ?", projectUID).Order("sequence ASC").Find(&activities).Error; err != nil {
 		return nil, err
 	}
 
@@ -632,27 +720,97 @@ func (s *ProjectService) GetProjectActivities(ctx context.Context, projectID str
 
 // CreateActivity creates a new activity for a project
 func (s *ProjectService) CreateActivity(ctx context.Context, activity *models.Activity) error {
-	activity.ID = uuid.New()
 	return s.db.Create(activity).Error
 }
 
-// UpdateActivity updates an activity
-func (s *ProjectService) UpdateActivity(ctx context.Context, id string, updates map[string]interface{}) (*models.Activity, error) {
-	uid, err := uuid.Parse(id)
-	if err != nil {
-		return nil, errors.New("invalid activity ID")
-	}
+// activityUpdateFields lists the activity fields that may be edited
+// directly; status changes go through the activity state machine
+var activityUpdateFields = map[string]bool{
+	"name":          true,
+	"description":   true,
+	"priority":      true,
+	"progress":      true,
+	"assignee_id":   true,
+	"planned_start": true,
+	"planned_end":   true,
+}
 
-	result := s.db.Model(&models.Activity{}).Where("id = ?", uid).Updates(updates)
-	if result.Error != nil {
-		return nil, result.Error
-	}
-	if result.RowsAffected == 0 {
-		return nil, errors.New("activity not found")
+// UpdateActivity updates an activity. A "status" key moves the activity
+// through its state machine as userID, with an optional "comment". New
+// planned dates ripple through the activity's successors. The activity
+// cannot be edited while an approval is pending.
+func (s *ProjectService) UpdateActivity(ctx context.Context, id string, updates map[string]interface{}, userID string) (*models.Activity, error) {
+	fields := make(map[string]interface{})
+	var status models.ActivityStatus
+	comment := ""
+	var plannedStart, plannedEnd *time.Time
+	for key, value := range updates {
+		switch {
+		case key == "status":
+			text, ok := value.(string)
+			if !ok {
+				return nil, errors.New("invalid activity status")
+			}
+			status = models.ActivityStatus(text)
+		case key == "comment":
+			comment, _ = value.(string)
+		case (key == "planned_start" || key == "planned_end") && value != nil:
+			date, err := parseScheduleDate(value)
+			if err != nil {
+				return nil, err
+			}
+			if key == "planned_start" {
+				plannedStart = date
+			} else {
+				plannedEnd = date
+			}
+		case activityUpdateFields[key]:
+			fields[key] = value
+		default:
+			return nil, fmt.Errorf("activity field %s cannot be updated", key)
+		}
 	}
 
 	var activity models.Activity
-	if err := s.db.First(&activity, "id = ?", uid).Error; err != nil {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkActivityEditable(tx, id); err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			result := tx.Model(&models.Activity{}).Where("id = ?", id).Updates(fields)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrActivityNotFound
+			}
+		}
+		if err := tx.First(&activity, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrActivityNotFound
+			}
+			return err
+		}
+		if plannedStart != nil || plannedEnd != nil {
+			if _, err := rescheduleActivity(tx, &activity, plannedStart, plannedEnd, userID); err != nil {
+				return err
+			}
+			if err := tx.First(&activity, "id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+		if status == "" || status == activity.Status {
+			return nil
+		}
+
+		transitioned, err := transitionActivity(tx, id, status, userID, comment)
+		if err != nil {
+			return err
+		}
+		activity = *transitioned
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
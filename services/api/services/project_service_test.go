@@ -5,7 +5,7 @@ import (
 	"testing"
 	"time"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
@@ -47,12 +47,12 @@ func TestProjectService_GenerateProjectCode(t *testing.T) {
 		today := time.Now().Format("20060102")
 		prefix := "RDP-PD-" + today + "-"
 
-		mock.ExpectQuery(`SELECT code FROM "projects"`).
+		mock.ExpectQuery(`SELECT "code" FROM "projects"`).
 			WithArgs(prefix + "%").
 			WillReturnRows(sqlmock.NewRows([]string{"code"}))
 
-		mock.ExpectQuery(`SELECT count\\(\\*\\) FROM "projects"`).
-			WithArgs(prefix+"%03d", 1).
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "projects"`).
+			WithArgs(prefix + "001").
 			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
 		code, err := service.GenerateProjectCode(ctx, "pd_project")
@@ -66,12 +66,12 @@ func TestProjectService_GenerateProjectCode(t *testing.T) {
 		prefix := "RDP-TR-" + today + "-"
 		existingCode := prefix + "005"
 
-		mock.ExpectQuery(`SELECT code FROM "projects"`).
+		mock.ExpectQuery(`SELECT "code" FROM "projects"`).
 			WithArgs(prefix + "%").
 			WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow(existingCode))
 
-		mock.ExpectQuery(`SELECT count\\(\\*\\) FROM "projects"`).
-			WithArgs(prefix+"%03d", 6).
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "projects"`).
+			WithArgs(prefix + "006").
 			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
 		code, err := service.GenerateProjectCode(ctx, "tech_research")
@@ -210,6 +210,7 @@ func TestProjectService_ListProjects(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), total)
+		assert.Len(t, projects, 1)
 	})
 }
 
@@ -234,7 +235,7 @@ func TestProjectService_CreateProject(t *testing.T) {
 		}
 
 		// Mock code generation query
-		mock.ExpectQuery(`SELECT code FROM "projects"`).WillReturnRows(sqlmock.NewRows([]string{"code"}))
+		mock.ExpectQuery(`SELECT "code" FROM "projects"`).WillReturnRows(sqlmock.NewRows([]string{"code"}))
 		mock.ExpectQuery(`SELECT count\(\*\) FROM "projects"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
 		// Mock transaction
@@ -294,9 +295,11 @@ func TestProjectService_UpdateProject(t *testing.T) {
 			WillReturnRows(userRows)
 
 		// Update project
+		mock.ExpectBegin()
 		mock.ExpectExec(`UPDATE "projects" SET`).
-			WithArgs("Updated Name", sqlmock.AnyArg()).
+			WithArgs("Updated Name", sqlmock.AnyArg(), projectID).
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
 		// Get updated project
 		projectRows := sqlmock.NewRows([]string{"id", "code", "name", "category", "status", "created_at", "updated_at"}).
@@ -328,8 +331,10 @@ func TestProjectService_UpdateProject(t *testing.T) {
 			WithArgs(sqlmock.AnyArg()).
 			WillReturnRows(userRows)
 
+		mock.ExpectBegin()
 		mock.ExpectExec(`UPDATE "projects" SET`).
 			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
 
 		project, err := service.UpdateProject(ctx, projectID.String(), updates, userID)
 		assert.Error(t, err)
@@ -358,9 +363,11 @@ func TestProjectService_DeleteProject(t *testing.T) {
 			WithArgs(sqlmock.AnyArg()).
 			WillReturnRows(userRows)
 
+		mock.ExpectBegin()
 		mock.ExpectExec(`UPDATE "projects" SET`).
-			WithArgs("deleted", sqlmock.AnyArg()).
+			WithArgs("deleted", sqlmock.AnyArg(), projectID).
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
 		err := service.DeleteProject(ctx, projectID.String(), userID)
 		assert.NoError(t, err)
@@ -375,8 +382,10 @@ func TestProjectService_DeleteProject(t *testing.T) {
 			WithArgs(sqlmock.AnyArg()).
 			WillReturnRows(userRows)
 
+		mock.ExpectBegin()
 		mock.ExpectExec(`UPDATE "projects" SET`).
 			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
 
 		err := service.DeleteProject(ctx, projectID.String(), userID)
 		assert.Error(t, err)
@@ -411,8 +420,10 @@ func TestProjectService_AddProjectMember(t *testing.T) {
 			WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 		// Create member
+		mock.ExpectBegin()
 		mock.ExpectQuery(`INSERT INTO "project_members"`).
-			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+			WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(time.Now()))
+		mock.ExpectCommit()
 
 		// Load user info
 		memberUserRows := sqlmock.NewRows([]string{"id", "username", "display_name"}).
@@ -474,6 +485,10 @@ func TestProjectService_GetProjectMembers(t *testing.T) {
 
 		mock.ExpectQuery(`SELECT \* FROM "project_members"`).
 			WillReturnRows(memberRows)
+		mock.ExpectQuery(`SELECT \* FROM "users"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).
+				AddRow(userID1, "manager").
+				AddRow(userID2, "developer"))
 
 		members, err := service.GetProjectMembers(ctx, projectID)
 		assert.NoError(t, err)
@@ -508,9 +523,16 @@ func TestProjectService_UpdateProjectProgress(t *testing.T) {
 		mock.ExpectQuery(`SELECT \* FROM "activities"`).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "project_id", "status", "progress"}))
 
+		// Set actual start date
+		mock.ExpectQuery(`SELECT \* FROM "projects"`).
+			WithArgs(projectID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(projectID, "draft"))
+
 		// Update project
+		mock.ExpectBegin()
 		mock.ExpectExec(`UPDATE "projects" SET`).
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
 		// Get updated project
 		projectRows := sqlmock.NewRows([]string{"id", "code", "name", "category", "status", "progress", "created_at", "updated_at"}).
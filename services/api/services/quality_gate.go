@@ -0,0 +1,605 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"gorm.io/gorm"
+)
+
+// Quality gate errors
+var (
+	ErrQualityGateFailed    = errors.New("quality gate failed")
+	ErrQualityGateNotFound  = errors.New("quality gate not found")
+	ErrQualityGateNotDCP    = errors.New("quality gates can only be set on dcp activities")
+	ErrInvalidQualityCheck  = errors.New("invalid quality check")
+	ErrWaiverNotFound       = errors.New("quality gate waiver not found")
+	ErrWaiverNotRequired    = errors.New("quality gate has not failed")
+	ErrWaiverAlreadyPending = errors.New("a waiver is already pending for this quality gate")
+	ErrWaiverNotPending     = errors.New("quality gate waiver is no longer pending")
+	ErrWaiverNotPermitted   = errors.New("not permitted to request a waiver for this quality gate")
+)
+
+// Notification types raised by quality gate waivers
+const (
+	NotificationWaiverRequested = "quality_gate_waiver_requested"
+	NotificationWaiverDecided   = "quality_gate_waiver_decided"
+)
+
+// Requirement statuses counted as approved
+var approvedRequirementStatuses = []models.RequirementStatus{
+	models.RequirementStatusApproved,
+	models.RequirementStatusImplemented,
+	models.RequirementStatusVerified,
+}
+
+// Defect statuses counted as open
+var openDefectStatuses = []models.DefectStatus{
+	models.DefectStatusNew,
+	models.DefectStatusAssigned,
+	models.DefectStatusInProgress,
+	models.DefectStatusReopened,
+}
+
+// QualityGateError is returned when a DCP is held up by failed quality
+// gates. It carries the results so the caller can show what failed.
+type QualityGateError struct {
+	Results []models.QualityGateResult
+}
+
+func (e *QualityGateError) Error() string {
+	var failed []string
+	for _, result := range e.Results {
+		if !result.Blocks() {
+			continue
+		}
+		for _, check := range result.Checks {
+			if !check.Passed {
+				failed = append(failed, check.Type)
+			}
+		}
+	}
+	return fmt.Sprintf("%s: %s", ErrQualityGateFailed, strings.Join(failed, ", "))
+}
+
+// Unwrap lets errors.Is match ErrQualityGateFailed
+func (e *QualityGateError) Unwrap() error {
+	return ErrQualityGateFailed
+}
+
+// QualityCheckEvaluator evaluates one type of quality check against a DCP
+type QualityCheckEvaluator interface {
+	Evaluate(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error)
+}
+
+// QualityCheckFunc adapts a function to QualityCheckEvaluator
+type QualityCheckFunc func(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error)
+
+// Evaluate calls f
+func (f QualityCheckFunc) Evaluate(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error) {
+	return f(db, activity, check)
+}
+
+// qualityChecks maps check types to their evaluators. They are shared by
+// every QualityGateService, since gates are evaluated from the activity
+// state machine too.
+var qualityChecks = struct {
+	sync.RWMutex
+	evaluators map[string]QualityCheckEvaluator
+}{
+	evaluators: map[string]QualityCheckEvaluator{
+		models.QualityCheckRequirementApproval:  QualityCheckFunc(evaluateRequirementApproval),
+		models.QualityCheckFeedbackClosed:       QualityCheckFunc(evaluateFeedbackClosed),
+		models.QualityCheckCriticalDefects:      QualityCheckFunc(evaluateCriticalDefects),
+		models.QualityCheckRequiredDeliverables: QualityCheckFunc(evaluateRequiredDeliverables),
+	},
+}
+
+// RegisterQualityCheck makes the evaluator handle checks of the given
+// type, replacing any evaluator registered for it, until the returned
+// function is called
+func RegisterQualityCheck(checkType string, evaluator QualityCheckEvaluator) func() {
+	qualityChecks.Lock()
+	defer qualityChecks.Unlock()
+	previous, replaced := qualityChecks.evaluators[checkType]
+	qualityChecks.evaluators[checkType] = evaluator
+
+	return func() {
+		qualityChecks.Lock()
+		defer qualityChecks.Unlock()
+		if replaced {
+			qualityChecks.evaluators[checkType] = previous
+		} else {
+			delete(qualityChecks.evaluators, checkType)
+		}
+	}
+}
+
+// qualityCheckEvaluator returns the evaluator registered for the check type
+func qualityCheckEvaluator(checkType string) (QualityCheckEvaluator, bool) {
+	qualityChecks.RLock()
+	defer qualityChecks.RUnlock()
+	evaluator, ok := qualityChecks.evaluators[checkType]
+	return evaluator, ok
+}
+
+// QualityGateService manages the quality gates of DCP activities
+// (SRS-QM-004): their checks are evaluated when the DCP is submitted and
+// a failed gate holds it up unless the department leader waives it
+type QualityGateService struct {
+	db *gorm.DB
+}
+
+// NewQualityGateService creates a new QualityGateService
+func NewQualityGateService(db *gorm.DB) *QualityGateService {
+	return &QualityGateService{db: db}
+}
+
+// CreateGate adds a quality gate to a DCP activity. Without checks the
+// gate gets the default ones.
+func (s *QualityGateService) CreateGate(activityID, userID string, req *models.CreateQualityGateRequest) (*models.QualityGate, error) {
+	var activity models.Activity
+	if err := s.db.First(&activity, "id = ?", activityID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrActivityNotFound
+		}
+		return nil, err
+	}
+	if activity.Type != models.ActivityTypeDCP {
+		return nil, ErrQualityGateNotDCP
+	}
+
+	checks := req.Checks
+	if len(checks) == 0 {
+		checks = models.DefaultQualityChecks
+	}
+	for _, check := range checks {
+		if _, ok := qualityCheckEvaluator(check.Type); !ok {
+			return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidQualityCheck, check.Type)
+		}
+		if check.Threshold < 0 {
+			return nil, fmt.Errorf("%w: %s threshold cannot be negative", ErrInvalidQualityCheck, check.Type)
+		}
+	}
+
+	gate := &models.QualityGate{
+		ProjectID:  activity.ProjectID,
+		ActivityID: activity.ID,
+		Name:       req.Name,
+		Checks:     checks,
+		CreatedBy:  userID,
+	}
+	if err := s.db.Create(gate).Error; err != nil {
+		return nil, err
+	}
+	return gate, nil
+}
+
+// ListGates returns the quality gates of an activity with their results,
+// newest first, and waivers
+func (s *QualityGateService) ListGates(activityID string) ([]models.QualityGate, error) {
+	var gates []models.QualityGate
+	if err := s.db.Preload("Results", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC, id DESC")
+	}).Preload("Waivers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC, id DESC")
+	}).Where("activity_id = ?", activityID).Order("created_at ASC").Find(&gates).Error; err != nil {
+		return nil, err
+	}
+	return gates, nil
+}
+
+// EvaluateActivity evaluates the quality gates of an activity and records
+// the results
+func (s *QualityGateService) EvaluateActivity(activityID, userID string) ([]models.QualityGateResult, error) {
+	return evaluateQualityGates(s.db, activityID, userID)
+}
+
+// RequestWaiver asks the department leader to let a failed gate through
+func (s *QualityGateService) RequestWaiver(gateID, userID, reason string) (*models.QualityGateWaiver, error) {
+	var waiver *models.QualityGateWaiver
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var gate models.QualityGate
+		if err := tx.First(&gate, "id = ?", gateID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrQualityGateNotFound
+			}
+			return err
+		}
+		var activity models.Activity
+		if err := tx.First(&activity, "id = ?", gate.ActivityID).Error; err != nil {
+			return err
+		}
+		allowed, err := activityActorAllowed(tx, &activity, models.ActivityActorAssignee, userID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrWaiverNotPermitted
+		}
+
+		var results []models.QualityGateResult
+		if err := tx.Where("gate_id = ?", gate.ID).Order("created_at DESC, id DESC").Limit(1).Find(&results).Error; err != nil {
+			return err
+		}
+		if len(results) == 0 || !results[0].Blocks() {
+			return ErrWaiverNotRequired
+		}
+		var pending int64
+		if err := tx.Model(&models.QualityGateWaiver{}).
+			Where("gate_id = ? AND status = ?", gate.ID, models.ApprovalStatusPending).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrWaiverAlreadyPending
+		}
+
+		var project models.Project
+		if err := tx.First(&project, "id = ?", gate.ProjectID).Error; err != nil {
+			return err
+		}
+		approver, err := departmentLeader(tx, &project)
+		if err != nil {
+			return err
+		}
+		if approver == "" {
+			return fmt.Errorf("%w: %s", ErrApproverNotResolved, models.ApprovalRoleDeptLeader)
+		}
+
+		waiver = &models.QualityGateWaiver{
+			GateID:      gate.ID,
+			ResultID:    results[0].ID,
+			ProjectID:   gate.ProjectID,
+			Reason:      reason,
+			Status:      models.ApprovalStatusPending,
+			RequestedBy: userID,
+			ApproverID:  approver,
+		}
+		if err := tx.Create(waiver).Error; err != nil {
+			return err
+		}
+		return notifyUser(tx, approver, NotificationWaiverRequested, fmt.Sprintf("活动「%s」的质量门「%s」申请豁免：%s", activity.Name, gate.Name, reason), "quality_gate_waiver", waiver.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return waiver, nil
+}
+
+// ApproveWaiver lets the failed gate through. Only the department leader
+// asked can decide.
+func (s *QualityGateService) ApproveWaiver(waiverID, userID, comment string) (*models.QualityGateWaiver, error) {
+	return s.decideWaiver(waiverID, userID, true, comment)
+}
+
+// RejectWaiver turns down the waiver with the reason for it
+func (s *QualityGateService) RejectWaiver(waiverID, userID, comment string) (*models.QualityGateWaiver, error) {
+	if comment == "" {
+		return nil, ErrApprovalCommentRequired
+	}
+	return s.decideWaiver(waiverID, userID, false, comment)
+}
+
+// ListPendingWaivers returns the waivers awaiting the user's decision
+func (s *QualityGateService) ListPendingWaivers(userID string) ([]models.QualityGateWaiver, error) {
+	var waivers []models.QualityGateWaiver
+	if err := s.db.Where("approver_id = ? AND status = ?", userID, models.ApprovalStatusPending).
+		Order("created_at ASC").
+		Find(&waivers).Error; err != nil {
+		return nil, err
+	}
+	return waivers, nil
+}
+
+// decideWaiver records the approver's decision on a pending waiver
+func (s *QualityGateService) decideWaiver(waiverID, userID string, approve bool, comment string) (*models.QualityGateWaiver, error) {
+	var waiver models.QualityGateWaiver
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&waiver, "id = ?", waiverID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWaiverNotFound
+			}
+			return err
+		}
+		if waiver.Status != models.ApprovalStatusPending {
+			return ErrWaiverNotPending
+		}
+		if waiver.ApproverID != userID {
+			return ErrNotApprover
+		}
+
+		now := time.Now()
+		waiver.Status = models.ApprovalStatusRejected
+		if approve {
+			waiver.Status = models.ApprovalStatusApproved
+		}
+		waiver.Comment = comment
+		waiver.DecidedAt = &now
+		// Guard against a concurrent decision
+		result := tx.Model(&models.QualityGateWaiver{}).
+			Where("id = ? AND status = ?", waiver.ID, models.ApprovalStatusPending).
+			Updates(map[string]interface{}{"status": waiver.Status, "comment": comment, "decided_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWaiverNotPending
+		}
+
+		title := "质量门豁免申请已通过"
+		if approve {
+			if err := tx.Model(&models.QualityGateResult{}).Where("id = ?", waiver.ResultID).
+				Update("status", models.QualityGateWaived).Error; err != nil {
+				return err
+			}
+		} else {
+			title = "质量门豁免申请被驳回：" + comment
+		}
+		return notifyUser(tx, waiver.RequestedBy, NotificationWaiverDecided, title, "quality_gate_waiver", waiver.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &waiver, nil
+}
+
+// evaluateQualityGates evaluates the gates of a DCP and records the
+// results. A failed gate with an approved waiver is recorded as waived.
+// The results are kept even when the gates hold up the DCP.
+func evaluateQualityGates(db *gorm.DB, activityID, userID string) ([]models.QualityGateResult, error) {
+	var results []models.QualityGateResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var activity models.Activity
+		if err := tx.First(&activity, "id = ?", activityID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrActivityNotFound
+			}
+			return err
+		}
+		var gates []models.QualityGate
+		if err := tx.Where("activity_id = ?", activity.ID).Order("created_at ASC").Find(&gates).Error; err != nil {
+			return err
+		}
+
+		for i := range gates {
+			result, err := evaluateQualityGate(tx, &activity, &gates[i])
+			if err != nil {
+				return err
+			}
+			result.EvaluatedBy = userID
+			if err := tx.Create(result).Error; err != nil {
+				return err
+			}
+			results = append(results, *result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// evaluateQualityGate runs the checks of a gate
+func evaluateQualityGate(db *gorm.DB, activity *models.Activity, gate *models.QualityGate) (*models.QualityGateResult, error) {
+	result := &models.QualityGateResult{
+		GateID:     gate.ID,
+		ActivityID: activity.ID,
+		ProjectID:  activity.ProjectID,
+		Status:     models.QualityGatePassed,
+		Checks:     make([]models.QualityCheckResult, 0, len(gate.Checks)),
+	}
+	for _, check := range gate.Checks {
+		evaluator, ok := qualityCheckEvaluator(check.Type)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidQualityCheck, check.Type)
+		}
+		checkResult, err := evaluator.Evaluate(db, activity, check)
+		if err != nil {
+			return nil, err
+		}
+		checkResult.Type = check.Type
+		if !checkResult.Passed {
+			result.Status = models.QualityGateFailed
+		}
+		result.Checks = append(result.Checks, *checkResult)
+	}
+
+	if result.Status == models.QualityGateFailed {
+		waived, err := qualityGateWaived(db, gate.ID)
+		if err != nil {
+			return nil, err
+		}
+		if waived {
+			result.Status = models.QualityGateWaived
+		}
+	}
+	return result, nil
+}
+
+// qualityGateWaived checks if a waiver of the gate has been approved
+func qualityGateWaived(db *gorm.DB, gateID string) (bool, error) {
+	var approved int64
+	err := db.Model(&models.QualityGateWaiver{}).
+		Where("gate_id = ? AND status = ?", gateID, models.ApprovalStatusApproved).
+		Count(&approved).Error
+	return approved > 0, err
+}
+
+// qualityGatesPassed checks if every quality gate of a DCP passes now or
+// has been waived. Other activities have no gates.
+func qualityGatesPassed(db *gorm.DB, activity *models.Activity) (bool, error) {
+	if activity.Type != models.ActivityTypeDCP {
+		return true, nil
+	}
+	var gates []models.QualityGate
+	if err := db.Where("activity_id = ?", activity.ID).Find(&gates).Error; err != nil {
+		return false, err
+	}
+	for i := range gates {
+		result, err := evaluateQualityGate(db, activity, &gates[i])
+		if err != nil {
+			return false, err
+		}
+		if result.Blocks() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// evaluateRequirementApproval checks the share of the project's
+// requirements that have been approved. Rejected requirements are left
+// out, and a project without requirements passes.
+func evaluateRequirementApproval(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error) {
+	var total, approved int64
+	if err := db.Model(&models.Requirement{}).
+		Where("project_id = ? AND status <> ?", activity.ProjectID, models.RequirementStatusRejected).
+		Count(&total).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Requirement{}).
+		Where("project_id = ? AND status IN ?", activity.ProjectID, approvedRequirementStatuses).
+		Count(&approved).Error; err != nil {
+		return nil, err
+	}
+
+	ratio := 1.0
+	if total > 0 {
+		ratio = float64(approved) / float64(total)
+	}
+	result := &models.QualityCheckResult{Passed: ratio >= check.Threshold, Actual: ratio}
+	if !result.Passed {
+		result.Message = fmt.Sprintf("%d of %d requirements approved, %.0f%% needed", approved, total, check.Threshold*100)
+	}
+	return result, nil
+}
+
+// evaluateFeedbackClosed checks that every feedback thread on the
+// project's reviews has been closed
+func evaluateFeedbackClosed(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error) {
+	reviews := db.Model(&models.Review{}).Select("id").Where("project_id = ?", activity.ProjectID)
+	var open int64
+	if err := db.Model(&models.Feedback{}).
+		Where("review_id IN (?) AND parent_id IS NULL AND closed_at IS NULL", reviews).
+		Count(&open).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.QualityCheckResult{Passed: open == 0, Actual: float64(open)}
+	if !result.Passed {
+		result.Message = fmt.Sprintf("%d review feedback threads still open", open)
+	}
+	return result, nil
+}
+
+// evaluateCriticalDefects checks the project's open critical defects
+// against the threshold
+func evaluateCriticalDefects(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error) {
+	var open int64
+	if err := db.Model(&models.Defect{}).
+		Where("project_id = ? AND severity = ? AND status IN ?", activity.ProjectID, models.DefectSeverityCritical, openDefectStatuses).
+		Count(&open).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.QualityCheckResult{Passed: float64(open) <= check.Threshold, Actual: float64(open)}
+	if !result.Passed {
+		result.Message = fmt.Sprintf("%d critical defects still open", open)
+	}
+	return result, nil
+}
+
+// evaluateRequiredDeliverables checks that the deliverables the check
+// names have been submitted anywhere in the workflow. Without names, the
+// deliverables of every activity leading up to the DCP must be.
+func evaluateRequiredDeliverables(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error) {
+	var deliverables []models.Deliverable
+	if len(check.Deliverables) > 0 {
+		activities := db.Model(&models.Activity{}).Select("id").Where("workflow_id = ?", activity.WorkflowID)
+		if err := db.Where("activity_id IN (?) AND name IN ?", activities, check.Deliverables).Find(&deliverables).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		predecessors, err := activityPredecessors(db, activity)
+		if err != nil {
+			return nil, err
+		}
+		if len(predecessors) > 0 {
+			if err := db.Where("activity_id IN ?", predecessors).Find(&deliverables).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var missing []string
+	if len(check.Deliverables) > 0 {
+		submitted := make(map[string]bool)
+		for _, deliverable := range deliverables {
+			if deliverableSubmitted(&deliverable) {
+				submitted[deliverable.Name] = true
+			}
+		}
+		for _, name := range check.Deliverables {
+			if !submitted[name] {
+				missing = append(missing, name)
+			}
+		}
+	} else {
+		for _, deliverable := range deliverables {
+			if !deliverableSubmitted(&deliverable) {
+				missing = append(missing, deliverable.Name)
+			}
+		}
+	}
+
+	result := &models.QualityCheckResult{Passed: len(missing) == 0, Actual: float64(len(missing))}
+	if !result.Passed {
+		result.Message = "missing deliverables: " + strings.Join(missing, ", ")
+	}
+	return result, nil
+}
+
+// deliverableSubmitted checks if the deliverable has been submitted
+func deliverableSubmitted(deliverable *models.Deliverable) bool {
+	return deliverable.SubmittedAt != nil || slices.Contains(submittedDeliverableStatuses, deliverable.Status)
+}
+
+// activityPredecessors returns the IDs of the activities the activity
+// depends on, directly or through others
+func activityPredecessors(db *gorm.DB, activity *models.Activity) ([]string, error) {
+	dependencies, err := workflowDependencies(db, activity.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	predecessors := make(map[string][]string)
+	for _, dependency := range dependencies {
+		predecessors[dependency.ActivityID] = append(predecessors[dependency.ActivityID], dependency.DependsOnID)
+	}
+
+	var ids []string
+	seen := map[string]bool{activity.ID: true}
+	queue := []string{activity.ID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, predecessor := range predecessors[id] {
+			if seen[predecessor] {
+				continue
+			}
+			seen[predecessor] = true
+			ids = append(ids, predecessor)
+			queue = append(queue, predecessor)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// QualityGateTestSuite 质量门禁测试套件
+type QualityGateTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	gates        *QualityGateService
+	approvals    *ApprovalService
+	activities   *ActivityService
+	project      *models.Project
+	workflow     *models.Workflow
+	design       *models.Activity
+	dcp          *models.Activity
+	leaderID     uuid.UUID
+	techLeaderID uuid.UUID
+	deptLeaderID uuid.UUID
+	assigneeID   uuid.UUID
+}
+
+func (s *QualityGateTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:quality_gate?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Organization{}, &models.Project{}, &models.ProjectMember{}, &models.Notification{},
+		&models.Workflow{}, &models.Activity{}, &models.Dependency{}, &models.Deliverable{}, &models.Review{}, &models.Feedback{},
+		&models.Requirement{}, &models.Defect{}, &models.ActivityTransition{}, &models.Approval{}, &models.ApprovalStep{},
+		&models.QualityGate{}, &models.QualityGateResult{}, &models.QualityGateWaiver{},
+	))
+	for _, table := range []string{"users", "organizations", "projects", "project_members", "notifications", "workflows", "activities",
+		"activity_dependencies", "deliverables", "reviews", "feedbacks", "requirements", "defects", "activity_transitions", "approvals",
+		"approval_steps", "quality_gates", "quality_gate_results", "quality_gate_waivers"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.leaderID, s.techLeaderID, s.deptLeaderID, s.assigneeID = uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	organization := &models.Organization{ID: uuid.New(), Name: "微波事业部", Code: "MW", LeaderID: &s.deptLeaderID}
+	require.NoError(s.T(), s.db.Create(organization).Error)
+	require.NoError(s.T(), s.db.Create(&models.User{ID: s.leaderID, Username: "leader", DisplayName: "项目负责人", Role: models.RoleDesigner, OrganizationID: &organization.ID}).Error)
+
+	s.project = &models.Project{ID: uuid.New(), Code: "P-QG", Name: "质量门禁", Category: "module", LeaderID: &s.leaderID, TechLeaderID: &s.techLeaderID}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+
+	s.gates = NewQualityGateService(s.db)
+	s.approvals = NewApprovalService(s.db)
+	s.activities = NewActivityService(s.db)
+	s.workflow, err = NewStateMachineService(s.db).CreateWorkflow(s.project.ID.String(), "", "模块开发", "", s.leaderID.String())
+	require.NoError(s.T(), err)
+
+	// 方案设计（已完成）→ DCP1
+	assignee := s.assigneeID.String()
+	s.design = &models.Activity{WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: "方案设计", Status: models.ActivityStatusCompleted, AssigneeID: &assignee}
+	require.NoError(s.T(), s.db.Create(s.design).Error)
+	s.dcp = &models.Activity{WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: "DCP1", Type: models.ActivityTypeDCP, Status: models.ActivityStatusRunning, AssigneeID: &assignee}
+	require.NoError(s.T(), s.db.Create(s.dcp).Error)
+	_, err = s.activities.AddDependency(s.dcp.ID, s.design.ID, "", 0)
+	require.NoError(s.T(), err)
+}
+
+func TestQualityGateSuite(t *testing.T) {
+	suite.Run(t, new(QualityGateTestSuite))
+}
+
+// createGate 为决策点创建默认检查项的质量门禁
+func (s *QualityGateTestSuite) createGate() *models.QualityGate {
+	gate, err := s.gates.CreateGate(s.dcp.ID, s.leaderID.String(), &models.CreateQualityGateRequest{Name: "DCP1质量门禁"})
+	require.NoError(s.T(), err)
+	return gate
+}
+
+// status 读取决策点当前状态
+func (s *QualityGateTestSuite) status() models.ActivityStatus {
+	var current models.Activity
+	require.NoError(s.T(), s.db.First(&current, "id = ?", s.dcp.ID).Error)
+	return current.Status
+}
+
+// failChecks 制造全部默认检查项不通过的项目数据，返回需要处理的记录
+func (s *QualityGateTestSuite) failChecks() (*models.Requirement, *models.Feedback, *models.Defect, *models.Deliverable) {
+	projectID := s.project.ID.String()
+	require.NoError(s.T(), s.db.Create(&models.Requirement{ProjectID: projectID, Title: "工作频段", Type: models.RequirementTypeFunctional, Status: models.RequirementStatusApproved}).Error)
+	draft := &models.Requirement{ProjectID: projectID, Title: "功耗", Type: models.RequirementTypeNonFunctional, Status: models.RequirementStatusDraft}
+	require.NoError(s.T(), s.db.Create(draft).Error)
+	// 被拒绝的需求不计入比例
+	require.NoError(s.T(), s.db.Create(&models.Requirement{ProjectID: projectID, Title: "重量", Type: models.RequirementTypeNonFunctional, Status: models.RequirementStatusRejected}).Error)
+
+	review := &models.Review{ActivityID: s.design.ID, ProjectID: projectID, Type: models.ReviewTypeDCP, Status: models.ReviewStatusApproved, CreatedBy: s.leaderID.String()}
+	require.NoError(s.T(), s.db.Create(review).Error)
+	feedback := &models.Feedback{ReviewID: review.ID, Content: "散热方案需补充仿真", AuthorID: s.techLeaderID.String()}
+	require.NoError(s.T(), s.db.Create(feedback).Error)
+
+	defect := &models.Defect{ProjectID: projectID, Title: "功放自激", Severity: models.DefectSeverityCritical, Status: models.DefectStatusInProgress}
+	require.NoError(s.T(), s.db.Create(defect).Error)
+	require.NoError(s.T(), s.db.Create(&models.Defect{ProjectID: projectID, Title: "丝印错误", Severity: models.DefectSeverityLow}).Error)
+
+	deliverable := &models.Deliverable{ActivityID: s.design.ID, Name: "设计报告", Type: "document", Status: "draft"}
+	require.NoError(s.T(), s.db.Create(deliverable).Error)
+	return draft, feedback, defect, deliverable
+}
+
+// TestSubmit_FailedGateBlocksAndIsRecorded 测试未通过的质量门禁阻止决策点提交并记录结果
+func (s *QualityGateTestSuite) TestSubmit_FailedGateBlocksAndIsRecorded() {
+	gate := s.createGate()
+	draft, feedback, defect, deliverable := s.failChecks()
+
+	_, err := s.approvals.SubmitForApproval(s.dcp.ID, s.assigneeID.String(), "")
+	require.ErrorIs(s.T(), err, ErrQualityGateFailed)
+	var gateErr *QualityGateError
+	require.ErrorAs(s.T(), err, &gateErr)
+	require.Len(s.T(), gateErr.Results, 1)
+	checks := gateErr.Results[0].Checks
+	require.Len(s.T(), checks, 4)
+	for _, check := range checks {
+		assert.False(s.T(), check.Passed, check.Type)
+	}
+	assert.InDelta(s.T(), 0.5, checks[0].Actual, 0.001)
+	assert.Equal(s.T(), models.ActivityStatusRunning, s.status())
+
+	// 直接流转同样受质量门禁守卫约束
+	_, err = s.activities.TransitionActivity(s.dcp.ID, models.ActivityStatusReviewing, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrTransitionGuardFailed)
+	assert.Contains(s.T(), err.Error(), string(models.ActivityGuardQualityGates))
+
+	now := time.Now()
+	require.NoError(s.T(), s.db.Model(draft).Update("status", models.RequirementStatusApproved).Error)
+	require.NoError(s.T(), s.db.Model(feedback).Update("closed_at", now).Error)
+	require.NoError(s.T(), s.db.Model(defect).Update("status", models.DefectStatusClosed).Error)
+	require.NoError(s.T(), s.db.Model(deliverable).Updates(map[string]interface{}{"status": "submitted", "submitted_at": now}).Error)
+
+	_, err = s.approvals.SubmitForApproval(s.dcp.ID, s.assigneeID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ActivityStatusReviewing, s.status())
+
+	gates, err := s.gates.ListGates(s.dcp.ID)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), gates, 1)
+	require.Len(s.T(), gates[0].Results, 2)
+	assert.Equal(s.T(), gate.ID, gates[0].Results[0].GateID)
+	assert.Equal(s.T(), models.QualityGatePassed, gates[0].Results[0].Status)
+	assert.Equal(s.T(), models.QualityGateFailed, gates[0].Results[1].Status)
+	assert.Equal(s.T(), s.assigneeID.String(), gates[0].Results[1].EvaluatedBy)
+}
+
+// TestWaiver_NeedsDeptLeaderApproval 测试未通过的质量门禁经部门负责人批准豁免后可提交
+func (s *QualityGateTestSuite) TestWaiver_NeedsDeptLeaderApproval() {
+	gate := s.createGate()
+	s.failChecks()
+
+	_, err := s.gates.RequestWaiver(gate.ID, s.assigneeID.String(), "尚未评估")
+	assert.ErrorIs(s.T(), err, ErrWaiverNotRequired)
+
+	results, err := s.gates.EvaluateActivity(s.dcp.ID, s.assigneeID.String())
+	require.NoError(s.T(), err)
+	require.Len(s.T(), results, 1)
+	assert.True(s.T(), results[0].Blocks())
+
+	_, err = s.gates.RequestWaiver(gate.ID, uuid.NewString(), "进度紧张")
+	assert.ErrorIs(s.T(), err, ErrWaiverNotPermitted)
+	waiver, err := s.gates.RequestWaiver(gate.ID, s.assigneeID.String(), "缺陷已有规避措施")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), s.deptLeaderID.String(), waiver.ApproverID)
+	assert.Equal(s.T(), results[0].ID, waiver.ResultID)
+	_, err = s.gates.RequestWaiver(gate.ID, s.assigneeID.String(), "再次申请")
+	assert.ErrorIs(s.T(), err, ErrWaiverAlreadyPending)
+
+	pending, err := s.gates.ListPendingWaivers(s.deptLeaderID.String())
+	require.NoError(s.T(), err)
+	require.Len(s.T(), pending, 1)
+
+	// 只有部门负责人可以批准豁免
+	_, err = s.gates.ApproveWaiver(waiver.ID, s.leaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrNotApprover)
+	_, err = s.approvals.SubmitForApproval(s.dcp.ID, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrQualityGateFailed)
+
+	decided, err := s.gates.ApproveWaiver(waiver.ID, s.deptLeaderID.String(), "同意带风险评审")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ApprovalStatusApproved, decided.Status)
+	_, err = s.gates.ApproveWaiver(waiver.ID, s.deptLeaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrWaiverNotPending)
+
+	var waived models.QualityGateResult
+	require.NoError(s.T(), s.db.First(&waived, "id = ?", results[0].ID).Error)
+	assert.Equal(s.T(), models.QualityGateWaived, waived.Status)
+
+	_, err = s.approvals.SubmitForApproval(s.dcp.ID, s.assigneeID.String(), "")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ActivityStatusReviewing, s.status())
+
+	var kinds []string
+	require.NoError(s.T(), s.db.Model(&models.Notification{}).Where("user_id = ?", s.assigneeID).Pluck("type", &kinds).Error)
+	assert.Contains(s.T(), kinds, NotificationWaiverDecided)
+}
+
+// TestWaiver_RejectNeedsComment 测试驳回豁免需填写意见且门禁仍然阻止提交
+func (s *QualityGateTestSuite) TestWaiver_RejectNeedsComment() {
+	gate := s.createGate()
+	s.failChecks()
+	_, err := s.gates.EvaluateActivity(s.dcp.ID, s.assigneeID.String())
+	require.NoError(s.T(), err)
+	waiver, err := s.gates.RequestWaiver(gate.ID, s.assigneeID.String(), "进度紧张")
+	require.NoError(s.T(), err)
+
+	_, err = s.gates.RejectWaiver(waiver.ID, s.deptLeaderID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrApprovalCommentRequired)
+	decided, err := s.gates.RejectWaiver(waiver.ID, s.deptLeaderID.String(), "关键缺陷须先关闭")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.ApprovalStatusRejected, decided.Status)
+
+	_, err = s.approvals.SubmitForApproval(s.dcp.ID, s.assigneeID.String(), "")
+	assert.ErrorIs(s.T(), err, ErrQualityGateFailed)
+	// 驳回后可重新申请
+	_, err = s.gates.RequestWaiver(gate.ID, s.assigneeID.String(), "已制定规避措施")
+	assert.NoError(s.T(), err)
+}
+
+// TestCreateGate_PluggableChecks 测试检查项校验及自定义检查项注册
+func (s *QualityGateTestSuite) TestCreateGate_PluggableChecks() {
+	_, err := s.gates.CreateGate(s.design.ID, s.leaderID.String(), &models.CreateQualityGateRequest{Name: "无效"})
+	assert.ErrorIs(s.T(), err, ErrQualityGateNotDCP)
+
+	custom := models.QualityCheck{Type: "test_coverage", Threshold: 0.8}
+	req := &models.CreateQualityGateRequest{Name: "覆盖率", Checks: []models.QualityCheck{custom}}
+	_, err = s.gates.CreateGate(s.dcp.ID, s.leaderID.String(), req)
+	assert.ErrorIs(s.T(), err, ErrInvalidQualityCheck)
+
+	coverage := 0.6
+	unregister := RegisterQualityCheck("test_coverage", QualityCheckFunc(func(db *gorm.DB, activity *models.Activity, check models.QualityCheck) (*models.QualityCheckResult, error) {
+		return &models.QualityCheckResult{Passed: coverage >= check.Threshold, Actual: coverage}, nil
+	}))
+	defer unregister()
+
+	_, err = s.gates.CreateGate(s.dcp.ID, s.leaderID.String(), req)
+	require.NoError(s.T(), err)
+	results, err := s.gates.EvaluateActivity(s.dcp.ID, s.leaderID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.QualityGateFailed, results[0].Status)
+	assert.Equal(s.T(), "test_coverage", results[0].Checks[0].Type)
+
+	coverage = 0.85
+	results, err = s.gates.EvaluateActivity(s.dcp.ID, s.leaderID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), models.QualityGatePassed, results[0].Status)
+
+	// 指定名称的交付物在工作流内任一活动提交即可
+	named := models.QualityCheck{Type: models.QualityCheckRequiredDeliverables, Deliverables: []string{"测试大纲"}}
+	gate, err := s.gates.CreateGate(s.dcp.ID, s.leaderID.String(), &models.CreateQualityGateRequest{Name: "交付物", Checks: []models.QualityCheck{named}})
+	require.NoError(s.T(), err)
+	passed, err := qualityGatesPassed(s.db, s.dcp)
+	require.NoError(s.T(), err)
+	assert.False(s.T(), passed)
+	now := time.Now()
+	require.NoError(s.T(), s.db.Create(&models.Deliverable{ActivityID: s.design.ID, Name: "测试大纲", Status: "submitted", SubmittedAt: &now}).Error)
+	passed, err = qualityGatesPassed(s.db, s.dcp)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), passed, gate.Name)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"gorm.io/gorm"
+)
+
+// revocationSyncOverlap re-reads entries written shortly before the last
+// sync so clock skew between API instances cannot hide a revocation
+const revocationSyncOverlap = time.Minute
+
+// revocationCache keeps revoked JTIs and family IDs in memory so token
+// validation does not query Postgres on every request. Revocations made by
+// this process are visible immediately; those made by other instances are
+// picked up on the next incremental sync.
+type revocationCache struct {
+	db           *gorm.DB
+	syncInterval time.Duration
+
+	mu       sync.RWMutex
+	entries  map[string]time.Time // revoked id -> token expiry
+	syncedAt time.Time
+}
+
+// newRevocationCache creates an empty cache; the first lookup loads it
+func newRevocationCache(db *gorm.DB, syncInterval time.Duration) *revocationCache {
+	return &revocationCache{
+		db:           db,
+		syncInterval: syncInterval,
+		entries:      make(map[string]time.Time),
+	}
+}
+
+// add records a revocation made by this process
+func (c *revocationCache) add(id string, expiresAt time.Time) {
+	c.mu.Lock()
+	c.entries[id] = expiresAt
+	c.mu.Unlock()
+}
+
+// contains reports whether any of the given ids has been revoked
+func (c *revocationCache) contains(ctx context.Context, ids ...string) (bool, error) {
+	if err := c.syncIfStale(ctx); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if expiresAt, ok := c.entries[id]; ok && expiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// syncIfStale reloads blacklist entries created since the last sync and
+// drops entries whose tokens have expired anyway
+func (c *revocationCache) syncIfStale(ctx context.Context) error {
+	c.mu.RLock()
+	fresh := !c.syncedAt.IsZero() && time.Since(c.syncedAt) < c.syncInterval
+	c.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.syncedAt.IsZero() && time.Since(c.syncedAt) < c.syncInterval {
+		return nil
+	}
+
+	now := time.Now()
+	query := c.db.WithContext(ctx).Model(&models.TokenBlacklist{}).Where("expires_at > ?", now)
+	if !c.syncedAt.IsZero() {
+		query = query.Where("created_at >= ?", c.syncedAt.Add(-revocationSyncOverlap))
+	}
+
+	var rows []models.TokenBlacklist
+	if err := query.Select("jti", "expires_at").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for id, expiresAt := range c.entries {
+		if !expiresAt.After(now) {
+			delete(c.entries, id)
+		}
+	}
+	for _, row := range rows {
+		c.entries[row.JTI] = row.ExpiresAt
+	}
+	c.syncedAt = now
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetProjectSchedule runs the critical path method over the project's
+// activities and their dependency links. The schedule starts at the
+// project start date, or the earliest activity date when it has none.
+func (s *ProjectService) GetProjectSchedule(ctx context.Context, projectID string) (*models.ProjectSchedule, error) {
+	projectUID, err := uuid.Parse(projectID)
+	if err != nil {
+		return nil, errors.New("invalid project ID")
+	}
+	db := s.db.WithContext(ctx)
+
+	var project models.Project
+	if err := db.First(&project, "id = ?", projectUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("project not found")
+		}
+		return nil, err
+	}
+
+	activities, dependencies, err := projectNetwork(db, project.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := computeSchedule(scheduleStart(&project, activities), activities, dependencies)
+	if err != nil {
+		return nil, err
+	}
+	schedule.ProjectID = project.ID.String()
+	if project.EndDate != nil {
+		schedule.PlannedFinish = project.EndDate
+		schedule.Delay = max(0, daysBetween(*project.EndDate, schedule.Finish))
+	}
+	return schedule, nil
+}
+
+// projectNetwork returns a project's activities and the dependency links
+// between them
+func projectNetwork(db *gorm.DB, projectID string) ([]models.Activity, []models.Dependency, error) {
+	var activities []models.Activity
+	if err := db.Where("project_id = ?", projectID).Order("sequence ASC, created_at ASC").Find(&activities).Error; err != nil {
+		return nil, nil, err
+	}
+	var dependencies []models.Dependency
+	if err := db.Where("activity_id IN (?)", db.Model(&models.Activity{}).Select("id").Where("project_id = ?", projectID)).
+		Order("id ASC").
+		Find(&dependencies).Error; err != nil {
+		return nil, nil, err
+	}
+	return activities, dependencies, nil
+}
+
+// scheduleStart returns the day a project's schedule counts from
+func scheduleStart(project *models.Project, activities []models.Activity) time.Time {
+	if project.StartDate != nil {
+		return truncateDay(*project.StartDate)
+	}
+	var start *time.Time
+	for i := range activities {
+		for _, date := range []*time.Time{activities[i].PlannedStart, activities[i].ActualStart} {
+			if date != nil && (start == nil || date.Before(*start)) {
+				start = date
+			}
+		}
+	}
+	if start == nil {
+		return truncateDay(time.Now())
+	}
+	return truncateDay(*start)
+}
+
+// computeSchedule makes the forward pass for early dates and the backward
+// pass for late dates. Activities already started keep their actual start;
+// those without predecessors start on their planned start.
+func computeSchedule(start time.Time, activities []models.Activity, dependencies []models.Dependency) (*models.ProjectSchedule, error) {
+	ids := make([]string, len(activities))
+	index := make(map[string]int, len(activities))
+	for i := range activities {
+		ids[i] = activities[i].ID
+		index[activities[i].ID] = i
+	}
+	links := networkLinks(index, dependencies)
+	order, cycle := topologicalOrder(ids, links)
+	if cycle != nil {
+		return nil, &DependencyCycleError{Path: cycle}
+	}
+	predecessors := make(map[string][]models.Dependency)
+	successors := make(map[string][]models.Dependency)
+	for _, link := range links {
+		predecessors[link.ActivityID] = append(predecessors[link.ActivityID], link)
+		successors[link.DependsOnID] = append(successors[link.DependsOnID], link)
+	}
+
+	entries := make([]models.ActivitySchedule, len(activities))
+	for i := range activities {
+		entries[i] = models.ActivitySchedule{
+			ActivityID: activities[i].ID,
+			Name:       activities[i].Name,
+			Status:     activities[i].Status,
+			Duration:   activityDuration(&activities[i]),
+		}
+	}
+
+	// Forward pass
+	finish := 0
+	for _, id := range order {
+		activity, entry := &activities[index[id]], &entries[index[id]]
+		switch {
+		case activity.ActualStart != nil:
+			entry.EarlyStart = daysBetween(start, *activity.ActualStart)
+		case len(predecessors[id]) == 0 && activity.PlannedStart != nil:
+			entry.EarlyStart = daysBetween(start, *activity.PlannedStart)
+		default:
+			for k, link := range predecessors[id] {
+				pred := &entries[index[link.DependsOnID]]
+				earliest := linkStart(link.DependencyType, link.Lag, pred.EarlyStart, pred.EarlyFinish, entry.Duration)
+				if k == 0 || earliest > entry.EarlyStart {
+					entry.EarlyStart = earliest
+				}
+			}
+		}
+		entry.EarlyFinish = entry.EarlyStart + entry.Duration
+		finish = max(finish, entry.EarlyFinish)
+	}
+
+	// Backward pass
+	for k := len(order) - 1; k >= 0; k-- {
+		id := order[k]
+		entry := &entries[index[id]]
+		entry.LateFinish = finish
+		free := finish - entry.EarlyFinish
+		for _, link := range successors[id] {
+			succ := &entries[index[link.ActivityID]]
+			entry.LateFinish = min(entry.LateFinish, linkFinish(link.DependencyType, link.Lag, succ.LateStart, succ.LateFinish, entry.Duration))
+			free = min(free, linkFinish(link.DependencyType, link.Lag, succ.EarlyStart, succ.EarlyFinish, entry.Duration)-entry.EarlyFinish)
+		}
+		entry.LateStart = entry.LateFinish - entry.Duration
+		entry.TotalFloat = entry.LateStart - entry.EarlyStart
+		entry.FreeFloat = min(free, entry.TotalFloat)
+		entry.Critical = entry.TotalFloat <= 0
+	}
+
+	schedule := &models.ProjectSchedule{
+		Start:        start,
+		Finish:       start.AddDate(0, 0, finish),
+		Duration:     finish,
+		Activities:   make([]models.ActivitySchedule, 0, len(order)),
+		CriticalPath: []string{},
+	}
+	for _, id := range order {
+		entry := entries[index[id]]
+		entry.EarlyStartDate = start.AddDate(0, 0, entry.EarlyStart)
+		entry.EarlyFinishDate = start.AddDate(0, 0, entry.EarlyFinish)
+		entry.LateStartDate = start.AddDate(0, 0, entry.LateStart)
+		entry.LateFinishDate = start.AddDate(0, 0, entry.LateFinish)
+		schedule.Activities = append(schedule.Activities, entry)
+		if entry.Critical {
+			schedule.CriticalPath = append(schedule.CriticalPath, id)
+		}
+	}
+	return schedule, nil
+}
+
+// networkLinks keeps the dependency links between indexed activities;
+// links to activities of other projects play no part
+func networkLinks(index map[string]int, dependencies []models.Dependency) []models.Dependency {
+	links := make([]models.Dependency, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		_, from := index[dependency.DependsOnID]
+		_, to := index[dependency.ActivityID]
+		if from && to {
+			links = append(links, dependency)
+		}
+	}
+	return links
+}
+
+// linkFinish returns the latest finish, in days, that a dependency link
+// allows a predecessor of the given duration. It is the inverse of
+// linkStart.
+func linkFinish(linkType string, lag, succStart, succEnd, duration int) int {
+	switch linkType {
+	case models.DependencyStartToStart:
+		return succStart - lag + duration
+	case models.DependencyFinishToFinish:
+		return succEnd - lag
+	case models.DependencyStartToFinish:
+		return succEnd - lag + duration
+	default:
+		return succStart - lag
+	}
+}
+
+// activityDuration returns an activity's length in days: the actual one
+// once finished, else the planned one. Skipped activities take no time.
+func activityDuration(activity *models.Activity) int {
+	if activity.Status == models.ActivityStatusSkipped {
+		return 0
+	}
+	if activity.ActualStart != nil && activity.ActualEnd != nil {
+		return max(0, daysBetween(*activity.ActualStart, *activity.ActualEnd))
+	}
+	if activity.PlannedStart != nil && activity.PlannedEnd != nil {
+		return max(0, daysBetween(*activity.PlannedStart, *activity.PlannedEnd))
+	}
+	return 0
+}
+
+// daysBetween returns the number of calendar days from one date to another
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(truncateDay(to).Sub(truncateDay(from)).Hours() / 24))
+}
+
+// truncateDay returns the start of the day in UTC
+func truncateDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
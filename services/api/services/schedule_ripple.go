@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rescheduling errors
+var (
+	ErrInvalidSchedule = errors.New("invalid activity schedule")
+	ErrScheduleLocked  = errors.New("finished activities cannot be rescheduled")
+)
+
+// Notification types raised by rescheduling
+const (
+	NotificationActivityRescheduled = "activity_rescheduled"
+	NotificationScheduleOverrun     = "project_schedule_overrun"
+)
+
+// RescheduleActivity moves an activity's planned dates and ripples the
+// change through its successors. A nil date keeps its current value. With
+// preview set nothing is saved and the proposed changes are returned.
+func (s *ProjectService) RescheduleActivity(ctx context.Context, projectID, activityID string, start, end *time.Time, userID string, preview bool) (*models.ScheduleRipple, error) {
+	var ripple *models.ScheduleRipple
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var activity models.Activity
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&activity, "id = ? AND project_id = ?", activityID, projectID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrActivityNotFound
+			}
+			return err
+		}
+		if err := checkActivityEditable(tx, activity.ID); err != nil {
+			return err
+		}
+
+		var err error
+		ripple, err = planRipple(tx, &activity, start, end)
+		if err != nil {
+			return err
+		}
+		ripple.Preview = preview
+		if preview {
+			return nil
+		}
+		return applyRipple(tx, ripple, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ripple, nil
+}
+
+// rescheduleActivity moves an activity's planned dates and its successors
+// inside a transaction
+func rescheduleActivity(tx *gorm.DB, activity *models.Activity, start, end *time.Time, userID string) (*models.ScheduleRipple, error) {
+	ripple, err := planRipple(tx, activity, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRipple(tx, ripple, userID); err != nil {
+		return nil, err
+	}
+	return ripple, nil
+}
+
+// planRipple works out the dates of the activity and its successors
+// without saving them
+func planRipple(tx *gorm.DB, activity *models.Activity, start, end *time.Time) (*models.ScheduleRipple, error) {
+	if scheduleLocked(activity) {
+		return nil, ErrScheduleLocked
+	}
+	if start == nil {
+		start = activity.PlannedStart
+	}
+	if end == nil {
+		end = activity.PlannedEnd
+	}
+	if start == nil || end == nil {
+		return nil, fmt.Errorf("%w: planned start and end are both required", ErrInvalidSchedule)
+	}
+	if truncateDay(*end).Before(truncateDay(*start)) {
+		return nil, fmt.Errorf("%w: planned end is before planned start", ErrInvalidSchedule)
+	}
+
+	calendar, err := projectCalendar(tx, activity.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	activities, dependencies, err := projectNetwork(tx, activity.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	var project models.Project
+	if err := tx.Select("id", "end_date").Where("id = ?", activity.ProjectID).Limit(1).Find(&project).Error; err != nil {
+		return nil, err
+	}
+
+	ripple, err := rippleSchedule(calendar, activities, dependencies, activity.ID, truncateDay(*start), truncateDay(*end))
+	if err != nil {
+		return nil, err
+	}
+	ripple.ProjectID = activity.ProjectID
+	if project.EndDate != nil {
+		ripple.PlannedFinish = project.EndDate
+		ripple.Delay = max(0, daysBetween(*project.EndDate, ripple.ProjectFinish))
+		ripple.ExceedsPlannedFinish = ripple.Delay > 0
+	}
+	return ripple, nil
+}
+
+// parseScheduleDate reads a planned date given as a time or as an RFC 3339
+// or YYYY-MM-DD string
+func parseScheduleDate(value interface{}) (*time.Time, error) {
+	switch date := value.(type) {
+	case time.Time:
+		return &date, nil
+	case *time.Time:
+		return date, nil
+	case string:
+		for _, layout := range []string{time.RFC3339, models.CalendarDateLayout} {
+			if parsed, err := time.Parse(layout, date); err == nil {
+				return &parsed, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %v is not a date", ErrInvalidSchedule, value)
+}
+
+// scheduleSpan is the planned start and end of an activity
+type scheduleSpan struct {
+	start, end time.Time
+}
+
+// rippleSchedule moves an activity to the given dates and walks its
+// successors in topological order. A successor is pushed out when a link
+// no longer holds, and pulled in when it was waiting on the moved date;
+// either way it keeps its length in working days. Finished successors are
+// never moved, so the ripple stops at them.
+func rippleSchedule(calendar *models.WorkCalendar, activities []models.Activity, dependencies []models.Dependency, activityID string, start, end time.Time) (*models.ScheduleRipple, error) {
+	ids := make([]string, len(activities))
+	index := make(map[string]int, len(activities))
+	for i := range activities {
+		ids[i] = activities[i].ID
+		index[activities[i].ID] = i
+	}
+	links := networkLinks(index, dependencies)
+	order, cycle := topologicalOrder(ids, links)
+	if cycle != nil {
+		return nil, &DependencyCycleError{Path: cycle}
+	}
+	predecessors := make(map[string][]models.Dependency)
+	for _, link := range links {
+		predecessors[link.ActivityID] = append(predecessors[link.ActivityID], link)
+	}
+
+	// Activities without planned dates take no part
+	before := make(map[string]scheduleSpan, len(activities))
+	for i := range activities {
+		if activities[i].PlannedStart != nil && activities[i].PlannedEnd != nil {
+			before[activities[i].ID] = scheduleSpan{truncateDay(*activities[i].PlannedStart), truncateDay(*activities[i].PlannedEnd)}
+		}
+	}
+	after := make(map[string]scheduleSpan, len(before))
+	for id, span := range before {
+		after[id] = span
+	}
+	after[activityID] = scheduleSpan{start, end}
+	moved := map[string]bool{activityID: true}
+
+	ripple := &models.ScheduleRipple{ActivityID: activityID, Changes: []models.ScheduleChange{}, Held: []string{}}
+	for _, id := range order {
+		old, scheduled := before[id]
+		if id == activityID || !scheduled || !linkMoved(predecessors[id], moved) {
+			continue
+		}
+		activity := &activities[index[id]]
+		duration := workdaysBetween(calendar, old.start, old.end)
+		needed, constrained := requiredStart(calendar, predecessors[id], after, duration)
+		previous, _ := requiredStart(calendar, predecessors[id], before, duration)
+		if !constrained {
+			continue
+		}
+
+		pushed := old.start.Before(needed)
+		pulled := old.start.Equal(previous) && needed.Before(previous)
+		if !pushed && !pulled {
+			continue
+		}
+		if scheduleLocked(activity) {
+			if pushed {
+				ripple.Held = append(ripple.Held, id)
+			}
+			continue
+		}
+		after[id] = scheduleSpan{needed, addWorkdays(calendar, needed, duration)}
+		moved[id] = true
+	}
+
+	for _, id := range order {
+		if !moved[id] {
+			continue
+		}
+		activity, span := &activities[index[id]], after[id]
+		if old, ok := before[id]; ok && old.start.Equal(span.start) && old.end.Equal(span.end) {
+			continue
+		}
+		ripple.Changes = append(ripple.Changes, models.ScheduleChange{
+			ActivityID: id,
+			Name:       activity.Name,
+			OldStart:   activity.PlannedStart,
+			OldEnd:     activity.PlannedEnd,
+			NewStart:   span.start,
+			NewEnd:     span.end,
+		})
+	}
+	ripple.PreviousFinish = latestEnd(before)
+	ripple.ProjectFinish = latestEnd(after)
+	return ripple, nil
+}
+
+// requiredStart returns the earliest start the links allow an activity of
+// the given length in working days. It is linkStart counted on the
+// working calendar. The flag is false when no predecessor is scheduled.
+func requiredStart(calendar *models.WorkCalendar, links []models.Dependency, dates map[string]scheduleSpan, duration int) (time.Time, bool) {
+	var start time.Time
+	constrained := false
+	for _, link := range links {
+		pred, ok := dates[link.DependsOnID]
+		if !ok {
+			continue
+		}
+		var earliest time.Time
+		switch link.DependencyType {
+		case models.DependencyStartToStart:
+			earliest = addWorkdays(calendar, pred.start, link.Lag)
+		case models.DependencyFinishToFinish:
+			earliest = addWorkdays(calendar, addWorkdays(calendar, pred.end, link.Lag), -duration)
+		case models.DependencyStartToFinish:
+			earliest = addWorkdays(calendar, addWorkdays(calendar, pred.start, link.Lag), -duration)
+		default:
+			earliest = addWorkdays(calendar, pred.end, link.Lag)
+		}
+		if !constrained || earliest.After(start) {
+			start = earliest
+		}
+		constrained = true
+	}
+	return start, constrained
+}
+
+// linkMoved checks if any predecessor of the links has moved
+func linkMoved(links []models.Dependency, moved map[string]bool) bool {
+	for _, link := range links {
+		if moved[link.DependsOnID] {
+			return true
+		}
+	}
+	return false
+}
+
+// latestEnd returns the latest planned end
+func latestEnd(dates map[string]scheduleSpan) time.Time {
+	var finish time.Time
+	for _, span := range dates {
+		if span.end.After(finish) {
+			finish = span.end
+		}
+	}
+	return finish
+}
+
+// scheduleLocked reports whether an activity's work is done, so its dates
+// stay as they are
+func scheduleLocked(activity *models.Activity) bool {
+	return activityFinished(activity) || activity.Status == models.ActivityStatusReviewing
+}
+
+// applyRipple saves the planned dates of a ripple. Owners of the moved
+// successors are notified, and the project leader when the change pushes
+// the project finish past its end date.
+func applyRipple(tx *gorm.DB, ripple *models.ScheduleRipple, userID string) error {
+	for _, change := range ripple.Changes {
+		if err := tx.Model(&models.Activity{}).Where("id = ?", change.ActivityID).Updates(map[string]interface{}{
+			"planned_start": change.NewStart,
+			"planned_end":   change.NewEnd,
+		}).Error; err != nil {
+			return err
+		}
+		if change.ActivityID == ripple.ActivityID {
+			continue
+		}
+		var successor models.Activity
+		if err := tx.First(&successor, "id = ?", change.ActivityID).Error; err != nil {
+			return err
+		}
+		title := fmt.Sprintf("活动「%s」随前置活动调整为 %s 至 %s", successor.Name,
+			change.NewStart.Format(models.CalendarDateLayout), change.NewEnd.Format(models.CalendarDateLayout))
+		if err := notifyActivityOwner(tx, &successor, NotificationActivityRescheduled, title); err != nil {
+			return err
+		}
+	}
+
+	if !ripple.ExceedsPlannedFinish || !ripple.ProjectFinish.After(ripple.PreviousFinish) {
+		return nil
+	}
+	var project models.Project
+	if err := tx.Select("id", "name", "leader_id").Where("id = ?", ripple.ProjectID).Limit(1).Find(&project).Error; err != nil {
+		return err
+	}
+	if project.LeaderID == nil || project.LeaderID.String() == userID {
+		return nil
+	}
+	title := fmt.Sprintf("项目「%s」计划完成日期 %s 超出计划结束日期 %d 天", project.Name,
+		ripple.ProjectFinish.Format(models.CalendarDateLayout), ripple.Delay)
+	return notifyUser(tx, project.LeaderID.String(), NotificationScheduleOverrun, title, "project", ripple.ProjectID)
+}
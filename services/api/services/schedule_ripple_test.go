@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ScheduleRippleTestSuite 计划调整联动测试套件
+type ScheduleRippleTestSuite struct {
+	suite.Suite
+	db         *gorm.DB
+	projects   *ProjectService
+	activities *ActivityService
+	project    *models.Project
+	workflow   *models.Workflow
+	leaderID   uuid.UUID
+	ctx        context.Context
+}
+
+func (s *ScheduleRippleTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:schedule_ripple?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.Project{}, &models.Notification{}, &models.Workflow{}, &models.Activity{}, &models.Dependency{},
+		&models.ActivityTransition{}, &models.Approval{}, &models.WorkCalendar{},
+	))
+	for _, table := range []string{"projects", "notifications", "workflows", "activities", "activity_dependencies", "activity_transitions", "approvals", "work_calendars"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	// 2025-03-03 为周一
+	start := date(3, 3)
+	end := date(3, 18)
+	s.leaderID = uuid.New()
+	s.project = &models.Project{ID: uuid.New(), Code: "P-RIPPLE", Name: "计划联动", Category: "module", StartDate: &start, EndDate: &end, LeaderID: &s.leaderID}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+
+	s.projects = NewProjectService(s.db)
+	s.activities = NewActivityService(s.db)
+	s.ctx = context.Background()
+	s.workflow, err = NewStateMachineService(s.db).CreateWorkflow(s.project.ID.String(), "", "模块开发", "", "")
+	require.NoError(s.T(), err)
+}
+
+func TestScheduleRippleSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleRippleTestSuite))
+}
+
+// date 返回2025年的某一天
+func date(month time.Month, day int) time.Time {
+	return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// createActivity 创建计划于start开始、end结束的活动
+func (s *ScheduleRippleTestSuite) createActivity(name string, start, end time.Time, status models.ActivityStatus) *models.Activity {
+	activity := &models.Activity{
+		WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: name, Status: status,
+		PlannedStart: &start, PlannedEnd: &end,
+	}
+	require.NoError(s.T(), s.db.Create(activity).Error)
+	return activity
+}
+
+// link 添加依赖关系
+func (s *ScheduleRippleTestSuite) link(activity, dependsOn *models.Activity, depType string, lag int) {
+	_, err := s.activities.AddDependency(activity.ID, dependsOn.ID, depType, lag)
+	require.NoError(s.T(), err)
+}
+
+// assertDates 断言活动当前的计划日期
+func (s *ScheduleRippleTestSuite) assertDates(activity *models.Activity, start, end time.Time) {
+	var reloaded models.Activity
+	require.NoError(s.T(), s.db.First(&reloaded, "id = ?", activity.ID).Error)
+	assert.True(s.T(), start.Equal(*reloaded.PlannedStart), "%s starts %s", activity.Name, reloaded.PlannedStart)
+	assert.True(s.T(), end.Equal(*reloaded.PlannedEnd), "%s ends %s", activity.Name, reloaded.PlannedEnd)
+}
+
+// countNotifications 统计某类通知数量
+func (s *ScheduleRippleTestSuite) countNotifications(kind string) int64 {
+	var count int64
+	s.db.Model(&models.Notification{}).Where("type = ?", kind).Count(&count)
+	return count
+}
+
+// TestUpdateActivity_RipplesSuccessors 测试修改结束日期后按依赖类型顺延后续活动，已完成活动保持不动
+func (s *ScheduleRippleTestSuite) TestUpdateActivity_RipplesSuccessors() {
+	design := s.createActivity("方案设计", date(3, 3), date(3, 10), models.ActivityStatusRunning)
+	hardware := s.createActivity("硬件设计", date(3, 10), date(3, 17), models.ActivityStatusPending)
+	software := s.createActivity("软件设计", date(3, 5), date(3, 7), models.ActivityStatusPending)
+	docs := s.createActivity("技术文档", date(3, 14), date(3, 17), models.ActivityStatusPending)
+	review := s.createActivity("内部评审", date(3, 17), date(3, 18), models.ActivityStatusCompleted)
+	s.link(hardware, design, "", 0)
+	s.link(software, design, models.DependencyStartToStart, 2)
+	s.link(docs, hardware, models.DependencyFinishToFinish, 0)
+	s.link(review, hardware, "", 0)
+
+	_, err := s.projects.UpdateActivity(s.ctx, design.ID, map[string]interface{}{"planned_end": "2025-03-12"}, "")
+	require.NoError(s.T(), err)
+
+	s.assertDates(design, date(3, 3), date(3, 12))
+	// 完成-开始：顺延两个工作日，保持5个工作日工期
+	s.assertDates(hardware, date(3, 12), date(3, 19))
+	// 开始-开始：前置活动开始日期未变
+	s.assertDates(software, date(3, 5), date(3, 7))
+	// 完成-完成：随硬件设计同日完成
+	s.assertDates(docs, date(3, 18), date(3, 19))
+	// 已完成活动不调整
+	s.assertDates(review, date(3, 17), date(3, 18))
+
+	assert.Equal(s.T(), int64(2), s.countNotifications(NotificationActivityRescheduled))
+	// 项目完成日期超出计划结束日期，提醒项目负责人
+	var overrun models.Notification
+	require.NoError(s.T(), s.db.First(&overrun, "type = ?", NotificationScheduleOverrun).Error)
+	assert.Equal(s.T(), s.leaderID, overrun.UserID)
+}
+
+// TestRescheduleActivity_PreviewAndPullIn 测试预览不保存，提前完成时紧后活动随之提前
+func (s *ScheduleRippleTestSuite) TestRescheduleActivity_PreviewAndPullIn() {
+	design := s.createActivity("方案设计", date(3, 3), date(3, 10), models.ActivityStatusRunning)
+	hardware := s.createActivity("硬件设计", date(3, 10), date(3, 17), models.ActivityStatusPending)
+	manual := s.createActivity("用户手册", date(3, 17), date(3, 18), models.ActivityStatusPending)
+	s.link(hardware, design, "", 0)
+	// 用户手册原计划留有余量，不随之提前
+	s.link(manual, design, "", 0)
+
+	end := date(3, 13)
+	ripple, err := s.projects.RescheduleActivity(s.ctx, s.project.ID.String(), design.ID, nil, &end, "", true)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), ripple.Preview)
+	require.Len(s.T(), ripple.Changes, 2)
+	assert.Equal(s.T(), hardware.ID, ripple.Changes[1].ActivityID)
+	assert.True(s.T(), date(3, 20).Equal(ripple.Changes[1].NewEnd))
+	assert.True(s.T(), ripple.ExceedsPlannedFinish)
+	assert.Equal(s.T(), 2, ripple.Delay)
+	// 预览不保存、不通知
+	s.assertDates(hardware, date(3, 10), date(3, 17))
+	assert.Zero(s.T(), s.countNotifications(NotificationActivityRescheduled))
+
+	end = date(3, 7)
+	ripple, err = s.projects.RescheduleActivity(s.ctx, s.project.ID.String(), design.ID, nil, &end, "", false)
+	require.NoError(s.T(), err)
+	assert.False(s.T(), ripple.Preview)
+	assert.False(s.T(), ripple.ExceedsPlannedFinish)
+	s.assertDates(hardware, date(3, 7), date(3, 14))
+	s.assertDates(manual, date(3, 17), date(3, 18))
+	assert.Zero(s.T(), s.countNotifications(NotificationScheduleOverrun))
+}
+
+// TestRescheduleActivity_WorkingCalendar 测试按项目工作日历计算搭接时间与工期
+func (s *ScheduleRippleTestSuite) TestRescheduleActivity_WorkingCalendar() {
+	_, err := s.projects.UpdateWorkCalendar(s.ctx, s.project.ID.String(), &models.UpdateWorkCalendarRequest{
+		Weekdays: models.DefaultWorkingWeekdays, Holidays: []string{"2025-03-12"}, Workdays: []string{"2025-03-15"},
+	}, "")
+	require.NoError(s.T(), err)
+
+	design := s.createActivity("方案设计", date(3, 3), date(3, 10), models.ActivityStatusRunning)
+	hardware := s.createActivity("硬件设计", date(3, 11), date(3, 19), models.ActivityStatusPending)
+	s.link(hardware, design, "", 1)
+
+	end := date(3, 11)
+	_, err = s.projects.RescheduleActivity(s.ctx, s.project.ID.String(), design.ID, nil, &end, "", false)
+	require.NoError(s.T(), err)
+	// 滞后1个工作日跳过3月12日假期；3月15日周六调休上班
+	s.assertDates(hardware, date(3, 13), date(3, 20))
+
+	_, err = s.projects.UpdateWorkCalendar(s.ctx, s.project.ID.String(), &models.UpdateWorkCalendarRequest{
+		Weekdays: []time.Weekday{}, Holidays: []string{},
+	}, "")
+	assert.ErrorIs(s.T(), err, ErrInvalidCalendar)
+	_, err = s.projects.UpdateWorkCalendar(s.ctx, s.project.ID.String(), &models.UpdateWorkCalendarRequest{
+		Weekdays: models.DefaultWorkingWeekdays, Holidays: []string{"3/12"},
+	}, "")
+	assert.ErrorIs(s.T(), err, ErrInvalidCalendar)
+
+	calendar, err := s.projects.GetWorkCalendar(s.ctx, s.project.ID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"2025-03-12"}, calendar.Holidays)
+}
+
+// TestRescheduleActivity_Rejects 测试已完成活动、无效日期与其他项目的活动
+func (s *ScheduleRippleTestSuite) TestRescheduleActivity_Rejects() {
+	done := s.createActivity("需求分析", date(3, 3), date(3, 5), models.ActivityStatusCompleted)
+	running := s.createActivity("方案设计", date(3, 5), date(3, 10), models.ActivityStatusRunning)
+
+	end := date(3, 7)
+	_, err := s.projects.RescheduleActivity(s.ctx, s.project.ID.String(), done.ID, nil, &end, "", true)
+	assert.ErrorIs(s.T(), err, ErrScheduleLocked)
+
+	end = date(3, 4)
+	_, err = s.projects.RescheduleActivity(s.ctx, s.project.ID.String(), running.ID, nil, &end, "", false)
+	assert.ErrorIs(s.T(), err, ErrInvalidSchedule)
+
+	_, err = s.projects.UpdateActivity(s.ctx, running.ID, map[string]interface{}{"planned_end": "next week"}, "")
+	assert.ErrorIs(s.T(), err, ErrInvalidSchedule)
+
+	_, err = s.projects.RescheduleActivity(s.ctx, uuid.NewString(), running.ID, nil, &end, "", true)
+	assert.ErrorIs(s.T(), err, ErrActivityNotFound)
+	s.assertDates(running, date(3, 5), date(3, 10))
+}
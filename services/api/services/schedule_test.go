@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// ScheduleTestSuite 关键路径计算测试套件
+type ScheduleTestSuite struct {
+	suite.Suite
+	db         *gorm.DB
+	projects   *ProjectService
+	activities *ActivityService
+	project    *models.Project
+	workflow   *models.Workflow
+	start      time.Time
+}
+
+func (s *ScheduleTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:schedule?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.Project{}, &models.Notification{}, &models.Workflow{}, &models.Activity{}, &models.Dependency{}, &models.ActivityTransition{},
+	))
+	for _, table := range []string{"projects", "notifications", "workflows", "activities", "activity_dependencies", "activity_transitions"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.start = time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	end := s.day(17)
+	s.project = &models.Project{ID: uuid.New(), Code: "P-CPM", Name: "关键路径", Category: "module", StartDate: &s.start, EndDate: &end}
+	require.NoError(s.T(), s.db.Create(s.project).Error)
+
+	s.projects = NewProjectService(s.db)
+	s.activities = NewActivityService(s.db)
+	s.workflow, err = NewStateMachineService(s.db).CreateWorkflow(s.project.ID.String(), "", "模块开发", "", "")
+	require.NoError(s.T(), err)
+}
+
+func TestScheduleSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleTestSuite))
+}
+
+// day 返回项目开始后第n天
+func (s *ScheduleTestSuite) day(n int) time.Time {
+	return s.start.AddDate(0, 0, n)
+}
+
+// createActivity 创建计划于第start天开始、持续duration天的活动
+func (s *ScheduleTestSuite) createActivity(name string, start, duration int) *models.Activity {
+	plannedStart, plannedEnd := s.day(start), s.day(start+duration)
+	activity := &models.Activity{
+		WorkflowID: s.workflow.ID, ProjectID: s.project.ID.String(), Name: name, Status: models.ActivityStatusPending,
+		PlannedStart: &plannedStart, PlannedEnd: &plannedEnd,
+	}
+	require.NoError(s.T(), s.db.Create(activity).Error)
+	return activity
+}
+
+// link 添加依赖关系
+func (s *ScheduleTestSuite) link(activity, dependsOn *models.Activity, depType string, lag int) {
+	_, err := s.activities.AddDependency(activity.ID, dependsOn.ID, depType, lag)
+	require.NoError(s.T(), err)
+}
+
+// network 建立测试网络：方案→硬件→联调→文档，软件与方案开始-开始搭接
+func (s *ScheduleTestSuite) network() (design, hardware, software, integration, docs, manual *models.Activity) {
+	design = s.createActivity("方案设计", 0, 5)
+	hardware = s.createActivity("硬件设计", 0, 10)
+	software = s.createActivity("软件设计", 0, 4)
+	integration = s.createActivity("联调", 0, 3)
+	docs = s.createActivity("技术文档", 0, 2)
+	manual = s.createActivity("用户手册", 1, 2)
+	s.link(hardware, design, "", 0)
+	s.link(software, design, models.DependencyStartToStart, 2)
+	s.link(integration, hardware, "", 0)
+	s.link(integration, software, "", 0)
+	s.link(docs, integration, models.DependencyFinishToFinish, 1)
+	return
+}
+
+// entries 按活动ID索引计划结果
+func entries(schedule *models.ProjectSchedule) map[string]models.ActivitySchedule {
+	byID := make(map[string]models.ActivitySchedule, len(schedule.Activities))
+	for _, entry := range schedule.Activities {
+		byID[entry.ActivityID] = entry
+	}
+	return byID
+}
+
+// TestSchedule_FloatAndCriticalPath 测试正推、逆推、总时差、自由时差与关键路径
+func (s *ScheduleTestSuite) TestSchedule_FloatAndCriticalPath() {
+	design, hardware, software, integration, docs, manual := s.network()
+
+	schedule, err := s.projects.GetProjectSchedule(context.Background(), s.project.ID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 19, schedule.Duration)
+	assert.True(s.T(), s.day(19).Equal(schedule.Finish))
+	assert.Equal(s.T(), 2, schedule.Delay, "finish runs two days past the planned end date")
+	assert.Equal(s.T(), []string{design.ID, hardware.ID, integration.ID, docs.ID}, schedule.CriticalPath)
+
+	byID := entries(schedule)
+	for _, tc := range []struct {
+		activity                 *models.Activity
+		es, ef, ls, lf, tf, free int
+	}{
+		{design, 0, 5, 0, 5, 0, 0},
+		{hardware, 5, 15, 5, 15, 0, 0},
+		{software, 2, 6, 11, 15, 9, 9},
+		{integration, 15, 18, 15, 18, 0, 0},
+		{docs, 17, 19, 17, 19, 0, 0},
+		{manual, 1, 3, 17, 19, 16, 16},
+	} {
+		entry := byID[tc.activity.ID]
+		assert.Equal(s.T(), []int{tc.es, tc.ef, tc.ls, tc.lf, tc.tf, tc.free},
+			[]int{entry.EarlyStart, entry.EarlyFinish, entry.LateStart, entry.LateFinish, entry.TotalFloat, entry.FreeFloat}, tc.activity.Name)
+		assert.Equal(s.T(), tc.tf == 0, entry.Critical, tc.activity.Name)
+	}
+	assert.True(s.T(), s.day(11).Equal(byID[software.ID].LateStartDate))
+}
+
+// TestSchedule_ActualDatesMoveFinish 测试已开始活动按实际日期计算
+func (s *ScheduleTestSuite) TestSchedule_ActualDatesMoveFinish() {
+	design, hardware, software, _, _, _ := s.network()
+	actualEnd := s.day(7)
+	require.NoError(s.T(), s.db.Model(design).Updates(map[string]interface{}{
+		"status": models.ActivityStatusCompleted, "actual_start": s.start, "actual_end": actualEnd,
+	}).Error)
+	// 软件设计延后开工，吃掉部分时差
+	require.NoError(s.T(), s.db.Model(software).Update("actual_start", s.day(8)).Error)
+
+	schedule, err := s.projects.GetProjectSchedule(context.Background(), s.project.ID.String())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 21, schedule.Duration)
+	assert.Equal(s.T(), 4, schedule.Delay)
+	byID := entries(schedule)
+	assert.Equal(s.T(), 7, byID[hardware.ID].EarlyStart)
+	assert.Equal(s.T(), 5, byID[software.ID].TotalFloat)
+}
+
+// TestSchedule_Errors 测试依赖环与无效项目
+func (s *ScheduleTestSuite) TestSchedule_Errors() {
+	design, _, _, _, docs, _ := s.network()
+	// 绕过依赖校验写入一个环
+	require.NoError(s.T(), s.db.Create(&models.Dependency{ActivityID: design.ID, DependsOnID: docs.ID, DependencyType: models.DependencyFinishToStart}).Error)
+
+	_, err := s.projects.GetProjectSchedule(context.Background(), s.project.ID.String())
+	assert.ErrorIs(s.T(), err, ErrDependencyCycle)
+
+	_, err = s.projects.GetProjectSchedule(context.Background(), uuid.NewString())
+	assert.Error(s.T(), err)
+	_, err = s.projects.GetProjectSchedule(context.Background(), "invalid")
+	assert.Error(s.T(), err)
+}
@@ -3,9 +3,10 @@ package services
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -22,11 +23,15 @@ func NewSecurityService(db *gorm.DB) *SecurityService {
 	return &SecurityService{db: db}
 }
 
-// CreateAuditLog creates a new audit log entry
+// CreateAuditLog appends a new entry to the audit hash chain and forwards
+// it to the registered audit sinks
 func (s *SecurityService) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
 	log.ID = uuid.New()
-	log.CreatedAt = time.Now().UTC()
-	return s.db.Create(log).Error
+	if err := chainAuditLogs(ctx, s.db, log); err != nil {
+		return err
+	}
+	publishAuditEvent(auditLogEvent(log))
+	return nil
 }
 
 // LogAction logs a user action for audit
@@ -38,6 +43,7 @@ func (s *SecurityService) LogAction(ctx context.Context, userID *uuid.UUID, user
 		Resource:      resource,
 		ResourceID:    &resourceID,
 		Classification: classification,
+		Severity:      auditSeverity(action),
 	}
 
 	// Get IP from context if available
@@ -53,9 +59,25 @@ func (s *SecurityService) ListAuditLogs(ctx context.Context, page, pageSize int,
 	var logs []models.AuditLog
 	var total int64
 
-	query := s.db.Model(&models.AuditLog{})
+	query := filterAuditLogs(s.db.Model(&models.AuditLog{}), filters)
 
-	// Apply filters
+	// Count total
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Pagination
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
+
+// filterAuditLogs applies the audit log filters shared by listing and
+// export
+func filterAuditLogs(query *gorm.DB, filters map[string]interface{}) *gorm.DB {
 	if userID, ok := filters["user_id"].(string); ok && userID != "" {
 		query = query.Where("user_id = ?", userID)
 	}
@@ -68,25 +90,16 @@ func (s *SecurityService) ListAuditLogs(ctx context.Context, page, pageSize int,
 	if classification, ok := filters["classification"].(string); ok && classification != "" {
 		query = query.Where("classification = ?", classification)
 	}
+	if severity, ok := filters["severity"].(string); ok && severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
 	if startDate, ok := filters["start_date"].(time.Time); ok {
 		query = query.Where("created_at >= ?", startDate)
 	}
 	if endDate, ok := filters["end_date"].(time.Time); ok {
 		query = query.Where("created_at <= ?", endDate)
 	}
-
-	// Count total
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
-	}
-
-	// Pagination
-	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&logs).Error; err != nil {
-		return nil, 0, err
-	}
-
-	return logs, total, nil
+	return query
 }
 
 // GetAuditLogByID returns an audit log by ID
@@ -107,11 +120,16 @@ func (s *SecurityService) GetAuditLogByID(ctx context.Context, id string) (*mode
 	return &log, nil
 }
 
-// CreateLoginLog creates a login attempt log
+// CreateLoginLog creates a login attempt log and forwards it to the
+// registered audit sinks
 func (s *SecurityService) CreateLoginLog(ctx context.Context, log *models.LoginLog) error {
 	log.ID = uuid.New()
 	log.CreatedAt = time.Now().UTC()
-	return s.db.Create(log).Error
+	if err := s.db.WithContext(ctx).Create(log).Error; err != nil {
+		return err
+	}
+	publishAuditEvent(loginLogEvent(log))
+	return nil
 }
 
 // ListLoginLogs returns login logs with filters
@@ -184,14 +202,48 @@ func (s *SecurityService) SeedDefaultClassifications(ctx context.Context) error
 	return nil
 }
 
+// Session errors
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrSessionExpired     = errors.New("session has reached its maximum lifetime")
+	ErrSessionIdleTimeout = errors.New("session timed out due to inactivity")
+)
+
+// Default session limits (SRS-SECURITY-002)
+const (
+	DefaultSessionIdleTimeout      = 30 * time.Minute
+	DefaultSessionAbsoluteLifetime = 8 * time.Hour
+	DefaultMaxConcurrentSessions   = 3
+	DefaultSessionCleanupInterval  = 10 * time.Minute
+)
+
+// sessionTouchInterval is how stale a session's last activity may get
+// before a request writes it again, so requests do not each cost an UPDATE
+const sessionTouchInterval = time.Minute
+
 // SessionService handles session management
 type SessionService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	policy models.SessionPolicy
 }
 
-// NewSessionService creates a new SessionService
-func NewSessionService(db *gorm.DB) *SessionService {
-	return &SessionService{db: db}
+// NewSessionService creates a new SessionService; zero policy values fall
+// back to the SRS defaults
+func NewSessionService(db *gorm.DB, policy models.SessionPolicy) *SessionService {
+	if policy.IdleTimeout <= 0 {
+		policy.IdleTimeout = DefaultSessionIdleTimeout
+	}
+	if policy.AbsoluteLifetime <= 0 {
+		policy.AbsoluteLifetime = DefaultSessionAbsoluteLifetime
+	}
+	if policy.MaxConcurrent <= 0 {
+		policy.MaxConcurrent = DefaultMaxConcurrentSessions
+	}
+	if policy.CleanupInterval <= 0 {
+		policy.CleanupInterval = DefaultSessionCleanupInterval
+	}
+	return &SessionService{db: db, policy: policy}
 }
 
 // CreateSession creates a new session
@@ -202,6 +254,150 @@ func (s *SessionService) CreateSession(ctx context.Context, session *models.Sess
 	return s.db.Create(session).Error
 }
 
+// StartSession opens a session for the user, evicting the oldest active
+// sessions when the concurrent-session cap would be exceeded
+func (s *SessionService) StartSession(ctx context.Context, userID uuid.UUID, token, ipAddress, userAgent string) (*models.Session, error) {
+	now := time.Now().UTC()
+	session := &models.Session{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Token:        token,
+		ExpiresAt:    now.Add(s.policy.AbsoluteLifetime),
+		LastActiveAt: now,
+		CreatedAt:    now,
+	}
+	if ipAddress != "" {
+		session.IPAddress = &ipAddress
+	}
+	if userAgent != "" {
+		session.UserAgent = &userAgent
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Concurrent logins of the same user take turns, so the count below
+		// includes sessions just opened by the others
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+
+		var active []models.Session
+		if err := s.activeSessions(tx, userID, now).Order("created_at ASC").Find(&active).Error; err != nil {
+			return err
+		}
+
+		if excess := len(active) - s.policy.MaxConcurrent + 1; excess > 0 {
+			ids := make([]uuid.UUID, 0, excess)
+			for _, old := range active[:excess] {
+				ids = append(ids, old.ID)
+			}
+			if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("is_revoked", true).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// TouchSession records activity on a session, failing when the session
+// has been revoked, has hit its absolute lifetime or has gone idle. The
+// activity is only written once it is older than sessionTouchInterval.
+func (s *SessionService) TouchSession(ctx context.Context, sessionID string) error {
+	session, err := s.ValidateSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(session.LastActiveAt) < sessionTouchInterval {
+		return nil
+	}
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND is_revoked = ? AND expires_at > ? AND last_active_at > ?",
+			session.ID, false, now, now.Add(-s.policy.IdleTimeout)).
+		Update("last_active_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// Revoked or timed out since it was read; look it up to report why
+	_, err = s.ValidateSession(ctx, sessionID)
+	return err
+}
+
+// ValidateSession checks the idle timeout and absolute lifetime of a
+// session without counting the lookup as activity
+func (s *SessionService) ValidateSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	sid, err := uuid.Parse(sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	var session models.Session
+	if err := s.db.WithContext(ctx).First(&session, "id = ?", sid).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case session.IsRevoked:
+		return nil, ErrSessionRevoked
+	case !now.Before(session.ExpiresAt):
+		return nil, ErrSessionExpired
+	case !now.Before(session.LastActiveAt.Add(s.policy.IdleTimeout)):
+		return nil, ErrSessionIdleTimeout
+	}
+
+	return &session, nil
+}
+
+// GetSessionInfo returns the remaining idle and absolute time of a session
+// without counting the lookup as activity
+func (s *SessionService) GetSessionInfo(ctx context.Context, sessionID string) (*models.SessionInfo, error) {
+	session, err := s.ValidateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.sessionInfo(session), nil
+}
+
+// sessionInfo computes the remaining lifetime of a session
+func (s *SessionService) sessionInfo(session *models.Session) *models.SessionInfo {
+	now := time.Now().UTC()
+	idleExpiresAt := session.LastActiveAt.Add(s.policy.IdleTimeout)
+	if idleExpiresAt.After(session.ExpiresAt) {
+		idleExpiresAt = session.ExpiresAt
+	}
+
+	info := &models.SessionInfo{
+		SessionID:             session.ID.String(),
+		CreatedAt:             session.CreatedAt,
+		LastActiveAt:          session.LastActiveAt,
+		IdleExpiresAt:         idleExpiresAt,
+		ExpiresAt:             session.ExpiresAt,
+		IdleRemainingSeconds:  remainingSeconds(now, idleExpiresAt),
+		TotalRemainingSeconds: remainingSeconds(now, session.ExpiresAt),
+	}
+	info.RemainingSeconds = info.IdleRemainingSeconds
+	if info.TotalRemainingSeconds < info.RemainingSeconds {
+		info.RemainingSeconds = info.TotalRemainingSeconds
+	}
+	return info
+}
+
 // GetSessionByToken returns a session by token
 func (s *SessionService) GetSessionByToken(ctx context.Context, token string) (*models.Session, error) {
 	var session models.Session
@@ -235,7 +431,43 @@ func (s *SessionService) RevokeAllUserSessions(ctx context.Context, userID strin
 	return s.db.Model(&models.Session{}).Where("user_id = ?", uid).Update("is_revoked", true).Error
 }
 
-// CleanExpiredSessions removes expired sessions
+// CleanExpiredSessions removes sessions that can no longer be used: revoked,
+// past their absolute lifetime, or idle for longer than the timeout
 func (s *SessionService) CleanExpiredSessions(ctx context.Context) error {
-	return s.db.Where("expires_at < ?", time.Now()).Delete(&models.Session{}).Error
+	now := time.Now().UTC()
+	return s.db.WithContext(ctx).
+		Where("is_revoked = ? OR expires_at < ? OR last_active_at < ?", true, now, now.Add(-s.policy.IdleTimeout)).
+		Delete(&models.Session{}).Error
+}
+
+// RunCleanup calls CleanExpiredSessions on the policy interval until ctx is done
+func (s *SessionService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(s.policy.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.CleanExpiredSessions(ctx); err != nil {
+				log.Printf("session cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+// activeSessions scopes a query to the user's usable sessions
+func (s *SessionService) activeSessions(tx *gorm.DB, userID uuid.UUID, now time.Time) *gorm.DB {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND is_revoked = ? AND expires_at > ? AND last_active_at > ?",
+			userID, false, now, now.Add(-s.policy.IdleTimeout))
+}
+
+// remainingSeconds returns the whole seconds left until t, never negative
+func remainingSeconds(now, t time.Time) int {
+	if !t.After(now) {
+		return 0
+	}
+	return int(t.Sub(now).Seconds())
 }
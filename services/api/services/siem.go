@@ -0,0 +1,494 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// Login events forwarded to SIEM sinks
+const (
+	AuditActionLoginSucceeded = "login_succeeded"
+	AuditActionLoginFailed    = "login_failed"
+)
+
+// Defaults for syslog sinks when not configured
+const (
+	DefaultSIEMFacility      = 13 // log audit
+	DefaultSIEMAppName       = "rdp-api"
+	DefaultSIEMBufferSize    = 10000
+	DefaultSIEMRetryInterval = 5 * time.Second
+	DefaultSIEMDialTimeout   = 5 * time.Second
+)
+
+// siemWriteTimeout bounds a single write to the SIEM
+const siemWriteTimeout = 5 * time.Second
+
+var (
+	// ErrInvalidSIEMNetwork is returned for a transport other than udp, tcp or tls
+	ErrInvalidSIEMNetwork = errors.New("SIEM network must be udp, tcp or tls")
+	// ErrInvalidSIEMFormat is returned for a format other than cef or json
+	ErrInvalidSIEMFormat = errors.New("SIEM format must be cef or json")
+	// ErrSIEMAddressRequired is returned for a sink without an address
+	ErrSIEMAddressRequired = errors.New("SIEM address is required")
+)
+
+// AuditSink receives the audit and login events recorded through a
+// SecurityService. Publish is called on the recording goroutine and must
+// not block.
+type AuditSink interface {
+	Publish(event *models.SIEMEvent)
+}
+
+// auditSinks are shared by every SecurityService, since each service
+// creates its own
+var auditSinks struct {
+	sync.RWMutex
+	sinks []AuditSink
+}
+
+// RegisterAuditSink forwards all SecurityService events to the sink until
+// the returned function is called
+func RegisterAuditSink(sink AuditSink) func() {
+	auditSinks.Lock()
+	defer auditSinks.Unlock()
+	auditSinks.sinks = append(auditSinks.sinks, sink)
+
+	return func() {
+		auditSinks.Lock()
+		defer auditSinks.Unlock()
+		for i, registered := range auditSinks.sinks {
+			if registered == sink {
+				auditSinks.sinks = append(auditSinks.sinks[:i:i], auditSinks.sinks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// publishAuditEvent hands the event to the registered sinks
+func publishAuditEvent(event *models.SIEMEvent) {
+	auditSinks.RLock()
+	defer auditSinks.RUnlock()
+	for _, sink := range auditSinks.sinks {
+		sink.Publish(event)
+	}
+}
+
+// auditLogEvent describes a recorded audit log entry for a SIEM
+func auditLogEvent(entry *models.AuditLog) *models.SIEMEvent {
+	event := &models.SIEMEvent{
+		Kind:           models.SIEMEventAudit,
+		Time:           entry.CreatedAt,
+		Action:         entry.Action,
+		Severity:       entry.Severity,
+		Classification: entry.Classification,
+		UserID:         entry.UserID,
+		Username:       stringValue(entry.Username),
+		IPAddress:      stringValue(entry.IPAddress),
+		UserAgent:      stringValue(entry.UserAgent),
+		Resource:       entry.Resource,
+		ResourceID:     stringValue(entry.ResourceID),
+		Details:        entry.Details,
+		Sequence:       entry.Sequence,
+		Hash:           entry.Hash,
+	}
+	if entry.OccurredAt != nil {
+		event.Time = *entry.OccurredAt
+	}
+	if event.Severity == "" {
+		event.Severity = auditSeverity(entry.Action)
+	}
+	if event.Classification == "" {
+		event.Classification = models.ClassificationInternal
+	}
+	if entry.ErrorMessage != nil {
+		event.Outcome, event.Reason = "failure", *entry.ErrorMessage
+	}
+	return event
+}
+
+// loginLogEvent describes a login attempt for a SIEM; failures are WARN
+func loginLogEvent(entry *models.LoginLog) *models.SIEMEvent {
+	event := &models.SIEMEvent{
+		Kind:           models.SIEMEventLogin,
+		Time:           entry.CreatedAt,
+		Action:         AuditActionLoginSucceeded,
+		Severity:       models.AuditSeverityInfo,
+		Classification: models.ClassificationInternal,
+		Outcome:        "success",
+		UserID:         entry.UserID,
+		Username:       entry.Username,
+		IPAddress:      stringValue(entry.IPAddress),
+		UserAgent:      stringValue(entry.UserAgent),
+		Resource:       "session",
+		Provider:       entry.Provider,
+	}
+	if !entry.Success {
+		event.Action, event.Severity, event.Outcome = AuditActionLoginFailed, models.AuditSeverityWarn, "failure"
+		event.Reason = stringValue(entry.FailureReason)
+	}
+	return event
+}
+
+// siemMessage is a formatted event waiting for delivery
+type siemMessage struct {
+	id   uint64
+	data []byte
+}
+
+// SyslogSink forwards events to a SIEM as RFC 5424 syslog over UDP, TCP or
+// TLS. Events are buffered and retried while the SIEM is unreachable, so
+// delivery is at least once; a full buffer drops the oldest events.
+type SyslogSink struct {
+	config    models.SIEMSinkConfig
+	hostname  string
+	tlsConfig *tls.Config
+
+	mu        sync.Mutex
+	buffer    []siemMessage
+	nextID    uint64
+	conn      net.Conn
+	lastError string
+	wake      chan struct{}
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// NewSyslogSink creates a new SyslogSink
+func NewSyslogSink(config models.SIEMSinkConfig) (*SyslogSink, error) {
+	config.Network = strings.ToLower(config.Network)
+	config.Format = strings.ToLower(config.Format)
+	switch config.Network {
+	case models.SIEMNetworkUDP, models.SIEMNetworkTCP, models.SIEMNetworkTLS:
+	default:
+		return nil, ErrInvalidSIEMNetwork
+	}
+	switch config.Format {
+	case "":
+		config.Format = models.SIEMFormatCEF
+	case models.SIEMFormatCEF, models.SIEMFormatJSON:
+	default:
+		return nil, ErrInvalidSIEMFormat
+	}
+	if config.Address == "" {
+		return nil, ErrSIEMAddressRequired
+	}
+	if config.Name == "" {
+		config.Name = config.Address
+	}
+	if config.Facility <= 0 || config.Facility > 23 {
+		config.Facility = DefaultSIEMFacility
+	}
+	if config.AppName == "" {
+		config.AppName = DefaultSIEMAppName
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultSIEMBufferSize
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultSIEMRetryInterval
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = DefaultSIEMDialTimeout
+	}
+
+	sink := &SyslogSink{config: config, hostname: "-", wake: make(chan struct{}, 1)}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		sink.hostname = hostname
+	}
+	if config.Network == models.SIEMNetworkTLS {
+		host, _, err := net.SplitHostPort(config.Address)
+		if err != nil {
+			return nil, err
+		}
+		sink.tlsConfig = &tls.Config{
+			ServerName:         host,
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		}
+		if config.CAFile != "" {
+			pem, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", config.CAFile)
+			}
+			sink.tlsConfig.RootCAs = pool
+		}
+	}
+	return sink, nil
+}
+
+// Publish buffers the event for delivery if the sink's filters select it
+func (s *SyslogSink) Publish(event *models.SIEMEvent) {
+	if !s.accepts(event) {
+		return
+	}
+	data, err := s.format(event)
+	if err != nil {
+		log.Printf("SIEM sink %s: failed to format %s: %v", s.config.Name, event.Action, err)
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.buffer) >= s.config.BufferSize {
+		s.buffer = s.buffer[1:]
+		s.dropped.Add(1)
+	}
+	s.nextID++
+	s.buffer = append(s.buffer, siemMessage{id: s.nextID, data: data})
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers buffered events until ctx is cancelled, reconnecting after
+// RetryInterval when the SIEM is unreachable
+func (s *SyslogSink) Run(ctx context.Context) {
+	defer s.disconnect()
+
+	for {
+		if err := s.flush(); err != nil {
+			s.setError(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.config.RetryInterval):
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+	}
+}
+
+// Metrics returns the sink's delivery counters
+func (s *SyslogSink) Metrics() models.SIEMSinkMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return models.SIEMSinkMetrics{
+		Name:      s.config.Name,
+		Sent:      s.sent.Load(),
+		Dropped:   s.dropped.Load(),
+		Buffered:  len(s.buffer),
+		Connected: s.conn != nil,
+		LastError: s.lastError,
+	}
+}
+
+// flush writes the buffer in order, keeping each message until it is
+// written
+func (s *SyslogSink) flush() error {
+	for {
+		s.mu.Lock()
+		if len(s.buffer) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		message := s.buffer[0]
+		conn := s.conn
+		s.mu.Unlock()
+
+		if conn == nil {
+			var err error
+			if conn, err = s.dial(); err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.conn = conn
+			s.mu.Unlock()
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(siemWriteTimeout))
+		if _, err := conn.Write(s.frame(message.data)); err != nil {
+			s.disconnect()
+			return err
+		}
+		s.sent.Add(1)
+
+		s.mu.Lock()
+		// The message may have been dropped from a full buffer meanwhile
+		if len(s.buffer) > 0 && s.buffer[0].id == message.id {
+			s.buffer = s.buffer[1:]
+		}
+		s.lastError = ""
+		s.mu.Unlock()
+	}
+}
+
+// dial connects to the SIEM
+func (s *SyslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.config.DialTimeout}
+	if s.config.Network == models.SIEMNetworkTLS {
+		return tls.DialWithDialer(dialer, "tcp", s.config.Address, s.tlsConfig)
+	}
+	return dialer.Dial(s.config.Network, s.config.Address)
+}
+
+// disconnect closes the connection so the next flush reconnects
+func (s *SyslogSink) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// setError records a delivery failure
+func (s *SyslogSink) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastError != err.Error() {
+		log.Printf("SIEM sink %s: %v", s.config.Name, err)
+	}
+	s.lastError = err.Error()
+}
+
+// accepts applies the sink's action and classification filters
+func (s *SyslogSink) accepts(event *models.SIEMEvent) bool {
+	if len(s.config.Classifications) > 0 && !slices.Contains(s.config.Classifications, event.Classification) {
+		return false
+	}
+	if len(s.config.Actions) == 0 {
+		return true
+	}
+	for _, action := range s.config.Actions {
+		if prefix, ok := strings.CutSuffix(action, "*"); ok && strings.HasPrefix(event.Action, prefix) {
+			return true
+		}
+		if action == event.Action {
+			return true
+		}
+	}
+	return false
+}
+
+// frame delimits a message: one datagram over UDP, octet counting over a
+// stream (RFC 6587, RFC 5425)
+func (s *SyslogSink) frame(data []byte) []byte {
+	if s.config.Network == models.SIEMNetworkUDP {
+		return data
+	}
+	return append([]byte(strconv.Itoa(len(data))+" "), data...)
+}
+
+// format renders the event as an RFC 5424 syslog message
+func (s *SyslogSink) format(event *models.SIEMEvent) ([]byte, error) {
+	var body string
+	switch s.config.Format {
+	case models.SIEMFormatJSON:
+		data, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	default:
+		body = formatCEF(event)
+	}
+
+	severity := 6 // informational
+	if event.Severity == models.AuditSeverityWarn {
+		severity = 4 // warning
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s -",
+		s.config.Facility*8+severity,
+		event.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, s.config.AppName, os.Getpid(), event.Kind)
+	return []byte(header + " " + body), nil
+}
+
+// formatCEF renders the event in ArcSight Common Event Format
+func formatCEF(event *models.SIEMEvent) string {
+	severity := 3
+	if event.Severity == models.AuditSeverityWarn {
+		severity = 7
+	}
+
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtension(value))
+		}
+	}
+	add("rt", strconv.FormatInt(event.Time.UnixMilli(), 10))
+	add("cat", event.Kind)
+	add("act", event.Action)
+	add("outcome", event.Outcome)
+	add("reason", event.Reason)
+	if event.UserID != nil {
+		add("suid", event.UserID.String())
+	}
+	add("suser", event.Username)
+	add("src", event.IPAddress)
+	add("requestClientApplication", event.UserAgent)
+	add("cs1Label", "classification")
+	add("cs1", event.Classification)
+	if event.Resource != "" {
+		add("cs2Label", "resource")
+		add("cs2", event.Resource)
+	}
+	if event.ResourceID != "" {
+		add("cs3Label", "resourceId")
+		add("cs3", event.ResourceID)
+	}
+	if event.Provider != "" {
+		add("cs4Label", "provider")
+		add("cs4", event.Provider)
+	}
+	if event.Hash != "" {
+		add("cs5Label", "hash")
+		add("cs5", event.Hash)
+	}
+	if event.Details != nil {
+		if data, err := json.Marshal(event.Details); err == nil {
+			add("cs6Label", "details")
+			add("cs6", string(data))
+		}
+	}
+	if event.Sequence > 0 {
+		add("cn1Label", "sequence")
+		add("cn1", strconv.FormatInt(event.Sequence, 10))
+	}
+
+	return fmt.Sprintf("CEF:0|RDP|%s|1.0|%s|%s|%d|%s",
+		cefHeader(DefaultSIEMAppName),
+		cefHeader(event.Action),
+		cefHeader(strings.ReplaceAll(event.Action, "_", " ")),
+		severity,
+		strings.Join(ext, " "))
+}
+
+// cefHeader escapes a CEF header field
+func cefHeader(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(value)
+}
+
+// cefExtension escapes a CEF extension value
+func cefExtension(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// SIEMTestSuite SIEM syslog转发测试套件
+type SIEMTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	security *SecurityService
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func (s *SIEMTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:siem?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.AuditLog{}, &models.AuditChainHead{}, &models.LoginLog{}))
+	for _, table := range []string{"audit_logs", "audit_chain_heads", "login_logs"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.security = NewSecurityService(s.db)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+}
+
+func (s *SIEMTestSuite) TearDownTest() {
+	s.cancel()
+}
+
+func TestSIEMSuite(t *testing.T) {
+	suite.Run(t, new(SIEMTestSuite))
+}
+
+// start 创建、注册并运行一个syslog目标
+func (s *SIEMTestSuite) start(config models.SIEMSinkConfig) *SyslogSink {
+	sink, err := NewSyslogSink(config)
+	require.NoError(s.T(), err)
+	s.T().Cleanup(RegisterAuditSink(sink))
+	go sink.Run(s.ctx)
+	return sink
+}
+
+// readFrame 读取一条按字节数分帧的syslog消息
+func (s *SIEMTestSuite) readFrame(conn net.Conn) string {
+	require.NoError(s.T(), conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reader := bufio.NewReader(conn)
+	length, err := reader.ReadString(' ')
+	require.NoError(s.T(), err)
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	require.NoError(s.T(), err)
+	message := make([]byte, n)
+	_, err = io.ReadFull(reader, message)
+	require.NoError(s.T(), err)
+	return string(message)
+}
+
+// TestUDP_ForwardsFilteredEventsAsCEF 测试经UDP以CEF格式转发，并按操作和密级过滤
+func (s *SIEMTestSuite) TestUDP_ForwardsFilteredEventsAsCEF() {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(s.T(), err)
+	defer listener.Close()
+
+	sink := s.start(models.SIEMSinkConfig{
+		Name:            "soc",
+		Network:         models.SIEMNetworkUDP,
+		Address:         listener.LocalAddr().String(),
+		Actions:         []string{"permission_*"},
+		Classifications: []string{models.ClassificationInternal},
+	})
+
+	username := "admin"
+	ctx := context.WithValue(context.Background(), "ip_address", "10.0.0.8")
+	require.NoError(s.T(), s.security.LogAction(ctx, nil, &username, AuditActionPersonalTokenCreated, "personal_access_token", "t1", "internal"))
+	require.NoError(s.T(), s.security.LogAction(ctx, nil, &username, AuditActionPolicyAdded, "permission_policy", "p|a=b", "secret"))
+	require.NoError(s.T(), s.security.LogAction(ctx, nil, &username, AuditActionPolicyAdded, "permission_policy", "p|a=b", "internal"))
+
+	buf := make([]byte, 4096)
+	require.NoError(s.T(), listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(s.T(), err)
+	message := string(buf[:n])
+
+	// facility 13 (log audit) * 8 + warning
+	assert.True(s.T(), strings.HasPrefix(message, "<108>1 "), message)
+	assert.Contains(s.T(), message, " rdp-api ")
+	assert.Contains(s.T(), message, " audit - CEF:0|RDP|rdp-api|1.0|permission_policy_added|permission policy added|7|")
+	assert.Contains(s.T(), message, "suser=admin src=10.0.0.8")
+	assert.Contains(s.T(), message, "cs1Label=classification cs1=internal")
+	assert.Contains(s.T(), message, `cs3=p|a\=b`)
+	assert.Contains(s.T(), message, "cn1Label=sequence cn1=3")
+
+	assert.Eventually(s.T(), func() bool {
+		return sink.Metrics().Sent == 1 && sink.Metrics().Buffered == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// TestTCP_BuffersUntilSIEMReachable 测试SIEM不可达时缓冲并在恢复后重试发送
+func (s *SIEMTestSuite) TestTCP_BuffersUntilSIEMReachable() {
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.T(), err)
+	address := reserved.Addr().String()
+	require.NoError(s.T(), reserved.Close())
+
+	sink := s.start(models.SIEMSinkConfig{
+		Network:       models.SIEMNetworkTCP,
+		Address:       address,
+		Format:        models.SIEMFormatJSON,
+		RetryInterval: 20 * time.Millisecond,
+	})
+
+	reason := "invalid_password"
+	require.NoError(s.T(), s.security.CreateLoginLog(context.Background(), &models.LoginLog{
+		Username: "designer", Provider: LoginProviderLocal, FailureReason: &reason,
+	}))
+	require.Eventually(s.T(), func() bool {
+		return sink.Metrics().LastError != ""
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(s.T(), 1, sink.Metrics().Buffered)
+	assert.Zero(s.T(), sink.Metrics().Sent)
+
+	// SIEM恢复后收到缓冲的事件
+	listener, err := net.Listen("tcp", address)
+	require.NoError(s.T(), err)
+	defer listener.Close()
+	conn, err := listener.Accept()
+	require.NoError(s.T(), err)
+	defer conn.Close()
+
+	message := s.readFrame(conn)
+	assert.True(s.T(), strings.HasPrefix(message, "<108>1 "), message)
+	body := message[strings.Index(message, " - {")+3:]
+	var event models.SIEMEvent
+	require.NoError(s.T(), json.Unmarshal([]byte(body), &event))
+	assert.Equal(s.T(), models.SIEMEventLogin, event.Kind)
+	assert.Equal(s.T(), AuditActionLoginFailed, event.Action)
+	assert.Equal(s.T(), models.AuditSeverityWarn, event.Severity)
+	assert.Equal(s.T(), "failure", event.Outcome)
+	assert.Equal(s.T(), reason, event.Reason)
+	assert.Equal(s.T(), "designer", event.Username)
+
+	require.Eventually(s.T(), func() bool {
+		metrics := sink.Metrics()
+		return metrics.Sent == 1 && metrics.Buffered == 0 && metrics.Connected && metrics.LastError == ""
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// TestBuffer_DropsOldestWhenFull 测试缓冲区满时丢弃最早的事件
+func (s *SIEMTestSuite) TestBuffer_DropsOldestWhenFull() {
+	sink, err := NewSyslogSink(models.SIEMSinkConfig{Network: models.SIEMNetworkTCP, Address: "127.0.0.1:1", BufferSize: 2})
+	require.NoError(s.T(), err)
+	for _, action := range []string{"a", "b", "c"} {
+		sink.Publish(&models.SIEMEvent{Kind: models.SIEMEventAudit, Action: action, Time: time.Now()})
+	}
+	metrics := sink.Metrics()
+	assert.Equal(s.T(), 2, metrics.Buffered)
+	assert.Equal(s.T(), uint64(1), metrics.Dropped)
+	assert.Contains(s.T(), string(sink.buffer[0].data), "|b|")
+
+	_, err = NewSyslogSink(models.SIEMSinkConfig{Network: "http", Address: "127.0.0.1:1"})
+	assert.ErrorIs(s.T(), err, ErrInvalidSIEMNetwork)
+	_, err = NewSyslogSink(models.SIEMSinkConfig{Network: "udp", Address: "127.0.0.1:1", Format: "leef"})
+	assert.ErrorIs(s.T(), err, ErrInvalidSIEMFormat)
+}
+
+// TestTLS_VerifiesServerWithCAFile 测试TLS syslog使用指定CA校验服务端
+func (s *SIEMTestSuite) TestTLS_VerifiesServerWithCAFile() {
+	certificate, caFile := s.selfSignedCertificate()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	require.NoError(s.T(), err)
+	defer listener.Close()
+
+	s.start(models.SIEMSinkConfig{
+		Network: models.SIEMNetworkTLS,
+		Address: listener.Addr().String(),
+		CAFile:  caFile,
+	})
+	require.NoError(s.T(), s.security.CreateLoginLog(context.Background(), &models.LoginLog{Username: "admin", Success: true, Provider: LoginProviderLocal}))
+
+	conn, err := listener.Accept()
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	message := s.readFrame(conn)
+	// facility 13 * 8 + informational
+	assert.True(s.T(), strings.HasPrefix(message, "<110>1 "), message)
+	assert.Contains(s.T(), message, " login - CEF:0|RDP|rdp-api|1.0|login_succeeded|")
+	assert.Contains(s.T(), message, "outcome=success suser=admin")
+	assert.Contains(s.T(), message, "cs4Label=provider cs4=local")
+}
+
+// selfSignedCertificate 生成127.0.0.1的自签名证书，返回证书与CA文件路径
+func (s *SIEMTestSuite) selfSignedCertificate() (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(s.T(), err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "siem"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(s.T(), err)
+
+	caFile := filepath.Join(s.T().TempDir(), "ca.pem")
+	require.NoError(s.T(), os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
@@ -1,11 +1,16 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"time"
 
 	"gorm.io/gorm"
-	"rdp/services/api/models"
+	"gorm.io/gorm/clause"
+	"rdp-platform/rdp-api/models"
 )
 
 // StateMachineService handles workflow state machine logic
@@ -150,36 +155,76 @@ func (s *ActivityService) GetActivity(activityID string) (*models.Activity, erro
 
 // StartActivity starts an activity
 func (s *ActivityService) StartActivity(activityID, userID string) error {
-	activity, err := s.GetActivity(activityID)
-	if err != nil {
-		return err
-	}
-
-	if !activity.CanStart() {
-		return errors.New("activity cannot be started")
-	}
-
-	activity.Start()
-	return s.db.Save(activity).Error
+	_, err := s.TransitionActivity(activityID, models.ActivityStatusRunning, userID, "")
+	return err
 }
 
 // CompleteActivity completes an activity
 func (s *ActivityService) CompleteActivity(activityID, userID string) error {
-	activity, err := s.GetActivity(activityID)
-	if err != nil {
+	_, err := s.TransitionActivity(activityID, models.ActivityStatusCompleted, userID, "")
+	return err
+}
+
+// AdvanceWorkflow re-evaluates a workflow's activities and state, e.g.
+// after an activity was rejected or skipped
+func (s *ActivityService) AdvanceWorkflow(workflowID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return advanceWorkflow(tx, workflowID)
+	})
+}
+
+// LagCheckInterval is how often workflows waiting out a lag are
+// re-evaluated
+const LagCheckInterval = time.Minute
+
+// AdvanceLaggedWorkflows re-evaluates the open workflows with a pending
+// activity behind a lag or lead. No state change marks the end of the
+// wait, so nothing else would ready the activity.
+func (s *ActivityService) AdvanceLaggedWorkflows(ctx context.Context) error {
+	var workflowIDs []string
+	if err := s.db.WithContext(ctx).Model(&models.Activity{}).
+		Joins("JOIN activity_dependencies ON activity_dependencies.activity_id = activities.id").
+		Joins("JOIN workflows ON workflows.id = activities.workflow_id").
+		Where("activities.status = ? AND activity_dependencies.lag <> 0", models.ActivityStatusPending).
+		Where("workflows.state NOT IN ?", []models.WorkflowState{models.WorkflowStateCompleted, models.WorkflowStateCancelled}).
+		Distinct().
+		Pluck("activities.workflow_id", &workflowIDs).Error; err != nil {
 		return err
 	}
 
-	if activity.Status != models.ActivityStatusRunning {
-		return errors.New("activity must be running to complete")
+	for _, workflowID := range workflowIDs {
+		if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return advanceWorkflow(tx, workflowID)
+		}); err != nil {
+			log.Printf("failed to advance workflow %s: %v", workflowID, err)
+		}
 	}
+	return nil
+}
 
-	activity.Complete()
-	return s.db.Save(activity).Error
+// RunLagCheck calls AdvanceLaggedWorkflows every LagCheckInterval until
+// ctx is done
+func (s *ActivityService) RunLagCheck(ctx context.Context) {
+	ticker := time.NewTicker(LagCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.AdvanceLaggedWorkflows(ctx); err != nil {
+				log.Printf("workflow lag check failed: %v", err)
+			}
+		}
+	}
 }
 
 // AssignActivity assigns an activity to a user
 func (s *ActivityService) AssignActivity(activityID, assigneeID string) error {
+	if err := checkActivityEditable(s.db, activityID); err != nil {
+		return err
+	}
 	return s.db.Model(&models.Activity{}).Where("id = ?", activityID).Update("assignee_id", assigneeID).Error
 }
 
@@ -188,6 +233,9 @@ func (s *ActivityService) UpdateActivityProgress(activityID string, progress int
 	if progress < 0 || progress > 100 {
 		return errors.New("progress must be between 0 and 100")
 	}
+	if err := checkActivityEditable(s.db, activityID); err != nil {
+		return err
+	}
 	return s.db.Model(&models.Activity{}).Where("id = ?", activityID).Update("progress", progress).Error
 }
 
@@ -213,33 +261,106 @@ func (s *ActivityService) ListActivities(workflowID string, status models.Activi
 	return activities, total, nil
 }
 
-// AddDependency adds a dependency between activities
-func (s *ActivityService) AddDependency(activityID, dependsOnID, depType string) error {
+// AddDependency makes an activity depend on another in the same workflow.
+// Lag is in days after the predecessor's start or finish and may be
+// negative. A link that would close a cycle is rejected with the path.
+func (s *ActivityService) AddDependency(activityID, dependsOnID, depType string, lag int) (*models.Dependency, error) {
+	if depType == "" {
+		depType = models.DependencyFinishToStart
+	}
+	if !slices.Contains(models.ValidDependencyTypes, depType) {
+		return nil, ErrInvalidDependencyType
+	}
+	if activityID == dependsOnID {
+		return nil, ErrSelfDependency
+	}
+
 	dependency := &models.Dependency{
 		ActivityID:     activityID,
 		DependsOnID:    dependsOnID,
 		DependencyType: depType,
+		Lag:            lag,
 	}
-	return s.db.Create(dependency).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var activities []models.Activity
+		if err := tx.Select("id", "workflow_id", "project_id").Where("id IN ?", []string{activityID, dependsOnID}).Find(&activities).Error; err != nil {
+			return err
+		}
+		if len(activities) != 2 {
+			return ErrActivityNotFound
+		}
+		if activities[0].WorkflowID != activities[1].WorkflowID {
+			return ErrCrossWorkflowDependency
+		}
+		// Links added at the same time could close a cycle neither check
+		// sees, so they take turns on the project row
+		var project models.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", activities[0].ProjectID).Limit(1).Find(&project).Error; err != nil {
+			return err
+		}
+
+		dependencies, err := workflowDependencies(tx, activities[0].WorkflowID)
+		if err != nil {
+			return err
+		}
+		successors := make(map[string][]string)
+		for _, dep := range dependencies {
+			if dep.ActivityID == activityID && dep.DependsOnID == dependsOnID {
+				return ErrDependencyExists
+			}
+			successors[dep.DependsOnID] = append(successors[dep.DependsOnID], dep.ActivityID)
+		}
+
+		// The new link runs from dependsOnID to activityID, so any path
+		// back from activityID closes a cycle
+		if path := findDependencyPath(successors, activityID, dependsOnID); path != nil {
+			return &DependencyCycleError{Path: append([]string{dependsOnID}, path...)}
+		}
+
+		if err := tx.Create(dependency).Error; err != nil {
+			return err
+		}
+		// The new predecessor may hold back an activity that was ready
+		return advanceWorkflow(tx, activities[0].WorkflowID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dependency, nil
 }
 
-// CheckDependencies checks if all dependencies are completed
+// CheckDependencies checks if the activity's predecessors allow it to
+// start: finish_to_start and start_to_start links, including their lag
 func (s *ActivityService) CheckDependencies(activityID string) (bool, error) {
+	return dependenciesMet(s.db, activityID, false)
+}
+
+// CheckFinishDependencies checks if the activity's predecessors allow it
+// to finish: finish_to_finish and start_to_finish links
+func (s *ActivityService) CheckFinishDependencies(activityID string) (bool, error) {
+	return dependenciesMet(s.db, activityID, true)
+}
+
+// dependenciesMet checks the links gating the activity's start or finish
+func dependenciesMet(db *gorm.DB, activityID string, finish bool) (bool, error) {
 	var dependencies []models.Dependency
-	if err := s.db.Where("activity_id = ?", activityID).Find(&dependencies).Error; err != nil {
+	if err := db.Where("activity_id = ?", activityID).Find(&dependencies).Error; err != nil {
 		return false, err
 	}
 
-	if len(dependencies) == 0 {
-		return true, nil
-	}
-
-	for _, dep := range dependencies {
-		var activity models.Activity
-		if err := s.db.First(&activity, "id = ?", dep.DependsOnID).Error; err != nil {
+	now := time.Now()
+	for i := range dependencies {
+		dep := &dependencies[i]
+		if constrainsFinish(dep.DependencyType) != finish {
+			continue
+		}
+		var predecessor models.Activity
+		if err := db.First(&predecessor, "id = ?", dep.DependsOnID).Error; err != nil {
 			return false, err
 		}
-		if !activity.IsCompleted() {
+		if !linkSatisfied(dep, &predecessor, now) {
 			return false, nil
 		}
 	}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 附录B的SHA1密钥 "12345678901234567890"
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// 取RFC 8位测试值的后6位
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		code, err := totpCode(rfcTOTPSecret, totpStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "T=%d", unix)
+	}
+}
+
+func TestMatchTOTP_Skew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := totpStep(now)
+
+	prev, _ := totpCode(rfcTOTPSecret, step-1)
+	got, ok := matchTOTP(rfcTOTPSecret, prev, now)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, got)
+
+	stale, _ := totpCode(rfcTOTPSecret, step-2)
+	_, ok = matchTOTP(rfcTOTPSecret, stale, now)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := totpProvisioningURI("RDP", "zhang san", rfcTOTPSecret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/RDP:zhang%20san?"))
+	assert.Contains(t, uri, "secret="+rfcTOTPSecret)
+	assert.Contains(t, uri, "issuer=RDP")
+}
+
+func TestSecretBox_RoundTrip(t *testing.T) {
+	box, err := newSecretBox("passphrase")
+	require.NoError(t, err)
+	sealed, err := box.seal(rfcTOTPSecret)
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, rfcTOTPSecret)
+
+	opened, err := box.open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, rfcTOTPSecret, opened)
+
+	other, _ := newSecretBox("other")
+	_, err = other.open(sealed)
+	assert.Error(t, err)
+}
@@ -4,20 +4,55 @@ import (
 	"context"
 	"errors"
 
-	"rdp/services/api/models"
+	"rdp-platform/rdp-api/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// User service errors
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUsernameExists     = errors.New("username already exists")
+	ErrEmailExists        = errors.New("email already exists")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserDisabled       = errors.New("user account is disabled")
+)
+
+// Audit actions for profile changes
+const (
+	AuditActionUserUpdated     = "user_updated"
+	AuditActionUserRoleChanged = "user_role_changed"
+)
+
 // UserService handles user business logic
 type UserService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	authConfig  models.AuthConfig
+	revocations *revocationCache
+	sessions    *SessionService
+	security    *SecurityService
 }
 
 // NewUserService creates a new UserService
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, authConfig models.AuthConfig) *UserService {
+	authConfig = withPasswordDefaults(authConfig)
+	authConfig = withPersonalTokenDefaults(authConfig)
+	authConfig = withMFADefaults(authConfig)
+	return &UserService{
+		db:          db,
+		authConfig:  authConfig,
+		revocations: newRevocationCache(db, authConfig.RevocationSyncInterval),
+		sessions:    NewSessionService(db, authConfig.Session),
+		security:    NewSecurityService(db),
+	}
+}
+
+// Sessions returns the session service used for logins, so background
+// cleanup runs on the same policy
+func (s *UserService) Sessions() *SessionService {
+	return s.sessions
 }
 
 // ListUsers returns paginated users
@@ -68,7 +103,7 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User,
 
 	if err := s.db.First(&user, "id = ?", uid).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -82,7 +117,7 @@ func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*
 
 	if err := s.db.First(&user, "username = ?", username).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -96,7 +131,7 @@ func (s *UserService) GetUserByCasdoorID(ctx context.Context, casdoorID string)
 
 	if err := s.db.First(&user, "casdoor_id = ?", casdoorID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -104,54 +139,126 @@ func (s *UserService) GetUserByCasdoorID(ctx context.Context, casdoorID string)
 	return &user, nil
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
+// CreateUser creates a new user with a hashed password
+func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	if req.Role == "" {
+		req.Role = models.RoleDesigner
+	}
+	if !models.IsValidRole(req.Role) {
+		return nil, ErrInvalidRole
+	}
+	if err := ValidatePasswordPolicy(s.authConfig.Password, req.Password); err != nil {
+		return nil, err
+	}
+
 	// Check if username exists
 	var count int64
-	if err := s.db.Model(&models.User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
-		return err
+	if err := s.db.Model(&models.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+		return nil, err
 	}
 	if count > 0 {
-		return errors.New("username already exists")
+		return nil, ErrUsernameExists
 	}
 
 	// Check if email exists (if provided)
-	if user.Email != nil && *user.Email != "" {
-		if err := s.db.Model(&models.User{}).Where("email = ?", *user.Email).Count(&count).Error; err != nil {
-			return err
+	if req.Email != "" {
+		if err := s.db.Model(&models.User{}).Where("email = ?", req.Email).Count(&count).Error; err != nil {
+			return nil, err
 		}
 		if count > 0 {
-			return errors.New("email already exists")
+			return nil, ErrEmailExists
 		}
 	}
 
-	user.ID = uuid.New()
-	if user.ID == uuid.Nil {
-		user.ID = uuid.New()
+	user := &models.User{
+		ID:          uuid.New(),
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Role:        req.Role,
+		IsActive:    true,
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = req.Username
+	}
+	if req.Email != "" {
+		user.Email = &req.Email
+	}
+	if req.Phone != "" {
+		user.Phone = &req.Phone
+	}
+	if req.Team != "" {
+		user.Team = &req.Team
+	}
+	if req.ProductLine != "" {
+		user.ProductLine = &req.ProductLine
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		return nil, err
 	}
 
-	return s.db.Create(user).Error
+	if err := s.db.Create(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
-// UpdateUser updates an existing user
+// UpdateUser updates an existing user. Passwords are not accepted here:
+// users change theirs with the old password (UpdatePassword) and
+// administrators force a reset (ForcePasswordReset). The changed fields are
+// audited with their previous values; a role change is audited as a
+// permission change.
 func (s *UserService) UpdateUser(ctx context.Context, id string, updates map[string]interface{}) (*models.User, error) {
 	uid, err := uuid.Parse(id)
 	if err != nil {
 		return nil, errors.New("invalid user ID")
 	}
+	for _, field := range []string{"password", "password_hash"} {
+		if _, ok := updates[field]; ok {
+			return nil, ErrPasswordNotUpdatable
+		}
+	}
+	before, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
 	result := s.db.Model(&models.User{}).Where("id = ?", uid).Updates(updates)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	if result.RowsAffected == 0 {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
+	}
+	// Access tokens are checked against their session, so a deactivated
+	// user is signed out everywhere
+	if active, ok := updates["is_active"].(bool); ok && !active {
+		if err := s.sessions.RevokeAllUserSessions(ctx, id); err != nil {
+			return nil, err
+		}
 	}
 
-	return s.GetUserByID(ctx, id)
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	if details := auditDiff(before, user, fields...); len(details.Changes) > 0 {
+		action := AuditActionUserUpdated
+		if _, ok := details.Changes["role"]; ok {
+			action = AuditActionUserRoleChanged
+		}
+		if err := s.auditUserEvent(ctx, action, user, details); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
 }
 
-// DeleteUser soft deletes a user
+// DeleteUser soft deletes a user and revokes their sessions
 func (s *UserService) DeleteUser(ctx context.Context, id string) error {
 	uid, err := uuid.Parse(id)
 	if err != nil {
@@ -163,10 +270,10 @@ func (s *UserService) DeleteUser(ctx context.Context, id string) error {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
 
-	return nil
+	return s.sessions.RevokeAllUserSessions(ctx, id)
 }
 
 // UpdateLastLogin updates the last login timestamp
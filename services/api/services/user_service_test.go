@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -29,7 +32,8 @@ func (s *UserServiceTestSuite) SetupSuite() {
 	}
 
 	// 自动迁移
-	err = s.db.AutoMigrate(&models.User{}, &models.TokenBlacklist{})
+	err = s.db.AutoMigrate(&models.User{}, &models.TokenBlacklist{}, &models.RefreshToken{}, &models.LoginLog{}, &models.Session{},
+		&models.PasswordHistory{}, &models.PersonalAccessToken{}, &models.UserMFA{}, &models.MFARecoveryCode{}, &models.AuditLog{}, &models.AuditChainHead{})
 	if err != nil {
 		s.T().Fatal(err)
 	}
@@ -55,6 +59,14 @@ func (s *UserServiceTestSuite) TearDownSuite() {
 func (s *UserServiceTestSuite) SetupTest() {
 	// 清空表
 	s.db.Exec("DELETE FROM token_blacklists")
+	s.db.Exec("DELETE FROM refresh_tokens")
+	s.db.Exec("DELETE FROM login_logs")
+	s.db.Exec("DELETE FROM sessions")
+	s.db.Exec("DELETE FROM password_histories")
+	s.db.Exec("DELETE FROM personal_access_tokens")
+	s.db.Exec("DELETE FROM user_mfa")
+	s.db.Exec("DELETE FROM mfa_recovery_codes")
+	s.db.Exec("DELETE FROM audit_logs")
 	s.db.Exec("DELETE FROM users")
 }
 
@@ -78,7 +90,7 @@ func (s *UserServiceTestSuite) TestCreateUser() {
 	assert.NotNil(s.T(), user)
 	assert.Equal(s.T(), req.Username, user.Username)
 	assert.Equal(s.T(), req.DisplayName, user.DisplayName)
-	assert.Equal(s.T(), req.Email, user.Email)
+	assert.Equal(s.T(), req.Email, *user.Email)
 	assert.Equal(s.T(), req.Role, user.Role)
 	assert.NotEmpty(s.T(), user.ID)
 	assert.NotEmpty(s.T(), user.PasswordHash)
@@ -171,7 +183,7 @@ func (s *UserServiceTestSuite) TestGetUserByID() {
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
 	// 获取用户
-	user, err := s.userService.GetUserByID(s.ctx, created.ID)
+	user, err := s.userService.GetUserByID(s.ctx, created.ID.String())
 	assert.NoError(s.T(), err)
 	assert.NotNil(s.T(), user)
 	assert.Equal(s.T(), created.ID, user.ID)
@@ -180,7 +192,7 @@ func (s *UserServiceTestSuite) TestGetUserByID() {
 
 // TestGetUserByID_NotFound 测试用户不存在
 func (s *UserServiceTestSuite) TestGetUserByID_NotFound() {
-	_, err := s.userService.GetUserByID(s.ctx, "non-existent-id")
+	_, err := s.userService.GetUserByID(s.ctx, uuid.NewString())
 	assert.Error(s.T(), err)
 	assert.Equal(s.T(), ErrUserNotFound, err)
 }
@@ -218,19 +230,14 @@ func (s *UserServiceTestSuite) TestGetUserList() {
 		assert.NoError(s.T(), err)
 	}
 
-	query := models.DefaultUserListQuery()
-	query.Page = 1
-	query.PageSize = 10
-
-	resp, err := s.userService.GetUserList(s.ctx, query)
+	users, total, err := s.userService.ListUsers(s.ctx, 1, 3, nil)
 	assert.NoError(s.T(), err)
-	assert.NotNil(s.T(), resp)
-	assert.Equal(s.T(), int64(5), resp.Total)
-	assert.Equal(s.T(), 1, resp.Page)
+	assert.Equal(s.T(), int64(5), total)
+	assert.Len(s.T(), users, 3)
 }
 
-// TestGetUserList_WithKeyword 测试关键词搜索
-func (s *UserServiceTestSuite) TestGetUserList_WithKeyword() {
+// TestGetUserList_WithFilter 测试按角色筛选
+func (s *UserServiceTestSuite) TestGetUserList_WithFilter() {
 	req1 := models.CreateUserRequest{
 		Username:    "alice",
 		Password:    "TestPass123",
@@ -245,16 +252,14 @@ func (s *UserServiceTestSuite) TestGetUserList_WithKeyword() {
 		Password:    "TestPass123",
 		DisplayName: "Bob Johnson",
 		Email:       "bob@example.com",
-		Role:        models.RoleDesigner,
+		Role:        models.RoleTeamLeader,
 	}
 	_, _ = s.userService.CreateUser(s.ctx, req2)
 
-	query := models.DefaultUserListQuery()
-	query.Keyword = "alice"
-
-	resp, err := s.userService.GetUserList(s.ctx, query)
+	users, total, err := s.userService.ListUsers(s.ctx, 1, 10, map[string]interface{}{"role": models.RoleTeamLeader})
 	assert.NoError(s.T(), err)
-	assert.Equal(s.T(), int64(1), resp.Total)
+	assert.Equal(s.T(), int64(1), total)
+	assert.Equal(s.T(), "bob", users[0].Username)
 }
 
 // TestUpdateUser 测试更新用户
@@ -269,15 +274,15 @@ func (s *UserServiceTestSuite) TestUpdateUser() {
 
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
-	updateReq := models.UpdateUserRequest{
-		DisplayName: "Updated Name",
-		Bio:         "New bio",
+	updates := map[string]interface{}{
+		"display_name": "Updated Name",
+		"bio":          "New bio",
 	}
 
-	updated, err := s.userService.UpdateUser(s.ctx, created.ID, updateReq, false)
+	updated, err := s.userService.UpdateUser(s.ctx, created.ID.String(), updates)
 	assert.NoError(s.T(), err)
 	assert.Equal(s.T(), "Updated Name", updated.DisplayName)
-	assert.Equal(s.T(), "New bio", updated.Bio)
+	assert.Equal(s.T(), "New bio", *updated.Bio)
 }
 
 // TestUpdateUser_AsAdmin 测试管理员更新用户
@@ -292,17 +297,43 @@ func (s *UserServiceTestSuite) TestUpdateUser_AsAdmin() {
 
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
-	updateReq := models.UpdateUserRequest{
-		Role:     models.RoleTeamLeader,
-		IsActive: boolPtr(false),
+	updates := map[string]interface{}{
+		"role":      models.RoleTeamLeader,
+		"is_active": false,
 	}
 
-	updated, err := s.userService.UpdateUser(s.ctx, created.ID, updateReq, true)
+	updated, err := s.userService.UpdateUser(s.ctx, created.ID.String(), updates)
 	assert.NoError(s.T(), err)
 	assert.Equal(s.T(), models.RoleTeamLeader, updated.Role)
 	assert.False(s.T(), updated.IsActive)
 }
 
+// TestUpdateUser_RejectsPassword 测试通用更新接口不能修改密码
+func (s *UserServiceTestSuite) TestUpdateUser_RejectsPassword() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+
+	for _, field := range []string{"password", "password_hash"} {
+		_, err := s.userService.UpdateUser(s.ctx, created.ID.String(), map[string]interface{}{
+			"display_name": "Updated Name",
+			field:          "NewPass456",
+		})
+		assert.ErrorIs(s.T(), err, ErrPasswordNotUpdatable, field)
+	}
+
+	// 密码与其他字段均未修改
+	user, err := s.userService.GetUserByID(s.ctx, created.ID.String())
+	require.NoError(s.T(), err)
+	assert.True(s.T(), user.CheckPassword("TestPass123"))
+	assert.Equal(s.T(), "Test User", user.DisplayName)
+}
+
 // TestDeleteUser 测试删除用户
 func (s *UserServiceTestSuite) TestDeleteUser() {
 	req := models.CreateUserRequest{
@@ -315,30 +346,38 @@ func (s *UserServiceTestSuite) TestDeleteUser() {
 
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
-	err := s.userService.DeleteUser(s.ctx, created.ID)
+	err := s.userService.DeleteUser(s.ctx, created.ID.String())
 	assert.NoError(s.T(), err)
 
-	// 确认用户已删除
-	_, err = s.userService.GetUserByID(s.ctx, created.ID)
-	assert.Error(s.T(), err)
+	// 删除为软删除，用户被停用
+	user, err := s.userService.GetUserByID(s.ctx, created.ID.String())
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), user.IsActive)
+
+	err = s.userService.DeleteUser(s.ctx, uuid.NewString())
 	assert.Equal(s.T(), ErrUserNotFound, err)
 }
 
-// TestDeleteUser_Admin 测试不能删除管理员
-func (s *UserServiceTestSuite) TestDeleteUser_Admin() {
+// TestDeactivateUser_RevokesSessions 测试停用用户后已签发的访问令牌失效
+func (s *UserServiceTestSuite) TestDeactivateUser_RevokesSessions() {
 	req := models.CreateUserRequest{
-		Username:    "adminuser",
+		Username:    "testuser",
 		Password:    "TestPass123",
-		DisplayName: "Admin User",
-		Email:       "admin@example.com",
-		Role:        models.RoleAdmin,
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
 	}
 
 	created, _ := s.userService.CreateUser(s.ctx, req)
+	resp, err := s.userService.StartSession(s.ctx, created, "", "")
+	require.NoError(s.T(), err)
+
+	_, err = s.userService.UpdateUser(s.ctx, created.ID.String(), map[string]interface{}{"is_active": false})
+	require.NoError(s.T(), err)
 
-	err := s.userService.DeleteUser(s.ctx, created.ID)
+	_, err = s.userService.ValidateToken(s.ctx, resp.AccessToken)
+	assert.Equal(s.T(), ErrSessionRevoked, err)
+	_, err = s.userService.RefreshAccessToken(s.ctx, resp.RefreshToken)
 	assert.Error(s.T(), err)
-	assert.Equal(s.T(), ErrCannotDeleteAdmin, err)
 }
 
 // TestValidateCredentials 测试验证凭据
@@ -382,10 +421,7 @@ func (s *UserServiceTestSuite) TestValidateCredentials_DisabledUser() {
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
 	// 禁用用户
-	updateReq := models.UpdateUserRequest{
-		IsActive: boolPtr(false),
-	}
-	_, _ = s.userService.UpdateUser(s.ctx, created.ID, updateReq, true)
+	_, _ = s.userService.UpdateUser(s.ctx, created.ID.String(), map[string]interface{}{"is_active": false})
 
 	// 尝试登录
 	_, err := s.userService.ValidateCredentials(s.ctx, "testuser", "TestPass123")
@@ -396,7 +432,7 @@ func (s *UserServiceTestSuite) TestValidateCredentials_DisabledUser() {
 // TestGenerateTokenPair 测试生成令牌对
 func (s *UserServiceTestSuite) TestGenerateTokenPair() {
 	user := &models.User{
-		ID:          "test-id",
+		ID:          uuid.New(),
 		Username:    "testuser",
 		DisplayName: "Test User",
 		Role:        models.RoleDesigner,
@@ -433,6 +469,147 @@ func (s *UserServiceTestSuite) TestRefreshAccessToken() {
 	assert.Equal(s.T(), "Bearer", refreshResp.TokenType)
 }
 
+// TestRefreshAccessToken_Rotation 测试刷新令牌轮换
+func (s *UserServiceTestSuite) TestRefreshAccessToken_Rotation() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	resp, _ := s.userService.GenerateTokenPair(created)
+
+	refreshResp, err := s.userService.RefreshAccessToken(s.ctx, resp.RefreshToken)
+	assert.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), refreshResp.RefreshToken)
+	assert.NotEqual(s.T(), resp.RefreshToken, refreshResp.RefreshToken)
+
+	// 新的刷新令牌可以继续使用
+	_, err = s.userService.RefreshAccessToken(s.ctx, refreshResp.RefreshToken)
+	assert.NoError(s.T(), err)
+}
+
+// TestRefreshAccessToken_ReuseRevokesFamily 测试刷新令牌重放时撤销整个令牌族
+func (s *UserServiceTestSuite) TestRefreshAccessToken_ReuseRevokesFamily() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	resp, _ := s.userService.GenerateTokenPair(created)
+
+	rotated, err := s.userService.RefreshAccessToken(s.ctx, resp.RefreshToken)
+	assert.NoError(s.T(), err)
+
+	// 重放已轮换的令牌
+	_, err = s.userService.RefreshAccessToken(s.ctx, resp.RefreshToken)
+	assert.Equal(s.T(), ErrRefreshTokenReused, err)
+
+	// 同一令牌族的令牌全部失效
+	_, err = s.userService.RefreshAccessToken(s.ctx, rotated.RefreshToken)
+	assert.Equal(s.T(), ErrTokenBlacklisted, err)
+	_, err = s.userService.ValidateToken(s.ctx, rotated.AccessToken)
+	assert.Equal(s.T(), ErrTokenBlacklisted, err)
+
+	// 记录登录失败日志
+	var count int64
+	s.db.Model(&models.LoginLog{}).Where("user_id = ? AND success = ?", created.ID, false).Count(&count)
+	assert.Equal(s.T(), int64(1), count)
+}
+
+// TestStartSession_EvictsOldest 测试超过并发会话上限时踢出最早的会话
+func (s *UserServiceTestSuite) TestStartSession_EvictsOldest() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+
+	var logins []*models.LoginResponse
+	for i := 0; i < DefaultMaxConcurrentSessions+1; i++ {
+		resp, err := s.userService.StartSession(s.ctx, created, "127.0.0.1", "test-agent")
+		assert.NoError(s.T(), err)
+		logins = append(logins, resp)
+	}
+
+	_, err := s.userService.ValidateToken(s.ctx, logins[0].AccessToken)
+	assert.Equal(s.T(), ErrSessionRevoked, err)
+	for _, resp := range logins[1:] {
+		_, err := s.userService.ValidateToken(s.ctx, resp.AccessToken)
+		assert.NoError(s.T(), err)
+	}
+}
+
+// TestValidateToken_IdleTimeout 测试会话空闲超时
+func (s *UserServiceTestSuite) TestValidateToken_IdleTimeout() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	resp, _ := s.userService.StartSession(s.ctx, created, "", "")
+
+	claims, err := s.userService.ValidateToken(s.ctx, resp.AccessToken)
+	assert.NoError(s.T(), err)
+
+	info, err := s.userService.GetSessionInfo(s.ctx, claims.SessionID)
+	assert.NoError(s.T(), err)
+	assert.LessOrEqual(s.T(), info.RemainingSeconds, int(DefaultSessionIdleTimeout.Seconds()))
+
+	// 模拟超过空闲时间未活动
+	s.db.Model(&models.Session{}).Where("id = ?", claims.SessionID).
+		Update("last_active_at", time.Now().UTC().Add(-DefaultSessionIdleTimeout-time.Minute))
+
+	_, err = s.userService.ValidateToken(s.ctx, resp.AccessToken)
+	assert.Equal(s.T(), ErrSessionIdleTimeout, err)
+	_, err = s.userService.RefreshAccessToken(s.ctx, resp.RefreshToken)
+	assert.Equal(s.T(), ErrSessionIdleTimeout, err)
+}
+
+// TestValidateToken_TouchThrottled 测试会话活动时间每分钟最多写入一次
+func (s *UserServiceTestSuite) TestValidateToken_TouchThrottled() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+		Role:        models.RoleDesigner,
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	resp, _ := s.userService.StartSession(s.ctx, created, "", "")
+	claims, err := s.userService.ValidateToken(s.ctx, resp.AccessToken)
+	require.NoError(s.T(), err)
+
+	lastActive := func() time.Time {
+		var session models.Session
+		require.NoError(s.T(), s.db.First(&session, "id = ?", claims.SessionID).Error)
+		return session.LastActiveAt
+	}
+
+	recent := time.Now().UTC().Add(-30 * time.Second)
+	s.db.Model(&models.Session{}).Where("id = ?", claims.SessionID).Update("last_active_at", recent)
+	_, err = s.userService.ValidateToken(s.ctx, resp.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), recent.Equal(lastActive()))
+
+	stale := time.Now().UTC().Add(-2 * time.Minute)
+	s.db.Model(&models.Session{}).Where("id = ?", claims.SessionID).Update("last_active_at", stale)
+	_, err = s.userService.ValidateToken(s.ctx, resp.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), lastActive().After(stale.Add(time.Minute)))
+}
+
 // TestRefreshAccessToken_InvalidToken 测试无效令牌刷新
 func (s *UserServiceTestSuite) TestRefreshAccessToken_InvalidToken() {
 	_, err := s.userService.RefreshAccessToken(s.ctx, "invalid-token")
@@ -443,7 +620,7 @@ func (s *UserServiceTestSuite) TestRefreshAccessToken_InvalidToken() {
 // TestLogout 测试登出
 func (s *UserServiceTestSuite) TestLogout() {
 	user := &models.User{
-		ID:          "test-id",
+		ID:          uuid.New(),
 		Username:    "testuser",
 		DisplayName: "Test User",
 		Role:        models.RoleDesigner,
@@ -474,7 +651,7 @@ func (s *UserServiceTestSuite) TestUpdatePassword() {
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
 	// 更新密码
-	err := s.userService.UpdatePassword(s.ctx, created.ID, "OldPass123", "NewPass456")
+	err := s.userService.UpdatePassword(s.ctx, created.ID.String(), "OldPass123", "NewPass456")
 	assert.NoError(s.T(), err)
 
 	// 使用新密码登录
@@ -499,7 +676,7 @@ func (s *UserServiceTestSuite) TestResetPassword() {
 	created, _ := s.userService.CreateUser(s.ctx, req)
 
 	// 重置密码
-	err := s.userService.ResetPassword(s.ctx, created.ID, "NewPass456")
+	err := s.userService.ResetPassword(s.ctx, created.ID.String(), "NewPass456")
 	assert.NoError(s.T(), err)
 
 	// 使用新密码登录
@@ -507,6 +684,236 @@ func (s *UserServiceTestSuite) TestResetPassword() {
 	assert.NoError(s.T(), err)
 }
 
+// TestCreateUser_WeakPassword 测试密码复杂度校验
+func (s *UserServiceTestSuite) TestCreateUser_WeakPassword() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "short",
+		DisplayName: "Test User",
+	}
+
+	_, err := s.userService.CreateUser(s.ctx, req)
+	assert.ErrorIs(s.T(), err, ErrPasswordPolicy)
+}
+
+// TestUpdatePassword_History 测试密码历史限制
+func (s *UserServiceTestSuite) TestUpdatePassword_History() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "OldPass123",
+		DisplayName: "Test User",
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	id := created.ID.String()
+
+	err := s.userService.UpdatePassword(s.ctx, id, "OldPass123", "OldPass123")
+	assert.Equal(s.T(), ErrPasswordReused, err)
+
+	err = s.userService.UpdatePassword(s.ctx, id, "OldPass123", "NewPass456")
+	assert.NoError(s.T(), err)
+
+	// 最近使用过的密码不能再次使用
+	err = s.userService.UpdatePassword(s.ctx, id, "NewPass456", "OldPass123")
+	assert.Equal(s.T(), ErrPasswordReused, err)
+}
+
+// TestValidateCredentials_Lockout 测试连续登录失败锁定账户
+func (s *UserServiceTestSuite) TestValidateCredentials_Lockout() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+
+	for i := 0; i < DefaultMaxFailedLogins-1; i++ {
+		_, err := s.userService.ValidateCredentials(s.ctx, "testuser", "WrongPass1")
+		assert.Equal(s.T(), ErrInvalidCredentials, err)
+	}
+	_, err := s.userService.ValidateCredentials(s.ctx, "testuser", "WrongPass1")
+	assert.Equal(s.T(), ErrAccountLocked, err)
+
+	// 锁定期间正确密码也无法登录
+	_, err = s.userService.ValidateCredentials(s.ctx, "testuser", "TestPass123")
+	assert.Equal(s.T(), ErrAccountLocked, err)
+
+	// 管理员解锁
+	err = s.userService.UnlockAccount(s.ctx, created.ID.String())
+	assert.NoError(s.T(), err)
+	_, err = s.userService.ValidateCredentials(s.ctx, "testuser", "TestPass123")
+	assert.NoError(s.T(), err)
+
+	var count int64
+	s.db.Model(&models.AuditLog{}).Where("resource_id = ?", created.ID.String()).
+		Where("action IN ?", []string{AuditActionAccountLocked, AuditActionAccountUnlocked}).Count(&count)
+	assert.Equal(s.T(), int64(2), count)
+}
+
+// TestPersonalAccessToken_Lifecycle 测试个人访问令牌的创建、使用与吊销
+func (s *UserServiceTestSuite) TestPersonalAccessToken_Lifecycle() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+	}
+
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	id := created.ID.String()
+
+	_, err := s.userService.CreatePersonalAccessToken(s.ctx, id, &models.CreatePersonalAccessTokenRequest{
+		Name: "ci", Scopes: []string{"admin"}, ExpiresInDays: 30,
+	})
+	assert.ErrorIs(s.T(), err, ErrPersonalTokenRequest)
+
+	resp, err := s.userService.CreatePersonalAccessToken(s.ctx, id, &models.CreatePersonalAccessTokenRequest{
+		Name: "desktop helper", Scopes: []string{models.ScopeRead}, ExpiresInDays: 30,
+	})
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), strings.HasPrefix(resp.Token, models.PersonalAccessTokenPrefix))
+	assert.NotEqual(s.T(), resp.Token, resp.TokenHash)
+
+	// 使用令牌时记录最后使用时间和IP
+	ctx := context.WithValue(s.ctx, "ip_address", "10.0.0.8")
+	claims, err := s.userService.ValidatePersonalAccessToken(ctx, resp.Token)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), id, claims.UserID)
+	assert.Equal(s.T(), models.TokenTypePersonal, claims.TokenType)
+	assert.Equal(s.T(), []string{models.ScopeRead}, claims.Scopes)
+
+	tokens, err := s.userService.ListPersonalAccessTokens(s.ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), tokens, 1)
+	assert.NotNil(s.T(), tokens[0].LastUsedAt)
+	assert.Equal(s.T(), "10.0.0.8", *tokens[0].LastUsedIP)
+
+	// 吊销后立即失效
+	err = s.userService.RevokePersonalAccessToken(s.ctx, id, resp.ID.String())
+	assert.NoError(s.T(), err)
+	_, err = s.userService.ValidatePersonalAccessToken(s.ctx, resp.Token)
+	assert.ErrorIs(s.T(), err, ErrPersonalTokenInvalid)
+
+	// 其他用户不能吊销不属于自己的令牌
+	err = s.userService.RevokePersonalAccessToken(s.ctx, uuid.New().String(), resp.ID.String())
+	assert.ErrorIs(s.T(), err, ErrPersonalTokenNotFound)
+}
+
+// TestMFA_RequiredEnrollmentAndLogin 测试强制角色首次登录注册TOTP及后续二次验证
+func (s *UserServiceTestSuite) TestMFA_RequiredEnrollmentAndLogin() {
+	req := models.CreateUserRequest{
+		Username:    "leader",
+		Password:    "TestPass123",
+		DisplayName: "Dept Leader",
+		Role:        models.RoleDeptLeader,
+	}
+	s.userService.CreateUser(s.ctx, req)
+
+	user, err := s.userService.ValidateCredentials(s.ctx, "leader", "TestPass123")
+	assert.NoError(s.T(), err)
+	challenge, err := s.userService.BeginMFAChallenge(s.ctx, user)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), challenge.EnrollmentRequired)
+
+	// 注册令牌不能直接用于二次验证
+	_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, "123456", "")
+	assert.ErrorIs(s.T(), err, ErrInvalidToken)
+
+	enrollment, err := s.userService.BeginMFAEnrollmentWithChallenge(s.ctx, challenge.ChallengeToken)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/"))
+
+	step := totpStep(time.Now())
+	code, _ := totpCode(enrollment.Secret, step)
+	_, recoveryCodes, err := s.userService.CompleteMFAEnrollment(s.ctx, challenge.ChallengeToken, code)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), recoveryCodes, DefaultMFARecoveryCodeCount)
+
+	// 已注册用户登录需要验证码
+	challenge, err = s.userService.BeginMFAChallenge(s.ctx, user)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), challenge.EnrollmentRequired)
+
+	// 已使用过的验证码不能重放
+	_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, code, "")
+	assert.ErrorIs(s.T(), err, ErrMFAInvalidCode)
+
+	next, _ := totpCode(enrollment.Secret, step+1)
+	verified, err := s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, next, "")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), user.ID, verified.ID)
+
+	// 挑战令牌只能使用一次
+	_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, next, "")
+	assert.ErrorIs(s.T(), err, ErrTokenBlacklisted)
+
+	// 恢复码不区分大小写且只能使用一次
+	challenge, _ = s.userService.BeginMFAChallenge(s.ctx, user)
+	_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, "", strings.ToLower(recoveryCodes[0]))
+	assert.NoError(s.T(), err)
+	challenge, _ = s.userService.BeginMFAChallenge(s.ctx, user)
+	_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, "", recoveryCodes[0])
+	assert.ErrorIs(s.T(), err, ErrMFAInvalidCode)
+
+	status, err := s.userService.GetMFAStatus(s.ctx, user.ID.String())
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), status.Enabled)
+	assert.True(s.T(), status.Required)
+	assert.Equal(s.T(), DefaultMFARecoveryCodeCount-1, status.RecoveryCodesRemaining)
+
+	// 强制角色不能自行关闭
+	err = s.userService.DisableMFA(s.ctx, user.ID.String(), code)
+	assert.ErrorIs(s.T(), err, ErrMFARequired)
+}
+
+// TestMFA_FailedCodesLockAccount 测试二次验证失败记录日志并触发锁定
+func (s *UserServiceTestSuite) TestMFA_FailedCodesLockAccount() {
+	req := models.CreateUserRequest{
+		Username:    "testuser",
+		Password:    "TestPass123",
+		DisplayName: "Test User",
+	}
+	created, _ := s.userService.CreateUser(s.ctx, req)
+	id := created.ID.String()
+
+	// 非强制角色无需二次验证
+	challenge, err := s.userService.BeginMFAChallenge(s.ctx, created)
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), challenge)
+
+	enrollment, err := s.userService.BeginMFAEnrollment(s.ctx, id)
+	assert.NoError(s.T(), err)
+	code, _ := totpCode(enrollment.Secret, totpStep(time.Now()))
+	_, err = s.userService.ConfirmMFAEnrollment(s.ctx, id, "000000")
+	assert.ErrorIs(s.T(), err, ErrMFAInvalidCode)
+	_, err = s.userService.ConfirmMFAEnrollment(s.ctx, id, code)
+	assert.NoError(s.T(), err)
+
+	challenge, err = s.userService.BeginMFAChallenge(s.ctx, created)
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), challenge)
+
+	wrong := "000000"
+	for i := 0; i < DefaultMaxFailedLogins-1; i++ {
+		_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, wrong, "")
+		assert.ErrorIs(s.T(), err, ErrMFAInvalidCode)
+	}
+	_, err = s.userService.VerifyMFAChallenge(s.ctx, challenge.ChallengeToken, wrong, "")
+	assert.ErrorIs(s.T(), err, ErrAccountLocked)
+
+	var failures int64
+	s.db.Model(&models.LoginLog{}).
+		Where("user_id = ? AND provider = ? AND failure_reason = ?", created.ID, LoginProviderTOTP, LoginFailureInvalidMFACode).
+		Count(&failures)
+	assert.Equal(s.T(), int64(DefaultMaxFailedLogins), failures)
+
+	// 管理员重置后可重新注册
+	err = s.userService.ResetMFA(s.ctx, id)
+	assert.NoError(s.T(), err)
+	status, _ := s.userService.GetMFAStatus(s.ctx, id)
+	assert.False(s.T(), status.Enabled)
+}
+
 // TestIsAdmin 测试管理员检查
 func (s *UserServiceTestSuite) TestIsAdmin() {
 	adminUser := &models.User{Role: models.RoleAdmin}
@@ -531,8 +938,3 @@ func (s *UserServiceTestSuite) TestHasRole() {
 	assert.True(s.T(), designer.HasRole(models.RoleDesigner))
 	assert.False(s.T(), designer.HasRole(models.RoleTeamLeader))
 }
-
-// Helper function
-func boolPtr(b bool) *bool {
-	return &b
-}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// ErrWatermarkUnsupported is returned for file types a watermark cannot be
+// applied to; such files cannot be exported at watermarked levels
+var ErrWatermarkUnsupported = errors.New("file type cannot be watermarked")
+
+func init() {
+	// pdfcpu would otherwise create, and exit on failing to create, a
+	// configuration directory in the user's home
+	api.DisableConfigDir()
+}
+
+// watermarkText is the visible mark on an exported file (SRS-SECURITY-001)
+func watermarkText(username string, at time.Time) string {
+	return fmt.Sprintf("%s %s", username, at.Format("2006-01-02 15:04:05"))
+}
+
+// applyWatermark marks content according to its file type: PDFs and images
+// are stamped, office documents get a header and footer and text files a
+// first and last line
+func applyWatermark(content []byte, filename, text string) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pdf":
+		return watermarkPDF(content, text)
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return watermarkImage(content, text)
+	case ".docx":
+		return watermarkDocx(content, text)
+	case ".xlsx":
+		return watermarkXlsx(content, text)
+	}
+	if strings.HasPrefix(http.DetectContentType(content), "text/") {
+		return watermarkTextFile(content, text), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWatermarkUnsupported, filepath.Ext(filename))
+}
+
+// watermarkPDF stamps the text diagonally across every page
+func watermarkPDF(content []byte, text string) ([]byte, error) {
+	wm, err := api.TextWatermark(text, "font:Helvetica, points:36, rot:45, opacity:0.3, scale:0.8 rel, color:0.5 0.5 0.5", true, false, types.POINTS)
+	if err != nil {
+		return nil, err
+	}
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+
+	var out bytes.Buffer
+	if err := api.AddWatermarks(bytes.NewReader(content), &out, nil, wm, conf); err != nil {
+		return nil, fmt.Errorf("failed to watermark PDF: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// watermarkImage tiles the text over the image in translucent grey and
+// re-encodes it in its original format
+func watermarkImage(content []byte, text string) ([]byte, error) {
+	src, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	bounds := src.Bounds()
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, bounds, src, bounds.Min, draw.Src)
+
+	// Render the text once at the bitmap font's size, then scale it so it
+	// spans about a third of the image width
+	face := basicfont.Face7x13
+	label := image.NewAlpha(image.Rect(0, 0, font.MeasureString(face, text).Ceil(), face.Height))
+	drawer := &font.Drawer{Dst: label, Src: image.Opaque, Face: face, Dot: fixed.P(0, face.Ascent)}
+	drawer.DrawString(text)
+
+	scale := bounds.Dx() / (3 * label.Bounds().Dx())
+	if scale < 1 {
+		scale = 1
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, label.Bounds().Dx()*scale, label.Bounds().Dy()*scale))
+	xdraw.NearestNeighbor.Scale(mask, mask.Bounds(), label, label.Bounds(), draw.Src, nil)
+
+	ink := image.NewUniform(color.NRGBA{R: 128, G: 128, B: 128, A: 96})
+	stepX, stepY := mask.Bounds().Dx()*3/2, mask.Bounds().Dy()*4
+	for row, y := 0, bounds.Min.Y; y < bounds.Max.Y; row, y = row+1, y+stepY {
+		// Offset every other row so the marks form a diagonal pattern
+		for x := bounds.Min.X - (row%2)*stepX/2; x < bounds.Max.X; x += stepX {
+			r := mask.Bounds().Add(image.Pt(x, y))
+			draw.DrawMask(canvas, r, ink, image.Point{}, mask, image.Point{}, draw.Over)
+		}
+	}
+
+	var out bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&out, canvas, &jpeg.Options{Quality: 90})
+	case "gif":
+		err = gif.Encode(&out, canvas, nil)
+	default:
+		err = png.Encode(&out, canvas)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// watermarkTextFile adds the mark as the first and last line
+func watermarkTextFile(content []byte, text string) []byte {
+	line := "==== " + text + " ===="
+	var out bytes.Buffer
+	out.WriteString(line + "\n")
+	out.Write(content)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	out.WriteString(line + "\n")
+	return out.Bytes()
+}
+
+// Parts added to Word documents
+const (
+	docxHeaderPart = "word/rdp-watermark-header.xml"
+	docxFooterPart = "word/rdp-watermark-footer.xml"
+)
+
+var (
+	docxSectionStart = regexp.MustCompile(`<w:sectPr(\s[^>]*)?>`)
+	docxEmptySection = regexp.MustCompile(`<w:sectPr(\s[^>]*)?/>`)
+	docxReference    = regexp.MustCompile(`<w:(header|footer)Reference\b[^>]*/>`)
+)
+
+// watermarkDocx replaces the header and footer of every section with the
+// mark, on first, odd and even pages alike
+func watermarkDocx(content []byte, text string) ([]byte, error) {
+	paragraph := `<w:p><w:pPr><w:jc w:val="center"/></w:pPr><w:r><w:rPr><w:color w:val="C00000"/></w:rPr>` +
+		`<w:t xml:space="preserve">` + xmlEscape(text) + `</w:t></w:r></w:p>`
+	ns := `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	added := map[string]string{
+		docxHeaderPart: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<w:hdr ` + ns + `>` + paragraph + `</w:hdr>`,
+		docxFooterPart: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<w:ftr ` + ns + `>` + paragraph + `</w:ftr>`,
+	}
+
+	var references strings.Builder
+	for _, kind := range []string{"default", "first", "even"} {
+		references.WriteString(`<w:headerReference w:type="` + kind + `" r:id="rIdRdpWatermarkHeader"/>`)
+		references.WriteString(`<w:footerReference w:type="` + kind + `" r:id="rIdRdpWatermarkFooter"/>`)
+	}
+
+	return rewriteZip(content, added, func(name string, data []byte) ([]byte, error) {
+		switch name {
+		case "word/document.xml":
+			doc := docxReference.ReplaceAllString(string(data), "")
+			doc = docxEmptySection.ReplaceAllString(doc, "<w:sectPr$1></w:sectPr>")
+			if !docxSectionStart.MatchString(doc) {
+				return nil, fmt.Errorf("%w: document has no section properties", ErrWatermarkUnsupported)
+			}
+			return []byte(docxSectionStart.ReplaceAllString(doc, "${0}"+references.String())), nil
+		case "word/_rels/document.xml.rels":
+			rels := `<Relationship Id="rIdRdpWatermarkHeader" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/header" Target="rdp-watermark-header.xml"/>` +
+				`<Relationship Id="rIdRdpWatermarkFooter" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footer" Target="rdp-watermark-footer.xml"/>`
+			return insertBefore(data, "</Relationships>", rels)
+		case "[Content_Types].xml":
+			types := `<Override PartName="/` + docxHeaderPart + `" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.header+xml"/>` +
+				`<Override PartName="/` + docxFooterPart + `" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.footer+xml"/>`
+			return insertBefore(data, "</Types>", types)
+		}
+		return data, nil
+	})
+}
+
+var (
+	xlsxWorksheet    = regexp.MustCompile(`^xl/worksheets/[^/]+\.xml$`)
+	xlsxHeaderFooter = regexp.MustCompile(`(?s)<headerFooter\b[^>]*/>|<headerFooter\b.*?</headerFooter>`)
+	// Elements that follow headerFooter in the worksheet schema
+	xlsxAfterHeaderFooter = regexp.MustCompile(`<(rowBreaks|colBreaks|customProperties|cellWatches|ignoredErrors|smartTags|drawing|legacyDrawing|legacyDrawingHF|picture|oleObjects|controls|webPublishItems|tableParts|extLst)\b|</worksheet>`)
+)
+
+// watermarkXlsx sets the printed header and footer of every worksheet
+func watermarkXlsx(content []byte, text string) ([]byte, error) {
+	// & starts a format code in header text, so it is doubled first
+	mark := xmlEscape("&C" + strings.ReplaceAll(text, "&", "&&"))
+	headerFooter := `<headerFooter differentOddEven="0" differentFirst="0"><oddHeader>` + mark + `</oddHeader><oddFooter>` + mark + `</oddFooter></headerFooter>`
+
+	return rewriteZip(content, nil, func(name string, data []byte) ([]byte, error) {
+		if !xlsxWorksheet.MatchString(name) {
+			return data, nil
+		}
+		sheet := xlsxHeaderFooter.ReplaceAllString(string(data), "")
+		loc := xlsxAfterHeaderFooter.FindStringIndex(sheet)
+		if loc == nil {
+			return nil, fmt.Errorf("%w: malformed worksheet %s", ErrWatermarkUnsupported, name)
+		}
+		return []byte(sheet[:loc[0]] + headerFooter + sheet[loc[0]:]), nil
+	})
+}
+
+// rewriteZip copies an OOXML package, passing every entry through edit and
+// appending the added entries
+func rewriteZip(content []byte, added map[string]string, edit func(name string, data []byte) ([]byte, error)) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not an office document", ErrWatermarkUnsupported)
+	}
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for _, entry := range reader.File {
+		if _, replaced := added[entry.Name]; replaced {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if data, err = edit(entry.Name, data); err != nil {
+			return nil, err
+		}
+		w, err := writer.Create(entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	for name, data := range added {
+		w, err := writer.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// insertBefore inserts addition before the last occurrence of marker
+func insertBefore(data []byte, marker, addition string) ([]byte, error) {
+	i := bytes.LastIndex(data, []byte(marker))
+	if i < 0 {
+		return nil, fmt.Errorf("%w: missing %s", ErrWatermarkUnsupported, marker)
+	}
+	out := make([]byte, 0, len(data)+len(addition))
+	out = append(out, data[:i]...)
+	out = append(out, addition...)
+	return append(out, data[i:]...), nil
+}
+
+// xmlEscape escapes text for use in XML character data
+func xmlEscape(text string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Notification types raised while a workflow advances
+const (
+	NotificationActivityReady     = "activity_ready"
+	NotificationActivityBlocked   = "activity_blocked"
+	NotificationWorkflowReviewing = "workflow_reviewing"
+	NotificationWorkflowCompleted = "workflow_completed"
+)
+
+// activityFinished reports whether an activity no longer holds up its
+// workflow
+func activityFinished(activity *models.Activity) bool {
+	return activity.IsCompleted() || activity.Status == models.ActivityStatusSkipped
+}
+
+// activityNotStarted reports whether the engine may still move an
+// activity between pending, ready and blocked
+func activityNotStarted(activity *models.Activity) bool {
+	switch activity.Status {
+	case models.ActivityStatusPending, models.ActivityStatusReady, models.ActivityStatusBlocked:
+		return true
+	}
+	return false
+}
+
+// advanceWorkflow re-evaluates a workflow after one of its activities
+// changed state. Activities that have not started become ready once their
+// start links are satisfied and blocked while a predecessor is rejected or
+// blocked. Once every terminal activity has finished the workflow moves on
+// to reviewing, or completed when nothing awaits review. It must run in
+// the transaction of the state change.
+func advanceWorkflow(tx *gorm.DB, workflowID string) error {
+	var workflow models.Workflow
+	if err := tx.First(&workflow, "id = ?", workflowID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWorkflowNotFound
+		}
+		return err
+	}
+	if workflow.State == models.WorkflowStateCompleted || workflow.State == models.WorkflowStateCancelled {
+		return nil
+	}
+
+	var activities []models.Activity
+	if err := tx.Where("workflow_id = ?", workflowID).Order("sequence ASC, created_at ASC").Find(&activities).Error; err != nil {
+		return err
+	}
+	dependencies, err := workflowDependencies(tx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(activities))
+	byID := make(map[string]*models.Activity, len(activities))
+	for i := range activities {
+		ids[i] = activities[i].ID
+		byID[activities[i].ID] = &activities[i]
+	}
+	order, cycle := topologicalOrder(ids, dependencies)
+	if cycle != nil {
+		return &DependencyCycleError{Path: cycle}
+	}
+	incoming := make(map[string][]*models.Dependency)
+	hasSuccessors := make(map[string]bool)
+	for i := range dependencies {
+		dep := &dependencies[i]
+		incoming[dep.ActivityID] = append(incoming[dep.ActivityID], dep)
+		hasSuccessors[dep.DependsOnID] = true
+	}
+
+	// Predecessors are settled first, so blocking carries down the chain
+	now := time.Now()
+	for _, id := range order {
+		activity := byID[id]
+		if !activityNotStarted(activity) {
+			continue
+		}
+
+		status := models.ActivityStatusReady
+		for _, dep := range incoming[id] {
+			predecessor := byID[dep.DependsOnID]
+			if predecessor.Status == models.ActivityStatusRejected || predecessor.Status == models.ActivityStatusBlocked {
+				status = models.ActivityStatusBlocked
+				break
+			}
+			if !constrainsFinish(dep.DependencyType) && !linkSatisfied(dep, predecessor, now) {
+				status = models.ActivityStatusPending
+			}
+		}
+		if status == activity.Status {
+			continue
+		}
+
+		from := activity.Status
+		activity.Status = status
+		if err := tx.Model(activity).Update("status", status).Error; err != nil {
+			return err
+		}
+		if err := recordTransition(tx, activity, from, "", ""); err != nil {
+			return err
+		}
+		switch status {
+		case models.ActivityStatusReady:
+			err = notifyActivityOwner(tx, activity, NotificationActivityReady, fmt.Sprintf("活动「%s」已就绪，可以开始", activity.Name))
+		case models.ActivityStatusBlocked:
+			err = notifyActivityOwner(tx, activity, NotificationActivityBlocked, fmt.Sprintf("活动「%s」因前置活动被驳回而受阻", activity.Name))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return advanceWorkflowState(tx, &workflow, activities, hasSuccessors)
+}
+
+// advanceWorkflowState moves the workflow to executing once work has
+// started and to reviewing or completed once its terminal activities
+// have finished
+func advanceWorkflowState(tx *gorm.DB, workflow *models.Workflow, activities []models.Activity, hasSuccessors map[string]bool) error {
+	if workflow.State == models.WorkflowStatePaused || len(activities) == 0 {
+		return nil
+	}
+
+	started, finished, awaitingReview := false, true, false
+	for i := range activities {
+		activity := &activities[i]
+		if !activityNotStarted(activity) {
+			started = true
+		}
+		if hasSuccessors[activity.ID] {
+			continue
+		}
+		if !activityFinished(activity) {
+			finished = false
+		} else if activity.RequireReview && activity.Status == models.ActivityStatusCompleted {
+			awaitingReview = true
+		}
+	}
+	if !started {
+		return nil
+	}
+
+	// Only executing workflows may move to reviewing, and only reviewing
+	// ones complete, so step through the states in between
+	var path []models.WorkflowState
+	switch workflow.State {
+	case models.WorkflowStateDraft:
+		path = append(path, models.WorkflowStatePlanning, models.WorkflowStateExecuting)
+	case models.WorkflowStatePlanning:
+		path = append(path, models.WorkflowStateExecuting)
+	}
+	if finished {
+		if workflow.State != models.WorkflowStateReviewing {
+			path = append(path, models.WorkflowStateReviewing)
+		}
+		if !awaitingReview {
+			path = append(path, models.WorkflowStateCompleted)
+		}
+	} else if workflow.State == models.WorkflowStateReviewing {
+		path = append(path, models.WorkflowStateExecuting)
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	for _, state := range path {
+		if err := workflow.TransitionTo(state); err != nil {
+			return err
+		}
+	}
+	if err := tx.Save(workflow).Error; err != nil {
+		return err
+	}
+
+	switch workflow.State {
+	case models.WorkflowStateReviewing:
+		return notifyUser(tx, workflow.CreatedBy, NotificationWorkflowReviewing, fmt.Sprintf("工作流「%s」的活动已全部完成，等待评审", workflow.Name), "workflow", workflow.ID)
+	case models.WorkflowStateCompleted:
+		return notifyUser(tx, workflow.CreatedBy, NotificationWorkflowCompleted, fmt.Sprintf("工作流「%s」已完成", workflow.Name), "workflow", workflow.ID)
+	}
+	return nil
+}
+
+// notifyActivityOwner notifies the assignee of an activity, or the
+// project leader while it is unassigned
+func notifyActivityOwner(tx *gorm.DB, activity *models.Activity, kind, title string) error {
+	owner := ""
+	if activity.AssigneeID != nil {
+		owner = *activity.AssigneeID
+	} else {
+		var project models.Project
+		if err := tx.Select("leader_id").Where("id = ?", activity.ProjectID).Limit(1).Find(&project).Error; err != nil {
+			return err
+		}
+		if project.LeaderID != nil {
+			owner = project.LeaderID.String()
+		}
+	}
+	return notifyUser(tx, owner, kind, title, "activity", activity.ID)
+}
+
+// notifyUser creates a notification in the transaction; users that are
+// not set are skipped
+func notifyUser(tx *gorm.DB, userID, kind, title, relatedType, relatedID string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil
+	}
+	return tx.Create(&models.Notification{
+		ID:          uuid.New(),
+		UserID:      uid,
+		Type:        kind,
+		Title:       title,
+		RelatedID:   &relatedID,
+		RelatedType: &relatedType,
+	}).Error
+}
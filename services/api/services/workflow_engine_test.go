@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// WorkflowEngineTestSuite 活动自动推进测试套件
+type WorkflowEngineTestSuite struct {
+	suite.Suite
+	db         *gorm.DB
+	activities *ActivityService
+	workflow   *models.Workflow
+	leaderID   uuid.UUID
+	creatorID  uuid.UUID
+	assigneeID uuid.UUID
+}
+
+func (s *WorkflowEngineTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:workflow_engine?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(
+		&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.Notification{}, &models.Workflow{},
+		&models.Activity{}, &models.Dependency{}, &models.Deliverable{}, &models.Review{}, &models.ActivityTransition{}, &models.Approval{},
+	))
+	for _, table := range []string{"projects", "project_members", "notifications", "workflows", "activities", "activity_dependencies", "deliverables", "reviews", "activity_transitions", "approvals"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.leaderID, s.creatorID, s.assigneeID = uuid.New(), uuid.New(), uuid.New()
+	project := &models.Project{ID: uuid.New(), Code: "P-ENG", Name: "引擎", Category: "module", LeaderID: &s.leaderID}
+	require.NoError(s.T(), s.db.Create(project).Error)
+
+	s.activities = NewActivityService(s.db)
+	s.workflow, err = NewStateMachineService(s.db).CreateWorkflow(project.ID.String(), "", "模块开发", "", s.creatorID.String())
+	require.NoError(s.T(), err)
+}
+
+func TestWorkflowEngineSuite(t *testing.T) {
+	suite.Run(t, new(WorkflowEngineTestSuite))
+}
+
+// createActivity 创建活动，assignee为空表示未分配
+func (s *WorkflowEngineTestSuite) createActivity(name string, status models.ActivityStatus, assignee *uuid.UUID) *models.Activity {
+	activity := &models.Activity{WorkflowID: s.workflow.ID, ProjectID: s.workflow.ProjectID, Name: name, Status: status}
+	if assignee != nil {
+		id := assignee.String()
+		activity.AssigneeID = &id
+	}
+	require.NoError(s.T(), s.db.Create(activity).Error)
+	return activity
+}
+
+// status 读取活动当前状态
+func (s *WorkflowEngineTestSuite) status(activity *models.Activity) models.ActivityStatus {
+	var current models.Activity
+	require.NoError(s.T(), s.db.First(&current, "id = ?", activity.ID).Error)
+	return current.Status
+}
+
+// setStatus 直接设置活动状态并重新推进工作流
+func (s *WorkflowEngineTestSuite) setStatus(activity *models.Activity, status models.ActivityStatus) {
+	require.NoError(s.T(), s.db.Model(activity).Update("status", status).Error)
+	require.NoError(s.T(), s.activities.AdvanceWorkflow(s.workflow.ID))
+}
+
+// run 由项目负责人开始并完成活动
+func (s *WorkflowEngineTestSuite) run(activity *models.Activity) {
+	require.NoError(s.T(), s.activities.StartActivity(activity.ID, s.leaderID.String()))
+	require.NoError(s.T(), s.activities.CompleteActivity(activity.ID, s.leaderID.String()))
+}
+
+// notifications 返回指定用户收到的通知类型
+func (s *WorkflowEngineTestSuite) notifications(userID uuid.UUID) []string {
+	var kinds []string
+	require.NoError(s.T(), s.db.Model(&models.Notification{}).Where("user_id = ?", userID).Order("created_at ASC").Pluck("type", &kinds).Error)
+	return kinds
+}
+
+// workflowState 读取工作流当前状态
+func (s *WorkflowEngineTestSuite) workflowState() models.WorkflowState {
+	var workflow models.Workflow
+	require.NoError(s.T(), s.db.First(&workflow, "id = ?", s.workflow.ID).Error)
+	return workflow.State
+}
+
+// TestComplete_ReadiesSuccessorsAndCompletesWorkflow 测试完成活动后就绪后继活动、通知负责人并完成工作流
+func (s *WorkflowEngineTestSuite) TestComplete_ReadiesSuccessorsAndCompletesWorkflow() {
+	design := s.createActivity("设计", models.ActivityStatusReady, nil)
+	hardware := s.createActivity("硬件", models.ActivityStatusPending, &s.assigneeID)
+	software := s.createActivity("软件", models.ActivityStatusPending, nil)
+	integration := s.createActivity("集成", models.ActivityStatusPending, &s.assigneeID)
+	for _, link := range [][2]*models.Activity{{hardware, design}, {software, design}, {integration, hardware}, {integration, software}} {
+		_, err := s.activities.AddDependency(link[0].ID, link[1].ID, "", 0)
+		require.NoError(s.T(), err)
+	}
+	// 连线过程中尚无前置的活动会短暂就绪
+	s.db.Exec("DELETE FROM notifications")
+
+	require.NoError(s.T(), s.activities.StartActivity(design.ID, s.leaderID.String()))
+	assert.Equal(s.T(), models.WorkflowStateExecuting, s.workflowState())
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(hardware))
+
+	require.NoError(s.T(), s.activities.CompleteActivity(design.ID, s.leaderID.String()))
+	assert.Equal(s.T(), models.ActivityStatusReady, s.status(hardware))
+	assert.Equal(s.T(), models.ActivityStatusReady, s.status(software))
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(integration))
+	// 已分配的活动通知负责人，未分配的通知项目负责人
+	assert.Equal(s.T(), []string{NotificationActivityReady}, s.notifications(s.assigneeID))
+	assert.Equal(s.T(), []string{NotificationActivityReady}, s.notifications(s.leaderID))
+
+	s.run(hardware)
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(integration))
+	s.run(software)
+	assert.Equal(s.T(), models.ActivityStatusReady, s.status(integration))
+
+	s.run(integration)
+	assert.Equal(s.T(), models.WorkflowStateCompleted, s.workflowState())
+	assert.Equal(s.T(), []string{NotificationWorkflowCompleted}, s.notifications(s.creatorID))
+}
+
+// TestReject_BlocksDownstreamUntilReworked 测试前置活动被驳回时阻塞下游活动，返工后解除
+func (s *WorkflowEngineTestSuite) TestReject_BlocksDownstreamUntilReworked() {
+	review := s.createActivity("评审", models.ActivityStatusReady, nil)
+	build := s.createActivity("实现", models.ActivityStatusPending, &s.assigneeID)
+	release := s.createActivity("发布", models.ActivityStatusPending, nil)
+	_, err := s.activities.AddDependency(build.ID, review.ID, "", 0)
+	require.NoError(s.T(), err)
+	_, err = s.activities.AddDependency(release.ID, build.ID, "", 0)
+	require.NoError(s.T(), err)
+
+	s.setStatus(review, models.ActivityStatusRejected)
+	assert.Equal(s.T(), models.ActivityStatusBlocked, s.status(build))
+	assert.Equal(s.T(), models.ActivityStatusBlocked, s.status(release))
+	assert.Equal(s.T(), []string{NotificationActivityBlocked}, s.notifications(s.assigneeID))
+
+	s.setStatus(review, models.ActivityStatusRunning)
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(build))
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(release))
+}
+
+// TestComplete_MovesWorkflowToReviewing 测试终止活动需要评审时工作流进入评审
+func (s *WorkflowEngineTestSuite) TestComplete_MovesWorkflowToReviewing() {
+	final := s.createActivity("定型", models.ActivityStatusReady, nil)
+	require.NoError(s.T(), s.db.Model(final).Update("require_review", true).Error)
+
+	s.run(final)
+	assert.Equal(s.T(), models.WorkflowStateReviewing, s.workflowState())
+	assert.Equal(s.T(), []string{NotificationWorkflowReviewing}, s.notifications(s.creatorID))
+
+	s.setStatus(final, models.ActivityStatusApproved)
+	assert.Equal(s.T(), models.WorkflowStateCompleted, s.workflowState())
+}
+
+// TestComplete_RollsBackWhenAdvanceFails 测试推进失败时活动状态变更一并回滚
+func (s *WorkflowEngineTestSuite) TestComplete_RollsBackWhenAdvanceFails() {
+	first := s.createActivity("甲", models.ActivityStatusReady, nil)
+	second := s.createActivity("乙", models.ActivityStatusPending, nil)
+	require.NoError(s.T(), s.activities.StartActivity(first.ID, s.leaderID.String()))
+	// 绕过校验写入环路，使推进失败
+	require.NoError(s.T(), s.db.Create(&[]models.Dependency{
+		{ActivityID: second.ID, DependsOnID: first.ID, DependencyType: models.DependencyFinishToStart},
+		{ActivityID: first.ID, DependsOnID: second.ID, DependencyType: models.DependencyFinishToStart},
+	}).Error)
+
+	err := s.activities.CompleteActivity(first.ID, s.leaderID.String())
+	assert.ErrorIs(s.T(), err, ErrDependencyCycle)
+	assert.Equal(s.T(), models.ActivityStatusRunning, s.status(first))
+}
+
+// TestAdvanceLaggedWorkflows 测试滞后时间结束后定期检查使后继活动就绪
+func (s *WorkflowEngineTestSuite) TestAdvanceLaggedWorkflows() {
+	finished := time.Now().Add(-23 * time.Hour)
+	first := &models.Activity{WorkflowID: s.workflow.ID, ProjectID: s.workflow.ProjectID, Name: "甲", Status: models.ActivityStatusCompleted, ActualEnd: &finished}
+	require.NoError(s.T(), s.db.Create(first).Error)
+	second := s.createActivity("乙", models.ActivityStatusPending, &s.assigneeID)
+	_, err := s.activities.AddDependency(second.ID, first.ID, models.DependencyFinishToStart, 1)
+	require.NoError(s.T(), err)
+
+	// 滞后1天未到
+	require.NoError(s.T(), s.activities.AdvanceLaggedWorkflows(context.Background()))
+	assert.Equal(s.T(), models.ActivityStatusPending, s.status(second))
+
+	finished = time.Now().Add(-25 * time.Hour)
+	require.NoError(s.T(), s.db.Model(first).Update("actual_end", finished).Error)
+	require.NoError(s.T(), s.activities.AdvanceLaggedWorkflows(context.Background()))
+	assert.Equal(s.T(), models.ActivityStatusReady, s.status(second))
+	assert.Contains(s.T(), s.notifications(s.assigneeID), NotificationActivityReady)
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"rdp-platform/rdp-api/models"
+
+	"gorm.io/gorm"
+)
+
+// Workflow and dependency errors
+var (
+	ErrWorkflowNotFound        = errors.New("workflow not found")
+	ErrActivityNotFound        = errors.New("activity not found")
+	ErrSelfDependency          = errors.New("an activity cannot depend on itself")
+	ErrInvalidDependencyType   = errors.New("invalid dependency type")
+	ErrDependencyExists        = errors.New("dependency already exists")
+	ErrCrossWorkflowDependency = errors.New("activities belong to different workflows")
+	ErrDependencyCycle         = errors.New("dependency cycle")
+)
+
+// DependencyCycleError reports the activities on a dependency cycle
+type DependencyCycleError struct {
+	// Path lists activity IDs along the cycle; the first is repeated last
+	Path []string
+}
+
+func (e *DependencyCycleError) Error() string {
+	return ErrDependencyCycle.Error() + ": " + strings.Join(e.Path, " -> ")
+}
+
+func (e *DependencyCycleError) Unwrap() error {
+	return ErrDependencyCycle
+}
+
+// linkStart returns the earliest start, in days, that a dependency link
+// allows a successor of the given duration
+func linkStart(linkType string, lag, predStart, predEnd, duration int) int {
+	switch linkType {
+	case models.DependencyStartToStart:
+		return predStart + lag
+	case models.DependencyFinishToFinish:
+		return predEnd + lag - duration
+	case models.DependencyStartToFinish:
+		return predStart + lag - duration
+	default:
+		return predEnd + lag
+	}
+}
+
+// constrainsFinish reports whether a link type gates the successor's
+// finish rather than its start
+func constrainsFinish(linkType string) bool {
+	return linkType == models.DependencyFinishToFinish || linkType == models.DependencyStartToFinish
+}
+
+// linkSatisfied reports whether the predecessor of a link allows the
+// successor to start (finish_to_start, start_to_start) or finish
+// (finish_to_finish, start_to_finish) at now
+func linkSatisfied(dependency *models.Dependency, predecessor *models.Activity, now time.Time) bool {
+	if predecessor.Status == models.ActivityStatusSkipped {
+		return true
+	}
+
+	var actual, planned *time.Time
+	switch dependency.DependencyType {
+	case models.DependencyStartToStart, models.DependencyStartToFinish:
+		actual, planned = predecessor.ActualStart, predecessor.PlannedStart
+	default:
+		if predecessor.IsCompleted() {
+			if predecessor.ActualEnd == nil {
+				return true
+			}
+			actual = predecessor.ActualEnd
+		}
+		planned = predecessor.PlannedEnd
+	}
+
+	lag := time.Duration(dependency.Lag) * 24 * time.Hour
+	if actual != nil {
+		return !actual.Add(lag).After(now)
+	}
+	// A lead lets the successor go ahead of the predecessor's planned date
+	return dependency.Lag < 0 && planned != nil && !planned.Add(lag).After(now)
+}
+
+// findDependencyPath returns the activities on a path from one activity
+// to another following successor links, or nil when there is none
+func findDependencyPath(successors map[string][]string, from, to string) []string {
+	previous := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == to {
+			var path []string
+			for id := to; id != ""; id = previous[id] {
+				path = append(path, id)
+			}
+			slices.Reverse(path)
+			return path
+		}
+		for _, next := range successors[current] {
+			if _, seen := previous[next]; !seen {
+				previous[next] = current
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// topologicalOrder orders activity IDs so every activity comes after its
+// predecessors, keeping the given order otherwise. When the dependencies
+// contain a cycle it returns one instead.
+func topologicalOrder(ids []string, dependencies []models.Dependency) ([]string, []string) {
+	successors := make(map[string][]string)
+	predecessors := make(map[string][]string)
+	inDegree := make(map[string]int, len(ids))
+	for _, id := range ids {
+		inDegree[id] = 0
+	}
+	for _, dep := range dependencies {
+		// Links to activities outside the set do not order it
+		_, from := inDegree[dep.DependsOnID]
+		_, to := inDegree[dep.ActivityID]
+		if !from || !to {
+			continue
+		}
+		successors[dep.DependsOnID] = append(successors[dep.DependsOnID], dep.ActivityID)
+		predecessors[dep.ActivityID] = append(predecessors[dep.ActivityID], dep.DependsOnID)
+		inDegree[dep.ActivityID]++
+	}
+
+	order := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if inDegree[id] == 0 {
+			order = append(order, id)
+		}
+	}
+	for k := 0; k < len(order); k++ {
+		for _, next := range successors[order[k]] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				order = append(order, next)
+			}
+		}
+	}
+	if len(order) == len(ids) {
+		return order, nil
+	}
+
+	// Every activity left over has a predecessor that is left over too, so
+	// walking predecessors from one of them must come back round
+	var start string
+	for _, id := range ids {
+		if inDegree[id] > 0 {
+			start = id
+			break
+		}
+	}
+	visited := make(map[string]int)
+	var walk []string
+	for id := start; ; {
+		if at, ok := visited[id]; ok {
+			cycle := append(walk[at:], id)
+			slices.Reverse(cycle)
+			return nil, cycle
+		}
+		visited[id] = len(walk)
+		walk = append(walk, id)
+		for _, pred := range predecessors[id] {
+			if inDegree[pred] > 0 {
+				id = pred
+				break
+			}
+		}
+	}
+}
+
+// workflowDependencies returns the dependencies between a workflow's
+// activities
+func workflowDependencies(db *gorm.DB, workflowID string) ([]models.Dependency, error) {
+	var dependencies []models.Dependency
+	err := db.Where("activity_id IN (?)", db.Model(&models.Activity{}).Select("id").Where("workflow_id = ?", workflowID)).
+		Order("id ASC").
+		Find(&dependencies).Error
+	return dependencies, err
+}
+
+// GetWorkflowGraph returns the validated dependency graph of a workflow
+// with its activities in topological order
+func (s *StateMachineService) GetWorkflowGraph(workflowID string) (*models.WorkflowGraph, error) {
+	var workflow models.Workflow
+	if err := s.db.First(&workflow, "id = ?", workflowID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkflowNotFound
+		}
+		return nil, err
+	}
+
+	var activities []models.Activity
+	if err := s.db.Where("workflow_id = ?", workflowID).Order("sequence ASC, created_at ASC").Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	dependencies, err := workflowDependencies(s.db, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(activities))
+	byID := make(map[string]*models.Activity, len(activities))
+	for i := range activities {
+		ids[i] = activities[i].ID
+		byID[activities[i].ID] = &activities[i]
+	}
+	order, cycle := topologicalOrder(ids, dependencies)
+	if cycle != nil {
+		return nil, &DependencyCycleError{Path: cycle}
+	}
+
+	position := make(map[string]int, len(order))
+	for i, id := range order {
+		position[id] = i
+	}
+	slices.SortStableFunc(dependencies, func(a, b models.Dependency) int {
+		if position[a.ActivityID] != position[b.ActivityID] {
+			return position[a.ActivityID] - position[b.ActivityID]
+		}
+		return position[a.DependsOnID] - position[b.DependsOnID]
+	})
+
+	// Levels follow from the predecessors, which come first in the order
+	level := make(map[string]int, len(order))
+	graph := &models.WorkflowGraph{
+		WorkflowID: workflowID,
+		Nodes:      make([]models.WorkflowGraphNode, 0, len(order)),
+		Edges:      make([]models.WorkflowGraphEdge, 0, len(dependencies)),
+	}
+	for _, dep := range dependencies {
+		graph.Edges = append(graph.Edges, models.WorkflowGraphEdge{
+			ID:   dep.ID,
+			From: dep.DependsOnID,
+			To:   dep.ActivityID,
+			Type: dep.DependencyType,
+			Lag:  dep.Lag,
+		})
+	}
+	for _, id := range order {
+		for _, edge := range graph.Edges {
+			if edge.To == id {
+				level[id] = max(level[id], level[edge.From]+1)
+			}
+		}
+		activity := byID[id]
+		graph.Nodes = append(graph.Nodes, models.WorkflowGraphNode{
+			ID:           activity.ID,
+			Name:         activity.Name,
+			Type:         activity.Type,
+			Status:       activity.Status,
+			PlannedStart: activity.PlannedStart,
+			PlannedEnd:   activity.PlannedEnd,
+			Level:        level[id],
+		})
+	}
+
+	return graph, nil
+}
+
+// WorkflowProjectID returns the ID of the project a workflow belongs to
+func (s *StateMachineService) WorkflowProjectID(workflowID string) (string, error) {
+	var workflow models.Workflow
+	if err := s.db.Select("project_id").First(&workflow, "id = ?", workflowID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrWorkflowNotFound
+		}
+		return "", err
+	}
+	return workflow.ProjectID, nil
+}
+
+// ActivityProjectID returns the ID of the project an activity belongs to
+func (s *ActivityService) ActivityProjectID(activityID string) (string, error) {
+	var activity models.Activity
+	if err := s.db.Select("project_id").First(&activity, "id = ?", activityID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrActivityNotFound
+		}
+		return "", err
+	}
+	return activity.ProjectID, nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rdp-platform/rdp-api/models"
+)
+
+// WorkflowGraphTestSuite 活动依赖图测试套件
+type WorkflowGraphTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	stateMachine *StateMachineService
+	activities   *ActivityService
+	workflow     *models.Workflow
+}
+
+func (s *WorkflowGraphTestSuite) SetupTest() {
+	var err error
+	s.db, err = gorm.Open(sqlite.Open("file:workflow_graph?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.AutoMigrate(&models.Workflow{}, &models.Activity{}, &models.Dependency{}, &models.ActivityTransition{}))
+	for _, table := range []string{"workflows", "activities", "activity_dependencies", "activity_transitions"} {
+		s.db.Exec("DELETE FROM " + table)
+	}
+
+	s.stateMachine = NewStateMachineService(s.db)
+	s.activities = NewActivityService(s.db)
+	s.workflow, err = s.stateMachine.CreateWorkflow("project-1", "", "研发流程", "", "user-1")
+	require.NoError(s.T(), err)
+}
+
+func TestWorkflowGraphSuite(t *testing.T) {
+	suite.Run(t, new(WorkflowGraphTestSuite))
+}
+
+// createActivity 在测试工作流中创建活动
+func (s *WorkflowGraphTestSuite) createActivity(name string, sequence int) *models.Activity {
+	activity := &models.Activity{WorkflowID: s.workflow.ID, ProjectID: "project-1", Name: name, Sequence: sequence, Status: models.ActivityStatusPending}
+	require.NoError(s.T(), s.db.Create(activity).Error)
+	return activity
+}
+
+// TestAddDependency_RejectsCycleWithPath 测试添加依赖时拒绝环路并报告环路路径
+func (s *WorkflowGraphTestSuite) TestAddDependency_RejectsCycleWithPath() {
+	a, b, c := s.createActivity("需求", 1), s.createActivity("设计", 2), s.createActivity("实现", 3)
+	_, err := s.activities.AddDependency(b.ID, a.ID, "", 0)
+	require.NoError(s.T(), err)
+	_, err = s.activities.AddDependency(c.ID, b.ID, models.DependencyStartToStart, 2)
+	require.NoError(s.T(), err)
+
+	_, err = s.activities.AddDependency(a.ID, c.ID, "", 0)
+	var cycle *DependencyCycleError
+	require.ErrorAs(s.T(), err, &cycle)
+	assert.ErrorIs(s.T(), err, ErrDependencyCycle)
+	assert.Equal(s.T(), []string{c.ID, a.ID, b.ID, c.ID}, cycle.Path)
+
+	_, err = s.activities.AddDependency(a.ID, a.ID, "", 0)
+	assert.ErrorIs(s.T(), err, ErrSelfDependency)
+	_, err = s.activities.AddDependency(b.ID, a.ID, "", 0)
+	assert.ErrorIs(s.T(), err, ErrDependencyExists)
+	_, err = s.activities.AddDependency(c.ID, a.ID, "after", 0)
+	assert.ErrorIs(s.T(), err, ErrInvalidDependencyType)
+
+	other, err := s.stateMachine.CreateWorkflow("project-1", "", "另一流程", "", "user-1")
+	require.NoError(s.T(), err)
+	stranger := &models.Activity{WorkflowID: other.ID, ProjectID: "project-1", Name: "外部"}
+	require.NoError(s.T(), s.db.Create(stranger).Error)
+	_, err = s.activities.AddDependency(stranger.ID, a.ID, "", 0)
+	assert.ErrorIs(s.T(), err, ErrCrossWorkflowDependency)
+
+	var count int64
+	s.db.Model(&models.Dependency{}).Count(&count)
+	assert.Equal(s.T(), int64(2), count)
+}
+
+// TestCheckDependencies_LinkTypesAndLag 测试四种依赖类型及正负时滞的判定
+func (s *WorkflowGraphTestSuite) TestCheckDependencies_LinkTypesAndLag() {
+	now := time.Now()
+	daysAgo := func(days int) *time.Time {
+		t := now.AddDate(0, 0, -days)
+		return &t
+	}
+	// 前置活动：两天前开始、仍在进行，计划一天后完成
+	predecessor := s.createActivity("前置", 1)
+	predecessor.Status = models.ActivityStatusRunning
+	predecessor.ActualStart = daysAgo(2)
+	predecessor.PlannedEnd = daysAgo(-1)
+	require.NoError(s.T(), s.db.Save(predecessor).Error)
+
+	link := func(depType string, lag int) *models.Activity {
+		successor := s.createActivity(depType, 2)
+		_, err := s.activities.AddDependency(successor.ID, predecessor.ID, depType, lag)
+		require.NoError(s.T(), err)
+		return successor
+	}
+	canStart := func(activity *models.Activity) bool {
+		ok, err := s.activities.CheckDependencies(activity.ID)
+		require.NoError(s.T(), err)
+		return ok
+	}
+	canFinish := func(activity *models.Activity) bool {
+		ok, err := s.activities.CheckFinishDependencies(activity.ID)
+		require.NoError(s.T(), err)
+		return ok
+	}
+
+	fs := link(models.DependencyFinishToStart, 0)
+	fsLead := link(models.DependencyFinishToStart, -2)
+	ss := link(models.DependencyStartToStart, 1)
+	ssLag := link(models.DependencyStartToStart, 3)
+	ff := link(models.DependencyFinishToFinish, 0)
+	sf := link(models.DependencyStartToFinish, 0)
+
+	assert.False(s.T(), canStart(fs))
+	assert.True(s.T(), canStart(fsLead), "a two day lead on a finish due tomorrow")
+	assert.True(s.T(), canStart(ss))
+	assert.False(s.T(), canStart(ssLag), "started two days ago with a three day lag")
+	assert.True(s.T(), canStart(ff), "finish_to_finish does not gate the start")
+	assert.False(s.T(), canFinish(ff))
+	assert.True(s.T(), canFinish(sf))
+	assert.True(s.T(), canFinish(fs), "finish_to_start does not gate the finish")
+
+	predecessor.Status = models.ActivityStatusCompleted
+	predecessor.ActualEnd = &now
+	require.NoError(s.T(), s.db.Save(predecessor).Error)
+	assert.True(s.T(), canStart(fs))
+	assert.True(s.T(), canFinish(ff))
+}
+
+// TestGetWorkflowGraph_TopologicalOrder 测试依赖图按拓扑顺序返回并计算层级
+func (s *WorkflowGraphTestSuite) TestGetWorkflowGraph_TopologicalOrder() {
+	// 按序号排列与依赖顺序相反
+	review := s.createActivity("评审", 1)
+	hardware := s.createActivity("硬件", 2)
+	software := s.createActivity("软件", 3)
+	design := s.createActivity("设计", 4)
+	for _, link := range [][2]*models.Activity{{hardware, design}, {software, design}, {review, hardware}, {review, software}} {
+		_, err := s.activities.AddDependency(link[0].ID, link[1].ID, "", 0)
+		require.NoError(s.T(), err)
+	}
+
+	graph, err := s.stateMachine.GetWorkflowGraph(s.workflow.ID)
+	require.NoError(s.T(), err)
+	var order []string
+	levels := make(map[string]int)
+	for _, node := range graph.Nodes {
+		order = append(order, node.Name)
+		levels[node.Name] = node.Level
+	}
+	assert.Equal(s.T(), []string{"设计", "硬件", "软件", "评审"}, order)
+	assert.Equal(s.T(), map[string]int{"设计": 0, "硬件": 1, "软件": 1, "评审": 2}, levels)
+	require.Len(s.T(), graph.Edges, 4)
+	assert.Equal(s.T(), design.ID, graph.Edges[0].From)
+	assert.Equal(s.T(), models.DependencyFinishToStart, graph.Edges[0].Type)
+
+	// 绕过校验写入的环路在读取图时报告
+	require.NoError(s.T(), s.db.Create(&models.Dependency{ActivityID: design.ID, DependsOnID: review.ID, DependencyType: models.DependencyFinishToStart}).Error)
+	_, err = s.stateMachine.GetWorkflowGraph(s.workflow.ID)
+	var cycle *DependencyCycleError
+	require.ErrorAs(s.T(), err, &cycle)
+	assert.Equal(s.T(), cycle.Path[0], cycle.Path[len(cycle.Path)-1])
+	assert.Len(s.T(), cycle.Path, 4)
+
+	_, err = s.stateMachine.GetWorkflowGraph("missing")
+	assert.ErrorIs(s.T(), err, ErrWorkflowNotFound)
+}
+
+// TestTopologicalOrder_IgnoresOutsideLinks 测试集合外的前置活动不被误报为环路
+func (s *WorkflowGraphTestSuite) TestTopologicalOrder_IgnoresOutsideLinks() {
+	order, cycle := topologicalOrder([]string{"b", "c"}, []models.Dependency{
+		{ActivityID: "b", DependsOnID: "a"},
+		{ActivityID: "c", DependsOnID: "b"},
+	})
+	assert.Nil(s.T(), cycle)
+	assert.Equal(s.T(), []string{"b", "c"}, order)
+}